@@ -0,0 +1,304 @@
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/schaeferpp/sconsify/infrastructure"
+	"github.com/schaeferpp/sconsify/sconsify"
+)
+
+// minimumListened is how long a track skipped must have been heard to count as
+// played.
+const minimumListened = 30 * time.Second
+
+// maxPlays is how many plays the history keeps, the oldest being forgotten. The
+// file is rewritten with the plays kept once it has twice as many lines.
+const maxPlays = 20000
+
+// History keeps the latest tracks played, one JSON object per line appended to
+// its file. Without a file the plays are only kept until sconsify exits.
+type History struct {
+	fileLocation string
+	maxPlays     int
+	mutex        sync.Mutex
+	plays        []*sconsify.Play
+	// lines is how many lines the file has, the plays forgotten included
+	lines      int
+	lastPlayed map[string]time.Time
+	playCounts map[string]int
+}
+
+type historyEntry struct {
+	URI       string    `json:"uri"`
+	Name      string    `json:"name,omitempty"`
+	Artist    string    `json:"artist,omitempty"`
+	ArtistURI string    `json:"artistUri,omitempty"`
+	Duration  string    `json:"duration,omitempty"`
+	Playlist  string    `json:"playlist,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+	Listened  string    `json:"listened"`
+	Finished  bool      `json:"finished"`
+}
+
+// Count is how many times an artist or a track was played.
+type Count struct {
+	Name  string
+	URI   string
+	Plays int
+}
+
+// Stats sums up the plays since a time.
+type Stats struct {
+	Since    time.Time
+	Plays    int
+	Skipped  int
+	Listened time.Duration
+	// TopArtists and TopTracks are the artists and tracks played the most,
+	// first the most played.
+	TopArtists []*Count
+	TopTracks  []*Count
+}
+
+// Open reads the plays recorded by the previous runs, skipping the lines it
+// cannot read.
+func Open(fileLocation string) *History {
+	history := &History{
+		fileLocation: fileLocation,
+		maxPlays:     maxPlays,
+		lastPlayed:   make(map[string]time.Time),
+		playCounts:   make(map[string]int),
+	}
+	if fileLocation == "" {
+		return history
+	}
+	infrastructure.ReadJsonLines(fileLocation, "play history", func(line []byte) error {
+		history.lines++
+		var entry historyEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return err
+		}
+		play, err := entry.toPlay()
+		if err != nil {
+			return err
+		}
+		history.add(play)
+		return nil
+	})
+	return history
+}
+
+func (entry *historyEntry) toPlay() (*sconsify.Play, error) {
+	if entry.URI == "" {
+		return nil, errors.New("play without a track")
+	}
+	listened, err := time.ParseDuration(entry.Listened)
+	if err != nil {
+		return nil, err
+	}
+	return &sconsify.Play{
+		URI:       entry.URI,
+		Name:      entry.Name,
+		Artist:    entry.Artist,
+		ArtistURI: entry.ArtistURI,
+		Duration:  entry.Duration,
+		Playlist:  entry.Playlist,
+		StartedAt: entry.StartedAt,
+		Listened:  listened,
+		Finished:  entry.Finished,
+	}, nil
+}
+
+func toHistoryEntry(play *sconsify.Play) *historyEntry {
+	return &historyEntry{
+		URI:       play.URI,
+		Name:      play.Name,
+		Artist:    play.Artist,
+		ArtistURI: play.ArtistURI,
+		Duration:  play.Duration,
+		Playlist:  play.Playlist,
+		StartedAt: play.StartedAt,
+		Listened:  play.Listened.String(),
+		Finished:  play.Finished,
+	}
+}
+
+// Add records the play, appending it to the file.
+func (history *History) Add(play *sconsify.Play) error {
+	history.mutex.Lock()
+	defer history.mutex.Unlock()
+
+	if history.fileLocation != "" {
+		if err := infrastructure.AppendJsonLine(history.fileLocation, toHistoryEntry(play)); err != nil {
+			return err
+		}
+		history.lines++
+	}
+	history.add(play)
+	if history.fileLocation != "" && history.lines >= 2*history.maxPlays {
+		if err := history.compact(); err != nil {
+			infrastructure.Warn("Cannot compact the play history", "error", err)
+		}
+	}
+	return nil
+}
+
+func (history *History) add(play *sconsify.Play) {
+	history.plays = append(history.plays, play)
+	if counts(play) {
+		history.playCounts[play.URI]++
+		if play.StartedAt.After(history.lastPlayed[play.URI]) {
+			history.lastPlayed[play.URI] = play.StartedAt
+		}
+	}
+	if len(history.plays) > history.maxPlays {
+		history.forget(history.plays[0])
+		history.plays = history.plays[1:]
+	}
+}
+
+// forget takes the oldest play out of the counts, as if it was never read.
+func (history *History) forget(play *sconsify.Play) {
+	if !counts(play) {
+		return
+	}
+	if history.playCounts[play.URI]--; history.playCounts[play.URI] == 0 {
+		delete(history.playCounts, play.URI)
+		delete(history.lastPlayed, play.URI)
+	}
+}
+
+// compact rewrites the file with the plays kept only.
+func (history *History) compact() error {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	for _, play := range history.plays {
+		encoder.Encode(toHistoryEntry(play))
+	}
+	if err := infrastructure.SaveFileAtomically(history.fileLocation, b.Bytes()); err != nil {
+		return err
+	}
+	history.lines = len(history.plays)
+	return nil
+}
+
+// counts tells if the play counts as the track played: to its end or long enough.
+func counts(play *sconsify.Play) bool {
+	return play.Finished || play.Listened >= minimumListened
+}
+
+// Recent returns up to count plays, the most recent first.
+func (history *History) Recent(count int) []*sconsify.Play {
+	history.mutex.Lock()
+	defer history.mutex.Unlock()
+
+	recent := make([]*sconsify.Play, 0, count)
+	for i := len(history.plays) - 1; i >= 0 && len(recent) < count; i-- {
+		recent = append(recent, history.plays[i])
+	}
+	return recent
+}
+
+// LastPlayed returns when the track was played the last time, zero when it never
+// was. The tracks skipped too soon are not counted.
+func (history *History) LastPlayed(URI string) time.Time {
+	history.mutex.Lock()
+	defer history.mutex.Unlock()
+	return history.lastPlayed[URI]
+}
+
+// PlayCount returns how many times the track was played. The tracks skipped too
+// soon are not counted.
+func (history *History) PlayCount(URI string) int {
+	history.mutex.Lock()
+	defer history.mutex.Unlock()
+	return history.playCounts[URI]
+}
+
+// Stats sums up the plays started since the time, with up to count top artists
+// and tracks.
+func (history *History) Stats(since time.Time, count int) *Stats {
+	history.mutex.Lock()
+	defer history.mutex.Unlock()
+
+	stats := &Stats{Since: since}
+	artists := make(map[string]*Count)
+	tracks := make(map[string]*Count)
+	for _, play := range history.plays {
+		if play.StartedAt.Before(since) {
+			continue
+		}
+		stats.Listened += play.Listened
+		if !counts(play) {
+			stats.Skipped++
+			continue
+		}
+		stats.Plays++
+		if play.Artist != "" {
+			increment(artists, play.Artist, play.ArtistURI, play.Artist)
+		}
+		name := play.Name
+		if play.Artist != "" {
+			name = play.Name + " - " + play.Artist
+		}
+		increment(tracks, play.URI, play.URI, name)
+	}
+	stats.TopArtists = top(artists, count)
+	stats.TopTracks = top(tracks, count)
+	return stats
+}
+
+func increment(counts map[string]*Count, key string, URI string, name string) {
+	if count, found := counts[key]; found {
+		count.Plays++
+		return
+	}
+	counts[key] = &Count{Name: name, URI: URI, Plays: 1}
+}
+
+func top(counts map[string]*Count, count int) []*Count {
+	sorted := make(byPlays, 0, len(counts))
+	for _, c := range counts {
+		sorted = append(sorted, c)
+	}
+	sort.Sort(sorted)
+	if len(sorted) > count {
+		sorted = sorted[:count]
+	}
+	return sorted
+}
+
+// byPlays sorts the most played first, then by name.
+type byPlays []*Count
+
+func (c byPlays) Len() int      { return len(c) }
+func (c byPlays) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c byPlays) Less(i, j int) bool {
+	if c[i].Plays != c[j].Plays {
+		return c[i].Plays > c[j].Plays
+	}
+	return c[i].Name < c[j].Name
+}
+
+// ParsePeriod returns when the period ending now started: day, week, month,
+// year or all.
+func ParsePeriod(period string, now time.Time) (time.Time, error) {
+	switch strings.ToLower(period) {
+	case "day":
+		return now.AddDate(0, 0, -1), nil
+	case "week":
+		return now.AddDate(0, 0, -7), nil
+	case "month":
+		return now.AddDate(0, -1, 0), nil
+	case "year":
+		return now.AddDate(-1, 0, 0), nil
+	case "all":
+		return time.Time{}, nil
+	}
+	return time.Time{}, errors.New("Unknown period: " + period + ", it should be day, week, month, year or all")
+}
@@ -0,0 +1,157 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schaeferpp/sconsify/sconsify"
+)
+
+func createHistory(t *testing.T, plays ...*sconsify.Play) (*History, string) {
+	dir, err := ioutil.TempDir("", "sconsify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileLocation := filepath.Join(dir, "history.json")
+	history := Open(fileLocation)
+	for _, play := range plays {
+		if err := history.Add(play); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return history, fileLocation
+}
+
+func TestHistoryIsReadAgain(t *testing.T) {
+	startedAt := time.Date(2017, 3, 1, 20, 0, 0, 0, time.UTC)
+	_, fileLocation := createHistory(t,
+		&sconsify.Play{URI: "track0", Name: "Waiting in vain", Artist: "Bob Marley", ArtistURI: "artist0", Duration: "4m16s", Playlist: "Reggae", StartedAt: startedAt, Listened: 4 * time.Minute, Finished: true},
+		&sconsify.Play{URI: "track1", Name: "Legalize it", Artist: "Peter Tosh", StartedAt: startedAt.Add(5 * time.Minute), Listened: 10 * time.Second},
+	)
+	defer os.RemoveAll(filepath.Dir(fileLocation))
+
+	file, err := os.OpenFile(fileLocation, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("{\"name\": \"without uri\", \"listened\": \"1s\"}\n{\"uri\": \"track2\", \"listened\": \"long\"}\n")
+	file.Close()
+
+	history := Open(fileLocation)
+	recent := history.Recent(10)
+	if len(recent) != 2 {
+		t.Fatalf("History should have the 2 plays recorded, it has %v", len(recent))
+	}
+	if play := recent[1]; play.URI != "track0" || play.Artist != "Bob Marley" || play.ArtistURI != "artist0" || play.Playlist != "Reggae" ||
+		!play.StartedAt.Equal(startedAt) || play.Listened != 4*time.Minute || !play.Finished {
+		t.Errorf("Oldest play should be track0 as recorded: %+v", play)
+	}
+	if track := recent[1].Track(); track.URI != "track0" || track.GetTitle() != "Waiting in vain - Bob Marley" {
+		t.Errorf("Track played should be track0: %v", track.GetFullTitle())
+	}
+	if recent := history.Recent(1); len(recent) != 1 || recent[0].URI != "track1" {
+		t.Errorf("Most recent play should be track1: %v", recent)
+	}
+}
+
+func TestHistoryForgetsTheOldestPlays(t *testing.T) {
+	history, fileLocation := createHistory(t)
+	defer os.RemoveAll(filepath.Dir(fileLocation))
+	history.maxPlays = 2
+
+	startedAt := time.Date(2017, 3, 1, 20, 0, 0, 0, time.UTC)
+	for i, URI := range []string{"track0", "track1", "track0", "track2"} {
+		if err := history.Add(&sconsify.Play{URI: URI, StartedAt: startedAt.Add(time.Duration(i) * time.Hour), Finished: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if recent := history.Recent(10); len(recent) != 2 || recent[0].URI != "track2" || recent[1].URI != "track0" {
+		t.Errorf("History should keep the 2 latest plays: %v", recent)
+	}
+	if history.PlayCount("track0") != 1 || history.PlayCount("track1") != 0 || !history.LastPlayed("track1").IsZero() {
+		t.Errorf("Plays forgotten should not count: %v %v", history.PlayCount("track0"), history.PlayCount("track1"))
+	}
+
+	content, err := ioutil.ReadFile(fileLocation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(content), "\n"); lines != 2 {
+		t.Errorf("File should be compacted to the 2 plays kept, it has %v lines", lines)
+	}
+	if recent := Open(fileLocation).Recent(10); len(recent) != 2 || recent[0].URI != "track2" {
+		t.Errorf("History read again should have the 2 plays kept: %v", recent)
+	}
+}
+
+func TestPlayStats(t *testing.T) {
+	now := time.Now()
+	history := Open("")
+	for _, play := range []*sconsify.Play{
+		{URI: "track0", StartedAt: now.Add(-48 * time.Hour), Finished: true},
+		{URI: "track0", StartedAt: now.Add(-time.Hour), Listened: time.Minute},
+		{URI: "track1", StartedAt: now.Add(-time.Hour), Listened: 10 * time.Second},
+	} {
+		history.Add(play)
+	}
+
+	if history.PlayCount("track0") != 2 || !history.LastPlayed("track0").Equal(now.Add(-time.Hour)) {
+		t.Errorf("track0 should be played twice, an hour ago the last time: %v %v", history.PlayCount("track0"), history.LastPlayed("track0"))
+	}
+	if history.PlayCount("track1") != 0 || !history.LastPlayed("track1").IsZero() {
+		t.Error("track1 skipped at once should not count as played")
+	}
+	var _ sconsify.PlayHistory = history
+}
+
+func TestStats(t *testing.T) {
+	now := time.Now()
+	history := Open("")
+	for _, play := range []*sconsify.Play{
+		{URI: "track0", Name: "Waiting in vain", Artist: "Bob Marley", ArtistURI: "marley", StartedAt: now.Add(-30 * 24 * time.Hour), Listened: 4 * time.Minute, Finished: true},
+		{URI: "track1", Name: "Legalize it", Artist: "Peter Tosh", ArtistURI: "tosh", StartedAt: now.Add(-2 * time.Hour), Listened: 4 * time.Minute, Finished: true},
+		{URI: "track2", Name: "Simmer down", Artist: "Bob Marley", ArtistURI: "marley", StartedAt: now.Add(-time.Hour), Listened: 2 * time.Minute, Finished: true},
+		{URI: "track0", Name: "Waiting in vain", Artist: "Bob Marley", ArtistURI: "marley", StartedAt: now.Add(-time.Hour), Listened: time.Minute},
+		{URI: "track1", Name: "Legalize it", Artist: "Peter Tosh", ArtistURI: "tosh", StartedAt: now.Add(-time.Minute), Listened: 5 * time.Second},
+	} {
+		history.Add(play)
+	}
+
+	since, _ := ParsePeriod("week", now)
+	stats := history.Stats(since, 1)
+	if stats.Plays != 3 || stats.Skipped != 1 || stats.Listened != 7*time.Minute+5*time.Second {
+		t.Errorf("Week should have 3 plays and 1 skipped for 7m5s: %+v", stats)
+	}
+	if len(stats.TopArtists) != 1 || stats.TopArtists[0].Name != "Bob Marley" || stats.TopArtists[0].URI != "marley" || stats.TopArtists[0].Plays != 2 {
+		t.Errorf("Top artist of the week should be Bob Marley: %+v", stats.TopArtists)
+	}
+	if len(stats.TopTracks) != 1 || stats.TopTracks[0].Name != "Legalize it - Peter Tosh" {
+		t.Errorf("Top track of the week should be the first by name: %+v", stats.TopTracks)
+	}
+
+	if stats := history.Stats(time.Time{}, 10); stats.Plays != 4 || len(stats.TopTracks) != 3 || stats.TopTracks[0].URI != "track0" || stats.TopTracks[0].Plays != 2 {
+		t.Errorf("All time top track should be track0, played twice: %+v", stats.TopTracks)
+	}
+}
+
+func TestParsePeriod(t *testing.T) {
+	now := time.Date(2017, 3, 31, 12, 0, 0, 0, time.UTC)
+	for period, since := range map[string]time.Time{
+		"day":   time.Date(2017, 3, 30, 12, 0, 0, 0, time.UTC),
+		"Week":  time.Date(2017, 3, 24, 12, 0, 0, 0, time.UTC),
+		"month": time.Date(2017, 3, 3, 12, 0, 0, 0, time.UTC),
+		"year":  time.Date(2016, 3, 31, 12, 0, 0, 0, time.UTC),
+		"all":   time.Time{},
+	} {
+		if parsed, err := ParsePeriod(period, now); err != nil || !parsed.Equal(since) {
+			t.Errorf("Period %v should start at %v, it starts at %v: %v", period, since, parsed, err)
+		}
+	}
+	if _, err := ParsePeriod("decade", now); err == nil {
+		t.Error("Unknown period should fail")
+	}
+}
@@ -0,0 +1,134 @@
+package history
+
+import (
+	"time"
+
+	"github.com/schaeferpp/sconsify/infrastructure"
+	"github.com/schaeferpp/sconsify/sconsify"
+)
+
+const (
+	// maximumStep is the longest step between two positions counted as heard,
+	// longer ones being seeks.
+	maximumStep = 3 * time.Second
+	// endMargin is how close to its end a track stopped counts as finished.
+	endMargin = 5 * time.Second
+)
+
+// recorder follows the track playing to record it once another track starts.
+type recorder struct {
+	publisher *sconsify.Publisher
+	history   *History
+	play      *sconsify.Play
+	total     time.Duration
+	elapsed   time.Duration
+	ending    bool
+	// loaded is set between a track loaded and its playing, telling a track
+	// played again from a track resumed
+	loaded       bool
+	loadedLength time.Duration
+	// source is the playlist the user interface played a track from last
+	source *sconsify.PlaySource
+}
+
+// Record adds the tracks played to the history until the engine shuts down,
+// which closes the channel returned.
+func Record(publisher *sconsify.Publisher, history *History) <-chan struct{} {
+	events := publisher.Subscribe(sconsify.Subscription{
+		Topics: []sconsify.Topic{
+			sconsify.TopicPlaySource,
+			sconsify.TopicNewTrackLoaded,
+			sconsify.TopicTrackPlaying,
+			sconsify.TopicPlaybackPosition,
+			sconsify.TopicTrackEnding,
+			sconsify.TopicNextPlay,
+			sconsify.TopicShutdownEngine,
+		},
+		Buffer: 64,
+		Stream: true,
+	})
+	recorder := &recorder{publisher: publisher, history: history}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		defer publisher.Unsubscribe(events)
+
+		for event := range events.StreamUpdates() {
+			switch event.Topic {
+			case sconsify.TopicPlaySource:
+				recorder.source = event.Value.(*sconsify.PlaySource)
+			case sconsify.TopicNewTrackLoaded:
+				recorder.finish(true)
+				recorder.loaded, recorder.loadedLength = true, event.Value.(time.Duration)
+			case sconsify.TopicTrackPlaying:
+				recorder.playing(event.Value.(*sconsify.Track), event.Time)
+			case sconsify.TopicPlaybackPosition:
+				recorder.position(event.Value.(sconsify.Position))
+			case sconsify.TopicTrackEnding:
+				recorder.ending = true
+			case sconsify.TopicNextPlay:
+				recorder.finish(true)
+			case sconsify.TopicShutdownEngine:
+				// the user interface is gone, nothing to tell it
+				recorder.finish(false)
+				return
+			}
+		}
+	}()
+	return stopped
+}
+
+func (recorder *recorder) playing(track *sconsify.Track, startedAt time.Time) {
+	if recorder.play != nil && recorder.play.URI == track.URI && !recorder.loaded {
+		// resumed after a pause
+		return
+	}
+	recorder.finish(true)
+
+	play := &sconsify.Play{URI: track.URI, Name: track.Name, Duration: track.Duration, StartedAt: startedAt}
+	if track.Artist != nil {
+		play.Artist, play.ArtistURI = track.Artist.Name, track.Artist.URI
+	}
+	if recorder.source != nil && recorder.source.URI == track.URI {
+		play.Playlist = recorder.source.Playlist
+	}
+	recorder.play = play
+	recorder.total = recorder.loadedLength
+	if recorder.total == 0 {
+		recorder.total, _ = time.ParseDuration(track.Duration)
+	}
+	recorder.loaded, recorder.loadedLength = false, 0
+}
+
+func (recorder *recorder) position(position sconsify.Position) {
+	if recorder.play == nil {
+		return
+	}
+	if step := position.Elapsed - recorder.elapsed; step > 0 && step <= maximumStep {
+		recorder.play.Listened += step
+	}
+	recorder.elapsed = position.Elapsed
+	if position.Total > 0 {
+		recorder.total = position.Total
+	}
+}
+
+// finish records the track playing, if any, telling the user interface when
+// publish is set.
+func (recorder *recorder) finish(publish bool) {
+	play := recorder.play
+	if play == nil {
+		return
+	}
+	play.Finished = recorder.ending || (recorder.total > 0 && recorder.elapsed >= recorder.total-endMargin)
+	recorder.play, recorder.total, recorder.elapsed, recorder.ending = nil, 0, 0, false
+
+	if err := recorder.history.Add(play); err != nil {
+		infrastructure.Warn("Cannot record the track played", "track", play.URI, "error", err)
+		return
+	}
+	if publish {
+		recorder.publisher.PlayRecorded(play)
+	}
+}
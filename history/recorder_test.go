@@ -0,0 +1,82 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/schaeferpp/sconsify/sconsify"
+)
+
+// startTestUserInterface returns the events the user interface would receive.
+func startTestUserInterface() (*sconsify.Publisher, *sconsify.Events) {
+	publisher := &sconsify.Publisher{}
+	uiEvents := publisher.Subscribe(sconsify.Subscription{Topics: []sconsify.Topic{sconsify.TopicPlayRecorded}, Buffer: 4})
+	return publisher, uiEvents
+}
+
+func waitForPlay(t *testing.T, uiEvents *sconsify.Events) *sconsify.Play {
+	select {
+	case play := <-uiEvents.PlayRecordedUpdates():
+		return play
+	case <-time.After(5 * time.Second):
+		t.Fatal("A play should be recorded")
+	}
+	return nil
+}
+
+func TestRecord(t *testing.T) {
+	publisher, uiEvents := startTestUserInterface()
+	history := Open("")
+	recorded := Record(publisher, history)
+
+	track0 := sconsify.InitTrack("track0", sconsify.InitArtist("artist0", "Bob Marley"), "Waiting in vain", "4m16s")
+	publisher.PlayFrom(track0, "Reggae")
+	publisher.NewTrackLoaded(4*time.Minute + 16*time.Second)
+	publisher.TrackPlaying(track0)
+	publisher.PlaybackPosition(time.Second, 4*time.Minute+16*time.Second)
+	publisher.PlaybackPosition(2*time.Second, 4*time.Minute+16*time.Second)
+	publisher.TrackPaused(track0)
+	publisher.TrackPlaying(track0)
+	publisher.PlaybackPosition(3*time.Second, 4*time.Minute+16*time.Second)
+	// a seek is not heard
+	publisher.PlaybackPosition(time.Minute, 4*time.Minute+16*time.Second)
+	publisher.PlaybackPosition(time.Minute+time.Second, 4*time.Minute+16*time.Second)
+	publisher.NextPlay()
+
+	play := waitForPlay(t, uiEvents)
+	if play.URI != "track0" || play.Artist != "Bob Marley" || play.ArtistURI != "artist0" || play.Playlist != "Reggae" {
+		t.Errorf("Play should be track0 from Reggae: %+v", play)
+	}
+	if play.Listened != 4*time.Second || play.Finished {
+		t.Errorf("Play should be skipped after 4s heard, resuming it: %+v", play)
+	}
+
+	track1 := sconsify.InitTrack("track1", sconsify.InitArtist("artist0", "Bob Marley"), "Simmer down", "2m50s")
+	// played from the queue
+	publisher.Play(track1)
+	publisher.NewTrackLoaded(2*time.Minute + 50*time.Second)
+	publisher.TrackPlaying(track1)
+	publisher.PlaybackPosition(2*time.Minute+47*time.Second, 2*time.Minute+50*time.Second)
+	publisher.TrackEnding()
+	// played again from its beginning
+	publisher.NewTrackLoaded(2*time.Minute + 50*time.Second)
+	publisher.TrackPlaying(track1)
+
+	if play := waitForPlay(t, uiEvents); play.URI != "track1" || !play.Finished || play.Playlist != "" {
+		t.Errorf("Play should be track1 to its end, without playlist: %+v", play)
+	}
+	publisher.PlaybackPosition(40*time.Second, 2*time.Minute+50*time.Second)
+	publisher.ShutdownEngine()
+
+	select {
+	case <-recorded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Recording should stop when the engine shuts down")
+	}
+	if recent := history.Recent(10); len(recent) != 3 || recent[0].URI != "track1" || recent[0].Finished {
+		t.Errorf("Track1 played again should be recorded at the shutdown: %v", recent)
+	}
+	if history.PlayCount("track1") != 1 || history.PlayCount("track0") != 0 {
+		t.Errorf("Only track1 to its end should count as played: %v %v", history.PlayCount("track1"), history.PlayCount("track0"))
+	}
+}
@@ -2,7 +2,9 @@ package infrastructure
 
 import (
 	"errors"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/fabiofalci/flagrc"
@@ -60,6 +62,60 @@ func GetKeyFunctionsFileLocation() string {
 	return ""
 }
 
+func GetEqualizerFileLocation() string {
+	if basePath := getConfLocation(); basePath != "" {
+		return basePath + "/equalizer.json"
+	}
+	return ""
+}
+
+func GetNormalisationFileLocation() string {
+	if basePath := getConfLocation(); basePath != "" {
+		return basePath + "/normalisation.json"
+	}
+	return ""
+}
+
+func GetPlaylistEditsFileLocation() string {
+	if basePath := getConfLocation(); basePath != "" {
+		return basePath + "/playlist-edits.json"
+	}
+	return ""
+}
+
+func GetSmartPlaylistsFileLocation() string {
+	if basePath := getConfLocation(); basePath != "" {
+		return basePath + "/smart-playlists.json"
+	}
+	return ""
+}
+
+func GetHistoryFileLocation() string {
+	if basePath := getConfLocation(); basePath != "" {
+		return basePath + "/history.json"
+	}
+	return ""
+}
+
+// GetServerSocketLocation returns where the server listens, in $XDG_RUNTIME_DIR
+// when it is set as only the user can read it.
+func GetServerSocketLocation() string {
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		return runtimeDir + "/sconsify.sock"
+	}
+	if basePath := getConfLocation(); basePath != "" {
+		return basePath + "/sconsify.sock"
+	}
+	return ""
+}
+
+func GetServerTokenLocation() string {
+	if basePath := getConfLocation(); basePath != "" {
+		return basePath + "/server-token"
+	}
+	return ""
+}
+
 func SaveFile(fileLocation string, content []byte) {
 	file, err := os.OpenFile(fileLocation, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
 	if err == nil {
@@ -68,6 +124,27 @@ func SaveFile(fileLocation string, content []byte) {
 	}
 }
 
+// SaveFileAtomically writes the content to a temporary file next to fileLocation
+// and renames it over, the file is never read half written nor lost by an
+// interrupted write.
+func SaveFileAtomically(fileLocation string, content []byte) error {
+	temp, err := ioutil.TempFile(filepath.Dir(fileLocation), "."+filepath.Base(fileLocation))
+	if err != nil {
+		return err
+	}
+	_, err = temp.Write(content)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), fileLocation)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+	}
+	return err
+}
+
 func getConfLocation() string {
 	if dir, err := homedir.Dir(); err == nil {
 		if dir, err = homedir.Expand(dir); err == nil && dir != "" {
@@ -0,0 +1,49 @@
+package infrastructure
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+)
+
+// maxJsonLine is the longest line read from a JSON lines file.
+const maxJsonLine = 1024 * 1024
+
+// ReadJsonLines calls read with every line of the file, one JSON object each. The
+// lines read returns an error for are skipped with a warning naming the file by
+// what, a file not created yet having no line.
+func ReadJsonLines(fileLocation string, what string, read func(line []byte) error) {
+	content, err := ioutil.ReadFile(fileLocation)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			Warn("Cannot read the "+what, "file", fileLocation, "error", err)
+		}
+		return
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, maxJsonLine)
+	for scanner.Scan() {
+		if err := read(scanner.Bytes()); err != nil {
+			Warn("Skipping a line of the "+what, "file", fileLocation, "error", err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		Warn("Cannot read the "+what, "file", fileLocation, "error", err)
+	}
+}
+
+// AppendJsonLine appends the value to the file as a JSON object on its own line,
+// creating the file if needed.
+func AppendJsonLine(fileLocation string, value interface{}) error {
+	file, err := os.OpenFile(fileLocation, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(file).Encode(value)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,53 @@
+package infrastructure
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type jsonLine struct {
+	Name string `json:"name"`
+}
+
+func TestJsonLinesAreReadAgain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sconsify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileLocation := filepath.Join(dir, "lines.json")
+
+	ReadJsonLines(fileLocation, "lines", func(line []byte) error {
+		t.Errorf("A file not created yet should have no line: %s", line)
+		return nil
+	})
+
+	for _, name := range []string{"Bob Marley", "", "Peter Tosh"} {
+		if err := AppendJsonLine(fileLocation, &jsonLine{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file, _ := os.OpenFile(fileLocation, os.O_WRONLY|os.O_APPEND, 0600)
+	file.WriteString("not json\n")
+	file.Close()
+
+	var names []string
+	ReadJsonLines(fileLocation, "lines", func(line []byte) error {
+		var entry jsonLine
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return err
+		}
+		if entry.Name == "" {
+			return errors.New("line without a name")
+		}
+		names = append(names, entry.Name)
+		return nil
+	})
+	if len(names) != 2 || names[0] != "Bob Marley" || names[1] != "Peter Tosh" {
+		t.Errorf("The lines read should be the 2 with a name, in order: %v", names)
+	}
+}
@@ -1,35 +1,254 @@
 package infrastructure
 
 import (
-	"log"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-var logger *log.Logger
-var file *os.File
+type Level int
 
-func InitialiseLogger() {
-	filename := GetLogFileLocation()
-	if filename != "" {
-		file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
-		if err == nil {
-			logger = log.New(file, "", log.LstdFlags)
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (level Level) String() string {
+	if level < LevelDebug || level > LevelError {
+		return "unknown"
+	}
+	return levelNames[level]
+}
+
+// ParseLogLevel reads a -log-level value: debug, info, warn or error.
+func ParseLogLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if strings.ToLower(name) == levelName {
+			return Level(level), nil
 		}
 	}
+	return LevelInfo, fmt.Errorf("Unknown log level: %v", name)
 }
 
-func CloseLogger() {
-	file.Close()
+const (
+	LogFormatText = "text"
+	LogFormatJson = "json"
+)
+
+const (
+	// the log file is rotated to sconsify.log.1 once it reaches maxLogSize, the
+	// oldest of maxLogBackups rotated files being removed
+	maxLogSize    = 10 * 1024 * 1024
+	maxLogBackups = 3
+)
+
+// logger writes to the log file the entries of its level and above. The ones of
+// info and above are printed to the console too, for the user to see them,
+// unless the console user interface is using it.
+type logger struct {
+	mutex    sync.Mutex
+	level    Level
+	json     bool
+	console  bool
+	filename string
+	file     *os.File
+	size     int64
+	maxSize  int64
+}
+
+var log = &logger{level: LevelInfo, console: true, maxSize: maxLogSize}
+
+// InitialiseLogger opens the log file, ~/.sconsify/sconsify.log, the entries
+// below the level not being written.
+func InitialiseLogger(level string, format string) error {
+	parsedLevel, err := ParseLogLevel(level)
+	if err != nil {
+		return err
+	}
+	if format != LogFormatText && format != LogFormatJson {
+		return fmt.Errorf("Unknown log format: %v", format)
+	}
+
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	log.level = parsedLevel
+	log.json = format == LogFormatJson
+	log.filename = GetLogFileLocation()
+	if log.filename != "" {
+		log.open()
+	}
+	return nil
+}
+
+// LogToConsole stops or resumes printing to the console.
+func LogToConsole(enabled bool) {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	log.console = enabled
 }
 
-func Debug(message string) {
-	if logger != nil {
-		logger.Println(message)
+func CloseLogger() {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	if log.file != nil {
+		log.file.Close()
+		log.file = nil
 	}
 }
 
+// Debug logs a message with key-value fields, e.g.
+// Debug("Track loaded", "track", track.URI, "playlist", playlist.Name()).
+func Debug(message string, fields ...interface{}) {
+	log.write(LevelDebug, message, fields)
+}
+
 func Debugf(format string, v ...interface{}) {
-	if logger != nil {
-		logger.Printf(format, v...)
+	log.write(LevelDebug, fmt.Sprintf(format, v...), nil)
+}
+
+func Info(message string, fields ...interface{}) {
+	log.write(LevelInfo, message, fields)
+}
+
+func Warn(message string, fields ...interface{}) {
+	log.write(LevelWarn, message, fields)
+}
+
+func Error(message string, fields ...interface{}) {
+	log.write(LevelError, message, fields)
+}
+
+func (logger *logger) open() {
+	file, err := os.OpenFile(logger.filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return
+	}
+	logger.file, logger.size = file, 0
+	if info, err := file.Stat(); err == nil {
+		logger.size = info.Size()
+	}
+}
+
+func (logger *logger) write(level Level, message string, fields []interface{}) {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+	if logger.printsToConsole(level) {
+		printToConsole(os.Stdout, level, message, fields)
+	}
+	if logger.file == nil || level < logger.level {
+		return
+	}
+
+	var entry []byte
+	if logger.json {
+		entry = formatJson(time.Now(), level, message, fields)
+	} else {
+		entry = formatText(time.Now(), level, message, fields)
+	}
+	if logger.size+int64(len(entry)) > logger.maxSize {
+		logger.rotate()
+		if logger.file == nil {
+			return
+		}
+	}
+	n, _ := logger.file.Write(entry)
+	logger.size += int64(n)
+}
+
+// printsToConsole tells if the entries of the level are printed to the console,
+// the debug ones being only written to the log file.
+func (logger *logger) printsToConsole(level Level) bool {
+	return logger.console && level >= LevelInfo && level >= logger.level
+}
+
+// rotate renames sconsify.log to sconsify.log.1, shifting the older files.
+func (logger *logger) rotate() {
+	logger.file.Close()
+	logger.file = nil
+	os.Remove(fmt.Sprintf("%v.%v", logger.filename, maxLogBackups))
+	for backup := maxLogBackups - 1; backup > 0; backup-- {
+		os.Rename(fmt.Sprintf("%v.%v", logger.filename, backup), fmt.Sprintf("%v.%v", logger.filename, backup+1))
+	}
+	os.Rename(logger.filename, logger.filename+".1")
+	logger.open()
+}
+
+// printToConsole keeps the messages the user used to see, e.g. "Error: ...".
+func printToConsole(console io.Writer, level Level, message string, fields []interface{}) {
+	var b bytes.Buffer
+	switch level {
+	case LevelWarn:
+		b.WriteString("Warning: ")
+	case LevelError:
+		b.WriteString("Error: ")
+	}
+	b.WriteString(message)
+	var err interface{}
+	for i := 0; i < len(fields); i += 2 {
+		key, value := fieldAt(fields, i)
+		if key == "error" {
+			err = value
+		} else {
+			fmt.Fprintf(&b, " %v=%v", key, value)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(&b, ": %v", err)
+	}
+	b.WriteString("\n")
+	console.Write(b.Bytes())
+}
+
+func formatText(now time.Time, level Level, message string, fields []interface{}) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%v %-5v %v", now.Format(time.RFC3339), strings.ToUpper(level.String()), message)
+	for i := 0; i < len(fields); i += 2 {
+		key, value := fieldAt(fields, i)
+		text := fmt.Sprint(value)
+		if text == "" || strings.ContainsAny(text, " \t\n\"=") {
+			text = strconv.Quote(text)
+		}
+		fmt.Fprintf(&b, " %v=%v", key, text)
+	}
+	b.WriteString("\n")
+	return b.Bytes()
+}
+
+func formatJson(now time.Time, level Level, message string, fields []interface{}) []byte {
+	entry := map[string]interface{}{
+		"time":    now.Format(time.RFC3339),
+		"level":   level.String(),
+		"message": message,
+	}
+	for i := 0; i < len(fields); i += 2 {
+		key, value := fieldAt(fields, i)
+		if err, isError := value.(error); isError {
+			value = err.Error()
+		}
+		entry[key] = value
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		b, _ = json.Marshal(map[string]interface{}{"time": entry["time"], "level": entry["level"], "message": message})
+	}
+	return append(b, '\n')
+}
+
+// fieldAt returns the key and the value of the field starting at i, a key
+// without a value is kept as the value of a bad key.
+func fieldAt(fields []interface{}, i int) (string, interface{}) {
+	if i+1 >= len(fields) {
+		return "!BADKEY", fields[i]
 	}
+	return fmt.Sprint(fields[i]), fields[i+1]
 }
@@ -0,0 +1,100 @@
+package infrastructure
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var logTime = time.Date(2017, 3, 4, 10, 20, 30, 0, time.UTC)
+
+func TestParseLogLevel(t *testing.T) {
+	if level, err := ParseLogLevel("WARN"); err != nil || level != LevelWarn {
+		t.Errorf("Level should be warn but is %v: %v", level, err)
+	}
+	if _, err := ParseLogLevel("verbose"); err == nil {
+		t.Error("Unknown level should fail")
+	}
+}
+
+func TestFormatText(t *testing.T) {
+	entry := formatText(logTime, LevelWarn, "Cannot prefetch", []interface{}{"track", "spotify:track:1", "playlist", "Bob Marley", "error", errors.New("not found")})
+
+	expected := "2017-03-04T10:20:30Z WARN  Cannot prefetch track=spotify:track:1 playlist=\"Bob Marley\" error=\"not found\"\n"
+	if string(entry) != expected {
+		t.Errorf("Entry should be %q but is %q", expected, entry)
+	}
+}
+
+func TestFormatJson(t *testing.T) {
+	entry := formatJson(logTime, LevelError, "Cannot open", []interface{}{"channels", 2, "error", errors.New("busy"), "odd"})
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(entry, &fields); err != nil {
+		t.Fatalf("Entry should be json: %v", err)
+	}
+	if fields["level"] != "error" || fields["message"] != "Cannot open" || fields["channels"] != 2.0 ||
+		fields["error"] != "busy" || fields["!BADKEY"] != "odd" {
+		t.Errorf("Wrong fields %v", fields)
+	}
+}
+
+func TestPrintToConsole(t *testing.T) {
+	var console bytes.Buffer
+	printToConsole(&console, LevelError, "Cannot start", []interface{}{"error", errors.New("no key"), "backend", "spotify"})
+
+	if console.String() != "Error: Cannot start backend=spotify: no key\n" {
+		t.Errorf("Wrong console message %q", console.String())
+	}
+}
+
+func TestConsoleFollowsLevel(t *testing.T) {
+	logger := &logger{level: LevelWarn, console: true}
+	if logger.printsToConsole(LevelInfo) || !logger.printsToConsole(LevelWarn) {
+		t.Error("Only warnings and errors should be printed with the warn level")
+	}
+	logger.level = LevelDebug
+	if logger.printsToConsole(LevelDebug) || !logger.printsToConsole(LevelInfo) {
+		t.Error("Debug entries should not be printed, info ones should")
+	}
+	logger.console = false
+	if logger.printsToConsole(LevelError) {
+		t.Error("Nothing should be printed without the console")
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sconsify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logger := &logger{level: LevelDebug, filename: filepath.Join(dir, "sconsify.log"), maxSize: 3 * 1024}
+	logger.open()
+	defer logger.file.Close()
+
+	message := strings.Repeat("x", int(logger.maxSize/3))
+	for i := 0; i < 3*(maxLogBackups+2); i++ {
+		logger.write(LevelDebug, message, nil)
+	}
+
+	for backup := 1; backup <= maxLogBackups; backup++ {
+		if _, err := os.Stat(fmt.Sprintf("%v.%v", logger.filename, backup)); err != nil {
+			t.Errorf("Backup %v should exist: %v", backup, err)
+		}
+	}
+	if _, err := os.Stat(fmt.Sprintf("%v.%v", logger.filename, maxLogBackups+1)); err == nil {
+		t.Error("Only the last backups should be kept")
+	}
+	if info, err := os.Stat(logger.filename); err != nil || info.Size() > logger.maxSize {
+		t.Errorf("Log file should stay under the maximum size: %v", err)
+	}
+}
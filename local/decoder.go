@@ -0,0 +1,55 @@
+package local
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"time"
+
+	sp "github.com/fabiofalci/go-libspotify/spotify"
+)
+
+// decoder delivers the content of an audio file as interleaved little endian int16
+// samples, the same frames libspotify delivers to the audio consumer.
+type decoder interface {
+	format() sp.AudioFormat
+	duration() time.Duration
+	read(frames []byte) (int, error)
+	seek(position time.Duration) error
+	close() error
+}
+
+var decoders = map[string]func(path string) (decoder, error){
+	".flac": newFlacDecoder,
+	".mp3":  newMp3Decoder,
+	".ogg":  newOggDecoder,
+	".wav":  newWavDecoder,
+}
+
+func isSupportedFile(path string) bool {
+	_, supported := decoders[strings.ToLower(filepath.Ext(path))]
+	return supported
+}
+
+func openDecoder(path string) (decoder, error) {
+	if newDecoder, supported := decoders[strings.ToLower(filepath.Ext(path))]; supported {
+		return newDecoder(path)
+	}
+	return nil, errors.New("Unsupported file: " + path)
+}
+
+func durationOf(samples int64, sampleRate int) time.Duration {
+	if sampleRate <= 0 {
+		return 0
+	}
+	return time.Duration(samples) * time.Second / time.Duration(sampleRate)
+}
+
+func samplesOf(position time.Duration, sampleRate int) int64 {
+	return int64(position * time.Duration(sampleRate) / time.Second)
+}
+
+func putSample(frames []byte, index int, sample int16) {
+	frames[index] = byte(sample)
+	frames[index+1] = byte(sample >> 8)
+}
@@ -0,0 +1,89 @@
+package local
+
+import (
+	"io"
+	"os"
+	"time"
+
+	sp "github.com/fabiofalci/go-libspotify/spotify"
+	"github.com/mewkiz/flac"
+)
+
+type flacDecoder struct {
+	file    *os.File
+	stream  *flac.Stream
+	pending []int16
+}
+
+func newFlacDecoder(path string) (decoder, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := flac.NewSeek(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &flacDecoder{file: file, stream: stream}, nil
+}
+
+func (decoder *flacDecoder) format() sp.AudioFormat {
+	return sp.AudioFormat{
+		SampleType: sp.SampleTypeInt16NativeEndian,
+		SampleRate: int(decoder.stream.Info.SampleRate),
+		Channels:   int(decoder.stream.Info.NChannels),
+	}
+}
+
+func (decoder *flacDecoder) duration() time.Duration {
+	return durationOf(int64(decoder.stream.Info.NSamples), int(decoder.stream.Info.SampleRate))
+}
+
+func (decoder *flacDecoder) read(frames []byte) (int, error) {
+	for len(decoder.pending) < len(frames)/2 {
+		frame, err := decoder.stream.ParseNext()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		bitsPerSample := uint(decoder.stream.Info.BitsPerSample)
+		for i := range frame.Subframes[0].Samples {
+			for _, subframe := range frame.Subframes {
+				decoder.pending = append(decoder.pending, toInt16(subframe.Samples[i], bitsPerSample))
+			}
+		}
+	}
+
+	if len(decoder.pending) == 0 {
+		return 0, io.EOF
+	}
+
+	read := 0
+	for read < len(frames)/2 && read < len(decoder.pending) {
+		putSample(frames, read*2, decoder.pending[read])
+		read++
+	}
+	decoder.pending = decoder.pending[read:]
+	return read * 2, nil
+}
+
+func toInt16(sample int32, bitsPerSample uint) int16 {
+	if bitsPerSample > 16 {
+		return int16(sample >> (bitsPerSample - 16))
+	}
+	return int16(sample << (16 - bitsPerSample))
+}
+
+func (decoder *flacDecoder) seek(position time.Duration) error {
+	decoder.pending = nil
+	_, err := decoder.stream.Seek(uint64(samplesOf(position, int(decoder.stream.Info.SampleRate))))
+	return err
+}
+
+func (decoder *flacDecoder) close() error {
+	decoder.stream.Close()
+	return decoder.file.Close()
+}
@@ -0,0 +1,57 @@
+package local
+
+import (
+	"io"
+	"os"
+	"time"
+
+	sp "github.com/fabiofalci/go-libspotify/spotify"
+	"github.com/hajimehoshi/go-mp3"
+)
+
+// mp3 frames are always decoded as 2 channels of int16
+const mp3BytesPerFrame = 4
+
+type mp3Decoder struct {
+	file    *os.File
+	decoder *mp3.Decoder
+}
+
+func newMp3Decoder(path string) (decoder, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	decoder, err := mp3.NewDecoder(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &mp3Decoder{file: file, decoder: decoder}, nil
+}
+
+func (decoder *mp3Decoder) format() sp.AudioFormat {
+	return sp.AudioFormat{SampleType: sp.SampleTypeInt16NativeEndian, SampleRate: decoder.decoder.SampleRate(), Channels: 2}
+}
+
+func (decoder *mp3Decoder) duration() time.Duration {
+	return durationOf(decoder.decoder.Length()/mp3BytesPerFrame, decoder.decoder.SampleRate())
+}
+
+func (decoder *mp3Decoder) read(frames []byte) (int, error) {
+	n, err := io.ReadFull(decoder.decoder, frames)
+	if err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (decoder *mp3Decoder) seek(position time.Duration) error {
+	offset := samplesOf(position, decoder.decoder.SampleRate()) * mp3BytesPerFrame
+	_, err := decoder.decoder.Seek(offset, io.SeekStart)
+	return err
+}
+
+func (decoder *mp3Decoder) close() error {
+	return decoder.file.Close()
+}
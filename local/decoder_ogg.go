@@ -0,0 +1,79 @@
+package local
+
+import (
+	"io"
+	"os"
+	"time"
+
+	sp "github.com/fabiofalci/go-libspotify/spotify"
+	"github.com/jfreymuth/oggvorbis"
+)
+
+type oggDecoder struct {
+	file   *os.File
+	reader *oggvorbis.Reader
+	buffer []float32
+}
+
+func newOggDecoder(path string) (decoder, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := oggvorbis.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &oggDecoder{file: file, reader: reader}, nil
+}
+
+func (decoder *oggDecoder) format() sp.AudioFormat {
+	return sp.AudioFormat{SampleType: sp.SampleTypeInt16NativeEndian, SampleRate: decoder.reader.SampleRate(), Channels: decoder.reader.Channels()}
+}
+
+func (decoder *oggDecoder) duration() time.Duration {
+	return durationOf(decoder.reader.Length(), decoder.reader.SampleRate())
+}
+
+func (decoder *oggDecoder) read(frames []byte) (int, error) {
+	samples := len(frames) / 2
+	if cap(decoder.buffer) < samples {
+		decoder.buffer = make([]float32, samples)
+	}
+	buffer := decoder.buffer[:samples]
+
+	read := 0
+	for read < samples {
+		n, err := decoder.reader.Read(buffer[read:])
+		read += n
+		if err == io.EOF {
+			if read == 0 {
+				return 0, io.EOF
+			}
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	for i := 0; i < read; i++ {
+		sample := buffer[i]
+		if sample > 1 {
+			sample = 1
+		} else if sample < -1 {
+			sample = -1
+		}
+		putSample(frames, i*2, int16(sample*32767))
+	}
+	return read * 2, nil
+}
+
+func (decoder *oggDecoder) seek(position time.Duration) error {
+	return decoder.reader.SetPosition(samplesOf(position, decoder.reader.SampleRate()))
+}
+
+func (decoder *oggDecoder) close() error {
+	return decoder.file.Close()
+}
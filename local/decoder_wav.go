@@ -0,0 +1,155 @@
+package local
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	sp "github.com/fabiofalci/go-libspotify/spotify"
+)
+
+type wavDecoder struct {
+	file          *os.File
+	channels      int
+	sampleRate    int
+	bitsPerSample int
+	dataOffset    int64
+	dataSize      int64
+	remaining     int64
+	buffer        []byte
+}
+
+func newWavDecoder(path string) (decoder, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	wav := &wavDecoder{file: file}
+	if err := wav.readHeader(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return wav, nil
+}
+
+func (wav *wavDecoder) readHeader() error {
+	var riff [12]byte
+	if _, err := io.ReadFull(wav.file, riff[:]); err != nil {
+		return err
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return errors.New("Not a wav file")
+	}
+
+	offset := int64(len(riff))
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(wav.file, chunk[:]); err != nil {
+			return err
+		}
+		offset += int64(len(chunk))
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		// the chunks of an odd size are followed by a pad byte
+		padded := size + size&1
+
+		switch string(chunk[0:4]) {
+		case "fmt ":
+			content := make([]byte, padded)
+			if _, err := io.ReadFull(wav.file, content); err != nil {
+				return err
+			}
+			content = content[:size]
+			if len(content) < 16 || binary.LittleEndian.Uint16(content[0:2]) != 1 {
+				return errors.New("Only PCM wav files are supported")
+			}
+			wav.channels = int(binary.LittleEndian.Uint16(content[2:4]))
+			wav.sampleRate = int(binary.LittleEndian.Uint32(content[4:8]))
+			wav.bitsPerSample = int(binary.LittleEndian.Uint16(content[14:16]))
+			if wav.bitsPerSample != 8 && wav.bitsPerSample != 16 && wav.bitsPerSample != 24 {
+				return errors.New("Unsupported wav bits per sample")
+			}
+		case "data":
+			if wav.channels == 0 {
+				return errors.New("Wav data chunk before fmt chunk")
+			}
+			wav.dataOffset = offset
+			wav.dataSize = size
+			wav.remaining = size
+			return nil
+		default:
+			if _, err := wav.file.Seek(padded, io.SeekCurrent); err != nil {
+				return err
+			}
+		}
+		offset += padded
+	}
+}
+
+func (wav *wavDecoder) format() sp.AudioFormat {
+	return sp.AudioFormat{SampleType: sp.SampleTypeInt16NativeEndian, SampleRate: wav.sampleRate, Channels: wav.channels}
+}
+
+func (wav *wavDecoder) bytesPerSample() int {
+	return wav.bitsPerSample / 8
+}
+
+func (wav *wavDecoder) duration() time.Duration {
+	return durationOf(wav.dataSize/int64(wav.bytesPerSample()*wav.channels), wav.sampleRate)
+}
+
+func (wav *wavDecoder) read(frames []byte) (int, error) {
+	if wav.remaining <= 0 {
+		return 0, io.EOF
+	}
+	bytesPerSample := wav.bytesPerSample()
+	samples := len(frames) / 2
+	size := int64(samples * bytesPerSample)
+	if size > wav.remaining {
+		size = wav.remaining - wav.remaining%int64(bytesPerSample)
+	}
+	if cap(wav.buffer) < int(size) {
+		wav.buffer = make([]byte, size)
+	}
+	buffer := wav.buffer[:size]
+	n, err := io.ReadFull(wav.file, buffer)
+	wav.remaining -= int64(n)
+	if err == io.ErrUnexpectedEOF {
+		wav.remaining = 0
+		err = nil
+	}
+
+	read := 0
+	for i := 0; i+bytesPerSample <= n; i += bytesPerSample {
+		var sample int16
+		switch bytesPerSample {
+		case 1:
+			sample = int16(int(buffer[i])-128) << 8
+		case 2:
+			sample = int16(binary.LittleEndian.Uint16(buffer[i : i+2]))
+		case 3:
+			sample = int16(binary.LittleEndian.Uint16(buffer[i+1 : i+3]))
+		}
+		putSample(frames, read, sample)
+		read += 2
+	}
+	return read, err
+}
+
+func (wav *wavDecoder) seek(position time.Duration) error {
+	blockAlign := int64(wav.bytesPerSample() * wav.channels)
+	offset := samplesOf(position, wav.sampleRate) * blockAlign
+	if offset > wav.dataSize {
+		offset = wav.dataSize
+	}
+	if _, err := wav.file.Seek(wav.dataOffset+offset, io.SeekStart); err != nil {
+		return err
+	}
+	wav.remaining = wav.dataSize - offset
+	return nil
+}
+
+func (wav *wavDecoder) close() error {
+	return wav.file.Close()
+}
@@ -0,0 +1,163 @@
+package local
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeWav(t *testing.T, path string, sampleRate int, channels int, samples []int16) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, len(samples)*2)
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(data[i*2:], uint16(sample))
+	}
+
+	header := make([]byte, 44)
+	copy(header[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:8], uint32(36+len(data)))
+	copy(header[8:16], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:20], 16)
+	binary.LittleEndian.PutUint16(header[20:22], 1)
+	binary.LittleEndian.PutUint16(header[22:24], uint16(channels))
+	binary.LittleEndian.PutUint32(header[24:28], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(header[28:32], uint32(sampleRate*channels*2))
+	binary.LittleEndian.PutUint16(header[32:34], uint16(channels*2))
+	binary.LittleEndian.PutUint16(header[34:36], 16)
+	copy(header[36:40], "data")
+	binary.LittleEndian.PutUint32(header[40:44], uint32(len(data)))
+
+	if err := ioutil.WriteFile(path, append(header, data...), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func createSamples(frames int, channels int) []int16 {
+	samples := make([]int16, frames*channels)
+	for i := range samples {
+		samples[i] = int16(i)
+	}
+	return samples
+}
+
+func TestWavDecoder(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "sconsify")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "track.wav")
+	samples := createSamples(22050, 2)
+	writeWav(t, path, 22050, 2, samples)
+
+	decoder, err := openDecoder(path)
+	if err != nil {
+		t.Fatalf("Wav file should be decoded: %v", err)
+	}
+	defer decoder.close()
+
+	if format := decoder.format(); format.SampleRate != 22050 || format.Channels != 2 {
+		t.Errorf("Wrong format %v", format)
+	}
+	if decoder.duration() != time.Second {
+		t.Errorf("Duration should be 1s but is %v", decoder.duration())
+	}
+
+	read := 0
+	frames := make([]byte, bufferSize(decoder.format()))
+	for {
+		n, err := decoder.read(frames)
+		for i := 0; i < n; i += 2 {
+			if sample := int16(binary.LittleEndian.Uint16(frames[i:])); sample != samples[read] {
+				t.Fatalf("Sample %v should be %v but is %v", read, samples[read], sample)
+			}
+			read++
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if read != len(samples) {
+		t.Errorf("Should read %v samples but read %v", len(samples), read)
+	}
+}
+
+func TestWavDecoderSeek(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "sconsify")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "track.wav")
+	samples := createSamples(1000, 1)
+	writeWav(t, path, 1000, 1, samples)
+
+	decoder, _ := openDecoder(path)
+	defer decoder.close()
+
+	if err := decoder.seek(500 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	frames := make([]byte, 2)
+	if n, _ := decoder.read(frames); n != 2 || int16(binary.LittleEndian.Uint16(frames)) != samples[500] {
+		t.Errorf("Seek should move to sample 500")
+	}
+
+	decoder.seek(2 * time.Second)
+	if _, err := decoder.read(frames); err != io.EOF {
+		t.Errorf("Seek after the end should reach the end of file")
+	}
+}
+
+func TestWavDecoderSkipsPadByte(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "sconsify")
+	defer os.RemoveAll(dir)
+
+	// a fmt chunk of 17 bytes, its pad byte and 2 samples of data
+	content := make([]byte, 50)
+	copy(content[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(content[4:8], uint32(len(content)-8))
+	copy(content[8:16], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(content[16:20], 17)
+	binary.LittleEndian.PutUint16(content[20:22], 1)
+	binary.LittleEndian.PutUint16(content[22:24], 1)
+	binary.LittleEndian.PutUint32(content[24:28], 1000)
+	binary.LittleEndian.PutUint32(content[28:32], 2000)
+	binary.LittleEndian.PutUint16(content[32:34], 2)
+	binary.LittleEndian.PutUint16(content[34:36], 16)
+	copy(content[38:42], "data")
+	binary.LittleEndian.PutUint32(content[42:46], 4)
+	binary.LittleEndian.PutUint16(content[46:48], 7)
+	binary.LittleEndian.PutUint16(content[48:50], 9)
+	path := filepath.Join(dir, "track.wav")
+	if err := ioutil.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	decoder, err := openDecoder(path)
+	if err != nil {
+		t.Fatalf("Wav file with an odd fmt chunk should be decoded: %v", err)
+	}
+	defer decoder.close()
+	frames := make([]byte, 4)
+	if n, _ := decoder.read(frames); n != 4 || binary.LittleEndian.Uint16(frames) != 7 || binary.LittleEndian.Uint16(frames[2:]) != 9 {
+		t.Errorf("The data should be read after the pad byte: %v", frames)
+	}
+}
+
+func TestUnsupportedFile(t *testing.T) {
+	if isSupportedFile("cover.jpg") {
+		t.Error("Images should not be supported")
+	}
+	if !isSupportedFile("track.FLAC") {
+		t.Error("Extension should be case insensitive")
+	}
+	if _, err := openDecoder("cover.jpg"); err == nil {
+		t.Error("Unsupported files should not be decoded")
+	}
+}
@@ -0,0 +1,235 @@
+package local
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dhowden/tag"
+	"github.com/schaeferpp/sconsify/infrastructure"
+	"github.com/schaeferpp/sconsify/sconsify"
+)
+
+const (
+	UnknownArtist = "Unknown Artist"
+
+	PlaylistPerFolder = "folder"
+	PlaylistPerAlbum  = "album"
+)
+
+type libraryTrack struct {
+	path        string
+	folder      string
+	trackNumber int
+	duration    time.Duration
+	track       *sconsify.Track
+}
+
+type library struct {
+	root   string
+	tracks []*libraryTrack
+	byURI  map[string]*libraryTrack
+}
+
+type libraryTrackByFolder []*libraryTrack
+
+func scanLibrary(root string) (*library, error) {
+	library := &library{root: root, tracks: make([]*libraryTrack, 0), byURI: make(map[string]*libraryTrack)}
+	artists := make(map[string]*sconsify.Artist)
+	albums := make(map[string]*sconsify.Album)
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			infrastructure.Debugf("Cannot read %v: %v", path, err)
+			return nil
+		}
+		if info.IsDir() || !isSupportedFile(path) {
+			return nil
+		}
+		if libraryTrack := library.loadTrack(path, artists, albums); libraryTrack != nil {
+			library.tracks = append(library.tracks, libraryTrack)
+			library.byURI[libraryTrack.track.URI] = libraryTrack
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(libraryTrackByFolder(library.tracks))
+	return library, nil
+}
+
+func (library *library) loadTrack(path string, artists map[string]*sconsify.Artist, albums map[string]*sconsify.Album) *libraryTrack {
+	decoder, err := openDecoder(path)
+	if err != nil {
+		infrastructure.Debugf("Ignoring %v: %v", path, err)
+		return nil
+	}
+	duration := decoder.duration()
+	decoder.close()
+
+	folder, _ := filepath.Rel(library.root, filepath.Dir(path))
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	artistName := UnknownArtist
+	albumName := filepath.Base(filepath.Dir(path))
+	trackNumber := 0
+
+	if metadata := readMetadata(path); metadata != nil {
+		if metadata.Title() != "" {
+			name = metadata.Title()
+		}
+		if metadata.Artist() != "" {
+			artistName = metadata.Artist()
+		} else if metadata.AlbumArtist() != "" {
+			artistName = metadata.AlbumArtist()
+		}
+		if metadata.Album() != "" {
+			albumName = metadata.Album()
+		}
+		trackNumber, _ = metadata.Track()
+	}
+
+	artist := artists[artistName]
+	if artist == nil {
+		artist = sconsify.InitArtist("local:artist:"+artistName, artistName)
+		artists[artistName] = artist
+	}
+	album := albums[artistName+":"+albumName]
+	if album == nil {
+		album = &sconsify.Album{URI: "local:album:" + artistName + ":" + albumName, Name: albumName, Artists: []*sconsify.Artist{artist}}
+		albums[artistName+":"+albumName] = album
+		artist.Albums = append(artist.Albums, album)
+	}
+
+	track := sconsify.InitTrack("local:track:"+path, artist, name, duration.String())
+	track.Album = album
+	infrastructure.Debugf("\tTrack '%v' (%v)", track.URI, track.Name)
+
+	return &libraryTrack{path: path, folder: folder, trackNumber: trackNumber, duration: duration, track: track}
+}
+
+func readMetadata(path string) tag.Metadata {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	if metadata, err := tag.ReadFrom(file); err == nil {
+		return metadata
+	}
+	return nil
+}
+
+func (library *library) get(URI string) *libraryTrack {
+	return library.byURI[URI]
+}
+
+func (library *library) playlists(playlistMode string) *sconsify.Playlists {
+	playlists := sconsify.InitPlaylists()
+
+	if playlistMode == PlaylistPerAlbum {
+		for _, playlist := range library.albumPlaylists(sconsify.InitPlaylist) {
+			playlists.AddPlaylist(playlist)
+		}
+	} else {
+		for _, playlist := range library.folderPlaylists() {
+			playlists.AddPlaylist(playlist)
+		}
+	}
+
+	playlists.AddPlaylist(sconsify.InitFolder("local:artists", "*Artists", library.artistPlaylists()))
+	playlists.AddPlaylist(sconsify.InitFolder("local:albums", "*Albums", library.albumPlaylists(sconsify.InitSubPlaylist)))
+	return playlists
+}
+
+func (library *library) folderPlaylists() []*sconsify.Playlist {
+	playlists := make([]*sconsify.Playlist, 0)
+	var playlist *sconsify.Playlist
+	for _, libraryTrack := range library.tracks {
+		if playlist == nil || playlist.URI != "local:folder:"+libraryTrack.folder {
+			name := libraryTrack.folder
+			if name == "." {
+				name = filepath.Base(library.root)
+			}
+			playlist = sconsify.InitPlaylist("local:folder:"+libraryTrack.folder, name, make([]*sconsify.Track, 0))
+			playlists = append(playlists, playlist)
+		}
+		playlist.AddTrack(libraryTrack.track)
+	}
+	return playlists
+}
+
+func (library *library) albumPlaylists(initPlaylist func(URI string, name string, tracks []*sconsify.Track) *sconsify.Playlist) []*sconsify.Playlist {
+	playlists := make([]*sconsify.Playlist, 0)
+	byAlbum := make(map[*sconsify.Album]*sconsify.Playlist)
+	for _, libraryTrack := range library.tracks {
+		album := libraryTrack.track.Album
+		playlist := byAlbum[album]
+		if playlist == nil {
+			playlist = initPlaylist(album.URI, album.Name, make([]*sconsify.Track, 0))
+			byAlbum[album] = playlist
+			playlists = append(playlists, playlist)
+		}
+		playlist.AddTrack(libraryTrack.track)
+	}
+	return playlists
+}
+
+func (library *library) artistPlaylists() []*sconsify.Playlist {
+	playlists := make([]*sconsify.Playlist, 0)
+	byArtist := make(map[*sconsify.Artist]*sconsify.Playlist)
+	for _, libraryTrack := range library.tracks {
+		artist := libraryTrack.track.Artist
+		playlist := byArtist[artist]
+		if playlist == nil {
+			playlist = sconsify.InitSubPlaylist(artist.URI, artist.Name, make([]*sconsify.Track, 0))
+			byArtist[artist] = playlist
+			playlists = append(playlists, playlist)
+		}
+		playlist.AddTrack(libraryTrack.track)
+	}
+	return playlists
+}
+
+// search matches the query against the track, artist and album names. The same
+// aliases as the spotify search are accepted.
+func (library *library) search(query string) []*sconsify.Track {
+	field := ""
+	for _, prefix := range []string{"artist:", "ar:", "album:", "al:", "track:", "tr:"} {
+		if strings.HasPrefix(query, prefix) {
+			field = prefix[:2]
+			query = strings.TrimPrefix(query, prefix)
+			break
+		}
+	}
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	tracks := make([]*sconsify.Track, 0)
+	for _, libraryTrack := range library.tracks {
+		track := libraryTrack.track
+		artist := strings.Contains(strings.ToLower(track.Artist.Name), query)
+		album := strings.Contains(strings.ToLower(track.Album.Name), query)
+		name := strings.Contains(strings.ToLower(track.Name), query)
+		if (field == "ar" && artist) || (field == "al" && album) || (field == "tr" && name) || (field == "" && (artist || album || name)) {
+			tracks = append(tracks, track)
+		}
+	}
+	return tracks
+}
+
+// sort Interface
+func (t libraryTrackByFolder) Len() int      { return len(t) }
+func (t libraryTrackByFolder) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
+
+func (t libraryTrackByFolder) Less(i, j int) bool {
+	if t[i].folder != t[j].folder {
+		return t[i].folder < t[j].folder
+	}
+	if t[i].trackNumber != t[j].trackNumber {
+		return t[i].trackNumber < t[j].trackNumber
+	}
+	return t[i].path < t[j].path
+}
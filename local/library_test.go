@@ -0,0 +1,89 @@
+package local
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func createLibrary(t *testing.T) string {
+	dir, _ := ioutil.TempDir("", "sconsify")
+	samples := createSamples(100, 2)
+	writeWav(t, filepath.Join(dir, "Album 1", "01 first.wav"), 44100, 2, samples)
+	writeWav(t, filepath.Join(dir, "Album 1", "02 second.wav"), 44100, 2, samples)
+	writeWav(t, filepath.Join(dir, "Album 2", "song.wav"), 44100, 2, samples)
+	ioutil.WriteFile(filepath.Join(dir, "Album 2", "cover.jpg"), []byte{}, 0600)
+	return dir
+}
+
+func TestScanLibrary(t *testing.T) {
+	dir := createLibrary(t)
+	defer os.RemoveAll(dir)
+
+	library, err := scanLibrary(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(library.tracks) != 3 {
+		t.Fatalf("Library should have 3 tracks but has %v", len(library.tracks))
+	}
+	track := library.tracks[0].track
+	if track.Name != "01 first" || track.Artist.Name != UnknownArtist || track.Album.Name != "Album 1" {
+		t.Errorf("Track without tags should be named after its file and folder: %v", track.GetFullTitle())
+	}
+	if library.get(track.URI) != library.tracks[0] {
+		t.Error("Track should be found by its URI")
+	}
+}
+
+func TestLibraryPlaylistPerFolder(t *testing.T) {
+	dir := createLibrary(t)
+	defer os.RemoveAll(dir)
+
+	library, _ := scanLibrary(dir)
+	playlists := library.playlists(PlaylistPerFolder)
+
+	if playlists.Playlists() != 4 {
+		t.Errorf("Should have 2 folder playlists plus *Artists and *Albums but has %v", playlists.Playlists())
+	}
+	if playlist := playlists.Get("Album 1"); playlist == nil || playlist.Tracks() != 2 {
+		t.Error("Playlist 'Album 1' should have 2 tracks")
+	}
+	if playlist := playlists.Get("*Artists"); playlist == nil || playlist.Playlists() != 1 || playlist.Tracks() != 3 {
+		t.Error("Folder *Artists should have 1 artist with 3 tracks")
+	}
+	if playlist := playlists.Get("*Albums"); playlist == nil || playlist.Playlists() != 2 {
+		t.Error("Folder *Albums should have 2 albums")
+	}
+}
+
+func TestLibraryPlaylistPerAlbum(t *testing.T) {
+	dir := createLibrary(t)
+	defer os.RemoveAll(dir)
+
+	library, _ := scanLibrary(dir)
+	playlists := library.playlists(PlaylistPerAlbum)
+
+	if playlist := playlists.GetByURI("local:album:" + UnknownArtist + ":Album 2"); playlist == nil || playlist.Tracks() != 1 {
+		t.Error("Playlist 'Album 2' should have 1 track")
+	}
+}
+
+func TestLibrarySearch(t *testing.T) {
+	dir := createLibrary(t)
+	defer os.RemoveAll(dir)
+
+	library, _ := scanLibrary(dir)
+
+	if tracks := library.search("second"); len(tracks) != 1 {
+		t.Errorf("Search should find 1 track but found %v", len(tracks))
+	}
+	if tracks := library.search("al:album 1"); len(tracks) != 2 {
+		t.Errorf("Album search should find 2 tracks but found %v", len(tracks))
+	}
+	if tracks := library.search("tr:album"); len(tracks) != 0 {
+		t.Errorf("Track search should not match album names but found %v", len(tracks))
+	}
+}
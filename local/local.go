@@ -0,0 +1,384 @@
+package local
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	sp "github.com/fabiofalci/go-libspotify/spotify"
+	"github.com/mitchellh/go-homedir"
+	"github.com/schaeferpp/sconsify/infrastructure"
+	"github.com/schaeferpp/sconsify/sconsify"
+	"github.com/schaeferpp/sconsify/spotify"
+)
+
+// bufferSize is the same libspotify delivers: 2048 frames of int16 samples, so a
+// frame is never split between two writes.
+func bufferSize(format sp.AudioFormat) int {
+	return 2048 * format.Channels * 2
+}
+
+type Local struct {
+	events    *sconsify.Events
+	publisher *sconsify.Publisher
+	audio     spotify.AudioOutput
+
+	library      *library
+	playlistMode string
+	crossfade    time.Duration
+
+	currentTrack *sconsify.Track
+	paused       bool
+	commands     chan *command
+
+	// prefetched track the stream moved to when the previous one ended
+	mutex      sync.Mutex
+	handedOver *sconsify.Track
+}
+
+type LocalInitConf struct {
+	Directory    string
+	PlaylistMode string
+	Audio        *spotify.AudioInitConf
+}
+
+type command struct {
+	load     decoder
+	prefetch decoder
+	track    *sconsify.Track
+	pause    bool
+	resume   bool
+	seek     time.Duration
+	stop     bool
+}
+
+func Initialise(initConf *LocalInitConf, events *sconsify.Events, publisher *sconsify.Publisher) {
+	if err := initialiseLocal(initConf, events, publisher); err != nil {
+		infrastructure.Error("Cannot start the local backend", "error", err)
+		publisher.ShutdownEngine()
+	}
+}
+
+func initialiseLocal(initConf *LocalInitConf, events *sconsify.Events, publisher *sconsify.Publisher) error {
+	directory, err := homedir.Expand(initConf.Directory)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Scanning %v\n", directory)
+	library, err := scanLibrary(directory)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Loaded %v tracks\n", len(library.tracks))
+
+	local := &Local{
+		events:       events,
+		publisher:    publisher,
+		library:      library,
+		playlistMode: initConf.PlaylistMode,
+		crossfade:    initConf.Audio.Crossfade,
+		commands:     make(chan *command),
+	}
+
+	local.audio = spotify.InitialiseAudio(publisher, initConf.Audio)
+	defer spotify.TerminateAudio(local.audio, initConf.Audio)
+	go local.stream()
+
+	return sconsify.StartBackend(local, events, publisher)
+}
+
+func (local *Local) LoadPlaylists() error {
+	if len(local.library.tracks) == 0 {
+		return errors.New("No track found")
+	}
+	local.publisher.NewPlaylist(local.library.playlists(local.playlistMode))
+	return nil
+}
+
+func (local *Local) Play(track *sconsify.Track) {
+	handedOver := local.takeHandedOver()
+	if local.paused && local.currentTrack == track {
+		local.commands <- &command{resume: true}
+	} else if handedOver == track {
+		// the stream is already playing it since the previous track ended
+		local.publisher.NewTrackLoaded(local.library.get(track.URI).duration)
+	} else {
+		libraryTrack := local.library.get(track.URI)
+		if libraryTrack == nil {
+			local.publisher.TrackNotAvailable(track)
+			return
+		}
+		decoder, err := openDecoder(libraryTrack.path)
+		if err != nil {
+			infrastructure.Warn("Cannot open the track", "track", track.URI, "file", libraryTrack.path, "error", err)
+			local.publisher.TrackNotAvailable(track)
+			return
+		}
+		local.commands <- &command{load: decoder, track: track}
+		local.publisher.NewTrackLoaded(decoder.duration())
+	}
+
+	local.publisher.TrackPlaying(track)
+	local.currentTrack = track
+	local.paused = false
+}
+
+func (local *Local) Pause() {
+	if local.currentTrack != nil && !local.paused {
+		local.pauseCurrentTrack()
+	}
+}
+
+func (local *Local) PlayPauseToggle() {
+	if local.currentTrack != nil {
+		if local.paused {
+			local.Play(local.currentTrack)
+		} else {
+			local.pauseCurrentTrack()
+		}
+	}
+}
+
+func (local *Local) pauseCurrentTrack() {
+	local.commands <- &command{pause: true}
+	local.publisher.TrackPaused(local.currentTrack)
+	local.paused = true
+}
+
+func (local *Local) Replay() {
+	if local.currentTrack != nil {
+		local.Play(local.currentTrack)
+	}
+}
+
+func (local *Local) Seek(offset time.Duration) {
+	if local.currentTrack != nil {
+		local.commands <- &command{seek: offset}
+	}
+}
+
+// Prefetch opens the track so the stream continues with it, without a gap, when
+// the current one ends.
+func (local *Local) Prefetch(track *sconsify.Track) {
+	libraryTrack := local.library.get(track.URI)
+	if libraryTrack == nil {
+		return
+	}
+	decoder, err := openDecoder(libraryTrack.path)
+	if err != nil {
+		infrastructure.Warn("Cannot prefetch", "track", track.URI, "file", libraryTrack.path, "error", err)
+		return
+	}
+	local.commands <- &command{prefetch: decoder, track: track}
+}
+
+func (local *Local) handOver(track *sconsify.Track) {
+	local.mutex.Lock()
+	defer local.mutex.Unlock()
+	local.handedOver = track
+}
+
+func (local *Local) takeHandedOver() *sconsify.Track {
+	local.mutex.Lock()
+	defer local.mutex.Unlock()
+	track := local.handedOver
+	local.handedOver = nil
+	return track
+}
+
+func (local *Local) SetVolume(volume sconsify.Volume) {
+	local.audio.SetVolume(volume)
+}
+
+func (local *Local) SetEqualizer(equalizer sconsify.Equalizer) {
+	local.audio.SetEqualizer(equalizer)
+}
+
+func (local *Local) Search(query string) {
+	playlists := sconsify.InitPlaylists()
+	name := " " + query
+	playlist := sconsify.InitSearchPlaylist(name, name, func(playlist *sconsify.Playlist) {
+		for _, track := range local.library.search(query) {
+			playlist.AddTrack(track)
+		}
+	})
+	playlist.ExecuteLoad()
+	playlists.AddPlaylist(playlist)
+
+	local.publisher.NewPlaylist(playlists)
+}
+
+func (local *Local) ArtistAlbums(artist *sconsify.Artist) {
+	folder := sconsify.InitFolder(artist.URI, "*"+artist.Name, make([]*sconsify.Playlist, 0))
+	for _, album := range artist.Albums {
+		tracks := make([]*sconsify.Track, 0)
+		for _, libraryTrack := range local.library.tracks {
+			if libraryTrack.track.Album == album {
+				tracks = append(tracks, libraryTrack.track)
+			}
+		}
+		folder.AddPlaylist(sconsify.InitSubPlaylist(album.URI, album.Name, tracks))
+	}
+	folder.LoadFolderTracks()
+	local.publisher.ArtistAlbums(folder)
+}
+
+func (local *Local) Shutdown() {
+	local.commands <- &command{stop: true}
+}
+
+// stream decodes the current track and writes its frames to the audio consumer
+// until the track ends, then it continues with the prefetched track, if any, and
+// asks for the next track. With crossfade the prefetched track is decoded and
+// written along with the end of the current one.
+func (local *Local) stream() {
+	var current, next decoder
+	var nextTrack *sconsify.Track
+	var decoded, nextDecoded time.Duration
+	playing := false
+	fading := false
+
+	stopFading := func() {
+		if fading {
+			local.audio.DropNext()
+			if err := next.seek(0); err != nil {
+				infrastructure.Debugf("Cannot rewind: %v", err)
+			}
+			nextDecoded = 0
+			fading = false
+		}
+	}
+
+	for {
+		var request *command
+		if playing {
+			select {
+			case request = <-local.commands:
+			default:
+			}
+		} else {
+			request = <-local.commands
+		}
+
+		if request != nil {
+			switch {
+			case request.load != nil:
+				stopFading()
+				if current != nil {
+					current.close()
+				}
+				if next != nil {
+					next.close()
+					next = nil
+				}
+				current = request.load
+				decoded = 0
+				local.markTrack(request.track)
+				local.audio.MarkPosition(0, current.duration())
+				playing = true
+			case request.prefetch != nil:
+				stopFading()
+				if next != nil {
+					next.close()
+				}
+				next, nextTrack = request.prefetch, request.track
+				local.markNextTrack(nextTrack)
+			case request.pause:
+				playing = false
+			case request.resume:
+				playing = current != nil
+			case request.stop:
+				if current != nil {
+					current.close()
+				}
+				if next != nil {
+					next.close()
+				}
+				return
+			default:
+				if current != nil {
+					stopFading()
+					position := local.audio.Position() + request.seek
+					if position < 0 {
+						position = 0
+					} else if position > current.duration() {
+						position = current.duration()
+					}
+					if err := current.seek(position); err != nil {
+						infrastructure.Debugf("Cannot seek: %v", err)
+					}
+					decoded = position
+					local.audio.MarkPosition(position, current.duration())
+				}
+			}
+			continue
+		}
+
+		n, err := local.decode(current, local.audio.WriteAudio)
+		decoded += n
+
+		// the tracks are only mixed when they play at the same sample rate and
+		// channels, otherwise the next one starts after the current one
+		if !fading && next != nil && local.crossfade > 0 && current.duration()-decoded <= local.crossfade &&
+			current.format() == next.format() {
+			fading = true
+		}
+		if fading {
+			n, _ := local.decode(next, local.audio.WriteNextAudio)
+			nextDecoded += n
+		}
+
+		if err != nil {
+			if err != io.EOF {
+				infrastructure.Warn("Cannot decode", "error", err)
+			}
+			current.close()
+			current = nil
+			playing = false
+			if next != nil {
+				current, next = next, nil
+				if fading {
+					local.audio.SwitchToNext(current.duration())
+					decoded = nextDecoded
+				} else {
+					local.markTrack(nextTrack)
+					local.audio.MarkPosition(0, current.duration())
+					decoded = 0
+				}
+				nextDecoded = 0
+				fading = false
+				local.handOver(nextTrack)
+				playing = true
+			}
+			go local.publisher.NextPlay()
+		}
+	}
+}
+
+func (local *Local) markTrack(track *sconsify.Track) {
+	local.audio.MarkTrack(track.URI, track.Album.URI)
+}
+
+func (local *Local) markNextTrack(track *sconsify.Track) {
+	local.audio.MarkNextTrack(track.URI, track.Album.URI)
+}
+
+// decode reads the next frames of the track and hands them over to the audio
+// consumer with write, returning how long they play.
+func (local *Local) decode(track decoder, write func(sp.AudioFormat, []byte) int) (time.Duration, error) {
+	format := track.format()
+	frames := make([]byte, bufferSize(format))
+	n, err := track.read(frames)
+	if n == 0 {
+		return 0, err
+	}
+	// the consumer accepts either all or none of the frames, waiting while its
+	// buffer is full
+	for write(format, frames[:n]) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return durationOf(int64(n/2/format.Channels), format.SampleRate), err
+}
@@ -0,0 +1,488 @@
+package mpd
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/schaeferpp/sconsify/sconsify"
+)
+
+// command answers a command of a client, writing its fields only when it succeeds.
+type command func(session *session, args []string) error
+
+var commands map[string]command
+
+func init() {
+	// initialised here as the commands command lists them
+	commands = map[string]command{
+		"ping":             func(session *session, args []string) error { return nil },
+		"password":         password,
+		"commands":         listCommands,
+		"status":           status,
+		"currentsong":      currentSong,
+		"play":             play,
+		"playid":           playId,
+		"pause":            pause,
+		"stop":             stop,
+		"next":             next,
+		"previous":         previous,
+		"setvol":           setVolume,
+		"playlistinfo":     playlistInfo,
+		"add":              add,
+		"delete":           deleteTrack,
+		"deleteid":         deleteId,
+		"clear":            clear,
+		"listplaylists":    listPlaylists,
+		"listplaylistinfo": listPlaylistInfo,
+		"load":             load,
+		"search":           search,
+	}
+}
+
+var errNoQueue = errors.New("There is no queue without the console user interface")
+
+func password(session *session, args []string) error {
+	if len(args) != 1 {
+		return argError("wrong number of arguments for \"password\"")
+	}
+	if subtle.ConstantTimeCompare([]byte(args[0]), []byte(session.server.password)) != 1 {
+		return &ackError{code: ackErrorPassword, message: "incorrect password"}
+	}
+	session.authorised = true
+	return nil
+}
+
+func listCommands(session *session, args []string) error {
+	names := make([]string, 0, len(commands)+3)
+	for name := range commands {
+		names = append(names, name)
+	}
+	names = append(names, "close", "idle", "noidle")
+	sort.Strings(names)
+	for _, name := range names {
+		session.field("command", name)
+	}
+	return nil
+}
+
+func status(session *session, args []string) error {
+	publisher := session.server.publisher
+	result, err := publisher.Control(func(playlists *sconsify.Playlists, queue sconsify.TrackQueue) (interface{}, error) {
+		random, length := 0, 0
+		if mode := playlists.Mode(); mode == sconsify.ShuffleMode || mode == sconsify.ShuffleAllMode {
+			random = 1
+		}
+		if queue != nil {
+			length = len(queue.Contents())
+		}
+		return []int{random, length}, nil
+	})
+	// the status is answered even before the playlists are loaded
+	random, length := 0, 0
+	if err == nil {
+		random, length = result.([]int)[0], result.([]int)[1]
+	}
+
+	volume := publisher.CurrentVolume()
+	if volume.Muted {
+		session.field("volume", 0)
+	} else {
+		session.field("volume", volume.Level)
+	}
+	session.field("repeat", 0)
+	session.field("random", random)
+	session.field("single", 0)
+	// the tracks of the queue are removed when they play
+	session.field("consume", 1)
+	session.field("playlist", session.server.queueVersion())
+	session.field("playlistlength", length)
+
+	track, paused := publisher.CurrentTrack()
+	if track == nil {
+		session.field("state", "stop")
+		return nil
+	}
+	if paused {
+		session.field("state", "pause")
+	} else {
+		session.field("state", "play")
+	}
+	position := publisher.CurrentPosition()
+	session.field("time", fmt.Sprintf("%v:%v", int(position.Elapsed.Seconds()), int(position.Total.Seconds())))
+	session.field("elapsed", fmt.Sprintf("%.3f", position.Elapsed.Seconds()))
+	session.field("duration", fmt.Sprintf("%.3f", position.Total.Seconds()))
+	return nil
+}
+
+func currentSong(session *session, args []string) error {
+	if track, _ := session.server.publisher.CurrentTrack(); track != nil {
+		session.song(track, -1)
+	}
+	return nil
+}
+
+// play resumes, or plays the track at a position of the queue, removing it from
+// the queue as the user interface does.
+func play(session *session, args []string) error {
+	if len(args) == 0 {
+		return resume(session)
+	}
+	position, err := strconv.Atoi(args[0])
+	if err != nil {
+		return argError("Integer expected: %v", args[0])
+	}
+	return playQueued(session, position)
+}
+
+// playId plays a track of the queue by its id, which is its position plus one.
+func playId(session *session, args []string) error {
+	if len(args) == 0 {
+		return resume(session)
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return argError("Integer expected: %v", args[0])
+	}
+	return playQueued(session, id-1)
+}
+
+func resume(session *session) error {
+	publisher := session.server.publisher
+	if track, paused := publisher.CurrentTrack(); track == nil {
+		publisher.NextPlay()
+	} else if paused {
+		publisher.PlayPauseToggle()
+	}
+	return nil
+}
+
+func playQueued(session *session, position int) error {
+	track, err := session.removeQueued(position)
+	if err != nil {
+		return err
+	}
+	session.server.publisher.Play(track)
+	return nil
+}
+
+func pause(session *session, args []string) error {
+	publisher := session.server.publisher
+	track, paused := publisher.CurrentTrack()
+	if track == nil {
+		return nil
+	}
+	if len(args) == 0 || (args[0] == "1") != paused {
+		publisher.PlayPauseToggle()
+	}
+	return nil
+}
+
+// stop pauses, as the track playing cannot be unloaded.
+func stop(session *session, args []string) error {
+	return pause(session, []string{"1"})
+}
+
+func next(session *session, args []string) error {
+	session.server.publisher.NextPlay()
+	return nil
+}
+
+// previous plays the track playing again, sconsify not keeping the tracks played.
+func previous(session *session, args []string) error {
+	session.server.publisher.Replay()
+	return nil
+}
+
+func setVolume(session *session, args []string) error {
+	if len(args) != 1 {
+		return argError("wrong number of arguments for \"setvol\"")
+	}
+	level, err := strconv.Atoi(args[0])
+	if err != nil || level < 0 || level > 100 {
+		return argError("Invalid volume value: %v", args[0])
+	}
+	session.server.publisher.SetVolume(level)
+	return nil
+}
+
+func playlistInfo(session *session, args []string) error {
+	result, err := session.control(func(playlists *sconsify.Playlists, queue sconsify.TrackQueue) (interface{}, error) {
+		if queue == nil {
+			return []*sconsify.Track{}, nil
+		}
+		return append([]*sconsify.Track(nil), queue.Contents()...), nil
+	})
+	if err != nil {
+		return err
+	}
+	tracks := result.([]*sconsify.Track)
+	if len(args) > 0 {
+		position, err := strconv.Atoi(args[0])
+		if err != nil {
+			return argError("Integer expected: %v", args[0])
+		}
+		if position < 0 || position >= len(tracks) {
+			return argError("Bad song index")
+		}
+		session.song(tracks[position], position)
+		return nil
+	}
+	for i, track := range tracks {
+		session.song(track, i)
+	}
+	return nil
+}
+
+// add queues a track, or every track of a playlist, by its URI or name.
+func add(session *session, args []string) error {
+	if len(args) != 1 {
+		return argError("wrong number of arguments for \"add\"")
+	}
+	return session.queueTracks(args[0])
+}
+
+// load queues the tracks of a playlist, as MPD loads a playlist in its queue.
+func load(session *session, args []string) error {
+	if len(args) == 0 {
+		return argError("wrong number of arguments for \"load\"")
+	}
+	return session.queueTracks(args[0])
+}
+
+func deleteTrack(session *session, args []string) error {
+	if len(args) != 1 {
+		return argError("wrong number of arguments for \"delete\"")
+	}
+	position, err := strconv.Atoi(args[0])
+	if err != nil {
+		return argError("Integer expected: %v", args[0])
+	}
+	_, err = session.removeQueued(position)
+	return err
+}
+
+func deleteId(session *session, args []string) error {
+	if len(args) != 1 {
+		return argError("wrong number of arguments for \"deleteid\"")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return argError("Integer expected: %v", args[0])
+	}
+	_, err = session.removeQueued(id - 1)
+	return err
+}
+
+func clear(session *session, args []string) error {
+	_, err := session.control(func(playlists *sconsify.Playlists, queue sconsify.TrackQueue) (interface{}, error) {
+		if queue == nil {
+			return nil, errNoQueue
+		}
+		queue.RemoveAll()
+		return nil, nil
+	})
+	if err == nil {
+		session.server.changed("playlist")
+	}
+	return err
+}
+
+func listPlaylists(session *session, args []string) error {
+	result, err := session.control(func(playlists *sconsify.Playlists, queue sconsify.TrackQueue) (interface{}, error) {
+		names := make([]string, 0)
+		for _, playlist := range allPlaylists(playlists) {
+			names = append(names, playlist.OriginalName())
+		}
+		return names, nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range result.([]string) {
+		session.field("playlist", name)
+	}
+	return nil
+}
+
+func listPlaylistInfo(session *session, args []string) error {
+	if len(args) != 1 {
+		return argError("wrong number of arguments for \"listplaylistinfo\"")
+	}
+	result, err := session.control(func(playlists *sconsify.Playlists, queue sconsify.TrackQueue) (interface{}, error) {
+		playlist := playlists.FindPlaylist(args[0])
+		if playlist == nil {
+			return nil, noExistError("No such playlist")
+		}
+		return playlistTracks(playlist), nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, track := range result.([]*sconsify.Track) {
+		session.song(track, -1)
+	}
+	return nil
+}
+
+// search finds the tracks of the playlists loaded, e.g. search artist "bob" title
+// "vain", the tags being any, artist, title or file, the URI.
+func search(session *session, args []string) error {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return argError("incorrect arguments")
+	}
+	for i := 0; i < len(args); i += 2 {
+		if tag := strings.ToLower(args[i]); tag != "any" && tag != "artist" && tag != "title" && tag != "file" {
+			return argError("Unknown tag type: %v", args[i])
+		}
+	}
+	result, err := session.control(func(playlists *sconsify.Playlists, queue sconsify.TrackQueue) (interface{}, error) {
+		found := make([]*sconsify.Track, 0)
+		seen := make(map[string]bool)
+		for _, playlist := range allPlaylists(playlists) {
+			for _, track := range playlistTracks(playlist) {
+				if !seen[track.URI] && matches(track, args) {
+					seen[track.URI] = true
+					found = append(found, track)
+				}
+			}
+		}
+		return found, nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, track := range result.([]*sconsify.Track) {
+		session.song(track, -1)
+	}
+	return nil
+}
+
+func matches(track *sconsify.Track, filters []string) bool {
+	artist := ""
+	if track.Artist != nil {
+		artist = strings.ToLower(track.Artist.Name)
+	}
+	title, file := strings.ToLower(track.Name), strings.ToLower(track.URI)
+	for i := 0; i < len(filters); i += 2 {
+		value := strings.ToLower(filters[i+1])
+		var found bool
+		switch strings.ToLower(filters[i]) {
+		case "artist":
+			found = strings.Contains(artist, value)
+		case "title":
+			found = strings.Contains(title, value)
+		case "file":
+			found = strings.Contains(file, value)
+		default:
+			found = strings.Contains(artist, value) || strings.Contains(title, value) || strings.Contains(file, value)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// allPlaylists returns the playlists by name, the playlists of a folder instead
+// of the folder.
+func allPlaylists(playlists *sconsify.Playlists) []*sconsify.Playlist {
+	names := playlists.Names()
+	sort.Strings(names)
+	all := make([]*sconsify.Playlist, 0, len(names))
+	for _, name := range names {
+		playlist := playlists.Get(name)
+		if !playlist.IsFolder() {
+			all = append(all, playlist)
+			continue
+		}
+		for i := 0; i < playlist.Playlists(); i++ {
+			all = append(all, playlist.Playlist(i))
+		}
+	}
+	return all
+}
+
+func playlistTracks(playlist *sconsify.Playlist) []*sconsify.Track {
+	tracks := make([]*sconsify.Track, playlist.Tracks())
+	for i := range tracks {
+		tracks[i] = playlist.Track(i)
+	}
+	return tracks
+}
+
+// control runs a request in the user interface, see sconsify.Publisher.Control.
+func (session *session) control(run func(playlists *sconsify.Playlists, queue sconsify.TrackQueue) (interface{}, error)) (interface{}, error) {
+	return session.server.publisher.Control(run)
+}
+
+// queueTracks queues a track or the tracks of a playlist, the clients being told
+// of the tracks queued before the queue is full too.
+func (session *session) queueTracks(key string) error {
+	added, err := session.control(func(playlists *sconsify.Playlists, queue sconsify.TrackQueue) (interface{}, error) {
+		if queue == nil {
+			return nil, errNoQueue
+		}
+		var tracks []*sconsify.Track
+		if playlist, index := playlists.FindTrack(key); playlist != nil {
+			tracks = []*sconsify.Track{playlist.Track(index)}
+		} else if playlist := playlists.FindPlaylist(key); playlist != nil {
+			tracks = playlistTracks(playlist)
+		} else {
+			return nil, noExistError("No such song or playlist: %v", key)
+		}
+		for i, track := range tracks {
+			if queue.Add(track) == nil {
+				return i, &ackError{code: ackErrorPlaylistMax, message: "The queue is full"}
+			}
+		}
+		return len(tracks), nil
+	})
+	if added, _ := added.(int); added > 0 {
+		session.server.changed("playlist")
+	}
+	return err
+}
+
+func (session *session) removeQueued(position int) (*sconsify.Track, error) {
+	result, err := session.control(func(playlists *sconsify.Playlists, queue sconsify.TrackQueue) (interface{}, error) {
+		if queue == nil {
+			return nil, errNoQueue
+		}
+		track := queue.Remove(position)
+		if track == nil {
+			return nil, argError("Bad song index")
+		}
+		return track, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	session.server.changed("playlist")
+	return result.(*sconsify.Track), nil
+}
+
+func (session *session) field(key string, value interface{}) {
+	fmt.Fprintf(session.out, "%v: %v\n", key, value)
+}
+
+// song writes a track, its position and id when it is in the queue.
+func (session *session) song(track *sconsify.Track, position int) {
+	session.field("file", track.URI)
+	if track.Artist != nil {
+		session.field("Artist", track.Artist.Name)
+	}
+	session.field("Title", track.Name)
+	if duration, err := time.ParseDuration(track.Duration); err == nil {
+		session.field("Time", int(duration.Seconds()))
+		session.field("duration", fmt.Sprintf("%.3f", duration.Seconds()))
+	}
+	if position >= 0 {
+		session.field("Pos", position)
+		session.field("Id", position+1)
+	}
+}
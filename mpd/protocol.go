@@ -0,0 +1,90 @@
+package mpd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// protocolVersion is the version of the MPD protocol answered to the clients, the
+// commands being a subset of it.
+const protocolVersion = "0.19.0"
+
+// the error codes of an ACK
+const (
+	ackErrorArg         = 2
+	ackErrorPassword    = 3
+	ackErrorPermission  = 4
+	ackErrorUnknown     = 5
+	ackErrorNoExist     = 50
+	ackErrorPlaylistMax = 51
+	ackErrorSystem      = 52
+)
+
+// ackError is an error answered to the client with its code, any other error is
+// answered as a system error.
+type ackError struct {
+	code    int
+	message string
+}
+
+func (err *ackError) Error() string {
+	return err.message
+}
+
+func argError(format string, v ...interface{}) error {
+	return &ackError{code: ackErrorArg, message: fmt.Sprintf(format, v...)}
+}
+
+func noExistError(format string, v ...interface{}) error {
+	return &ackError{code: ackErrorNoExist, message: fmt.Sprintf(format, v...)}
+}
+
+// formatAck formats an error as "ACK [code@index] {command} message", index being
+// the position of the command in a command list.
+func formatAck(err error, index int, command string) string {
+	code := ackErrorSystem
+	if ack, isAck := err.(*ackError); isAck {
+		code = ack.code
+	}
+	return fmt.Sprintf("ACK [%v@%v] {%v} %v\n", code, index, command, err.Error())
+}
+
+// splitArgs splits a command line in its command and arguments, an argument with
+// spaces being between double quotes, where \" and \\ are escaped.
+func splitArgs(line string) ([]string, error) {
+	args := make([]string, 0)
+	for i := 0; i < len(line); {
+		if line[i] == ' ' || line[i] == '\t' {
+			i++
+			continue
+		}
+		if line[i] != '"' {
+			end := strings.IndexAny(line[i:], " \t")
+			if end == -1 {
+				end = len(line) - i
+			}
+			args = append(args, line[i:i+end])
+			i += end
+			continue
+		}
+
+		var arg []byte
+		closed := false
+		for i++; i < len(line); i++ {
+			if line[i] == '\\' && i+1 < len(line) {
+				i++
+			} else if line[i] == '"' {
+				closed = true
+				i++
+				break
+			}
+			arg = append(arg, line[i])
+		}
+		if !closed {
+			return nil, errors.New("Missing closing '\"'")
+		}
+		args = append(args, string(arg))
+	}
+	return args, nil
+}
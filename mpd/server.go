@@ -0,0 +1,309 @@
+package mpd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/schaeferpp/sconsify/infrastructure"
+	"github.com/schaeferpp/sconsify/sconsify"
+)
+
+type ServerConf struct {
+	// Address is where the MPD clients connect, e.g. localhost:6600
+	Address string
+	// Password is asked to the clients, it is needed to listen beyond localhost
+	Password string
+}
+
+// Server answers the MPD clients, e.g. mpc or ncmpcpp. The current playlist of
+// MPD is the queue of the user interface, tracks being removed from it when they
+// play, and the playlists of MPD are the playlists of sconsify.
+type Server struct {
+	publisher *sconsify.Publisher
+	password  string
+
+	mutex   sync.Mutex
+	clients map[*client]bool
+	// version of the queue, increased whenever it changes
+	version int
+}
+
+// client is a connected client, with the subsystems changed since its last idle.
+type client struct {
+	mutex   sync.Mutex
+	changed map[string]bool
+	wake    chan struct{}
+}
+
+func StartServer(publisher *sconsify.Publisher, conf *ServerConf) error {
+	address, err := checkAddress(conf.Address, conf.Password)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("Cannot start the MPD server: %v", err)
+	}
+	server := newServer(publisher, conf.Password)
+	events := publisher.Subscribe(sconsify.Subscription{
+		Topics: []sconsify.Topic{sconsify.TopicTrackPlaying, sconsify.TopicTrackPaused, sconsify.TopicVolumeChanged, sconsify.TopicPlaylists, sconsify.TopicQueueChanged, sconsify.TopicShutdownEngine},
+		Buffer: 4,
+		Policy: sconsify.DropOldest,
+	})
+	go server.watch(events, listener)
+	go server.accept(listener)
+	return nil
+}
+
+// checkAddress returns where to listen, a port alone meaning localhost. Listening
+// beyond localhost needs a password.
+func checkAddress(address string, password string) (string, error) {
+	if !strings.Contains(address, ":") {
+		address = ":" + address
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", err
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) && password == "" {
+		return "", errors.New("The MPD server needs a password, -mpd-password, to listen beyond localhost")
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+func newServer(publisher *sconsify.Publisher, password string) *Server {
+	return &Server{publisher: publisher, password: password, clients: make(map[*client]bool)}
+}
+
+// watch tells the clients what the events changed until the engine shuts down.
+func (server *Server) watch(events *sconsify.Events, listener net.Listener) {
+	defer server.publisher.Unsubscribe(events)
+	for {
+		select {
+		case <-events.TrackPlayingUpdates():
+			server.changed("player")
+		case <-events.TrackPausedUpdates():
+			server.changed("player")
+		case <-events.VolumeChangedUpdates():
+			server.changed("mixer")
+		case <-events.PlaylistsUpdates():
+			server.changed("stored_playlist")
+		case <-events.QueueChangedUpdates():
+			server.changed("playlist")
+		case <-events.ShutdownEngineUpdates():
+			listener.Close()
+			return
+		}
+	}
+}
+
+func (server *Server) accept(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			infrastructure.Debug("The MPD server stopped accepting connections", "error", err)
+			return
+		}
+		go server.serve(conn)
+	}
+}
+
+func (server *Server) changed(subsystem string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if subsystem == "playlist" {
+		server.version++
+	}
+	for client := range server.clients {
+		client.mutex.Lock()
+		client.changed[subsystem] = true
+		client.mutex.Unlock()
+		select {
+		case client.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (server *Server) queueVersion() int {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.version
+}
+
+// take removes and returns the subsystems changed among the ones asked, every
+// subsystem when none is asked.
+func (client *client) take(subsystems []string) []string {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	taken := make([]string, 0)
+	for subsystem := range client.changed {
+		if len(subsystems) == 0 || contains(subsystems, subsystem) {
+			taken = append(taken, subsystem)
+			delete(client.changed, subsystem)
+		}
+	}
+	sort.Strings(taken)
+	return taken
+}
+
+// session is the connection of a client.
+type session struct {
+	server     *Server
+	client     *client
+	authorised bool
+	out        *bufio.Writer
+}
+
+func (server *Server) serve(conn io.ReadWriteCloser) {
+	defer conn.Close()
+	client := &client{changed: make(map[string]bool), wake: make(chan struct{}, 1)}
+	server.mutex.Lock()
+	server.clients[client] = true
+	server.mutex.Unlock()
+	defer func() {
+		server.mutex.Lock()
+		delete(server.clients, client)
+		server.mutex.Unlock()
+	}()
+
+	session := &session{server: server, client: client, authorised: server.password == "", out: bufio.NewWriter(conn)}
+	fmt.Fprintf(session.out, "OK MPD %v\n", protocolVersion)
+	session.out.Flush()
+
+	lines := make(chan string)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for line := range lines {
+		if !session.handle(line, lines) {
+			return
+		}
+		session.out.Flush()
+	}
+}
+
+// handle answers a line, reading the next lines of a command list or of an idle,
+// and returns false when the connection must be closed.
+func (session *session) handle(line string, lines <-chan string) bool {
+	switch strings.TrimSpace(line) {
+	case "close":
+		return false
+	case "noidle":
+		// the client was not idle
+		session.out.WriteString("OK\n")
+		return true
+	case "command_list_begin", "command_list_ok_begin":
+		listOk := strings.TrimSpace(line) == "command_list_ok_begin"
+		list := make([]string, 0)
+		for line := range lines {
+			if strings.TrimSpace(line) == "command_list_end" {
+				session.runList(list, listOk)
+				return true
+			}
+			list = append(list, line)
+		}
+		return false
+	}
+
+	args, err := splitArgs(line)
+	if err != nil {
+		session.out.WriteString(formatAck(&ackError{code: ackErrorArg, message: err.Error()}, 0, ""))
+		return true
+	}
+	if len(args) > 0 && args[0] == "idle" {
+		return session.idle(args[1:], lines)
+	}
+	session.runList([]string{line}, false)
+	return true
+}
+
+func (session *session) runList(list []string, listOk bool) {
+	for i, line := range list {
+		args, err := splitArgs(line)
+		if err != nil {
+			session.out.WriteString(formatAck(&ackError{code: ackErrorArg, message: err.Error()}, i, ""))
+			return
+		}
+		if len(args) == 0 {
+			session.out.WriteString(formatAck(&ackError{code: ackErrorUnknown, message: "No command given"}, i, ""))
+			return
+		}
+		if err := session.run(args[0], args[1:]); err != nil {
+			session.out.WriteString(formatAck(err, i, args[0]))
+			return
+		}
+		if listOk {
+			session.out.WriteString("list_OK\n")
+		}
+	}
+	session.out.WriteString("OK\n")
+}
+
+func (session *session) run(name string, args []string) error {
+	command, found := commands[name]
+	if !found {
+		return &ackError{code: ackErrorUnknown, message: fmt.Sprintf("unknown command \"%v\"", name)}
+	}
+	if !session.authorised && name != "password" && name != "ping" {
+		return &ackError{code: ackErrorPermission, message: fmt.Sprintf("you don't have permission for \"%v\"", name)}
+	}
+	return command(session, args)
+}
+
+// idle waits for a subsystem to change, answering the changes the client has not
+// seen yet at once, until the client sends noidle.
+func (session *session) idle(subsystems []string, lines <-chan string) bool {
+	if !session.authorised {
+		session.out.WriteString(formatAck(&ackError{code: ackErrorPermission, message: "you don't have permission for \"idle\""}, 0, "idle"))
+		return true
+	}
+	for {
+		if changed := session.client.take(subsystems); len(changed) > 0 {
+			for _, subsystem := range changed {
+				fmt.Fprintf(session.out, "changed: %v\n", subsystem)
+			}
+			session.out.WriteString("OK\n")
+			return true
+		}
+		select {
+		case <-session.client.wake:
+		case line, open := <-lines:
+			if !open || strings.TrimSpace(line) != "noidle" {
+				// only noidle is allowed while idle
+				return false
+			}
+			session.out.WriteString("OK\n")
+			return true
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
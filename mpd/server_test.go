@@ -0,0 +1,227 @@
+package mpd
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schaeferpp/sconsify/sconsify"
+	"github.com/schaeferpp/sconsify/ui"
+)
+
+type testClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// startTestServer connects a client to a server whose user interface has a
+// playlist and an empty queue, returning the events the backend would receive.
+func startTestServer(t *testing.T, password string) (*testClient, *sconsify.Publisher, *sconsify.Events) {
+	publisher := &sconsify.Publisher{}
+	backendEvents := publisher.Subscribe(sconsify.Subscription{Topics: []sconsify.Topic{sconsify.TopicPlay, sconsify.TopicPlayPauseToggle}, Buffer: 2})
+	uiEvents := publisher.Subscribe(sconsify.Subscription{Topics: []sconsify.Topic{sconsify.TopicControl}})
+
+	artist := sconsify.InitArtist("artist0", "Bob Marley")
+	playlists := sconsify.InitPlaylists()
+	playlists.AddPlaylist(sconsify.InitPlaylist("playlist0", "Bob Marley", []*sconsify.Track{
+		sconsify.InitTrack("track0", artist, "Waiting in vain", "4m16s"),
+		sconsify.InitTrack("track1", artist, "Stir it up", "5m32s"),
+	}))
+	queue := ui.InitQueue()
+	go func() {
+		for request := range uiEvents.ControlUpdates() {
+			request.Run(playlists, queue)
+		}
+	}()
+
+	server := newServer(publisher, password)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := publisher.Subscribe(sconsify.Subscription{Topics: []sconsify.Topic{sconsify.TopicTrackPlaying, sconsify.TopicTrackPaused, sconsify.TopicVolumeChanged, sconsify.TopicPlaylists, sconsify.TopicQueueChanged, sconsify.TopicShutdownEngine}, Buffer: 4})
+	go server.watch(events, listener)
+	go server.accept(listener)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &testClient{conn: conn, reader: bufio.NewReader(conn)}
+	if greeting := client.line(t); greeting != "OK MPD "+protocolVersion {
+		t.Fatalf("Wrong greeting %q", greeting)
+	}
+	return client, publisher, backendEvents
+}
+
+func (client *testClient) line(t *testing.T) string {
+	client.conn.SetReadDeadline(time.Now().Add(time.Second))
+	line, err := client.reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("No answer: %v", err)
+	}
+	return strings.TrimSuffix(line, "\n")
+}
+
+// send sends the lines and returns the answer until OK or ACK.
+func (client *testClient) send(t *testing.T, lines ...string) []string {
+	fmt.Fprint(client.conn, strings.Join(lines, "\n")+"\n")
+	answer := make([]string, 0)
+	for {
+		line := client.line(t)
+		answer = append(answer, line)
+		if line == "OK" || strings.HasPrefix(line, "ACK ") {
+			return answer
+		}
+	}
+}
+
+func TestQueueAndPlay(t *testing.T) {
+	client, _, backendEvents := startTestServer(t, "")
+	defer client.conn.Close()
+
+	client.send(t, `add "Bob Marley"`)
+	answer := client.send(t, "playlistinfo")
+	expected := []string{
+		"file: track0", "Artist: Bob Marley", "Title: Waiting in vain", "Time: 256", "duration: 256.000", "Pos: 0", "Id: 1",
+		"file: track1", "Artist: Bob Marley", "Title: Stir it up", "Time: 332", "duration: 332.000", "Pos: 1", "Id: 2",
+		"OK",
+	}
+	if !reflect.DeepEqual(answer, expected) {
+		t.Errorf("Wrong playlist info %q", answer)
+	}
+
+	client.send(t, "play 1")
+	if track := <-backendEvents.PlayUpdates(); track.URI != "track1" {
+		t.Errorf("Track1 should be played but is %v", track.URI)
+	}
+	if answer := client.send(t, "status"); !contains(answer, "playlistlength: 1") || !contains(answer, "state: stop") {
+		t.Errorf("Played track should leave the queue: %q", answer)
+	}
+
+	if answer := client.send(t, "play 5"); answer[0] != "ACK [2@0] {play} Bad song index" {
+		t.Errorf("Wrong position should fail: %q", answer)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	client, _, _ := startTestServer(t, "")
+	defer client.conn.Close()
+
+	if answer := client.send(t, `search artist marley title "STIR IT"`); answer[0] != "file: track1" || len(answer) != 6 {
+		t.Errorf("Only track1 should be found: %q", answer)
+	}
+	if answer := client.send(t, "search album x"); !strings.HasPrefix(answer[0], "ACK [2@0] {search}") {
+		t.Errorf("Unknown tag should fail: %q", answer)
+	}
+}
+
+func TestCommandList(t *testing.T) {
+	client, _, _ := startTestServer(t, "")
+	defer client.conn.Close()
+
+	answer := client.send(t, "command_list_ok_begin", "add track0", "listplaylists", "command_list_end")
+	if !reflect.DeepEqual(answer, []string{"list_OK", "playlist: Bob Marley", "list_OK", "OK"}) {
+		t.Errorf("Wrong command list answer %q", answer)
+	}
+
+	answer = client.send(t, "command_list_begin", "clear", "rewind", "ping", "command_list_end")
+	if !reflect.DeepEqual(answer, []string{`ACK [5@1] {rewind} unknown command "rewind"`}) {
+		t.Errorf("Command list should stop at the unknown command: %q", answer)
+	}
+}
+
+func TestIdle(t *testing.T) {
+	client, publisher, _ := startTestServer(t, "")
+	defer client.conn.Close()
+
+	fmt.Fprintln(client.conn, "idle player")
+	time.Sleep(50 * time.Millisecond)
+	publisher.TrackPlaying(sconsify.InitTrack("track0", sconsify.InitArtist("artist0", "Bob Marley"), "Waiting in vain", "4m16s"))
+	if changed, ok := client.line(t), client.line(t); changed != "changed: player" || ok != "OK" {
+		t.Errorf("Idle should answer the change: %q %q", changed, ok)
+	}
+	if answer := client.send(t, "currentsong"); answer[0] != "file: track0" {
+		t.Errorf("Current song should be the track playing: %q", answer)
+	}
+
+	fmt.Fprintln(client.conn, "idle")
+	if answer := client.send(t, "noidle"); !reflect.DeepEqual(answer, []string{"OK"}) {
+		t.Errorf("Noidle should end idle: %q", answer)
+	}
+}
+
+func TestQueueChangesOutsideTheServer(t *testing.T) {
+	client, publisher, _ := startTestServer(t, "")
+	defer client.conn.Close()
+
+	fmt.Fprintln(client.conn, "idle playlist")
+	time.Sleep(50 * time.Millisecond)
+	publisher.QueueChanged()
+	if changed, ok := client.line(t), client.line(t); changed != "changed: playlist" || ok != "OK" {
+		t.Errorf("Idle should answer the change of the queue: %q %q", changed, ok)
+	}
+	if answer := client.send(t, "status"); !contains(answer, "playlist: 1") {
+		t.Errorf("Queue version should be increased: %q", answer)
+	}
+}
+
+func TestQueueFilledByAPlaylist(t *testing.T) {
+	client, publisher, _ := startTestServer(t, "")
+	defer client.conn.Close()
+
+	publisher.Control(func(playlists *sconsify.Playlists, queue sconsify.TrackQueue) (interface{}, error) {
+		for i := 1; i < ui.QUEUE_MAX_ELEMENTS; i++ {
+			queue.Add(playlists.Get("Bob Marley").Track(0))
+		}
+		return nil, nil
+	})
+	if answer := client.send(t, `load "Bob Marley"`); answer[0] != "ACK [51@0] {load} The queue is full" {
+		t.Errorf("Loading past the end of the queue should fail: %q", answer)
+	}
+	if answer := client.send(t, "status"); !contains(answer, "playlist: 1") || !contains(answer, "playlistlength: 100") {
+		t.Errorf("Queue version should be increased by the track queued: %q", answer)
+	}
+}
+
+func TestPassword(t *testing.T) {
+	client, _, _ := startTestServer(t, "secret")
+	defer client.conn.Close()
+
+	if answer := client.send(t, "status"); !strings.HasPrefix(answer[0], "ACK [4@0] {status}") {
+		t.Errorf("Status should need the password: %q", answer)
+	}
+	if answer := client.send(t, "password guess"); !strings.HasPrefix(answer[0], "ACK [3@0] {password}") {
+		t.Errorf("Wrong password should fail: %q", answer)
+	}
+	client.send(t, "password secret")
+	if answer := client.send(t, "status"); answer[len(answer)-1] != "OK" {
+		t.Errorf("Status should be answered after the password: %q", answer)
+	}
+}
+
+func TestCheckAddress(t *testing.T) {
+	if address, err := checkAddress("6600", ""); err != nil || address != "localhost:6600" {
+		t.Errorf("Port alone should be localhost: %v %v", address, err)
+	}
+	if _, err := checkAddress("0.0.0.0:6600", ""); err == nil {
+		t.Error("Listening beyond localhost should need a password")
+	}
+	if _, err := checkAddress("0.0.0.0:6600", "secret"); err != nil {
+		t.Errorf("Listening beyond localhost with a password should be allowed: %v", err)
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	args, err := splitArgs(`search artist "Bob \"The\" Marley" title vain`)
+	if err != nil || !reflect.DeepEqual(args, []string{"search", "artist", `Bob "The" Marley`, "title", "vain"}) {
+		t.Errorf("Wrong args %q: %v", args, err)
+	}
+	if _, err := splitArgs(`add "unclosed`); err == nil {
+		t.Error("Unclosed quote should fail")
+	}
+}
@@ -0,0 +1,178 @@
+package mpris
+
+import (
+	"time"
+
+	"github.com/godbus/dbus"
+	"github.com/schaeferpp/sconsify/sconsify"
+)
+
+// noTrack is the track id of the metadata when nothing has played yet.
+const noTrack = dbus.ObjectPath("/org/mpris/MediaPlayer2/TrackList/NoTrack")
+
+// MediaPlayer answers the org.mpris.MediaPlayer2 interface, sconsify being
+// neither raised nor quit from the bus.
+type MediaPlayer struct{}
+
+func (mediaPlayer *MediaPlayer) Raise() *dbus.Error {
+	return nil
+}
+
+func (mediaPlayer *MediaPlayer) Quit() *dbus.Error {
+	return nil
+}
+
+func mediaPlayerProperties() map[string]dbus.Variant {
+	return map[string]dbus.Variant{
+		"CanQuit":             dbus.MakeVariant(false),
+		"CanRaise":            dbus.MakeVariant(false),
+		"HasTrackList":        dbus.MakeVariant(false),
+		"Identity":            dbus.MakeVariant("sconsify"),
+		"SupportedUriSchemes": dbus.MakeVariant([]string{}),
+		"SupportedMimeTypes":  dbus.MakeVariant([]string{}),
+	}
+}
+
+// Player answers the org.mpris.MediaPlayer2.Player interface by publishing the
+// same events as the keys of the user interface. Stop pauses, as sconsify does
+// not stop, and Previous plays the current track again.
+type Player struct {
+	publisher *sconsify.Publisher
+	conn      *dbus.Conn
+}
+
+func (player *Player) Next() *dbus.Error {
+	player.publisher.NextPlay()
+	return nil
+}
+
+func (player *Player) Previous() *dbus.Error {
+	player.publisher.Replay()
+	return nil
+}
+
+func (player *Player) Pause() *dbus.Error {
+	player.publisher.Pause()
+	return nil
+}
+
+func (player *Player) PlayPause() *dbus.Error {
+	player.publisher.PlayPauseToggle()
+	return nil
+}
+
+func (player *Player) Stop() *dbus.Error {
+	player.publisher.Pause()
+	return nil
+}
+
+func (player *Player) Play() *dbus.Error {
+	track, paused := player.publisher.CurrentTrack()
+	if track == nil {
+		player.publisher.NextPlay()
+	} else if paused {
+		player.publisher.PlayPauseToggle()
+	}
+	return nil
+}
+
+// SeekOffset answers Seek, moving the position by an offset in microseconds.
+func (player *Player) SeekOffset(offset int64) *dbus.Error {
+	player.publisher.Seek(time.Duration(offset) * time.Microsecond)
+	return nil
+}
+
+// SetPosition moves to a position in microseconds if the track is still the one
+// playing.
+func (player *Player) SetPosition(trackId dbus.ObjectPath, position int64) *dbus.Error {
+	if track, _ := player.publisher.CurrentTrack(); track == nil || toTrackId(track) != trackId {
+		return nil
+	}
+	elapsed := player.publisher.CurrentPosition().Elapsed
+	player.publisher.Seek(time.Duration(position)*time.Microsecond - elapsed)
+	return nil
+}
+
+func (player *Player) OpenUri(uri string) *dbus.Error {
+	return invalidArgs("Opening %v is not supported, play it from the playlists", uri)
+}
+
+// seeked emits Seeked with the position the backend moves to.
+func (player *Player) seeked(offset time.Duration) {
+	position := player.publisher.CurrentPosition()
+	elapsed := position.Elapsed + offset
+	if elapsed < 0 {
+		elapsed = 0
+	} else if position.Total > 0 && elapsed > position.Total {
+		elapsed = position.Total
+	}
+	player.conn.Emit(objectPath, playerInterface+".Seeked", toMicroseconds(elapsed))
+}
+
+func (player *Player) properties() map[string]dbus.Variant {
+	track, paused := player.publisher.CurrentTrack()
+	status := "Playing"
+	if track == nil {
+		status = "Stopped"
+	} else if paused {
+		status = "Paused"
+	}
+	volume := player.publisher.CurrentVolume()
+	level := float64(volume.Level) / sconsify.MaxVolume
+	if volume.Muted {
+		level = 0
+	}
+
+	return map[string]dbus.Variant{
+		"PlaybackStatus": dbus.MakeVariant(status),
+		"Rate":           dbus.MakeVariant(1.0),
+		"Metadata":       dbus.MakeVariant(toMetadata(track)),
+		"Volume":         dbus.MakeVariant(level),
+		"Position":       dbus.MakeVariant(toMicroseconds(player.publisher.CurrentPosition().Elapsed)),
+		"MinimumRate":    dbus.MakeVariant(1.0),
+		"MaximumRate":    dbus.MakeVariant(1.0),
+		"CanGoNext":      dbus.MakeVariant(true),
+		"CanGoPrevious":  dbus.MakeVariant(true),
+		"CanPlay":        dbus.MakeVariant(true),
+		"CanPause":       dbus.MakeVariant(true),
+		"CanSeek":        dbus.MakeVariant(true),
+		"CanControl":     dbus.MakeVariant(true),
+	}
+}
+
+func toMetadata(track *sconsify.Track) map[string]dbus.Variant {
+	if track == nil {
+		return map[string]dbus.Variant{"mpris:trackid": dbus.MakeVariant(noTrack)}
+	}
+	metadata := map[string]dbus.Variant{
+		"mpris:trackid": dbus.MakeVariant(toTrackId(track)),
+		"xesam:title":   dbus.MakeVariant(track.Name),
+		"xesam:url":     dbus.MakeVariant(track.URI),
+	}
+	if track.Artist != nil {
+		metadata["xesam:artist"] = dbus.MakeVariant([]string{track.Artist.Name})
+	}
+	if track.Album != nil {
+		metadata["xesam:album"] = dbus.MakeVariant(track.Album.Name)
+	}
+	if duration, err := time.ParseDuration(track.Duration); err == nil {
+		metadata["mpris:length"] = dbus.MakeVariant(toMicroseconds(duration))
+	}
+	return metadata
+}
+
+// toTrackId turns the URI of a track in an object path, every character other
+// than a letter or a digit becoming an underscore.
+func toTrackId(track *sconsify.Track) dbus.ObjectPath {
+	id := []byte(track.URI)
+	for i, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			id[i] = '_'
+		}
+	}
+	return dbus.ObjectPath("/org/sconsify/track/" + string(id))
+}
+
+func toMicroseconds(duration time.Duration) int64 {
+	return int64(duration / time.Microsecond)
+}
@@ -0,0 +1,243 @@
+package mpris
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/godbus/dbus"
+	"github.com/schaeferpp/sconsify/infrastructure"
+	"github.com/schaeferpp/sconsify/sconsify"
+)
+
+const (
+	busName    = "org.mpris.MediaPlayer2.sconsify"
+	objectPath = dbus.ObjectPath("/org/mpris/MediaPlayer2")
+
+	rootInterface           = "org.mpris.MediaPlayer2"
+	playerInterface         = "org.mpris.MediaPlayer2.Player"
+	propertiesInterface     = "org.freedesktop.DBus.Properties"
+	introspectableInterface = "org.freedesktop.DBus.Introspectable"
+)
+
+// StartServer exposes the player on the session bus as an MPRIS media player, so
+// desktop environments, playerctl and notification daemons can control it.
+func StartServer(publisher *sconsify.Publisher) error {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return fmt.Errorf("Cannot connect to the session bus: %v", err)
+	}
+	if err := export(conn, publisher); err != nil {
+		conn.Close()
+		return err
+	}
+	return nil
+}
+
+// export exports the MPRIS interfaces on a connection, owns the bus name and
+// emits the changes until the engine shuts down, closing the connection.
+func export(conn *dbus.Conn, publisher *sconsify.Publisher) error {
+	player := &Player{publisher: publisher, conn: conn}
+	exports := []struct {
+		object  interface{}
+		mapping map[string]string
+		iface   string
+	}{
+		// Seek would be mistaken for io.Seeker
+		{player, map[string]string{"SeekOffset": "Seek"}, playerInterface},
+		{&MediaPlayer{}, nil, rootInterface},
+		{&Properties{player: player}, nil, propertiesInterface},
+		{introspectable(introspection), nil, introspectableInterface},
+	}
+	for _, export := range exports {
+		if err := conn.ExportWithMap(export.object, export.mapping, objectPath, export.iface); err != nil {
+			return fmt.Errorf("Cannot export %v: %v", export.iface, err)
+		}
+	}
+
+	name, err := requestName(conn)
+	if err != nil {
+		return err
+	}
+	infrastructure.Debug("MPRIS player exported", "name", name)
+
+	events := publisher.Subscribe(sconsify.Subscription{
+		Topics: []sconsify.Topic{sconsify.TopicTrackPlaying, sconsify.TopicTrackPaused, sconsify.TopicVolumeChanged, sconsify.TopicSeek, sconsify.TopicShutdownEngine},
+		Buffer: 4,
+		Policy: sconsify.DropOldest,
+	})
+	go player.watch(events, name)
+	return nil
+}
+
+// requestName owns the bus name of sconsify or, when another sconsify owns it, a
+// name of this instance as the MPRIS specification asks.
+func requestName(conn *dbus.Conn) (string, error) {
+	for _, name := range []string{busName, fmt.Sprintf("%v.instance%v", busName, os.Getpid())} {
+		reply, err := conn.RequestName(name, dbus.NameFlagDoNotQueue)
+		if err != nil {
+			return "", fmt.Errorf("Cannot request the bus name %v: %v", name, err)
+		}
+		if reply == dbus.RequestNameReplyPrimaryOwner {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("The bus name %v is already taken", busName)
+}
+
+// watch tells the clients what the events changed until the engine shuts down.
+func (player *Player) watch(events *sconsify.Events, name string) {
+	defer player.publisher.Unsubscribe(events)
+	for {
+		select {
+		case <-events.TrackPlayingUpdates():
+			player.changed("PlaybackStatus", "Metadata")
+		case <-events.TrackPausedUpdates():
+			player.changed("PlaybackStatus", "Metadata")
+		case <-events.VolumeChangedUpdates():
+			player.changed("Volume")
+		case offset := <-events.SeekUpdates():
+			player.seeked(offset)
+		case <-events.ShutdownEngineUpdates():
+			player.conn.ReleaseName(name)
+			player.conn.Close()
+			return
+		}
+	}
+}
+
+// changed emits PropertiesChanged with the new values of the player properties.
+func (player *Player) changed(names ...string) {
+	properties := player.properties()
+	changed := make(map[string]dbus.Variant)
+	for _, name := range names {
+		changed[name] = properties[name]
+	}
+	if err := player.conn.Emit(objectPath, propertiesInterface+".PropertiesChanged", playerInterface, changed, []string{}); err != nil {
+		infrastructure.Debug("Cannot emit PropertiesChanged", "error", err)
+	}
+}
+
+// Properties answers the org.freedesktop.DBus.Properties interface for the
+// MPRIS interfaces, Volume being the only property written.
+type Properties struct {
+	player *Player
+}
+
+func (properties *Properties) Get(iface string, name string) (dbus.Variant, *dbus.Error) {
+	values, err := properties.GetAll(iface)
+	if err != nil {
+		return dbus.Variant{}, err
+	}
+	value, found := values[name]
+	if !found {
+		return dbus.Variant{}, invalidArgs("Unknown property %v of %v", name, iface)
+	}
+	return value, nil
+}
+
+func (properties *Properties) GetAll(iface string) (map[string]dbus.Variant, *dbus.Error) {
+	switch iface {
+	case rootInterface:
+		return mediaPlayerProperties(), nil
+	case playerInterface:
+		return properties.player.properties(), nil
+	}
+	return nil, invalidArgs("Unknown interface %v", iface)
+}
+
+func (properties *Properties) Set(iface string, name string, value dbus.Variant) *dbus.Error {
+	if iface != playerInterface || name != "Volume" {
+		return dbus.NewError("org.freedesktop.DBus.Error.PropertyReadOnly", []interface{}{fmt.Sprintf("Property %v of %v cannot be written", name, iface)})
+	}
+	volume, isDouble := value.Value().(float64)
+	if !isDouble {
+		return invalidArgs("Volume must be a double")
+	}
+	properties.player.publisher.SetVolume(int(volume*sconsify.MaxVolume + 0.5))
+	return nil
+}
+
+func invalidArgs(format string, v ...interface{}) *dbus.Error {
+	return dbus.NewError("org.freedesktop.DBus.Error.InvalidArgs", []interface{}{fmt.Sprintf(format, v...)})
+}
+
+type introspectable string
+
+func (xml introspectable) Introspect() (string, *dbus.Error) {
+	return string(xml), nil
+}
+
+const introspection = `<!DOCTYPE node PUBLIC "-//freedesktop//DTD D-BUS Object Introspection 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/introspect.dtd">
+<node>
+  <interface name="org.freedesktop.DBus.Introspectable">
+    <method name="Introspect">
+      <arg name="data" type="s" direction="out"/>
+    </method>
+  </interface>
+  <interface name="org.freedesktop.DBus.Properties">
+    <method name="Get">
+      <arg name="interface" type="s" direction="in"/>
+      <arg name="property" type="s" direction="in"/>
+      <arg name="value" type="v" direction="out"/>
+    </method>
+    <method name="GetAll">
+      <arg name="interface" type="s" direction="in"/>
+      <arg name="properties" type="a{sv}" direction="out"/>
+    </method>
+    <method name="Set">
+      <arg name="interface" type="s" direction="in"/>
+      <arg name="property" type="s" direction="in"/>
+      <arg name="value" type="v" direction="in"/>
+    </method>
+    <signal name="PropertiesChanged">
+      <arg name="interface" type="s"/>
+      <arg name="changed" type="a{sv}"/>
+      <arg name="invalidated" type="as"/>
+    </signal>
+  </interface>
+  <interface name="org.mpris.MediaPlayer2">
+    <method name="Raise"/>
+    <method name="Quit"/>
+    <property name="CanQuit" type="b" access="read"/>
+    <property name="CanRaise" type="b" access="read"/>
+    <property name="HasTrackList" type="b" access="read"/>
+    <property name="Identity" type="s" access="read"/>
+    <property name="SupportedUriSchemes" type="as" access="read"/>
+    <property name="SupportedMimeTypes" type="as" access="read"/>
+  </interface>
+  <interface name="org.mpris.MediaPlayer2.Player">
+    <method name="Next"/>
+    <method name="Previous"/>
+    <method name="Pause"/>
+    <method name="PlayPause"/>
+    <method name="Stop"/>
+    <method name="Play"/>
+    <method name="Seek">
+      <arg name="Offset" type="x" direction="in"/>
+    </method>
+    <method name="SetPosition">
+      <arg name="TrackId" type="o" direction="in"/>
+      <arg name="Position" type="x" direction="in"/>
+    </method>
+    <method name="OpenUri">
+      <arg name="Uri" type="s" direction="in"/>
+    </method>
+    <signal name="Seeked">
+      <arg name="Position" type="x"/>
+    </signal>
+    <property name="PlaybackStatus" type="s" access="read"/>
+    <property name="Rate" type="d" access="read"/>
+    <property name="Metadata" type="a{sv}" access="read"/>
+    <property name="Volume" type="d" access="readwrite"/>
+    <property name="Position" type="x" access="read"/>
+    <property name="MinimumRate" type="d" access="read"/>
+    <property name="MaximumRate" type="d" access="read"/>
+    <property name="CanGoNext" type="b" access="read"/>
+    <property name="CanGoPrevious" type="b" access="read"/>
+    <property name="CanPlay" type="b" access="read"/>
+    <property name="CanPause" type="b" access="read"/>
+    <property name="CanSeek" type="b" access="read"/>
+    <property name="CanControl" type="b" access="read"/>
+  </interface>
+</node>`
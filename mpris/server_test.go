@@ -0,0 +1,155 @@
+package mpris
+
+import (
+	"bufio"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+	"github.com/schaeferpp/sconsify/sconsify"
+)
+
+// startTestBus starts a private session bus, skipping the test when dbus-daemon
+// is not installed.
+func startTestBus(t *testing.T) (string, func()) {
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+	daemon := exec.Command("dbus-daemon", "--session", "--nofork", "--print-address")
+	stdout, err := daemon.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := daemon.Start(); err != nil {
+		t.Fatal(err)
+	}
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		daemon.Process.Kill()
+		t.Fatalf("No bus address: %v", err)
+	}
+	return strings.TrimSpace(address), func() {
+		daemon.Process.Kill()
+		daemon.Wait()
+	}
+}
+
+func connect(t *testing.T, address string) *dbus.Conn {
+	conn, err := dbus.Dial(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Auth(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Hello(); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// startTestPlayer exports the player on a private bus and returns a client
+// connection to it with the events the backend would receive.
+func startTestPlayer(t *testing.T) (*dbus.Conn, *sconsify.Publisher, *sconsify.Events, func()) {
+	address, stopBus := startTestBus(t)
+	publisher := &sconsify.Publisher{}
+	backendEvents := publisher.Subscribe(sconsify.Subscription{
+		Topics: []sconsify.Topic{sconsify.TopicPlayPauseToggle, sconsify.TopicReplay, sconsify.TopicSeek, sconsify.TopicSetVolume},
+		Buffer: 4,
+	})
+	if err := export(connect(t, address), publisher); err != nil {
+		stopBus()
+		t.Fatal(err)
+	}
+	client := connect(t, address)
+	return client, publisher, backendEvents, func() {
+		client.Close()
+		publisher.ShutdownEngine()
+		stopBus()
+	}
+}
+
+func TestControl(t *testing.T) {
+	client, _, backendEvents, stop := startTestPlayer(t)
+	defer stop()
+	player := client.Object(busName, objectPath)
+
+	if call := player.Call(playerInterface+".PlayPause", 0); call.Err != nil {
+		t.Fatal(call.Err)
+	}
+	<-backendEvents.PlayPauseToggleUpdates()
+
+	if call := player.Call(playerInterface+".Previous", 0); call.Err != nil {
+		t.Fatal(call.Err)
+	}
+	<-backendEvents.ReplayUpdates()
+
+	if call := player.Call(playerInterface+".Seek", 0, int64(-30000000)); call.Err != nil {
+		t.Fatal(call.Err)
+	}
+	if offset := <-backendEvents.SeekUpdates(); offset != -30*time.Second {
+		t.Errorf("Wrong seek offset %v", offset)
+	}
+
+	if call := player.Call(propertiesInterface+".Set", 0, playerInterface, "Volume", dbus.MakeVariant(0.5)); call.Err != nil {
+		t.Fatal(call.Err)
+	}
+	if level := <-backendEvents.SetVolumeUpdates(); level != 50 {
+		t.Errorf("Wrong volume %v", level)
+	}
+	if call := player.Call(propertiesInterface+".Set", 0, playerInterface, "PlaybackStatus", dbus.MakeVariant("Playing")); call.Err == nil {
+		t.Error("PlaybackStatus should not be written")
+	}
+}
+
+func TestPropertiesChanged(t *testing.T) {
+	client, publisher, _, stop := startTestPlayer(t)
+	defer stop()
+	player := client.Object(busName, objectPath)
+
+	var status dbus.Variant
+	if err := player.Call(propertiesInterface+".Get", 0, playerInterface, "PlaybackStatus").Store(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Value() != "Stopped" {
+		t.Errorf("Nothing played yet should be stopped: %v", status)
+	}
+
+	signals := make(chan *dbus.Signal, 4)
+	client.Signal(signals)
+	if call := client.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, "type='signal',interface='"+propertiesInterface+"'"); call.Err != nil {
+		t.Fatal(call.Err)
+	}
+
+	publisher.TrackPlaying(sconsify.InitTrack("spotify:track:0", sconsify.InitArtist("artist0", "Bob Marley"), "Waiting in vain", "4m16s"))
+	changed := propertiesChanged(t, signals)
+	if changed["PlaybackStatus"].Value() != "Playing" {
+		t.Errorf("Wrong status %v", changed["PlaybackStatus"])
+	}
+	metadata := changed["Metadata"].Value().(map[string]dbus.Variant)
+	if metadata["xesam:title"].Value() != "Waiting in vain" || metadata["mpris:length"].Value() != int64(256000000) || metadata["mpris:trackid"].Value() != dbus.ObjectPath("/org/sconsify/track/spotify_track_0") {
+		t.Errorf("Wrong metadata %v", metadata)
+	}
+
+	publisher.TrackPaused(sconsify.InitTrack("spotify:track:0", sconsify.InitArtist("artist0", "Bob Marley"), "Waiting in vain", "4m16s"))
+	if status := propertiesChanged(t, signals)["PlaybackStatus"]; status.Value() != "Paused" {
+		t.Errorf("Wrong status %v", status)
+	}
+}
+
+// propertiesChanged returns the properties of the next PropertiesChanged, other
+// signals, e.g. NameAcquired, being skipped.
+func propertiesChanged(t *testing.T, signals <-chan *dbus.Signal) map[string]dbus.Variant {
+	for {
+		select {
+		case signal := <-signals:
+			if signal.Name == propertiesInterface+".PropertiesChanged" {
+				return signal.Body[1].(map[string]dbus.Variant)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("PropertiesChanged should be emitted")
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/rpc"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/schaeferpp/sconsify/infrastructure"
+)
+
+const (
+	OutputText = "text"
+	OutputJson = "json"
+)
+
+// command is a call of a server method, reply pointing to where its result goes.
+type command struct {
+	method string
+	args   interface{}
+	reply  interface{}
+}
+
+// Client runs a command in the server, printing its result as text or as JSON.
+// It connects to the unix socket of the server unless a tcp address is given.
+func Client(line string, output string, tcpAddress string) error {
+	if output != OutputText && output != OutputJson {
+		return fmt.Errorf("Unknown command output: %v", output)
+	}
+	command, err := parseCommand(line)
+	if err != nil {
+		return err
+	}
+
+	var client *rpc.Client
+	if tcpAddress != "" {
+		var token string
+		if token, err = readToken(infrastructure.GetServerTokenLocation()); err != nil {
+			return err
+		}
+		client, err = dialTcp(tcpAddress, token)
+	} else {
+		client, err = dialUnix(infrastructure.GetServerSocketLocation())
+	}
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return command.run(client, output, os.Stdout)
+}
+
+func parseCommand(line string) (*command, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil, errors.New("Unknown command")
+	}
+	// the argument is the rest of the line, names of playlists and searches
+	// having spaces
+	argument := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), fields[0]))
+
+	var text string
+	switch fields[0] {
+	case "next":
+		return &command{method: "NextTrack", args: &NoArgs{}, reply: &text}, nil
+	case "play_pause":
+		return &command{method: "PlayPause", args: &NoArgs{}, reply: &text}, nil
+	case "replay":
+		return &command{method: "ReplayTrack", args: &NoArgs{}, reply: &text}, nil
+	case "pause":
+		return &command{method: "PauseTrack", args: &NoArgs{}, reply: &text}, nil
+	case "position":
+		return &command{method: "Position", args: &NoArgs{}, reply: &text}, nil
+	case "volume_up":
+		return &command{method: "VolumeUp", args: &NoArgs{}, reply: &text}, nil
+	case "volume_down":
+		return &command{method: "VolumeDown", args: &NoArgs{}, reply: &text}, nil
+	case "mute":
+		return &command{method: "ToggleMute", args: &NoArgs{}, reply: &text}, nil
+	case "volume":
+		if argument == "" {
+			return &command{method: "Volume", args: &NoArgs{}, reply: &text}, nil
+		}
+		level, err := strconv.Atoi(argument)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid volume: %v", argument)
+		}
+		return &command{method: "SetVolume", args: &VolumeArgs{Level: level}, reply: &text}, nil
+	case "equalizer":
+		if argument == "" {
+			return &command{method: "Equalizer", args: &NoArgs{}, reply: &text}, nil
+		}
+		return &command{method: "SetEqualizerPreset", args: &EqualizerArgs{Preset: argument}, reply: &text}, nil
+	case "seek":
+		offset, err := parseOffset(argument)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid seek offset: %v", argument)
+		}
+		return &command{method: "SeekTrack", args: &SeekArgs{Offset: offset}, reply: &text}, nil
+	case "status":
+		return &command{method: "Status", args: &NoArgs{}, reply: &Status{}}, nil
+	case "playlists":
+		return &command{method: "Playlists", args: &NoArgs{}, reply: &[]*PlaylistInfo{}}, nil
+	case "tracks":
+		if argument == "" {
+			return nil, errors.New("Missing playlist: tracks <uri or name>")
+		}
+		return &command{method: "Tracks", args: &URIArgs{URI: argument}, reply: &TracksReply{}}, nil
+	case "play":
+		if argument == "" {
+			return nil, errors.New("Missing track or playlist: play <uri or name>")
+		}
+		return &command{method: "Play", args: &URIArgs{URI: argument}, reply: &TrackInfo{}}, nil
+	case "queue":
+		if argument == "" {
+			return &command{method: "Queue", args: &NoArgs{}, reply: &[]*TrackInfo{}}, nil
+		}
+		return &command{method: "QueueTrack", args: &URIArgs{URI: argument}, reply: &[]*TrackInfo{}}, nil
+	case "dequeue":
+		position, err := strconv.Atoi(argument)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid queue position: %v", argument)
+		}
+		return &command{method: "Dequeue", args: &PositionArgs{Position: position}, reply: &TrackInfo{}}, nil
+	case "clear_queue":
+		return &command{method: "ClearQueue", args: &NoArgs{}, reply: &text}, nil
+	case "search":
+		if argument == "" {
+			return nil, errors.New("Missing query: search <query>")
+		}
+		return &command{method: "Search", args: &SearchArgs{Query: argument}, reply: &TracksReply{}}, nil
+	case "mode":
+		return &command{method: "SetMode", args: &ModeArgs{Mode: argument}, reply: &text}, nil
+	case "history":
+		count := 0
+		if argument != "" {
+			var err error
+			if count, err = strconv.Atoi(argument); err != nil || count <= 0 {
+				return nil, fmt.Errorf("Invalid history count: %v", argument)
+			}
+		}
+		return &command{method: "History", args: &CountArgs{Count: count}, reply: &[]*PlayInfo{}}, nil
+	case "stats":
+		return &command{method: "Stats", args: &PeriodArgs{Period: argument}, reply: &StatsReply{}}, nil
+	}
+	return nil, errors.New("Unknown command")
+}
+
+func (command *command) run(client *rpc.Client, output string, out io.Writer) error {
+	if err := client.Call("Server."+command.method, command.args, command.reply); err != nil {
+		return err
+	}
+	if output == OutputJson {
+		if text, isText := command.reply.(*string); isText && *text == "" {
+			return nil
+		}
+		return json.NewEncoder(out).Encode(command.reply)
+	}
+	printText(out, command.reply)
+	return nil
+}
+
+// printText prints a reply for a person to read, the fields of a line being
+// separated by tabs so they can be cut too.
+func printText(out io.Writer, reply interface{}) {
+	switch reply := reply.(type) {
+	case *string:
+		if *reply != "" {
+			fmt.Fprintln(out, *reply)
+		}
+	case *TrackInfo:
+		printTrack(out, reply)
+	case *[]*TrackInfo:
+		for i, track := range *reply {
+			fmt.Fprintf(out, "%v\t", i+1)
+			printTrack(out, track)
+		}
+	case *TracksReply:
+		for _, track := range reply.Tracks {
+			printTrack(out, track)
+		}
+	case *[]*PlaylistInfo:
+		for _, playlist := range *reply {
+			printPlaylist(out, playlist, "")
+		}
+	case *Status:
+		w := tabwriter.NewWriter(out, 0, 8, 1, ' ', 0)
+		fmt.Fprintf(w, "state:\t%v\n", reply.State)
+		if reply.Track != nil {
+			fmt.Fprintf(w, "track:\t%v - %v\t%v\n", reply.Track.Name, reply.Track.Artist, reply.Track.URI)
+			fmt.Fprintf(w, "position:\t%v/%v\n", reply.Elapsed, reply.Duration)
+		}
+		fmt.Fprintf(w, "mode:\t%v\n", reply.Mode)
+		if reply.Muted {
+			fmt.Fprintf(w, "volume:\t%v%% (muted)\n", reply.Volume)
+		} else {
+			fmt.Fprintf(w, "volume:\t%v%%\n", reply.Volume)
+		}
+		fmt.Fprintf(w, "equalizer:\t%v\n", reply.Equalizer)
+		fmt.Fprintf(w, "queue:\t%v track(s)\n", len(reply.Queue))
+		w.Flush()
+	case *[]*PlayInfo:
+		for _, play := range *reply {
+			printPlay(out, play)
+		}
+	case *StatsReply:
+		printStats(out, reply)
+	}
+}
+
+func printTrack(out io.Writer, track *TrackInfo) {
+	fmt.Fprintf(out, "%v\t%v - %v [%v]\n", track.URI, track.Name, track.Artist, track.Duration)
+}
+
+func printPlay(out io.Writer, play *PlayInfo) {
+	state := "skipped"
+	if play.Finished {
+		state = "finished"
+	}
+	fmt.Fprintf(out, "%v\t%v\t%v - %v\t%v\t%v %v\n", play.StartedAt, play.URI, play.Name, play.Artist, play.Playlist, state, play.Listened)
+}
+
+func printStats(out io.Writer, stats *StatsReply) {
+	w := tabwriter.NewWriter(out, 0, 8, 1, ' ', 0)
+	if stats.Since != "" {
+		fmt.Fprintf(w, "period:\t%v, since %v\n", stats.Period, stats.Since)
+	} else {
+		fmt.Fprintf(w, "period:\t%v\n", stats.Period)
+	}
+	fmt.Fprintf(w, "plays:\t%v, %v skipped\n", stats.Plays, stats.Skipped)
+	fmt.Fprintf(w, "listened:\t%v\n", stats.Listened)
+	w.Flush()
+	fmt.Fprintln(out, "top artists:")
+	for i, artist := range stats.TopArtists {
+		fmt.Fprintf(out, "%v\t%v\t%v play(s)\n", i+1, artist.Name, artist.Plays)
+	}
+	fmt.Fprintln(out, "top tracks:")
+	for i, track := range stats.TopTracks {
+		fmt.Fprintf(out, "%v\t%v\t%v play(s)\n", i+1, track.Name, track.Plays)
+	}
+}
+
+func printPlaylist(out io.Writer, playlist *PlaylistInfo, indent string) {
+	fmt.Fprintf(out, "%v%v\t%v\t%v track(s)\n", indent, playlist.URI, playlist.Name, playlist.Tracks)
+	for _, subPlaylist := range playlist.Playlists {
+		printPlaylist(out, subPlaylist, indent+"  ")
+	}
+}
+
+// parseOffset accepts a duration like 10s, -1m30s or a plain number of seconds.
+func parseOffset(value string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
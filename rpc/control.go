@@ -0,0 +1,368 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/schaeferpp/sconsify/sconsify"
+)
+
+const (
+	// the search results are waited for until searchTimeout, looking for them
+	// every searchPollInterval
+	searchTimeout      = 10 * time.Second
+	searchPollInterval = 100 * time.Millisecond
+)
+
+var (
+	errNoQueue  = errors.New("There is no queue without the console user interface")
+	errNoSearch = errors.New("Search needs the console user interface")
+)
+
+type URIArgs struct {
+	// URI of a track or a playlist, a playlist can be given by its name too
+	URI string
+}
+
+type PositionArgs struct {
+	// Position in the queue, starting at 1
+	Position int
+}
+
+type ModeArgs struct {
+	Mode string
+}
+
+type SearchArgs struct {
+	Query string
+}
+
+type TrackInfo struct {
+	URI      string `json:"uri"`
+	Name     string `json:"name"`
+	Artist   string `json:"artist,omitempty"`
+	Duration string `json:"duration,omitempty"`
+}
+
+type PlaylistInfo struct {
+	URI       string          `json:"uri"`
+	Name      string          `json:"name"`
+	Folder    bool            `json:"folder,omitempty"`
+	Tracks    int             `json:"tracks"`
+	Playlists []*PlaylistInfo `json:"playlists,omitempty"`
+}
+
+type TracksReply struct {
+	Playlist *PlaylistInfo `json:"playlist"`
+	Tracks   []*TrackInfo  `json:"tracks"`
+}
+
+type Status struct {
+	// State is playing, paused or stopped
+	State     string       `json:"state"`
+	Track     *TrackInfo   `json:"track,omitempty"`
+	Elapsed   string       `json:"elapsed,omitempty"`
+	Duration  string       `json:"duration,omitempty"`
+	Mode      string       `json:"mode,omitempty"`
+	Volume    int          `json:"volume"`
+	Muted     bool         `json:"muted"`
+	Equalizer string       `json:"equalizer"`
+	Queue     []*TrackInfo `json:"queue"`
+}
+
+func (t *Server) Status(args *NoArgs, reply *Status) error {
+	track, paused := t.publisher.CurrentTrack()
+	volume := t.publisher.CurrentVolume()
+	status := Status{
+		State:     "stopped",
+		Volume:    volume.Level,
+		Muted:     volume.Muted,
+		Equalizer: t.publisher.CurrentEqualizer().Preset,
+		Queue:     make([]*TrackInfo, 0),
+	}
+	if track != nil {
+		status.State = "playing"
+		if paused {
+			status.State = "paused"
+		}
+		position := t.publisher.CurrentPosition()
+		status.Track = toTrackInfo(track)
+		status.Elapsed, status.Duration = toSeconds(position.Elapsed).String(), toSeconds(position.Total).String()
+	}
+
+	// the mode and the queue are left out until the playlists are loaded
+	result, err := t.publisher.Control(func(playlists *sconsify.Playlists, queue sconsify.TrackQueue) (interface{}, error) {
+		uiStatus := &Status{Mode: sconsify.ModeNames[playlists.Mode()], Queue: make([]*TrackInfo, 0)}
+		if queue != nil {
+			uiStatus.Queue = toTrackInfos(queue.Contents())
+		}
+		return uiStatus, nil
+	})
+	if err == nil {
+		uiStatus := result.(*Status)
+		status.Mode, status.Queue = uiStatus.Mode, uiStatus.Queue
+	}
+	*reply = status
+	return nil
+}
+
+func (t *Server) Playlists(args *NoArgs, reply *[]*PlaylistInfo) error {
+	result, err := t.publisher.Control(func(playlists *sconsify.Playlists, queue sconsify.TrackQueue) (interface{}, error) {
+		names := playlists.Names()
+		sort.Strings(names)
+		infos := make([]*PlaylistInfo, 0, len(names))
+		for _, name := range names {
+			infos = append(infos, toPlaylistInfo(playlists.Get(name)))
+		}
+		return infos, nil
+	})
+	if err != nil {
+		return err
+	}
+	*reply = result.([]*PlaylistInfo)
+	return nil
+}
+
+func (t *Server) Tracks(args *URIArgs, reply *TracksReply) error {
+	if err := t.loadPlaylist(args.URI); err != nil {
+		return err
+	}
+	result, err := t.publisher.Control(func(playlists *sconsify.Playlists, queue sconsify.TrackQueue) (interface{}, error) {
+		playlist := playlists.FindPlaylist(args.URI)
+		if playlist == nil {
+			return nil, fmt.Errorf("Unknown playlist: %v", args.URI)
+		}
+		return toTracksReply(playlist), nil
+	})
+	if err != nil {
+		return err
+	}
+	*reply = *result.(*TracksReply)
+	return nil
+}
+
+// playing is the track Play plays and the name of its playlist.
+type playing struct {
+	track    *sconsify.Track
+	playlist string
+}
+
+// Play plays a track, or the first track of a playlist, continuing with the
+// next tracks of its playlist.
+func (t *Server) Play(args *URIArgs, reply *TrackInfo) error {
+	if err := t.loadPlaylist(args.URI); err != nil {
+		return err
+	}
+	result, err := t.publisher.Control(func(playlists *sconsify.Playlists, queue sconsify.TrackQueue) (interface{}, error) {
+		playlist, index := playlists.FindTrack(args.URI)
+		if playlist == nil {
+			if playlist, index = playlists.FindPlaylist(args.URI), 0; playlist == nil {
+				return nil, fmt.Errorf("Unknown track or playlist: %v", args.URI)
+			}
+		}
+		if err := playlists.SetCurrents(playlist.Name(), index); err != nil {
+			return nil, err
+		}
+		track := playlist.Track(index)
+		return &playing{track: track, playlist: playlists.PlaylistNameOf(track.URI)}, nil
+	})
+	if err != nil {
+		return err
+	}
+	playing := result.(*playing)
+	t.publisher.PlayFrom(playing.track, playing.playlist)
+	*reply = *toTrackInfo(playing.track)
+	return nil
+}
+
+func (t *Server) Queue(args *NoArgs, reply *[]*TrackInfo) error {
+	result, err := t.publisher.Control(func(playlists *sconsify.Playlists, queue sconsify.TrackQueue) (interface{}, error) {
+		if queue == nil {
+			return nil, errNoQueue
+		}
+		return toTrackInfos(queue.Contents()), nil
+	})
+	if err != nil {
+		return err
+	}
+	*reply = result.([]*TrackInfo)
+	return nil
+}
+
+// QueueTrack adds a track, or every track of a playlist, to the end of the queue.
+func (t *Server) QueueTrack(args *URIArgs, reply *[]*TrackInfo) error {
+	if err := t.loadPlaylist(args.URI); err != nil {
+		return err
+	}
+	result, err := t.publisher.Control(func(playlists *sconsify.Playlists, queue sconsify.TrackQueue) (interface{}, error) {
+		if queue == nil {
+			return nil, errNoQueue
+		}
+		var tracks []*sconsify.Track
+		if playlist, index := playlists.FindTrack(args.URI); playlist != nil {
+			tracks = []*sconsify.Track{playlist.Track(index)}
+		} else if playlist := playlists.FindPlaylist(args.URI); playlist != nil {
+			for i := 0; i < playlist.Tracks(); i++ {
+				tracks = append(tracks, playlist.Track(i))
+			}
+		} else {
+			return nil, fmt.Errorf("Unknown track or playlist: %v", args.URI)
+		}
+
+		queued := make([]*sconsify.Track, 0, len(tracks))
+		for _, track := range tracks {
+			if queue.Add(track) == nil {
+				break
+			}
+			queued = append(queued, track)
+		}
+		if len(queued) == 0 && len(tracks) > 0 {
+			return nil, errors.New("The queue is full")
+		}
+		return toTrackInfos(queued), nil
+	})
+	if err != nil {
+		return err
+	}
+	*reply = result.([]*TrackInfo)
+	return nil
+}
+
+func (t *Server) Dequeue(args *PositionArgs, reply *TrackInfo) error {
+	result, err := t.publisher.Control(func(playlists *sconsify.Playlists, queue sconsify.TrackQueue) (interface{}, error) {
+		if queue == nil {
+			return nil, errNoQueue
+		}
+		track := queue.Remove(args.Position - 1)
+		if track == nil {
+			return nil, fmt.Errorf("No track at position %v of the queue", args.Position)
+		}
+		return track, nil
+	})
+	if err != nil {
+		return err
+	}
+	*reply = *toTrackInfo(result.(*sconsify.Track))
+	return nil
+}
+
+func (t *Server) ClearQueue(args *NoArgs, reply *string) error {
+	_, err := t.publisher.Control(func(playlists *sconsify.Playlists, queue sconsify.TrackQueue) (interface{}, error) {
+		if queue == nil {
+			return nil, errNoQueue
+		}
+		queue.RemoveAll()
+		return nil, nil
+	})
+	return err
+}
+
+// Search asks the backend to search and waits for the results to be added to the
+// search folder.
+func (t *Server) Search(args *SearchArgs, reply *TracksReply) error {
+	if strings.TrimSpace(args.Query) == "" {
+		return errors.New("Nothing to search")
+	}
+	result, err := t.publisher.Control(func(playlists *sconsify.Playlists, queue sconsify.TrackQueue) (interface{}, error) {
+		if queue == nil {
+			return nil, errNoSearch
+		}
+		return countSearches(playlists), nil
+	})
+	if err != nil {
+		return err
+	}
+	searches := result.(int)
+
+	t.publisher.Search(args.Query)
+	for deadline := time.Now().Add(searchTimeout); time.Now().Before(deadline); {
+		time.Sleep(searchPollInterval)
+		result, err := t.publisher.Control(func(playlists *sconsify.Playlists, queue sconsify.TrackQueue) (interface{}, error) {
+			if countSearches(playlists) == searches {
+				return nil, nil
+			}
+			folder := playlists.GetByURI("Search")
+			return toTracksReply(folder.Playlist(folder.Playlists() - 1)), nil
+		})
+		if err != nil {
+			return err
+		}
+		if result != nil {
+			*reply = *result.(*TracksReply)
+			return nil
+		}
+	}
+	return errors.New("No search results in time")
+}
+
+func (t *Server) SetMode(args *ModeArgs, reply *string) error {
+	mode := -1
+	for i, name := range sconsify.ModeNames {
+		if name == args.Mode {
+			mode = i
+		}
+	}
+	if mode == -1 {
+		return fmt.Errorf("Unknown mode %v, available: %v", args.Mode, strings.Join(sconsify.ModeNames, ", "))
+	}
+	_, err := t.publisher.Control(func(playlists *sconsify.Playlists, queue sconsify.TrackQueue) (interface{}, error) {
+		playlists.SetMode(mode)
+		return nil, nil
+	})
+	return err
+}
+
+// loadPlaylist loads the tracks of an on demand playlist, e.g. an album, the
+// same way the console user interface does when it is selected. Nothing is done
+// when the key is not a playlist.
+func (t *Server) loadPlaylist(key string) error {
+	_, err := t.publisher.Control(func(playlists *sconsify.Playlists, queue sconsify.TrackQueue) (interface{}, error) {
+		if playlist := playlists.FindPlaylist(key); playlist != nil && playlist.IsOnDemand() && playlist.Tracks() == 0 {
+			playlist.ExecuteLoad()
+		}
+		return nil, nil
+	})
+	return err
+}
+
+func countSearches(playlists *sconsify.Playlists) int {
+	if folder := playlists.GetByURI("Search"); folder != nil {
+		return folder.Playlists()
+	}
+	return 0
+}
+
+func toTrackInfo(track *sconsify.Track) *TrackInfo {
+	info := &TrackInfo{URI: track.URI, Name: track.Name, Duration: track.Duration}
+	if track.Artist != nil {
+		info.Artist = track.Artist.Name
+	}
+	return info
+}
+
+func toTrackInfos(tracks []*sconsify.Track) []*TrackInfo {
+	infos := make([]*TrackInfo, len(tracks))
+	for i, track := range tracks {
+		infos[i] = toTrackInfo(track)
+	}
+	return infos
+}
+
+func toPlaylistInfo(playlist *sconsify.Playlist) *PlaylistInfo {
+	info := &PlaylistInfo{URI: playlist.URI, Name: playlist.OriginalName(), Folder: playlist.IsFolder(), Tracks: playlist.Tracks()}
+	for i := 0; i < playlist.Playlists(); i++ {
+		info.Playlists = append(info.Playlists, toPlaylistInfo(playlist.Playlist(i)))
+	}
+	return info
+}
+
+func toTracksReply(playlist *sconsify.Playlist) *TracksReply {
+	tracks := make([]*sconsify.Track, playlist.Tracks())
+	for i := range tracks {
+		tracks[i] = playlist.Track(i)
+	}
+	return &TracksReply{Playlist: toPlaylistInfo(playlist), Tracks: toTrackInfos(tracks)}
+}
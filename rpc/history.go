@@ -0,0 +1,119 @@
+package rpc
+
+import (
+	"errors"
+	"time"
+
+	"github.com/schaeferpp/sconsify/history"
+	"github.com/schaeferpp/sconsify/sconsify"
+)
+
+const (
+	defaultHistoryCount = 20
+	defaultStatsPeriod  = "week"
+	// statsTopCount is how many artists and tracks the stats list
+	statsTopCount = 10
+)
+
+var errNoHistory = errors.New("There is no history, the server was started with -history=false")
+
+type CountArgs struct {
+	Count int
+}
+
+type PeriodArgs struct {
+	// Period is day, week, month, year or all
+	Period string
+}
+
+type PlayInfo struct {
+	URI       string `json:"uri"`
+	Name      string `json:"name"`
+	Artist    string `json:"artist,omitempty"`
+	Playlist  string `json:"playlist,omitempty"`
+	StartedAt string `json:"startedAt"`
+	Listened  string `json:"listened"`
+	Finished  bool   `json:"finished"`
+}
+
+type CountInfo struct {
+	Name  string `json:"name"`
+	URI   string `json:"uri,omitempty"`
+	Plays int    `json:"plays"`
+}
+
+type StatsReply struct {
+	Period     string       `json:"period"`
+	Since      string       `json:"since,omitempty"`
+	Plays      int          `json:"plays"`
+	Skipped    int          `json:"skipped"`
+	Listened   string       `json:"listened"`
+	TopArtists []*CountInfo `json:"topArtists"`
+	TopTracks  []*CountInfo `json:"topTracks"`
+}
+
+// History answers the tracks played the most recently, first the last one.
+func (t *Server) History(args *CountArgs, reply *[]*PlayInfo) error {
+	if t.history == nil {
+		return errNoHistory
+	}
+	count := args.Count
+	if count <= 0 {
+		count = defaultHistoryCount
+	}
+	plays := make([]*PlayInfo, 0, count)
+	for _, play := range t.history.Recent(count) {
+		plays = append(plays, toPlayInfo(play))
+	}
+	*reply = plays
+	return nil
+}
+
+// Stats answers how much was played in the period and the artists and tracks
+// played the most.
+func (t *Server) Stats(args *PeriodArgs, reply *StatsReply) error {
+	if t.history == nil {
+		return errNoHistory
+	}
+	period := args.Period
+	if period == "" {
+		period = defaultStatsPeriod
+	}
+	since, err := history.ParsePeriod(period, time.Now())
+	if err != nil {
+		return err
+	}
+	stats := t.history.Stats(since, statsTopCount)
+	*reply = StatsReply{
+		Period:     period,
+		Plays:      stats.Plays,
+		Skipped:    stats.Skipped,
+		Listened:   (stats.Listened / time.Second * time.Second).String(),
+		TopArtists: toCountInfos(stats.TopArtists),
+		TopTracks:  toCountInfos(stats.TopTracks),
+	}
+	if !since.IsZero() {
+		reply.Since = since.Format(time.RFC3339)
+	}
+	return nil
+}
+
+func toPlayInfo(play *sconsify.Play) *PlayInfo {
+	return &PlayInfo{
+		URI:       play.URI,
+		Name:      play.Name,
+		Artist:    play.Artist,
+		Playlist:  play.Playlist,
+		StartedAt: play.StartedAt.Format(time.RFC3339),
+		Listened:  (play.Listened / time.Second * time.Second).String(),
+		Finished:  play.Finished,
+	}
+}
+
+func toCountInfos(counts []*history.Count) []*CountInfo {
+	infos := make([]*CountInfo, len(counts))
+	for i, count := range counts {
+		infos[i] = &CountInfo{Name: count.Name, URI: count.URI, Plays: count.Plays}
+	}
+	return infos
+}
@@ -0,0 +1,232 @@
+package rpc
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/schaeferpp/sconsify/sconsify"
+)
+
+// streamedTopics are the events pushed to the clients of GET /events.
+var streamedTopics = []sconsify.Topic{
+	sconsify.TopicTrackPlaying, sconsify.TopicTrackPaused, sconsify.TopicNewTrackLoaded, sconsify.TopicShutdownEngine,
+}
+
+// call answers a request of the HTTP API, a nil reply being answered with no content.
+type call func(r *http.Request) (interface{}, error)
+
+// httpHandler serves the HTTP API, a JSON view of the methods of the Server:
+//
+//	GET  /status                 the status
+//	GET  /playlists              the playlists
+//	GET  /playlists/{uri}/tracks the tracks of a playlist, by its URI or name
+//	GET  /queue                  the tracks in the queue
+//	POST /queue                  queue a track or a playlist: {"uri": "..."}
+//	POST /play                   play a track or a playlist: {"uri": "..."}
+//	POST /next                   play the next track
+//	GET  /events                 server-sent events of the tracks playing
+//
+// Every request must send the token of the server, as a bearer token or, for
+// the browsers opening an EventSource, as the token query parameter.
+type httpHandler struct {
+	server *Server
+	token  string
+	mux    *http.ServeMux
+	// tracks is not served by the mux, which would redirect the URIs with a /
+	tracks http.Handler
+}
+
+func newHttpHandler(server *Server, token string) http.Handler {
+	handler := &httpHandler{server: server, token: token, mux: http.NewServeMux()}
+	handler.tracks = methods(map[string]call{"GET": handler.playlistTracks})
+	handler.mux.Handle("/status", methods(map[string]call{"GET": handler.status}))
+	handler.mux.Handle("/playlists", methods(map[string]call{"GET": handler.playlists}))
+	handler.mux.Handle("/queue", methods(map[string]call{"GET": handler.queue, "POST": handler.queueTrack}))
+	handler.mux.Handle("/play", methods(map[string]call{"POST": handler.play}))
+	handler.mux.Handle("/next", methods(map[string]call{"POST": handler.next}))
+	handler.mux.HandleFunc("/events", handler.events)
+	return handler
+}
+
+func (handler *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// a browser remote can be opened from anywhere, the token protecting the API
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if r.Method == "OPTIONS" {
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if !handler.authorised(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, errors.New("Invalid token"))
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/playlists/") {
+		handler.tracks.ServeHTTP(w, r)
+		return
+	}
+	handler.mux.ServeHTTP(w, r)
+}
+
+func (handler *httpHandler) authorised(r *http.Request) bool {
+	token := r.URL.Query().Get("token")
+	if authorization := r.Header.Get("Authorization"); strings.HasPrefix(authorization, "Bearer ") {
+		token = strings.TrimPrefix(authorization, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(handler.token)) == 1
+}
+
+func methods(calls map[string]call) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		call, found := calls[r.Method]
+		if !found {
+			allowed := make([]string, 0, len(calls))
+			for method := range calls {
+				allowed = append(allowed, method)
+			}
+			sort.Strings(allowed)
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("Method %v not allowed", r.Method))
+			return
+		}
+		reply, err := call(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if reply == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJson(w, http.StatusOK, reply)
+	}
+}
+
+func (handler *httpHandler) status(r *http.Request) (interface{}, error) {
+	reply := &Status{}
+	return reply, handler.server.Status(&NoArgs{}, reply)
+}
+
+func (handler *httpHandler) playlists(r *http.Request) (interface{}, error) {
+	reply := make([]*PlaylistInfo, 0)
+	return reply, handler.server.Playlists(&NoArgs{}, &reply)
+}
+
+// playlistTracks answers /playlists/{uri}/tracks, the URI, or name, being
+// everything between /playlists/ and /tracks.
+func (handler *httpHandler) playlistTracks(r *http.Request) (interface{}, error) {
+	path := strings.TrimPrefix(r.URL.Path, "/playlists/")
+	if !strings.HasSuffix(path, "/tracks") {
+		return nil, fmt.Errorf("Unknown path: %v", r.URL.Path)
+	}
+	reply := &TracksReply{}
+	return reply, handler.server.Tracks(&URIArgs{URI: strings.TrimSuffix(path, "/tracks")}, reply)
+}
+
+func (handler *httpHandler) queue(r *http.Request) (interface{}, error) {
+	reply := make([]*TrackInfo, 0)
+	return reply, handler.server.Queue(&NoArgs{}, &reply)
+}
+
+func (handler *httpHandler) queueTrack(r *http.Request) (interface{}, error) {
+	args, err := readURIArgs(r)
+	if err != nil {
+		return nil, err
+	}
+	reply := make([]*TrackInfo, 0)
+	return reply, handler.server.QueueTrack(args, &reply)
+}
+
+func (handler *httpHandler) play(r *http.Request) (interface{}, error) {
+	args, err := readURIArgs(r)
+	if err != nil {
+		return nil, err
+	}
+	reply := &TrackInfo{}
+	return reply, handler.server.Play(args, reply)
+}
+
+func (handler *httpHandler) next(r *http.Request) (interface{}, error) {
+	var reply string
+	return nil, handler.server.NextTrack(&NoArgs{}, &reply)
+}
+
+// events streams the tracks playing, starting with the current one, until the
+// client goes away or the engine shuts down.
+func (handler *httpHandler) events(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("Method %v not allowed", r.Method))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("Streaming is not supported"))
+		return
+	}
+	publisher := handler.server.publisher
+	events := publisher.Subscribe(sconsify.Subscription{Topics: streamedTopics, Buffer: 16, Policy: sconsify.DropOldest, Stream: true})
+	defer publisher.Unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if track, paused := publisher.CurrentTrack(); track != nil {
+		if paused {
+			writeEvent(w, sconsify.TopicTrackPaused, toTrackInfo(track))
+		} else {
+			writeEvent(w, sconsify.TopicTrackPlaying, toTrackInfo(track))
+		}
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case event := <-events.StreamUpdates():
+			switch event.Topic {
+			case sconsify.TopicShutdownEngine:
+				return
+			case sconsify.TopicNewTrackLoaded:
+				writeEvent(w, event.Topic, map[string]string{"duration": fmt.Sprint(event.Value)})
+			default:
+				writeEvent(w, event.Topic, toTrackInfo(event.Value.(*sconsify.Track)))
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func readURIArgs(r *http.Request) (*URIArgs, error) {
+	args := &URIArgs{}
+	if err := json.NewDecoder(r.Body).Decode(args); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("Invalid body: %v", err)
+	}
+	if args.URI == "" {
+		return nil, errors.New(`Missing uri, e.g. {"uri": "spotify:track:..."}`)
+	}
+	return args, nil
+}
+
+func writeEvent(w io.Writer, topic sconsify.Topic, data interface{}) {
+	b, _ := json.Marshal(data)
+	fmt.Fprintf(w, "event: %v\ndata: %s\n\n", topic, b)
+}
+
+func writeJson(w http.ResponseWriter, status int, reply interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(reply)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJson(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,134 @@
+package rpc
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schaeferpp/sconsify/sconsify"
+)
+
+func startTestHttpServer() (*httptest.Server, *sconsify.Publisher, *sconsify.Events) {
+	publisher, backendEvents := startTestUserInterface()
+	return httptest.NewServer(newHttpHandler(&Server{publisher: publisher}, "secret")), publisher, backendEvents
+}
+
+func request(t *testing.T, method string, url string, body string) (int, string) {
+	r, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Authorization", "Bearer secret")
+	response, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	b, _ := ioutil.ReadAll(response.Body)
+	return response.StatusCode, string(b)
+}
+
+func TestHttpApi(t *testing.T) {
+	server, _, backendEvents := startTestHttpServer()
+	defer server.Close()
+
+	if status, body := request(t, "GET", server.URL+"/playlists/Bob Marley/tracks", ""); status != http.StatusOK || !strings.Contains(body, `"uri":"track1"`) {
+		t.Errorf("Tracks should be listed: %v %v", status, body)
+	}
+	if status, body := request(t, "POST", server.URL+"/play", `{"uri": "track2"}`); status != http.StatusOK || !strings.Contains(body, `"name":"I wanna be sedated"`) {
+		t.Errorf("Track should be played: %v %v", status, body)
+	}
+	if track := <-backendEvents.PlayUpdates(); track.URI != "track2" {
+		t.Errorf("Track2 should be played but is %v", track.URI)
+	}
+
+	request(t, "POST", server.URL+"/queue", `{"uri": "track0"}`)
+	if status, body := request(t, "GET", server.URL+"/queue", ""); status != http.StatusOK || body != `[{"uri":"track0","name":"Waiting in vain","artist":"Bob Marley","duration":"4m16s"}]`+"\n" {
+		t.Errorf("Track should be queued: %v %v", status, body)
+	}
+
+	if status, body := request(t, "POST", server.URL+"/play", `{}`); status != http.StatusBadRequest || !strings.Contains(body, "Missing uri") {
+		t.Errorf("Play without uri should fail: %v %v", status, body)
+	}
+	if status, _ := request(t, "GET", server.URL+"/next", ""); status != http.StatusMethodNotAllowed {
+		t.Errorf("Next should only be posted: %v", status)
+	}
+}
+
+func TestHttpApiNeedsToken(t *testing.T) {
+	server, _, _ := startTestHttpServer()
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Request without token should be refused: %v", response.StatusCode)
+	}
+
+	response, err = http.Get(server.URL + "/status?token=secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("Request with the token should be served: %v", response.StatusCode)
+	}
+}
+
+func TestHttpEvents(t *testing.T) {
+	server, publisher, _ := startTestHttpServer()
+	defer server.Close()
+
+	track := sconsify.InitTrack("track0", sconsify.InitArtist("artist0", "Bob Marley"), "Waiting in vain", "4m16s")
+	publisher.TrackPlaying(track)
+
+	response, err := http.Get(server.URL + "/events?token=secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			if scanner.Text() != "" {
+				lines <- scanner.Text()
+			}
+		}
+		close(lines)
+	}()
+	next := func() string {
+		select {
+		case line := <-lines:
+			return line
+		case <-time.After(time.Second):
+			t.Fatal("No event streamed")
+		}
+		return ""
+	}
+
+	// the current track first
+	if event, data := next(), next(); event != "event: trackPlaying" || !strings.Contains(data, `"uri":"track0"`) {
+		t.Errorf("Current track should be streamed: %v %v", event, data)
+	}
+	publisher.TrackPaused(track)
+	publisher.NewTrackLoaded(4*time.Minute + 16*time.Second)
+	if event, _ := next(), next(); event != "event: trackPaused" {
+		t.Errorf("Pause should be streamed: %v", event)
+	}
+	if event, data := next(), next(); event != "event: newTrackLoaded" || data != `data: {"duration":"4m16s"}` {
+		t.Errorf("New track should be streamed: %v %v", event, data)
+	}
+
+	publisher.ShutdownEngine()
+	if _, open := <-lines; open {
+		t.Error("Stream should end on shutdown")
+	}
+}
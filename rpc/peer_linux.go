@@ -0,0 +1,31 @@
+package rpc
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+)
+
+// checkPeer only accepts the connections of processes of the user running
+// sconsify, even if the socket was made readable by others.
+func checkPeer(conn net.Conn) (io.ReadWriteCloser, error) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, fmt.Errorf("Not a unix connection: %v", conn.RemoteAddr())
+	}
+	file, err := unixConn.File()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	credentials, err := syscall.GetsockoptUcred(int(file.Fd()), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	if err != nil {
+		return nil, err
+	}
+	if int(credentials.Uid) != os.Getuid() {
+		return nil, fmt.Errorf("Connection of the user %v, only the user %v is accepted", credentials.Uid, os.Getuid())
+	}
+	return conn, nil
+}
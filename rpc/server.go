@@ -1,58 +1,119 @@
 package rpc
 
 import (
+	"errors"
 	"fmt"
+	"github.com/schaeferpp/sconsify/history"
+	"github.com/schaeferpp/sconsify/infrastructure"
 	"github.com/schaeferpp/sconsify/sconsify"
 	"net"
 	"net/http"
 	"net/rpc"
+	"strings"
+	"time"
 )
 
 type NoArgs struct {
 }
 
+type SeekArgs struct {
+	Offset time.Duration
+}
+
+type VolumeArgs struct {
+	Level int
+}
+
+type EqualizerArgs struct {
+	Preset string
+}
+
 type Server struct {
 	publisher *sconsify.Publisher
+	// history is nil when the tracks played are not recorded
+	history *history.History
 }
 
-func StartServer(p *sconsify.Publisher) {
-	server := new(Server)
-	server.publisher = p
-	rpc.Register(server)
-	rpc.HandleHTTP()
-	listener, err := net.Listen("tcp", ":45800")
+type ServerConf struct {
+	// TcpAddress is a localhost address the JSON-RPC server listens on too
+	TcpAddress string
+	// HttpAddress is a localhost address the HTTP API is served on
+	HttpAddress string
+	// History answers the history and stats commands, nil when the tracks
+	// played are not recorded
+	History *history.History
+}
+
+// StartServer serves JSON-RPC 1.0 requests, e.g.
+// {"method": "Server.Play", "params": [{"URI": "spotify:track:..."}], "id": 1},
+// on a unix socket only the user can connect to and, when configured, on a
+// localhost tcp port and the HTTP API, both asking for the token of the server.
+// The server stops when the engine shuts down.
+func StartServer(p *sconsify.Publisher, conf *ServerConf) error {
+	service := &Server{publisher: p, history: conf.History}
+	server, err := newServer(service)
 	if err != nil {
-		fmt.Printf("Cannot start the server: %v\n", err)
-		return
+		return err
 	}
-	go http.Serve(listener, nil)
-}
-
-func Client(command string) {
-	var method string
-	if command == "next" {
-		method = "NextTrack"
-	} else if command == "play_pause" {
-		method = "PlayPause"
-	} else if command == "replay" {
-		method = "ReplayTrack"
-	} else if command == "pause" {
-		method = "PauseTrack"
-	} else {
-		fmt.Println("Unknown command")
-		return
+	socket := infrastructure.GetServerSocketLocation()
+	if socket == "" {
+		return errors.New("Cannot find where to create the server socket")
 	}
-
-	client, err := rpc.DialHTTP("tcp", ":45800")
+	unixListener, err := listenUnix(socket)
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
-		return
+		return err
 	}
-	var reply string
-	if err := client.Call("Server."+method, &NoArgs{}, &reply); err != nil {
-		fmt.Printf("Error: %v\n", err)
-		return
+	listeners := []net.Listener{unixListener}
+	go serve(server, unixListener, checkPeer)
+
+	if conf.TcpAddress != "" || conf.HttpAddress != "" {
+		token, err := createToken(infrastructure.GetServerTokenLocation())
+		if err != nil {
+			closeListeners(listeners)
+			return err
+		}
+		if conf.TcpAddress != "" {
+			tcpListener, err := listenTcp(conf.TcpAddress)
+			if err != nil {
+				closeListeners(listeners)
+				return err
+			}
+			listeners = append(listeners, tcpListener)
+			go serve(server, tcpListener, checkToken(token))
+		}
+		if conf.HttpAddress != "" {
+			httpListener, err := listenTcp(conf.HttpAddress)
+			if err != nil {
+				closeListeners(listeners)
+				return err
+			}
+			listeners = append(listeners, httpListener)
+			go http.Serve(httpListener, newHttpHandler(service, token))
+		}
 	}
+
+	events := p.Subscribe(sconsify.Subscription{Topics: []sconsify.Topic{sconsify.TopicShutdownEngine}, Buffer: 1})
+	go func() {
+		<-events.ShutdownEngineUpdates()
+		p.Unsubscribe(events)
+		// closing the unix listener removes the socket
+		closeListeners(listeners)
+	}()
+	return nil
+}
+
+func closeListeners(listeners []net.Listener) {
+	for _, listener := range listeners {
+		listener.Close()
+	}
+}
+
+func newServer(service *Server) (*rpc.Server, error) {
+	server := rpc.NewServer()
+	if err := server.Register(service); err != nil {
+		return nil, err
+	}
+	return server, nil
 }
 
 func (t *Server) NextTrack(args *NoArgs, reply *string) error {
@@ -74,3 +135,65 @@ func (t *Server) ReplayTrack(args *NoArgs, reply *string) error {
 	t.publisher.Replay()
 	return nil
 }
+
+func (t *Server) SeekTrack(args *SeekArgs, reply *string) error {
+	t.publisher.Seek(args.Offset)
+	return nil
+}
+
+func (t *Server) Position(args *NoArgs, reply *string) error {
+	position := t.publisher.CurrentPosition()
+	*reply = fmt.Sprintf("%v/%v", toSeconds(position.Elapsed), toSeconds(position.Total))
+	return nil
+}
+
+func (t *Server) Volume(args *NoArgs, reply *string) error {
+	volume := t.publisher.CurrentVolume()
+	if volume.Muted {
+		*reply = fmt.Sprintf("%v%% (muted)", volume.Level)
+	} else {
+		*reply = fmt.Sprintf("%v%%", volume.Level)
+	}
+	return nil
+}
+
+func (t *Server) SetVolume(args *VolumeArgs, reply *string) error {
+	t.publisher.SetVolume(args.Level)
+	return nil
+}
+
+func (t *Server) VolumeUp(args *NoArgs, reply *string) error {
+	t.publisher.VolumeUp()
+	return nil
+}
+
+func (t *Server) VolumeDown(args *NoArgs, reply *string) error {
+	t.publisher.VolumeDown()
+	return nil
+}
+
+func (t *Server) ToggleMute(args *NoArgs, reply *string) error {
+	t.publisher.ToggleMute()
+	return nil
+}
+
+func (t *Server) Equalizer(args *NoArgs, reply *string) error {
+	equalizer := t.publisher.CurrentEqualizer()
+	*reply = fmt.Sprintf("%v: %v\npresets: %v", equalizer.Preset, equalizer.GainsString(), strings.Join(equalizer.Presets, ", "))
+	return nil
+}
+
+func (t *Server) SetEqualizerPreset(args *EqualizerArgs, reply *string) error {
+	equalizer := t.publisher.CurrentEqualizer()
+	for _, preset := range equalizer.Presets {
+		if preset == args.Preset {
+			t.publisher.SetEqualizerPreset(args.Preset)
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown preset %v, available: %v", args.Preset, strings.Join(equalizer.Presets, ", "))
+}
+
+func toSeconds(duration time.Duration) time.Duration {
+	return duration / time.Second * time.Second
+}
@@ -0,0 +1,201 @@
+package rpc
+
+import (
+	"bytes"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schaeferpp/sconsify/history"
+	"github.com/schaeferpp/sconsify/sconsify"
+	"github.com/schaeferpp/sconsify/ui"
+)
+
+// startTestUserInterface answers the control requests with two playlists and an
+// empty queue, returning the events the backend would receive.
+func startTestUserInterface() (*sconsify.Publisher, *sconsify.Events) {
+	publisher := &sconsify.Publisher{}
+	backendEvents := publisher.Subscribe(sconsify.Subscription{Topics: []sconsify.Topic{sconsify.TopicPlay}, Buffer: 1})
+	uiEvents := publisher.Subscribe(sconsify.Subscription{Topics: []sconsify.Topic{sconsify.TopicControl}})
+
+	artist := sconsify.InitArtist("artist0", "Bob Marley")
+	playlists := sconsify.InitPlaylists()
+	playlists.AddPlaylist(sconsify.InitPlaylist("playlist0", "Bob Marley", []*sconsify.Track{
+		sconsify.InitTrack("track0", artist, "Waiting in vain", "4m16s"),
+		sconsify.InitTrack("track1", artist, "Stir it up", "5m32s"),
+	}))
+	playlists.AddPlaylist(sconsify.InitPlaylist("playlist1", "Ramones", []*sconsify.Track{
+		sconsify.InitTrack("track2", sconsify.InitArtist("artist1", "Ramones"), "I wanna be sedated", "2m29s"),
+	}))
+	queue := ui.InitQueue()
+	go func() {
+		for request := range uiEvents.ControlUpdates() {
+			request.Run(playlists, queue)
+		}
+	}()
+	return publisher, backendEvents
+}
+
+func startTestServer(t *testing.T) (*rpc.Client, *sconsify.Events) {
+	return startTestServerWithHistory(t, nil)
+}
+
+func startTestServerWithHistory(t *testing.T, playHistory *history.History) (*rpc.Client, *sconsify.Events) {
+	publisher, backendEvents := startTestUserInterface()
+	server, err := newServer(&Server{publisher: publisher, history: playHistory})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientConn, serverConn := net.Pipe()
+	go server.ServeCodec(jsonrpc.NewServerCodec(serverConn))
+	return rpc.NewClientWithCodec(jsonrpc.NewClientCodec(clientConn)), backendEvents
+}
+
+func runCommand(t *testing.T, client *rpc.Client, line string, output string) string {
+	command, err := parseCommand(line)
+	if err != nil {
+		t.Fatalf("Command %q should be parsed: %v", line, err)
+	}
+	var out bytes.Buffer
+	if err := command.run(client, output, &out); err != nil {
+		t.Fatalf("Command %q should run: %v", line, err)
+	}
+	return out.String()
+}
+
+func TestPlayTrackAndPlaylist(t *testing.T) {
+	client, backendEvents := startTestServer(t)
+	defer client.Close()
+
+	if out := runCommand(t, client, "play track1", OutputText); out != "track1\tStir it up - Bob Marley [5m32s]\n" {
+		t.Errorf("Wrong output %q", out)
+	}
+	if track := <-backendEvents.PlayUpdates(); track.URI != "track1" {
+		t.Errorf("Track1 should be played but is %v", track.URI)
+	}
+
+	runCommand(t, client, "play Ramones", OutputText)
+	if track := <-backendEvents.PlayUpdates(); track.URI != "track2" {
+		t.Errorf("First track of the playlist should be played but is %v", track.URI)
+	}
+
+	command, _ := parseCommand("play spotify:track:unknown")
+	if err := command.run(client, OutputText, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "Unknown track or playlist") {
+		t.Errorf("Unknown track should fail: %v", err)
+	}
+}
+
+func TestQueueAndDequeue(t *testing.T) {
+	client, _ := startTestServer(t)
+	defer client.Close()
+
+	if out := runCommand(t, client, "queue playlist0", OutputText); strings.Count(out, "\n") != 2 {
+		t.Errorf("Every track of the playlist should be queued: %q", out)
+	}
+	runCommand(t, client, "queue track2", OutputText)
+	runCommand(t, client, "dequeue 1", OutputText)
+
+	out := runCommand(t, client, "queue", OutputJson)
+	if out != `[{"uri":"track1","name":"Stir it up","artist":"Bob Marley","duration":"5m32s"},{"uri":"track2","name":"I wanna be sedated","artist":"Ramones","duration":"2m29s"}]`+"\n" {
+		t.Errorf("Wrong queue %q", out)
+	}
+
+	runCommand(t, client, "clear_queue", OutputText)
+	if out := runCommand(t, client, "queue", OutputJson); out != "[]\n" {
+		t.Errorf("Queue should be empty: %q", out)
+	}
+}
+
+func TestStatusAndMode(t *testing.T) {
+	client, _ := startTestServer(t)
+	defer client.Close()
+
+	runCommand(t, client, "mode shuffle_all", OutputText)
+	runCommand(t, client, "queue track0", OutputText)
+
+	var status Status
+	if err := client.Call("Server.Status", &NoArgs{}, &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.State != "stopped" || status.Mode != "shuffle_all" || len(status.Queue) != 1 || status.Volume != 100 {
+		t.Errorf("Wrong status %+v", status)
+	}
+
+	command, _ := parseCommand("mode random")
+	if err := command.run(client, OutputText, &bytes.Buffer{}); err == nil {
+		t.Error("Unknown mode should fail")
+	}
+}
+
+func TestListPlaylistsAndTracks(t *testing.T) {
+	client, _ := startTestServer(t)
+	defer client.Close()
+
+	if out := runCommand(t, client, "playlists", OutputText); out != "playlist0\tBob Marley\t2 track(s)\nplaylist1\tRamones\t1 track(s)\n" {
+		t.Errorf("Wrong playlists %q", out)
+	}
+	if out := runCommand(t, client, "tracks Bob Marley", OutputText); !strings.HasPrefix(out, "track0\tWaiting in vain") {
+		t.Errorf("Wrong tracks %q", out)
+	}
+}
+
+func TestParseCommandFails(t *testing.T) {
+	for _, line := range []string{"", "rewind", "dequeue first", "volume loud", "seek", "play", "search", "history last", "history 0"} {
+		if _, err := parseCommand(line); err == nil {
+			t.Errorf("Command %q should fail", line)
+		}
+	}
+}
+
+func TestHistoryAndStats(t *testing.T) {
+	playHistory := history.Open("")
+	startedAt := time.Now().Add(-time.Hour)
+	for _, play := range []*sconsify.Play{
+		{URI: "track0", Name: "Waiting in vain", Artist: "Bob Marley", ArtistURI: "artist0", Playlist: "Bob Marley", StartedAt: startedAt, Listened: 4 * time.Minute, Finished: true},
+		{URI: "track2", Name: "I wanna be sedated", Artist: "Ramones", ArtistURI: "artist1", StartedAt: startedAt.Add(5 * time.Minute), Listened: 10 * time.Second},
+		{URI: "track1", Name: "Stir it up", Artist: "Bob Marley", ArtistURI: "artist0", StartedAt: startedAt.Add(10 * time.Minute), Listened: time.Minute},
+	} {
+		if err := playHistory.Add(play); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client, _ := startTestServerWithHistory(t, playHistory)
+	defer client.Close()
+
+	out := runCommand(t, client, "history 2", OutputText)
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 2 || !strings.Contains(lines[0], "track1\tStir it up - Bob Marley\t\tskipped 1m0s") {
+		t.Errorf("Wrong history %q", out)
+	}
+
+	var stats StatsReply
+	if err := client.Call("Server.Stats", &PeriodArgs{Period: "day"}, &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Plays != 2 || stats.Skipped != 1 || stats.Listened != "5m10s" {
+		t.Errorf("Wrong stats %+v", stats)
+	}
+	if len(stats.TopArtists) != 1 || stats.TopArtists[0].Name != "Bob Marley" || stats.TopArtists[0].Plays != 2 {
+		t.Errorf("Bob Marley should be the only top artist: %+v", stats.TopArtists)
+	}
+	if out := runCommand(t, client, "stats all", OutputText); !strings.Contains(out, "top tracks:\n1\tStir it up - Bob Marley\t1 play(s)\n2\tWaiting in vain - Bob Marley\t1 play(s)\n") {
+		t.Errorf("Wrong stats %q", out)
+	}
+
+	command, _ := parseCommand("stats decade")
+	if err := command.run(client, OutputText, &bytes.Buffer{}); err == nil {
+		t.Error("Unknown period should fail")
+	}
+}
+
+func TestHistoryWithoutHistory(t *testing.T) {
+	client, _ := startTestServer(t)
+	defer client.Close()
+
+	command, _ := parseCommand("history")
+	if err := command.run(client, OutputText, &bytes.Buffer{}); err == nil || err.Error() != errNoHistory.Error() {
+		t.Errorf("History should fail without a history: %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package rpc
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/schaeferpp/sconsify/infrastructure"
+)
+
+// handshakeTimeout is how long a tcp client has to send the token.
+const handshakeTimeout = 5 * time.Second
+
+// ErrAlreadyRunning is returned when another sconsify owns the server socket.
+var ErrAlreadyRunning = errors.New("Another sconsify is already running with the server, stop it or start this one with -server=false")
+
+// authenticate accepts or refuses a connection before any request is read from
+// it, returning what the requests are read from.
+type authenticate func(conn net.Conn) (io.ReadWriteCloser, error)
+
+func serve(server *rpc.Server, listener net.Listener, authenticate authenticate) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			infrastructure.Debug("The server stopped accepting connections", "address", listener.Addr(), "error", err)
+			return
+		}
+		go func() {
+			authenticated, err := authenticate(conn)
+			if err != nil {
+				infrastructure.Warn("Connection to the server refused", "address", conn.RemoteAddr(), "error", err)
+				conn.Close()
+				return
+			}
+			server.ServeCodec(jsonrpc.NewServerCodec(authenticated))
+		}()
+	}
+}
+
+// listenUnix creates the socket, refusing to replace the socket of a sconsify
+// still running. A socket left by a sconsify that did not stop is replaced.
+func listenUnix(socket string) (net.Listener, error) {
+	if info, err := os.Lstat(socket); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("Cannot create the server socket, %v is not a socket", socket)
+		}
+		if conn, err := net.Dial("unix", socket); err == nil {
+			conn.Close()
+			return nil, ErrAlreadyRunning
+		}
+		os.Remove(socket)
+	}
+	if err := os.MkdirAll(filepath.Dir(socket), 0700); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(socket, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// listenTcp listens on a localhost address, e.g. localhost:45800 or just 45800.
+func listenTcp(address string) (net.Listener, error) {
+	address, err := localAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	return net.Listen("tcp", address)
+}
+
+func localAddress(address string) (string, error) {
+	if !strings.Contains(address, ":") {
+		address = ":" + address
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", err
+	}
+	if host == "" || host == "localhost" {
+		return net.JoinHostPort("localhost", port), nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return "", fmt.Errorf("The tcp server only listens on localhost, not on %v", host)
+	}
+	return address, nil
+}
+
+// createToken saves a new token the tcp clients must send, only the user being
+// able to read it.
+func createToken(location string) (string, error) {
+	if location == "" {
+		return "", errors.New("Cannot find where to save the server token")
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	if err := ioutil.WriteFile(location, []byte(token+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func readToken(location string) (string, error) {
+	token, err := ioutil.ReadFile(location)
+	if err != nil {
+		return "", fmt.Errorf("Cannot read the server token: %v", err)
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+// checkToken reads the first line of a tcp connection, which must be the token.
+func checkToken(token string) authenticate {
+	return func(conn net.Conn) (io.ReadWriteCloser, error) {
+		conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+		reader := bufio.NewReader(conn)
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(line)), []byte(token)) != 1 {
+			return nil, errors.New("Invalid token")
+		}
+		conn.SetReadDeadline(time.Time{})
+		return &bufferedConn{reader: reader, Conn: conn}, nil
+	}
+}
+
+// bufferedConn reads what the reader has buffered after the token first.
+type bufferedConn struct {
+	reader *bufio.Reader
+	net.Conn
+}
+
+func (conn *bufferedConn) Read(p []byte) (int, error) {
+	return conn.reader.Read(p)
+}
+
+func dialUnix(socket string) (*rpc.Client, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot connect to sconsify, is it running with its server? %v", err)
+	}
+	return jsonrpc.NewClient(conn), nil
+}
+
+func dialTcp(address string, token string) (*rpc.Client, error) {
+	address, err := localAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot connect to sconsify, is it running with -server-tcp? %v", err)
+	}
+	if _, err := fmt.Fprintln(conn, token); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return jsonrpc.NewClient(conn), nil
+}
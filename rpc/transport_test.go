@@ -0,0 +1,137 @@
+package rpc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/schaeferpp/sconsify/sconsify"
+)
+
+func TestListenUnixRefusesRunningServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sconsify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "sconsify.sock")
+
+	listener, err := listenUnix(socket)
+	if err != nil {
+		t.Fatalf("Socket should be created: %v", err)
+	}
+	if info, _ := os.Stat(socket); info.Mode().Perm() != 0600 {
+		t.Errorf("Only the user should connect to the socket: %v", info.Mode())
+	}
+	if _, err := listenUnix(socket); err != ErrAlreadyRunning {
+		t.Errorf("Running server should be reported: %v", err)
+	}
+	listener.Close()
+}
+
+func TestListenUnixReplacesStaleSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sconsify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "sconsify.sock")
+
+	// a socket nobody listens on anymore, as left by a killed sconsify
+	fd, err := syscall.Socket(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrUnix{Name: socket}); err != nil {
+		t.Fatal(err)
+	}
+	syscall.Close(fd)
+
+	listener, err := listenUnix(socket)
+	if err != nil {
+		t.Fatalf("Stale socket should be replaced: %v", err)
+	}
+	listener.Close()
+
+	ioutil.WriteFile(socket, []byte("not a socket"), 0600)
+	if _, err := listenUnix(socket); err == nil {
+		t.Error("A file should not be replaced")
+	}
+}
+
+func TestLocalAddress(t *testing.T) {
+	for address, expected := range map[string]string{"45800": "localhost:45800", ":45800": "localhost:45800", "127.0.0.1:45800": "127.0.0.1:45800", "[::1]:45800": "[::1]:45800"} {
+		if local, err := localAddress(address); err != nil || local != expected {
+			t.Errorf("Address %v should be %v but is %v: %v", address, expected, local, err)
+		}
+	}
+	for _, address := range []string{"0.0.0.0:45800", "192.168.1.2:45800", "example.com:45800"} {
+		if _, err := localAddress(address); err == nil {
+			t.Errorf("Address %v should be refused", address)
+		}
+	}
+}
+
+func TestTcpClientNeedsToken(t *testing.T) {
+	server, err := newServer(&Server{publisher: &sconsify.Publisher{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := listenTcp("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go serve(server, listener, checkToken("secret"))
+
+	var reply string
+	client, err := dialTcp(listener.Addr().String(), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Call("Server.Volume", &NoArgs{}, &reply); err != nil || reply != "100%" {
+		t.Errorf("Client with the token should be served: %v %v", reply, err)
+	}
+	client.Close()
+
+	client, err = dialTcp(listener.Addr().String(), "guess")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Call("Server.Volume", &NoArgs{}, &reply); err == nil {
+		t.Error("Client with a wrong token should be refused")
+	}
+	client.Close()
+}
+
+func TestUnixClientOfTheUserIsServed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sconsify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "sconsify.sock")
+
+	server, err := newServer(&Server{publisher: &sconsify.Publisher{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := listenUnix(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go serve(server, listener, checkPeer)
+
+	client, err := dialUnix(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	var reply string
+	if err := client.Call("Server.Volume", &NoArgs{}, &reply); err != nil || reply != "100%" {
+		t.Errorf("Client of the user should be served: %v %v", reply, err)
+	}
+}
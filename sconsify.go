@@ -9,10 +9,15 @@ import (
 	"strings"
 	"time"
 
+	"github.com/schaeferpp/sconsify/history"
 	"github.com/schaeferpp/sconsify/infrastructure"
+	"github.com/schaeferpp/sconsify/local"
+	"github.com/schaeferpp/sconsify/mpd"
+	"github.com/schaeferpp/sconsify/mpris"
 	"github.com/schaeferpp/sconsify/rpc"
 	"github.com/schaeferpp/sconsify/sconsify"
 	"github.com/schaeferpp/sconsify/spotify"
+	"github.com/schaeferpp/sconsify/spotify/mock"
 	"github.com/schaeferpp/sconsify/ui/noui"
 	"github.com/schaeferpp/sconsify/ui/simple"
 	"github.com/howeyc/gopass"
@@ -34,11 +39,19 @@ func init() {
 func main() {
 	infrastructure.ProcessSconsifyrc()
 
+	providedBackend := flag.String("backend", "spotify", "Playback backend: spotify (libspotify), local or mock.")
+	providedLocalDirectory := flag.String("local-dir", "~/Music", "Music directory played by the local backend.")
+	providedLocalPlaylists := flag.String("local-playlists", "folder", "Playlists created by the local backend: one per folder or one per album.")
+	providedAudioOutput := flag.String("audio-output", "portaudio", "Where the audio is played: portaudio, wav:/path, raw:/path, pipe (raw PCM to standard output), fifo:/path or null.")
+	providedNormalisation := flag.String("normalisation", "off", "Normalise the loudness of the tracks: off, track or album.")
+	providedCrossfade := flag.Duration("crossfade", 0, "Mix the end of a track with the beginning of the next one, e.g. 5s. Local backend only.")
 	providedUsername := flag.String("username", "", "Spotify username.")
 	providedWebApi := flag.Bool("web-api", true, "Use Spotify WEB API for more features. It requires web authorization.")
 	providedOpenBrowser := flag.String("open-browser-cmd", "", "Open browser command to complete the web authorization.")
-	providedStatusFile := flag.String("status-file", "", "File that sconsify will output status such as track being played.")
-	providedStatusFileTemplate := flag.String("status-file-template", "", "Status file template.")
+	var providedStatusFiles, providedStatusFileTemplates, providedStatusFileFormats stringsFlag
+	flag.Var(&providedStatusFiles, "status-file", "File that sconsify will output status such as track being played, can be given several times.")
+	flag.Var(&providedStatusFileTemplates, "status-file-template", "Status file template, one per status file, fields: Action, Track, Artist, Album, URI, Elapsed, Remaining, Duration, Playlist, Mode, Queue, Volume and Muted.")
+	flag.Var(&providedStatusFileFormats, "status-file-format", "Status file format, one per status file: text, from the template, or json.")
 	providedUi := flag.Bool("ui", true, "Run Sconsify with Console User Interface. If false then no User Interface will be presented and it'll shuffle tracks.")
 	providedPlaylists := flag.String("playlists", "", "Select just some Playlists to play. Comma separated list.")
 	providedPreferredBitrate := flag.String("preferred-bitrate", "320k", "Preferred bitrate: 96k, 160k, 320k.")
@@ -47,10 +60,22 @@ func main() {
 	providedNoUiShuffle := flag.Bool("noui-shuffle", true, "Shuffle tracks or follow playlist order.")
 	providedWebApiCacheToken := flag.Bool("web-api-cache-token", true, "Cache the web-api token as plain text in ~/.sconsify until its expiration.")
 	providedWebApiCacheContent := flag.Bool("web-api-cache-content", true, "Cache some of the web-api content as plain text in ~/.sconsify.")
-	providedDebug := flag.Bool("debug", false, "Enable debug mode.")
+	providedDebug := flag.Bool("debug", false, "Enable debug mode, the same as -log-level=debug.")
+	providedLogLevel := flag.String("log-level", "info", "Lowest level written to ~/.sconsify/sconsify.log and, from info, printed: debug, info, warn or error.")
+	providedLogFormat := flag.String("log-format", "text", "Format of the log file: text or json.")
 	askingVersion := flag.Bool("version", false, "Print version.")
-	providedCommand := flag.String("command", "", "Execute a command in the server: replay, play_pause, next")
-	providedServer := flag.Bool("server", true, "Start a background server to accept commands.")
+	providedCommand := flag.String("command", "", "Execute a command in the server: replay, play_pause, next, pause, position, \"seek <offset>\", volume, \"volume <level>\", volume_up, volume_down, mute, equalizer, \"equalizer <preset>\", status, playlists, \"tracks <playlist>\", \"play <track or playlist>\", queue, \"queue <track or playlist>\", \"dequeue <position>\", clear_queue, \"search <query>\", \"mode <mode>\", \"history [count]\", \"stats [period]\"")
+	providedCommandOutput := flag.String("command-output", rpc.OutputText, "Output of -command: text or json.")
+	providedCommandTcp := flag.String("command-tcp", "", "Send -command over tcp to a server started with -server-tcp, e.g. localhost:45800.")
+	providedServer := flag.Bool("server", true, "Start a background server to accept commands on a unix socket in $XDG_RUNTIME_DIR or ~/.sconsify.")
+	providedServerTcp := flag.String("server-tcp", "", "Accept commands on a localhost tcp address too, e.g. localhost:45800, the clients sending the token saved in ~/.sconsify/server-token.")
+	providedServerHttp := flag.String("server-http", "", "Serve the HTTP API on a localhost address, e.g. localhost:45801, the clients sending the token saved in ~/.sconsify/server-token.")
+	providedMpd := flag.String("mpd", "", "Answer MPD clients, e.g. mpc or ncmpcpp, on an address, e.g. localhost:6600.")
+	providedMpdPassword := flag.String("mpd-password", "", "Password the MPD clients must send, needed to listen beyond localhost.")
+	providedMpris := flag.Bool("mpris", true, "Expose the player on the D-Bus session bus as an MPRIS media player, e.g. for playerctl.")
+	providedHistory := flag.Bool("history", true, "Record the tracks played in ~/.sconsify/history.json, for the *History playlist and the history and stats commands.")
+	providedRecordEvents := flag.String("record-events", "", "Record every event to a journal file, one JSON object per line.")
+	providedReplayEvents := flag.String("replay-events", "", "Replay a journal recorded with -record-events against a mock backend doing nothing.")
 	flag.Parse()
 
 	if *askingVersion {
@@ -64,55 +89,203 @@ func main() {
 	}
 
 	if *providedDebug {
-		infrastructure.InitialiseLogger()
-		defer infrastructure.CloseLogger()
+		*providedLogLevel = "debug"
 	}
+	if err := infrastructure.InitialiseLogger(*providedLogLevel, *providedLogFormat); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer infrastructure.CloseLogger()
 
 	if *providedCommand != "" {
-		rpc.Client(*providedCommand)
+		if err := rpc.Client(*providedCommand, *providedCommandOutput, *providedCommandTcp); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
 		return
 	}
 
+	audioSink, err := spotify.ParseAudioSink(*providedAudioOutput)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := spotify.CheckNormalisation(*providedNormalisation); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	audioInitConf := &spotify.AudioInitConf{
+		Sink:          audioSink,
+		Crossfade:     *providedCrossfade,
+		Normalisation: *providedNormalisation,
+	}
+	var replayJournal *sconsify.Journal
+	if *providedReplayEvents != "" {
+		if replayJournal, err = readJournal(*providedReplayEvents); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		*providedBackend = "mock"
+		// the tracks replayed were not played, and the sconsify running, if
+		// any, keeps its server and status files
+		*providedHistory = false
+		*providedServer = false
+		*providedMpris = false
+		providedStatusFiles = nil
+		sconsify.ForgetEqualizerChanges()
+	}
+	if *providedAudioOutput == "pipe" {
+		// the standard output carries the audio, messages go to the standard error
+		os.Stdout = os.Stderr
+	}
+
 	fmt.Println("Sconsify - your awesome Spotify music service in a text-mode interface.")
-	username, pass := credentials(providedUsername)
-	events := sconsify.InitialiseEvents()
 	publisher := &sconsify.Publisher{}
+	// subscribed before anything starts publishing
+	backendEvents := publisher.Subscribe(sconsify.Subscription{Topics: sconsify.BackendTopics})
+	uiEvents := publisher.Subscribe(sconsify.Subscription{Topics: sconsify.UserInterfaceTopics})
 
-	if *providedStatusFile != "" {
-		statusFileTemplate := "{{.Action}}: {{.Track}} - {{.Artist}}\n"
-		if *providedStatusFileTemplate!= "" {
-			statusFileTemplate = *providedStatusFileTemplate
+	var playHistory *history.History
+	if *providedHistory {
+		playHistory = history.Open(infrastructure.GetHistoryFileLocation())
+		recorded := history.Record(publisher, playHistory)
+		defer func() {
+			// give the last track played a moment to be recorded before exiting
+			select {
+			case <-recorded:
+			case <-time.After(time.Second):
+			}
+		}()
+	}
+
+	if *providedServer {
+		// two sconsify would fight over the socket, without the server only the
+		// remote control is missing
+		if err := rpc.StartServer(publisher, &rpc.ServerConf{TcpAddress: *providedServerTcp, HttpAddress: *providedServerHttp, History: playHistory}); err == rpc.ErrAlreadyRunning {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		} else if err != nil {
+			infrastructure.Warn("Server not started", "error", err)
 		}
-		go ui.ToStatusFile(*providedStatusFile, statusFileTemplate)
 	}
 
-	initConf := &spotify.SpotifyInitConf{
-		WebApiAuth:         *providedWebApi,
-		PlaylistFilter:     *providedPlaylists,
-		PreferredBitrate:   *providedPreferredBitrate,
-		CacheWebApiToken:   *providedWebApiCacheToken,
-		CacheWebApiContent: *providedWebApiCacheContent,
-		SpotifyClientId:    spotifyClientId,
-		AuthRedirectUrl:    authRedirectUrl,
-		OpenBrowserCommand: *providedOpenBrowser,
+	if *providedMpd != "" {
+		if err := mpd.StartServer(publisher, &mpd.ServerConf{Address: *providedMpd, Password: *providedMpdPassword}); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
 	}
-	go spotify.Initialise(initConf, username, pass, events, publisher)
 
-	if *providedServer {
-		go rpc.StartServer(publisher)
+	if *providedMpris {
+		// no session bus is common, e.g. on macOS or over ssh, and not worth stopping for
+		if err := mpris.StartServer(publisher); err != nil {
+			infrastructure.Warn("MPRIS media player not exposed", "error", err)
+		}
+	}
+
+	if *providedRecordEvents != "" {
+		journal, err := os.Create(*providedRecordEvents)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer journal.Close()
+		sconsify.RecordEvents(publisher, journal)
+	}
+
+	if len(providedStatusFiles) > 0 {
+		statusFiles, err := ui.InitStatusFiles(providedStatusFiles, providedStatusFileTemplates, providedStatusFileFormats)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		stopped := ui.ToStatusFiles(publisher, statusFiles)
+		defer func() {
+			// give the stopped status a moment to be written before exiting
+			select {
+			case <-stopped:
+			case <-time.After(time.Second):
+			}
+		}()
+	}
+
+	switch *providedBackend {
+	case "spotify":
+		if *providedCrossfade > 0 {
+			fmt.Println("Crossfade is not supported by the spotify backend, libspotify plays one track at a time.")
+			audioInitConf.Crossfade = 0
+		}
+		username, pass := credentials(providedUsername)
+		initConf := &spotify.SpotifyInitConf{
+			WebApiAuth:         *providedWebApi,
+			PlaylistFilter:     *providedPlaylists,
+			PreferredBitrate:   *providedPreferredBitrate,
+			CacheWebApiToken:   *providedWebApiCacheToken,
+			CacheWebApiContent: *providedWebApiCacheContent,
+			SpotifyClientId:    spotifyClientId,
+			AuthRedirectUrl:    authRedirectUrl,
+			OpenBrowserCommand: *providedOpenBrowser,
+			Audio:              audioInitConf,
+		}
+		go spotify.Initialise(initConf, username, pass, backendEvents, publisher)
+	case "local":
+		initConf := &local.LocalInitConf{
+			Directory:    *providedLocalDirectory,
+			PlaylistMode: *providedLocalPlaylists,
+			Audio:        audioInitConf,
+		}
+		go local.Initialise(initConf, backendEvents, publisher)
+	case "mock":
+		if replayJournal != nil {
+			go mock.InitialiseReplay(backendEvents, publisher)
+		} else {
+			go mock.Initialise(backendEvents, publisher)
+		}
+	default:
+		fmt.Printf("Unknown backend: %v\n", *providedBackend)
+		os.Exit(1)
+	}
+
+	if replayJournal != nil {
+		go replayJournal.Replay(publisher)
 	}
 
 	if *providedUi {
-		ui := simple.InitialiseConsoleUserInterface(events, publisher, true)
-		sconsify.StartMainLoop(events, publisher, ui, false)
+		var uiHistory sconsify.PlayHistory
+		if playHistory != nil {
+			uiHistory = playHistory
+		}
+		ui := simple.InitialiseConsoleUserInterface(uiEvents, publisher, true, uiHistory)
+		sconsify.StartMainLoop(uiEvents, publisher, ui, false)
 	} else {
 		var output noui.Printer
 		if *providedNoUiSilent {
 			output = new(noui.SilentPrinter)
 		}
-		ui := noui.InitialiseNoUserInterface(events, publisher, output, providedNoUiRepeatOn, providedNoUiShuffle)
-		sconsify.StartMainLoop(events, publisher, ui, true)
+		ui := noui.InitialiseNoUserInterface(uiEvents, publisher, output, providedNoUiRepeatOn, providedNoUiShuffle)
+		sconsify.StartMainLoop(uiEvents, publisher, ui, true)
+	}
+}
+
+// stringsFlag is a flag given several times.
+type stringsFlag []string
+
+func (values *stringsFlag) String() string {
+	return strings.Join(*values, ", ")
+}
+
+func (values *stringsFlag) Set(value string) error {
+	*values = append(*values, value)
+	return nil
+}
+
+func readJournal(path string) (*sconsify.Journal, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
 	}
+	defer file.Close()
+	return sconsify.ReadJournal(file)
 }
 
 func credentials(providedUsername *string) (string, []byte) {
@@ -6,3 +6,11 @@ type Album struct {
 	Name    string
 	Artists []*Artist
 }
+
+func InitAlbum(URI string, name string, artist *Artist) *Album {
+	return &Album{
+		URI:     URI,
+		Name:    name,
+		Artists: []*Artist{artist},
+	}
+}
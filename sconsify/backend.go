@@ -0,0 +1,106 @@
+package sconsify
+
+import (
+	"time"
+
+	"github.com/schaeferpp/sconsify/infrastructure"
+)
+
+// Backend is a playback engine. It loads the playlists, plays the tracks requested
+// by the user interfaces and reports back through the publisher.
+type Backend interface {
+	LoadPlaylists() error
+	Play(track *Track)
+	Pause()
+	PlayPauseToggle()
+	Replay()
+	Seek(offset time.Duration)
+	// Prefetch prepares the track expected to play next, the following Play of
+	// the same track continues without a gap.
+	Prefetch(track *Track)
+	SetVolume(volume Volume)
+	SetEqualizer(equalizer Equalizer)
+	Search(query string)
+	ArtistAlbums(artist *Artist)
+	Shutdown()
+}
+
+// StartBackend loads the playlists and then dispatches the published events to the
+// backend until a shutdown is requested. It owns the volume and the equalizer so
+// every user interface changes the same ones. The playlist edits are saved from
+// their own goroutine, in the order they were made, so the playback does not
+// wait for Spotify.
+func StartBackend(backend Backend, events *Events, publisher *Publisher) error {
+	if err := backend.LoadPlaylists(); err != nil {
+		return err
+	}
+
+	shutdown := make(chan struct{})
+	defer close(shutdown)
+	go editPlaylists(backend, events, publisher, shutdown)
+
+	volume := InitVolume()
+	changeVolume := func(newVolume Volume) {
+		volume = newVolume
+		backend.SetVolume(volume)
+		publisher.VolumeChanged(volume)
+	}
+
+	fileLocation := equalizerFileLocation()
+	settings := loadEqualizerSettings(fileLocation)
+	changeEqualizer := func() {
+		equalizer := settings.equalizer()
+		backend.SetEqualizer(equalizer)
+		publisher.EqualizerChanged(equalizer)
+	}
+	if equalizer := settings.equalizer(); equalizer.IsFlat() {
+		publisher.EqualizerChanged(equalizer)
+	} else {
+		changeEqualizer()
+	}
+
+	for {
+		select {
+		case track := <-events.PlayUpdates():
+			backend.Play(track)
+		case <-events.PauseUpdates():
+			backend.Pause()
+		case <-events.PlayPauseToggleUpdates():
+			backend.PlayPauseToggle()
+		case <-events.ReplayUpdates():
+			backend.Replay()
+		case offset := <-events.SeekUpdates():
+			backend.Seek(offset)
+		case track := <-events.PrefetchUpdates():
+			backend.Prefetch(track)
+		case level := <-events.SetVolumeUpdates():
+			changeVolume(volume.set(level))
+		case <-events.VolumeUpUpdates():
+			changeVolume(volume.up())
+		case <-events.VolumeDownUpdates():
+			changeVolume(volume.down())
+		case <-events.ToggleMuteUpdates():
+			changeVolume(volume.toggleMute())
+		case preset := <-events.SetEqualizerPresetUpdates():
+			if settings.setPreset(preset) {
+				settings.save(fileLocation)
+				changeEqualizer()
+			} else {
+				infrastructure.Warn("Unknown equalizer preset", "preset", preset)
+			}
+		case band := <-events.SetEqualizerBandUpdates():
+			if settings.setBand(band.Band, band.Gain) {
+				settings.save(fileLocation)
+				changeEqualizer()
+			}
+		case query := <-events.SearchUpdates():
+			backend.Search(query)
+		case artist := <-events.GetArtistAlbumsUpdates():
+			backend.ArtistAlbums(artist)
+		case <-events.ShutdownSpotifyUpdates():
+			backend.Shutdown()
+			publisher.ShutdownEngine()
+			return nil
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package sconsify
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func init() {
+	// the tests don't read or change the equalizer settings of the user
+	equalizerFileLocation = func() string { return "" }
+}
+
+type TestBackend struct {
+	calls         chan string
+	loadPlaylists error
+}
+
+func newTestBackend() *TestBackend {
+	return &TestBackend{calls: make(chan string, 10)}
+}
+
+func (backend *TestBackend) LoadPlaylists() error {
+	backend.calls <- "LoadPlaylists"
+	return backend.loadPlaylists
+}
+
+func (backend *TestBackend) Play(track *Track) {
+	backend.calls <- "Play " + track.URI
+}
+
+func (backend *TestBackend) Pause() {
+	backend.calls <- "Pause"
+}
+
+func (backend *TestBackend) PlayPauseToggle() {
+	backend.calls <- "PlayPauseToggle"
+}
+
+func (backend *TestBackend) Replay() {
+	backend.calls <- "Replay"
+}
+
+func (backend *TestBackend) Seek(offset time.Duration) {
+	backend.calls <- "Seek " + offset.String()
+}
+
+func (backend *TestBackend) Prefetch(track *Track) {
+	backend.calls <- "Prefetch " + track.URI
+}
+
+func (backend *TestBackend) SetVolume(volume Volume) {
+	backend.calls <- fmt.Sprintf("SetVolume %v %v", volume.Level, volume.Muted)
+}
+
+func (backend *TestBackend) SetEqualizer(equalizer Equalizer) {
+	backend.calls <- fmt.Sprintf("SetEqualizer %v %v", equalizer.Preset, equalizer.GainsString())
+}
+
+func (backend *TestBackend) Search(query string) {
+	backend.calls <- "Search " + query
+}
+
+func (backend *TestBackend) ArtistAlbums(artist *Artist) {
+	backend.calls <- "ArtistAlbums " + artist.Name
+}
+
+func (backend *TestBackend) Shutdown() {
+	backend.calls <- "Shutdown"
+}
+
+func TestStartBackendDispatchesEvents(t *testing.T) {
+	publisher := &Publisher{}
+	events := publisher.Subscribe(Subscription{})
+	backend := newTestBackend()
+
+	finished := make(chan error)
+	go func() {
+		finished <- StartBackend(backend, events, publisher)
+	}()
+
+	assertBackendCall(t, backend, "LoadPlaylists")
+
+	publisher.Play(InitPartialTrack("track0"))
+	assertBackendCall(t, backend, "Play track0")
+
+	publisher.Pause()
+	assertBackendCall(t, backend, "Pause")
+
+	publisher.PlayPauseToggle()
+	assertBackendCall(t, backend, "PlayPauseToggle")
+
+	publisher.Replay()
+	assertBackendCall(t, backend, "Replay")
+
+	publisher.Seek(-10 * time.Second)
+	assertBackendCall(t, backend, "Seek -10s")
+
+	publisher.Prefetch(InitPartialTrack("track1"))
+	assertBackendCall(t, backend, "Prefetch track1")
+
+	publisher.Search("elvis")
+	assertBackendCall(t, backend, "Search elvis")
+
+	publisher.GetArtistAlbums(InitArtist("artist0", "Elvis Presley"))
+	assertBackendCall(t, backend, "ArtistAlbums Elvis Presley")
+
+	go publisher.ShutdownSpotify()
+	assertBackendCall(t, backend, "Shutdown")
+
+	<-events.ShutdownEngineUpdates()
+	if err := <-finished; err != nil {
+		t.Errorf("Backend should finish without error: %v", err)
+	}
+}
+
+func TestStartBackendChangesVolume(t *testing.T) {
+	publisher := &Publisher{}
+	events := publisher.Subscribe(Subscription{})
+	backend := newTestBackend()
+
+	go StartBackend(backend, events, publisher)
+	assertBackendCall(t, backend, "LoadPlaylists")
+
+	publisher.VolumeUp()
+	assertBackendCall(t, backend, "SetVolume 100 false")
+
+	publisher.VolumeDown()
+	assertBackendCall(t, backend, "SetVolume 95 false")
+
+	publisher.ToggleMute()
+	assertBackendCall(t, backend, "SetVolume 95 true")
+
+	publisher.VolumeUp()
+	assertBackendCall(t, backend, "SetVolume 100 false")
+
+	publisher.SetVolume(-20)
+	assertBackendCall(t, backend, "SetVolume 0 false")
+
+	go publisher.ShutdownSpotify()
+	assertBackendCall(t, backend, "Shutdown")
+	<-events.ShutdownEngineUpdates()
+
+	if volume := publisher.CurrentVolume(); volume.Level != 0 || volume.Muted {
+		t.Errorf("Last volume should be published but is %+v", volume)
+	}
+}
+
+func TestStartBackendChangesEqualizer(t *testing.T) {
+	publisher := &Publisher{}
+	events := publisher.Subscribe(Subscription{})
+	backend := newTestBackend()
+
+	go StartBackend(backend, events, publisher)
+	assertBackendCall(t, backend, "LoadPlaylists")
+
+	publisher.SetEqualizerPreset("bass")
+	assertBackendCall(t, backend, "SetEqualizer bass +6 +5 +4 +2 0 0 0 0 0 0")
+
+	publisher.SetEqualizerBand(1, 20)
+	assertBackendCall(t, backend, "SetEqualizer custom +6 +12 +4 +2 0 0 0 0 0 0")
+
+	publisher.SetEqualizerPreset("unknown")
+	go publisher.ShutdownSpotify()
+	assertBackendCall(t, backend, "Shutdown")
+	<-events.ShutdownEngineUpdates()
+
+	if equalizer := publisher.CurrentEqualizer(); equalizer.Preset != CustomPreset {
+		t.Errorf("Last equalizer should be published but is %+v", equalizer)
+	}
+}
+
+func TestStartBackendFailingToLoadPlaylists(t *testing.T) {
+	publisher := &Publisher{}
+	events := publisher.Subscribe(Subscription{Topics: BackendTopics})
+	backend := newTestBackend()
+	backend.loadPlaylists = errors.New("No playlist to load")
+
+	if err := StartBackend(backend, events, publisher); err == nil {
+		t.Error("Backend should return the error loading playlists")
+	}
+	assertBackendCall(t, backend, "LoadPlaylists")
+}
+
+func assertBackendCall(t *testing.T, backend *TestBackend, expected string) {
+	select {
+	case call := <-backend.calls:
+		if call != expected {
+			t.Errorf("Backend should receive '%v' but received '%v'", expected, call)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Backend did not receive '%v'", expected)
+	}
+}
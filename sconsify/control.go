@@ -0,0 +1,80 @@
+package sconsify
+
+import (
+	"errors"
+	"time"
+)
+
+// controlTimeout is how long a remote control waits for the user interface,
+// shortened by the tests.
+var controlTimeout = 5 * time.Second
+
+// TrackQueue is the queue of a user interface, played before the playlists.
+type TrackQueue interface {
+	Add(track *Track) *Track
+	Remove(index int) *Track
+	RemoveAll()
+	Contents() []*Track
+}
+
+// ControlRequest is a request of a remote control, e.g. the rpc server, reading
+// or changing the playlists and the queue of the user interface.
+type ControlRequest struct {
+	run   func(playlists *Playlists, queue TrackQueue) (interface{}, error)
+	reply chan controlReply
+	// abandoned is closed once the remote control stopped waiting, the request
+	// being left out when it is received too late
+	abandoned chan struct{}
+}
+
+type controlReply struct {
+	result interface{}
+	err    error
+}
+
+// Run runs the request and replies to the remote control. It is called by the
+// user interface from the goroutine owning its playlists and queue, the queue
+// being nil for a user interface without one.
+func (request *ControlRequest) Run(playlists *Playlists, queue TrackQueue) {
+	select {
+	case <-request.abandoned:
+		return
+	default:
+	}
+	if playlists == nil {
+		request.reply <- controlReply{err: errors.New("No playlist loaded yet")}
+		return
+	}
+	result, err := request.run(playlists, queue)
+	request.reply <- controlReply{result: result, err: err}
+}
+
+// Control asks the user interface to run the request, returning what it returned.
+// The request is published aside so a user interface too busy to receive it
+// fails the remote control after the timeout too.
+func (publisher *Publisher) Control(run func(playlists *Playlists, queue TrackQueue) (interface{}, error)) (interface{}, error) {
+	request := &ControlRequest{run: run, reply: make(chan controlReply, 1), abandoned: make(chan struct{})}
+	go publisher.publish(TopicControl, request)
+
+	select {
+	case reply := <-request.reply:
+		return reply.result, reply.err
+	case <-time.After(controlTimeout):
+		close(request.abandoned)
+		return nil, errors.New("The user interface is not answering")
+	}
+}
+
+func (events *Events) ControlUpdates() <-chan *ControlRequest {
+	return events.control
+}
+
+// QueueChanged tells the remote controls the queue of the user interface
+// changed, e.g. a track was queued or played from the queue.
+func (publisher *Publisher) QueueChanged() {
+	publisher.publish(TopicQueueChanged, true)
+}
+
+func (events *Events) QueueChangedUpdates() <-chan bool {
+	return events.queueChanged
+}
@@ -0,0 +1,178 @@
+package sconsify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/schaeferpp/sconsify/infrastructure"
+)
+
+const (
+	// MaxEqualizerGain is the most a band is boosted or cut, in dB.
+	MaxEqualizerGain = 12
+	EqualizerStep    = 1
+
+	FlatPreset   = "flat"
+	CustomPreset = "custom"
+)
+
+// EqualizerFrequencies are the centre frequencies, in Hz, of the equalizer bands.
+var EqualizerFrequencies = []float64{31, 62, 125, 250, 500, 1000, 2000, 4000, 8000, 16000}
+
+var equalizerPresets = map[string][]float64{
+	FlatPreset:   {0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+	"bass":       {6, 5, 4, 2, 0, 0, 0, 0, 0, 0},
+	"treble":     {0, 0, 0, 0, 0, 0, 2, 4, 5, 6},
+	"vocal":      {-2, -2, -1, 0, 2, 4, 4, 2, 0, -1},
+	"rock":       {4, 3, 2, 0, -1, -1, 0, 2, 3, 4},
+	"headphones": {3, 2, 1, 0, -1, -1, 0, 1, 3, 2},
+	"loudness":   {5, 4, 2, 0, -1, 0, 0, 2, 4, 5},
+}
+
+// equalizerFileLocation is where the settings are kept, replaced by the tests so
+// they don't touch the user's settings.
+var equalizerFileLocation = infrastructure.GetEqualizerFileLocation
+
+// ForgetEqualizerChanges starts the equalizer flat and keeps its changes in
+// memory only, e.g. while replaying a journal. Called before the backend starts.
+func ForgetEqualizerChanges() {
+	equalizerFileLocation = func() string { return "" }
+}
+
+// Equalizer is the gain of each band, in dB, applied by the audio output, along
+// with the presets it can switch to.
+type Equalizer struct {
+	Preset  string
+	Gains   []float64
+	Presets []string
+}
+
+func (equalizer Equalizer) IsFlat() bool {
+	for _, gain := range equalizer.Gains {
+		if gain != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (equalizer Equalizer) String() string {
+	if equalizer.IsFlat() {
+		return ""
+	}
+	return fmt.Sprintf("[EQ %v] ", equalizer.Preset)
+}
+
+// GainsString formats the gains as signed whole dB, e.g. "+4 +2 0 -1".
+func (equalizer Equalizer) GainsString() string {
+	gains := make([]string, len(equalizer.Gains))
+	for i, gain := range equalizer.Gains {
+		gains[i] = FormatEqualizerGain(gain)
+	}
+	return strings.Join(gains, " ")
+}
+
+func FormatEqualizerGain(gain float64) string {
+	if gain == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%+g", gain)
+}
+
+// equalizerSettings is what the equalizer file keeps: the selected preset, the
+// band gains changed by hand as the custom preset and presets added by the user.
+type equalizerSettings struct {
+	Preset  string
+	Custom  []float64
+	Presets map[string][]float64
+}
+
+func loadEqualizerSettings(fileLocation string) *equalizerSettings {
+	settings := &equalizerSettings{Preset: FlatPreset}
+	if fileLocation != "" {
+		if b, err := ioutil.ReadFile(fileLocation); err == nil {
+			if err := json.Unmarshal(b, settings); err != nil {
+				infrastructure.Warn("Cannot read the equalizer settings", "file", fileLocation, "error", err)
+			}
+		}
+	}
+	if _, found := settings.gains(settings.Preset); !found {
+		settings.Preset = FlatPreset
+	}
+	return settings
+}
+
+func (settings *equalizerSettings) save(fileLocation string) {
+	if fileLocation != "" {
+		if b, err := json.MarshalIndent(settings, "", "  "); err == nil {
+			infrastructure.SaveFile(fileLocation, b)
+		}
+	}
+}
+
+// gains returns a copy of the gains of the preset, user presets replacing the
+// built in ones with the same name.
+func (settings *equalizerSettings) gains(preset string) ([]float64, bool) {
+	gains, found := settings.Presets[preset]
+	if !found {
+		gains, found = equalizerPresets[preset]
+	}
+	if preset == CustomPreset {
+		gains, found = settings.Custom, settings.Custom != nil
+	}
+	if !found || len(gains) != len(EqualizerFrequencies) {
+		return nil, false
+	}
+	return append([]float64(nil), gains...), true
+}
+
+func (settings *equalizerSettings) presets() []string {
+	names := make([]string, 0, len(equalizerPresets)+len(settings.Presets)+1)
+	for name := range equalizerPresets {
+		names = append(names, name)
+	}
+	for name := range settings.Presets {
+		if _, builtIn := equalizerPresets[name]; !builtIn {
+			names = append(names, name)
+		}
+	}
+	if settings.Custom != nil {
+		names = append(names, CustomPreset)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (settings *equalizerSettings) equalizer() Equalizer {
+	gains, _ := settings.gains(settings.Preset)
+	return Equalizer{Preset: settings.Preset, Gains: gains, Presets: settings.presets()}
+}
+
+func (settings *equalizerSettings) setPreset(preset string) bool {
+	if _, found := settings.gains(preset); !found {
+		return false
+	}
+	settings.Preset = preset
+	return true
+}
+
+// setBand changes the gain of a band of the current gains, which become the
+// custom preset.
+func (settings *equalizerSettings) setBand(band int, gain float64) bool {
+	if band < 0 || band >= len(EqualizerFrequencies) {
+		return false
+	}
+	if gain > MaxEqualizerGain {
+		gain = MaxEqualizerGain
+	} else if gain < -MaxEqualizerGain {
+		gain = -MaxEqualizerGain
+	}
+	gains, _ := settings.gains(settings.Preset)
+	gains[band] = gain
+	settings.Custom = gains
+	settings.Preset = CustomPreset
+	return true
+}
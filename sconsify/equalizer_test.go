@@ -0,0 +1,67 @@
+package sconsify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEqualizerSettingsWithoutFile(t *testing.T) {
+	equalizer := loadEqualizerSettings("").equalizer()
+
+	if equalizer.Preset != FlatPreset || !equalizer.IsFlat() || equalizer.String() != "" {
+		t.Errorf("Equalizer should be flat without settings: %+v", equalizer)
+	}
+	if strings.Join(equalizer.Presets, ",") != "bass,flat,headphones,loudness,rock,treble,vocal" {
+		t.Errorf("Built in presets should be listed but are %v", equalizer.Presets)
+	}
+}
+
+func TestEqualizerSettingsBands(t *testing.T) {
+	settings := loadEqualizerSettings("")
+
+	if settings.setPreset("unknown") {
+		t.Error("Unknown preset should not be set")
+	}
+	settings.setPreset("treble")
+	settings.setBand(0, -20)
+	if settings.setBand(len(EqualizerFrequencies), 1) {
+		t.Error("Band out of range should not be set")
+	}
+
+	equalizer := settings.equalizer()
+	if equalizer.Preset != CustomPreset || equalizer.GainsString() != "-12 0 0 0 0 0 +2 +4 +5 +6" {
+		t.Errorf("Changing a band should make a custom preset from the current one: %v %v", equalizer.Preset, equalizer.GainsString())
+	}
+	if equalizer.String() != "[EQ custom] " {
+		t.Errorf("Custom equalizer should be shown but is %v", equalizer.String())
+	}
+
+	settings.setPreset("bass")
+	if !settings.setPreset(CustomPreset) || settings.equalizer().Gains[0] != -12 {
+		t.Error("Custom preset should be kept when switching presets")
+	}
+}
+
+func TestEqualizerSettingsFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "sconsify")
+	defer os.RemoveAll(dir)
+	location := filepath.Join(dir, "equalizer.json")
+	ioutil.WriteFile(location, []byte(`{"Preset": "mine", "Presets": {"mine": [1, 1, 1, 1, 1, 1, 1, 1, 1, 1], "short": [1]}}`), 0600)
+
+	settings := loadEqualizerSettings(location)
+	if equalizer := settings.equalizer(); equalizer.Preset != "mine" || equalizer.Gains[9] != 1 {
+		t.Errorf("User preset should be selected: %+v", equalizer)
+	}
+	if settings.setPreset("short") {
+		t.Error("Preset without a gain for every band should not be set")
+	}
+
+	settings.setBand(9, 3)
+	settings.save(location)
+	if equalizer := loadEqualizerSettings(location).equalizer(); equalizer.Preset != CustomPreset || equalizer.Gains[9] != 3 {
+		t.Errorf("Custom preset should be saved: %+v", equalizer)
+	}
+}
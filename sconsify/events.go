@@ -1,14 +1,41 @@
 package sconsify
 
 import (
+	"reflect"
+	"sync"
 	"time"
 )
 
+// Publisher delivers the events to its subscribers. The zero value is ready to
+// use.
 type Publisher struct {
+	mutex       sync.Mutex
+	subscribers []*Events
+	track       *Track
+	paused      bool
+	position    Position
+	volume      *Volume
+	equalizer   *Equalizer
+}
 
+// Position is the playback position of the current track, counted by the audio
+// output from the frames actually played.
+type Position struct {
+	Elapsed time.Duration
+	Total   time.Duration
 }
 
+// Events are the channels of a subscriber, nil for the topics not subscribed.
 type Events struct {
+	channels    map[Topic]reflect.Value
+	policy      DropPolicy
+	stream      chan Event
+	done        chan struct{}
+	unsubscribe sync.Once
+	// snapshot, when set, replaces the values by copies taken before any
+	// subscriber receives them, e.g. the playlists the user interface changes
+	snapshot func(topic Topic, value interface{}) interface{}
+
 	shutdownEngine  chan bool
 	shutdownSpotify chan bool
 
@@ -17,6 +44,18 @@ type Events struct {
 	search          chan string
 	replay          chan bool
 	playPauseToggle chan bool
+	seek            chan time.Duration
+	prefetch        chan *Track
+
+	setVolume     chan int
+	volumeUp      chan bool
+	volumeDown    chan bool
+	toggleMute    chan bool
+	volumeChanged chan Volume
+
+	setEqualizerPreset chan string
+	setEqualizerBand   chan EqualizerBand
+	equalizerChanged   chan Equalizer
 
 	getArtistAlbums chan *Artist
 	artistAlbums    chan *Playlist
@@ -28,59 +67,318 @@ type Events struct {
 	trackPlaying      chan *Track
 	trackPaused       chan *Track
 
-	newTrackLoaded chan time.Duration
+	newTrackLoaded   chan time.Duration
+	playbackPosition chan Position
+	trackEnding      chan bool
+
+	control      chan *ControlRequest
+	queueChanged chan bool
+
+	editPlaylist          chan *PlaylistEdit
+	playlistEdited        chan *PlaylistEdit
+	playlistEditsReplayed chan *PlaylistEditsReplay
+
+	playSource   chan *PlaySource
+	playRecorded chan *Play
 }
 
+// Topic is a kind of event, a subscriber only receives the topics it asked for.
+type Topic string
+
+const (
+	TopicShutdownEngine  Topic = "shutdownEngine"
+	TopicShutdownSpotify Topic = "shutdownSpotify"
+
+	TopicPlay            Topic = "play"
+	TopicPause           Topic = "pause"
+	TopicSearch          Topic = "search"
+	TopicReplay          Topic = "replay"
+	TopicPlayPauseToggle Topic = "playPauseToggle"
+	TopicSeek            Topic = "seek"
+	TopicPrefetch        Topic = "prefetch"
+
+	TopicSetVolume     Topic = "setVolume"
+	TopicVolumeUp      Topic = "volumeUp"
+	TopicVolumeDown    Topic = "volumeDown"
+	TopicToggleMute    Topic = "toggleMute"
+	TopicVolumeChanged Topic = "volumeChanged"
+
+	TopicSetEqualizerPreset Topic = "setEqualizerPreset"
+	TopicSetEqualizerBand   Topic = "setEqualizerBand"
+	TopicEqualizerChanged   Topic = "equalizerChanged"
+
+	TopicGetArtistAlbums Topic = "getArtistAlbums"
+	TopicArtistAlbums    Topic = "artistAlbums"
+
+	TopicNextPlay          Topic = "nextPlay"
+	TopicPlayTokenLost     Topic = "playTokenLost"
+	TopicPlaylists         Topic = "playlists"
+	TopicTrackNotAvailable Topic = "trackNotAvailable"
+	TopicTrackPlaying      Topic = "trackPlaying"
+	TopicTrackPaused       Topic = "trackPaused"
+
+	TopicNewTrackLoaded   Topic = "newTrackLoaded"
+	TopicPlaybackPosition Topic = "playbackPosition"
+	TopicTrackEnding      Topic = "trackEnding"
+
+	TopicControl      Topic = "control"
+	TopicQueueChanged Topic = "queueChanged"
+
+	TopicEditPlaylist          Topic = "editPlaylist"
+	TopicPlaylistEdited        Topic = "playlistEdited"
+	TopicPlaylistEditsReplayed Topic = "playlistEditsReplayed"
+
+	TopicPlaySource   Topic = "playSource"
+	TopicPlayRecorded Topic = "playRecorded"
+)
+
 var (
-	subscribers []*Events
+	// BackendTopics are the requests dispatched by StartBackend.
+	BackendTopics = []Topic{
+		TopicShutdownSpotify, TopicPlay, TopicPause, TopicSearch, TopicReplay, TopicPlayPauseToggle,
+		TopicSeek, TopicPrefetch, TopicSetVolume, TopicVolumeUp, TopicVolumeDown, TopicToggleMute,
+		TopicSetEqualizerPreset, TopicSetEqualizerBand, TopicGetArtistAlbums, TopicEditPlaylist,
+	}
+
+	// UserInterfaceTopics are the updates dispatched by StartMainLoop.
+	UserInterfaceTopics = []Topic{
+		TopicShutdownEngine, TopicVolumeChanged, TopicEqualizerChanged, TopicArtistAlbums,
+		TopicNextPlay, TopicPlayTokenLost, TopicPlaylists, TopicTrackNotAvailable, TopicTrackPlaying,
+		TopicTrackPaused, TopicNewTrackLoaded, TopicPlaybackPosition, TopicTrackEnding, TopicControl,
+		TopicPlaylistEdited, TopicPlaylistEditsReplayed, TopicPlayRecorded,
+	}
+)
+
+// topic is the channel of Events a topic is delivered to. Lossy topics are
+// notifications the publisher never waits for, a newer one replacing them.
+type topic struct {
+	channel func(events *Events) interface{}
+	buffer  int
+	lossy   bool
+}
+
+var topics = map[Topic]topic{
+	TopicShutdownEngine:  {channel: func(events *Events) interface{} { return &events.shutdownEngine }},
+	TopicShutdownSpotify: {channel: func(events *Events) interface{} { return &events.shutdownSpotify }},
+
+	TopicPlay:            {channel: func(events *Events) interface{} { return &events.play }},
+	TopicPause:           {channel: func(events *Events) interface{} { return &events.pause }},
+	TopicSearch:          {channel: func(events *Events) interface{} { return &events.search }},
+	TopicReplay:          {channel: func(events *Events) interface{} { return &events.replay }},
+	TopicPlayPauseToggle: {channel: func(events *Events) interface{} { return &events.playPauseToggle }},
+	TopicSeek:            {channel: func(events *Events) interface{} { return &events.seek }},
+	TopicPrefetch:        {channel: func(events *Events) interface{} { return &events.prefetch }},
+
+	TopicSetVolume:     {channel: func(events *Events) interface{} { return &events.setVolume }},
+	TopicVolumeUp:      {channel: func(events *Events) interface{} { return &events.volumeUp }},
+	TopicVolumeDown:    {channel: func(events *Events) interface{} { return &events.volumeDown }},
+	TopicToggleMute:    {channel: func(events *Events) interface{} { return &events.toggleMute }},
+	TopicVolumeChanged: {channel: func(events *Events) interface{} { return &events.volumeChanged }, buffer: 2, lossy: true},
+
+	TopicSetEqualizerPreset: {channel: func(events *Events) interface{} { return &events.setEqualizerPreset }},
+	TopicSetEqualizerBand:   {channel: func(events *Events) interface{} { return &events.setEqualizerBand }},
+	TopicEqualizerChanged:   {channel: func(events *Events) interface{} { return &events.equalizerChanged }, buffer: 2, lossy: true},
+
+	TopicGetArtistAlbums: {channel: func(events *Events) interface{} { return &events.getArtistAlbums }},
+	TopicArtistAlbums:    {channel: func(events *Events) interface{} { return &events.artistAlbums }},
+
+	TopicNextPlay:          {channel: func(events *Events) interface{} { return &events.nextPlay }},
+	TopicPlayTokenLost:     {channel: func(events *Events) interface{} { return &events.playTokenLost }},
+	TopicPlaylists:         {channel: func(events *Events) interface{} { return &events.playlists }},
+	TopicTrackNotAvailable: {channel: func(events *Events) interface{} { return &events.trackNotAvailable }},
+	TopicTrackPlaying:      {channel: func(events *Events) interface{} { return &events.trackPlaying }, buffer: 2},
+	TopicTrackPaused:       {channel: func(events *Events) interface{} { return &events.trackPaused }},
+
+	TopicNewTrackLoaded:   {channel: func(events *Events) interface{} { return &events.newTrackLoaded }, buffer: 2, lossy: true},
+	TopicPlaybackPosition: {channel: func(events *Events) interface{} { return &events.playbackPosition }, buffer: 2, lossy: true},
+	TopicTrackEnding:      {channel: func(events *Events) interface{} { return &events.trackEnding }, buffer: 1, lossy: true},
+
+	TopicControl:      {channel: func(events *Events) interface{} { return &events.control }},
+	TopicQueueChanged: {channel: func(events *Events) interface{} { return &events.queueChanged }, buffer: 1, lossy: true},
+
+	TopicEditPlaylist:          {channel: func(events *Events) interface{} { return &events.editPlaylist }},
+	TopicPlaylistEdited:        {channel: func(events *Events) interface{} { return &events.playlistEdited }},
+	TopicPlaylistEditsReplayed: {channel: func(events *Events) interface{} { return &events.playlistEditsReplayed }},
+
+	TopicPlaySource:   {channel: func(events *Events) interface{} { return &events.playSource }},
+	TopicPlayRecorded: {channel: func(events *Events) interface{} { return &events.playRecorded }},
+}
+
+// DropPolicy is what the publisher does when a subscriber's channel is full.
+type DropPolicy int
+
+const (
+	// Block waits for the subscriber to receive the event, or to unsubscribe.
+	// Lossy topics never block, the new event is dropped instead.
+	Block DropPolicy = iota
+	// DropNewest discards the event being published.
+	DropNewest
+	// DropOldest discards the oldest event waiting in the channel to make room.
+	DropOldest
 )
 
-func init() {
-	subscribers = make([]*Events, 0)
+// Subscription is what a subscriber receives. Without topics it receives every
+// topic. The channels buffer at least Buffer events, DropOldest needing at least
+// one. A Stream subscriber receives all its topics through StreamUpdates, in the
+// order they are published.
+type Subscription struct {
+	Topics []Topic
+	Buffer int
+	Policy DropPolicy
+	Stream bool
 }
 
-func InitialiseEvents() *Events {
+// Event is a published event as received through StreamUpdates, Value being what
+// the updates of its topic deliver.
+type Event struct {
+	Topic Topic
+	Time  time.Time
+	Value interface{}
+}
+
+// Subscribe registers a subscriber, it receives the events published from now
+// on until it unsubscribes. The updates of the topics not subscribed never
+// deliver anything.
+func (publisher *Publisher) Subscribe(subscription Subscription) *Events {
+	return publisher.subscribe(subscription, nil)
+}
+
+func (publisher *Publisher) subscribe(subscription Subscription, snapshot func(topic Topic, value interface{}) interface{}) *Events {
 	events := &Events{
-		shutdownEngine:  make(chan bool),
-		shutdownSpotify: make(chan bool),
-
-		play:            make(chan *Track),
-		pause:           make(chan bool),
-		search:          make(chan string),
-		replay:          make(chan bool),
-		playPauseToggle: make(chan bool),
-
-		getArtistAlbums: make(chan *Artist),
-		artistAlbums:    make(chan *Playlist),
-
-		nextPlay:          make(chan bool),
-		playTokenLost:     make(chan bool),
-		playlists:         make(chan Playlists),
-		trackNotAvailable: make(chan *Track),
-		trackPlaying:      make(chan *Track, 2),
-		trackPaused:       make(chan *Track),
-
-		newTrackLoaded: make(chan time.Duration, 2),
+		channels: make(map[Topic]reflect.Value),
+		policy:   subscription.Policy,
+		done:     make(chan struct{}),
+		snapshot: snapshot,
+	}
+
+	names := subscription.Topics
+	if len(names) == 0 {
+		for name := range topics {
+			names = append(names, name)
+		}
+	}
+	if subscription.Stream {
+		buffer := subscription.Buffer
+		if subscription.Policy == DropOldest && buffer == 0 {
+			buffer = 1
+		}
+		events.stream = make(chan Event, buffer)
+	}
+	for _, name := range names {
+		topic, found := topics[name]
+		if !found {
+			continue
+		}
+		if events.stream != nil {
+			events.channels[name] = reflect.ValueOf(events.stream)
+			continue
+		}
+		buffer := subscription.Buffer
+		if topic.buffer > buffer {
+			buffer = topic.buffer
+		}
+		if subscription.Policy == DropOldest && buffer == 0 {
+			buffer = 1
+		}
+		field := reflect.ValueOf(topic.channel(events)).Elem()
+		channel := reflect.MakeChan(field.Type(), buffer)
+		field.Set(channel)
+		events.channels[name] = channel
 	}
 
-	subscribers = append(subscribers, events)
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+	subscribers := make([]*Events, len(publisher.subscribers), len(publisher.subscribers)+1)
+	copy(subscribers, publisher.subscribers)
+	publisher.subscribers = append(subscribers, events)
 	return events
 }
 
-func (publisher *Publisher) ShutdownEngine() {
+// Unsubscribe stops the deliveries to the subscriber, a publisher blocked on it
+// carries on.
+func (publisher *Publisher) Unsubscribe(events *Events) {
+	events.unsubscribe.Do(func() {
+		close(events.done)
+	})
+
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+	subscribers := make([]*Events, 0, len(publisher.subscribers))
+	for _, subscriber := range publisher.subscribers {
+		if subscriber != events {
+			subscribers = append(subscribers, subscriber)
+		}
+	}
+	publisher.subscribers = subscribers
+}
+
+func (publisher *Publisher) publish(topic Topic, value interface{}) {
+	publisher.mutex.Lock()
+	subscribers := publisher.subscribers
+	publisher.mutex.Unlock()
+
+	var snapshots map[*Events]interface{}
 	for _, subscriber := range subscribers {
-		subscriber.shutdownEngine <- true
+		if _, subscribed := subscriber.channels[topic]; subscribed && subscriber.snapshot != nil {
+			if snapshots == nil {
+				snapshots = make(map[*Events]interface{})
+			}
+			snapshots[subscriber] = subscriber.snapshot(topic, value)
+		}
+	}
+	for _, subscriber := range subscribers {
+		if snapshot, found := snapshots[subscriber]; found {
+			subscriber.deliver(topic, snapshot)
+		} else {
+			subscriber.deliver(topic, value)
+		}
 	}
 }
 
+func (events *Events) deliver(name Topic, value interface{}) {
+	channel, subscribed := events.channels[name]
+	if !subscribed {
+		return
+	}
+	policy := events.policy
+	if policy == Block && topics[name].lossy {
+		policy = DropNewest
+	}
+
+	sent := reflect.ValueOf(value)
+	if events.stream != nil {
+		sent = reflect.ValueOf(Event{Topic: name, Time: time.Now(), Value: value})
+	}
+	switch policy {
+	case DropNewest:
+		channel.TrySend(sent)
+	case DropOldest:
+		for !channel.TrySend(sent) {
+			channel.TryRecv()
+		}
+	default:
+		reflect.Select([]reflect.SelectCase{
+			{Dir: reflect.SelectSend, Chan: channel, Send: sent},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(events.done)},
+		})
+	}
+}
+
+// StreamUpdates delivers the events of a Stream subscription.
+func (events *Events) StreamUpdates() <-chan Event {
+	return events.stream
+}
+
+func (publisher *Publisher) ShutdownEngine() {
+	publisher.publish(TopicShutdownEngine, true)
+}
+
 func (events *Events) ShutdownEngineUpdates() <-chan bool {
 	return events.shutdownEngine
 }
 
 func (publisher *Publisher) ShutdownSpotify() {
-	for _, subscriber := range subscribers {
-		subscriber.shutdownSpotify <- true
-	}
+	publisher.publish(TopicShutdownSpotify, true)
 }
 
 func (events *Events) ShutdownSpotifyUpdates() <-chan bool {
@@ -88,9 +386,11 @@ func (events *Events) ShutdownSpotifyUpdates() <-chan bool {
 }
 
 func (publisher *Publisher) TrackPlaying(track *Track) {
-	for _, subscriber := range subscribers {
-		subscriber.trackPlaying <- track
-	}
+	publisher.mutex.Lock()
+	publisher.track, publisher.paused = track, false
+	publisher.mutex.Unlock()
+
+	publisher.publish(TopicTrackPlaying, track)
 }
 
 func (events *Events) TrackPlayingUpdates() <-chan *Track {
@@ -98,19 +398,26 @@ func (events *Events) TrackPlayingUpdates() <-chan *Track {
 }
 
 func (publisher *Publisher) TrackPaused(track *Track) {
-	for _, subscriber := range subscribers {
-		subscriber.trackPaused <- track
-	}
+	publisher.mutex.Lock()
+	publisher.track, publisher.paused = track, true
+	publisher.mutex.Unlock()
+
+	publisher.publish(TopicTrackPaused, track)
 }
 
 func (events *Events) TrackPausedUpdates() <-chan *Track {
 	return events.trackPaused
 }
 
+// CurrentTrack returns the last track playing or paused, nil before any plays.
+func (publisher *Publisher) CurrentTrack() (*Track, bool) {
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+	return publisher.track, publisher.paused
+}
+
 func (publisher *Publisher) Search(query string) {
-	for _, subscriber := range subscribers {
-		subscriber.search <- query
-	}
+	publisher.publish(TopicSearch, query)
 }
 
 func (events *Events) SearchUpdates() <-chan string {
@@ -118,9 +425,7 @@ func (events *Events) SearchUpdates() <-chan string {
 }
 
 func (publisher *Publisher) TrackNotAvailable(track *Track) {
-	for _, subscriber := range subscribers {
-		subscriber.trackNotAvailable <- track
-	}
+	publisher.publish(TopicTrackNotAvailable, track)
 }
 
 func (events *Events) TrackNotAvailableUpdates() <-chan *Track {
@@ -128,9 +433,7 @@ func (events *Events) TrackNotAvailableUpdates() <-chan *Track {
 }
 
 func (publisher *Publisher) NextPlay() {
-	for _, subscriber := range subscribers {
-		subscriber.nextPlay <- true
-	}
+	publisher.publish(TopicNextPlay, true)
 }
 
 func (events *Events) NextPlayUpdates() <-chan bool {
@@ -138,9 +441,7 @@ func (events *Events) NextPlayUpdates() <-chan bool {
 }
 
 func (publisher *Publisher) Play(track *Track) {
-	for _, subscriber := range subscribers {
-		subscriber.play <- track
-	}
+	publisher.publish(TopicPlay, track)
 }
 
 func (events *Events) PlayUpdates() <-chan *Track {
@@ -148,9 +449,7 @@ func (events *Events) PlayUpdates() <-chan *Track {
 }
 
 func (publisher *Publisher) Replay() {
-	for _, subscriber := range subscribers {
-		subscriber.replay <- true
-	}
+	publisher.publish(TopicReplay, true)
 }
 
 func (events *Events) ReplayUpdates() <-chan bool {
@@ -158,9 +457,7 @@ func (events *Events) ReplayUpdates() <-chan bool {
 }
 
 func (publisher *Publisher) Pause() {
-	for _, subscriber := range subscribers {
-		subscriber.pause <- true
-	}
+	publisher.publish(TopicPause, true)
 }
 
 func (events *Events) PauseUpdates() <-chan bool {
@@ -168,9 +465,7 @@ func (events *Events) PauseUpdates() <-chan bool {
 }
 
 func (publisher *Publisher) PlayPauseToggle() {
-	for _, subscriber := range subscribers {
-		subscriber.playPauseToggle <- true
-	}
+	publisher.publish(TopicPlayPauseToggle, true)
 }
 
 func (events *Events) PlayPauseToggleUpdates() <-chan bool {
@@ -178,9 +473,7 @@ func (events *Events) PlayPauseToggleUpdates() <-chan bool {
 }
 
 func (publisher *Publisher) NewPlaylist(playlists *Playlists) {
-	for _, subscriber := range subscribers {
-		subscriber.playlists <- *playlists
-	}
+	publisher.publish(TopicPlaylists, *playlists)
 }
 
 func (events *Events) PlaylistsUpdates() <-chan Playlists {
@@ -188,9 +481,7 @@ func (events *Events) PlaylistsUpdates() <-chan Playlists {
 }
 
 func (publisher *Publisher) PlayTokenLost() {
-	for _, subscriber := range subscribers {
-		subscriber.playTokenLost <- true
-	}
+	publisher.publish(TopicPlayTokenLost, true)
 }
 
 func (events *Events) PlayTokenLostUpdates() <-chan bool {
@@ -198,9 +489,7 @@ func (events *Events) PlayTokenLostUpdates() <-chan bool {
 }
 
 func (publisher *Publisher) GetArtistAlbums(artist *Artist) {
-	for _, subscriber := range subscribers {
-		subscriber.getArtistAlbums <- artist
-	}
+	publisher.publish(TopicGetArtistAlbums, artist)
 }
 
 func (events *Events) GetArtistAlbumsUpdates() <-chan *Artist {
@@ -208,9 +497,7 @@ func (events *Events) GetArtistAlbumsUpdates() <-chan *Artist {
 }
 
 func (publisher *Publisher) ArtistAlbums(folder *Playlist) {
-	for _, subscriber := range subscribers {
-		subscriber.artistAlbums <- folder
-	}
+	publisher.publish(TopicArtistAlbums, folder)
 }
 
 func (events *Events) ArtistAlbumsUpdates() <-chan *Playlist {
@@ -218,14 +505,159 @@ func (events *Events) ArtistAlbumsUpdates() <-chan *Playlist {
 }
 
 func (publisher *Publisher) NewTrackLoaded(duration time.Duration) {
-	for _, subscriber := range subscribers {
-		select {
-		case subscriber.newTrackLoaded <- duration:
-		default:
-		}
-	}
+	publisher.publish(TopicNewTrackLoaded, duration)
 }
 
 func (events *Events) NewTrackLoadedUpdate() <-chan time.Duration {
 	return events.newTrackLoaded
 }
+
+func (publisher *Publisher) Seek(offset time.Duration) {
+	publisher.publish(TopicSeek, offset)
+}
+
+func (events *Events) SeekUpdates() <-chan time.Duration {
+	return events.seek
+}
+
+func (publisher *Publisher) PlaybackPosition(elapsed time.Duration, total time.Duration) {
+	position := Position{Elapsed: elapsed, Total: total}
+	publisher.mutex.Lock()
+	publisher.position = position
+	publisher.mutex.Unlock()
+
+	publisher.publish(TopicPlaybackPosition, position)
+}
+
+// CurrentPosition returns the last position published by the audio output.
+func (publisher *Publisher) CurrentPosition() Position {
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+	return publisher.position
+}
+
+func (events *Events) PlaybackPositionUpdates() <-chan Position {
+	return events.playbackPosition
+}
+
+// Left is the time left to the end of the track in whole seconds.
+func (position Position) Left() time.Duration {
+	return (position.Total - position.Elapsed) / time.Second * time.Second
+}
+
+func (publisher *Publisher) SetVolume(level int) {
+	publisher.publish(TopicSetVolume, level)
+}
+
+func (events *Events) SetVolumeUpdates() <-chan int {
+	return events.setVolume
+}
+
+func (publisher *Publisher) VolumeUp() {
+	publisher.publish(TopicVolumeUp, true)
+}
+
+func (events *Events) VolumeUpUpdates() <-chan bool {
+	return events.volumeUp
+}
+
+func (publisher *Publisher) VolumeDown() {
+	publisher.publish(TopicVolumeDown, true)
+}
+
+func (events *Events) VolumeDownUpdates() <-chan bool {
+	return events.volumeDown
+}
+
+func (publisher *Publisher) ToggleMute() {
+	publisher.publish(TopicToggleMute, true)
+}
+
+func (events *Events) ToggleMuteUpdates() <-chan bool {
+	return events.toggleMute
+}
+
+func (publisher *Publisher) VolumeChanged(volume Volume) {
+	publisher.mutex.Lock()
+	publisher.volume = &volume
+	publisher.mutex.Unlock()
+
+	publisher.publish(TopicVolumeChanged, volume)
+}
+
+// CurrentVolume returns the last volume applied by the backend.
+func (publisher *Publisher) CurrentVolume() Volume {
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+	if publisher.volume == nil {
+		return InitVolume()
+	}
+	return *publisher.volume
+}
+
+func (events *Events) VolumeChangedUpdates() <-chan Volume {
+	return events.volumeChanged
+}
+
+// EqualizerBand is the gain, in dB, of one of the EqualizerFrequencies.
+type EqualizerBand struct {
+	Band int
+	Gain float64
+}
+
+func (publisher *Publisher) SetEqualizerPreset(preset string) {
+	publisher.publish(TopicSetEqualizerPreset, preset)
+}
+
+func (events *Events) SetEqualizerPresetUpdates() <-chan string {
+	return events.setEqualizerPreset
+}
+
+func (publisher *Publisher) SetEqualizerBand(band int, gain float64) {
+	publisher.publish(TopicSetEqualizerBand, EqualizerBand{Band: band, Gain: gain})
+}
+
+func (events *Events) SetEqualizerBandUpdates() <-chan EqualizerBand {
+	return events.setEqualizerBand
+}
+
+func (publisher *Publisher) EqualizerChanged(equalizer Equalizer) {
+	publisher.mutex.Lock()
+	publisher.equalizer = &equalizer
+	publisher.mutex.Unlock()
+
+	publisher.publish(TopicEqualizerChanged, equalizer)
+}
+
+// CurrentEqualizer returns the last equalizer applied by the backend, without any
+// preset before the backend starts.
+func (publisher *Publisher) CurrentEqualizer() Equalizer {
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+	if publisher.equalizer == nil {
+		return Equalizer{}
+	}
+	return *publisher.equalizer
+}
+
+func (events *Events) EqualizerChangedUpdates() <-chan Equalizer {
+	return events.equalizerChanged
+}
+
+// TrackEnding is published by the audio output when the current track is about
+// to end, so the next one can be prefetched.
+func (publisher *Publisher) TrackEnding() {
+	publisher.publish(TopicTrackEnding, true)
+}
+
+func (events *Events) TrackEndingUpdates() <-chan bool {
+	return events.trackEnding
+}
+
+func (publisher *Publisher) Prefetch(track *Track) {
+	publisher.publish(TopicPrefetch, track)
+}
+
+func (events *Events) PrefetchUpdates() <-chan *Track {
+	return events.prefetch
+}
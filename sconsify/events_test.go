@@ -0,0 +1,189 @@
+package sconsify
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPlaybackPosition(t *testing.T) {
+	publisher := &Publisher{}
+	events := publisher.Subscribe(Subscription{Topics: []Topic{TopicPlaybackPosition}})
+
+	publisher.PlaybackPosition(61500*time.Millisecond, 3*time.Minute)
+
+	position := <-events.PlaybackPositionUpdates()
+	if position.Elapsed != 61500*time.Millisecond || position.Total != 3*time.Minute {
+		t.Errorf("Wrong position published %v", position)
+	}
+	if publisher.CurrentPosition() != position {
+		t.Errorf("Current position should be the last published but is %v", publisher.CurrentPosition())
+	}
+	if position.Left() != 118*time.Second {
+		t.Errorf("Time left should be 1m58s but is %v", position.Left())
+	}
+}
+
+func TestSubscribeReceivesOnlyItsTopics(t *testing.T) {
+	publisher := &Publisher{}
+	events := publisher.Subscribe(Subscription{Topics: []Topic{TopicPlay}})
+
+	// nobody receives the pause, it must not block
+	publisher.Pause()
+	if events.PauseUpdates() != nil {
+		t.Error("Pause is not subscribed and should never be delivered")
+	}
+
+	go publisher.Play(InitPartialTrack("track0"))
+	if track := <-events.PlayUpdates(); track.URI != "track0" {
+		t.Errorf("Should receive track0 but received %v", track.URI)
+	}
+}
+
+func TestDropPolicies(t *testing.T) {
+	publisher := &Publisher{}
+	newest := publisher.Subscribe(Subscription{Topics: []Topic{TopicSearch}, Buffer: 2, Policy: DropNewest})
+	oldest := publisher.Subscribe(Subscription{Topics: []Topic{TopicSearch}, Buffer: 2, Policy: DropOldest})
+
+	publisher.Search("first")
+	publisher.Search("second")
+	publisher.Search("third")
+
+	assertSearches(t, newest.SearchUpdates(), "first", "second")
+	assertSearches(t, oldest.SearchUpdates(), "second", "third")
+}
+
+func TestLossyTopicsNeverBlock(t *testing.T) {
+	publisher := &Publisher{}
+	events := publisher.Subscribe(Subscription{})
+
+	for level := 0; level < 10; level++ {
+		publisher.VolumeChanged(Volume{Level: level})
+	}
+
+	if volume := <-events.VolumeChangedUpdates(); volume.Level != 0 {
+		t.Errorf("First volume should be kept but is %v", volume.Level)
+	}
+	if publisher.CurrentVolume().Level != 9 {
+		t.Errorf("Current volume should be the last published but is %v", publisher.CurrentVolume().Level)
+	}
+}
+
+func TestUnsubscribeReleasesBlockedPublisher(t *testing.T) {
+	publisher := &Publisher{}
+	events := publisher.Subscribe(Subscription{Topics: []Topic{TopicReplay}})
+
+	published := make(chan bool)
+	go func() {
+		publisher.Replay()
+		published <- true
+	}()
+
+	select {
+	case <-published:
+		t.Fatal("Publisher should wait for the subscriber")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	publisher.Unsubscribe(events)
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("Publisher should carry on once the subscriber unsubscribes")
+	}
+
+	publisher.Replay()
+	publisher.Unsubscribe(events)
+}
+
+func TestStreamKeepsPublishingOrder(t *testing.T) {
+	publisher := &Publisher{}
+	events := publisher.Subscribe(Subscription{Topics: []Topic{TopicSearch, TopicPlaybackPosition}, Buffer: 3, Stream: true})
+
+	publisher.PlaybackPosition(time.Second, time.Minute)
+	publisher.Search("elvis")
+	publisher.NextPlay()
+	publisher.PlaybackPosition(2*time.Second, time.Minute)
+
+	for _, expected := range []Topic{TopicPlaybackPosition, TopicSearch, TopicPlaybackPosition} {
+		if event := <-events.StreamUpdates(); event.Topic != expected {
+			t.Errorf("Should receive %v but received %v", expected, event.Topic)
+		}
+	}
+	if events.PlaybackPositionUpdates() != nil {
+		t.Error("Stream subscriber should only receive through the stream")
+	}
+}
+
+func TestConcurrentPublishAndSubscribe(t *testing.T) {
+	publisher := &Publisher{}
+	var wait sync.WaitGroup
+
+	for i := 0; i < 4; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for j := 0; j < 100; j++ {
+				publisher.PlaybackPosition(time.Duration(j)*time.Second, time.Minute)
+				publisher.Search("elvis")
+			}
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for j := 0; j < 50; j++ {
+				events := publisher.Subscribe(Subscription{Buffer: 1, Policy: DropOldest})
+				select {
+				case <-events.PlaybackPositionUpdates():
+				case <-events.SearchUpdates():
+				default:
+				}
+				publisher.Unsubscribe(events)
+			}
+		}()
+	}
+
+	wait.Wait()
+}
+
+func assertSearches(t *testing.T, updates <-chan string, expected ...string) {
+	for _, query := range expected {
+		select {
+		case received := <-updates:
+			if received != query {
+				t.Errorf("Should receive '%v' but received '%v'", query, received)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("Did not receive '%v'", query)
+		}
+	}
+	select {
+	case received := <-updates:
+		t.Errorf("Should not receive '%v'", received)
+	default:
+	}
+}
+
+func TestControlTimesOutWhenTheRequestIsNotReceived(t *testing.T) {
+	defer func(timeout time.Duration) { controlTimeout = timeout }(controlTimeout)
+	controlTimeout = 50 * time.Millisecond
+
+	publisher := &Publisher{}
+	events := publisher.Subscribe(Subscription{Topics: []Topic{TopicControl}})
+	ran := false
+	if _, err := publisher.Control(func(playlists *Playlists, queue TrackQueue) (interface{}, error) {
+		ran = true
+		return nil, nil
+	}); err == nil {
+		t.Fatal("Control should fail when the user interface does not receive the request")
+	}
+
+	// received too late, the request is left out
+	request := <-events.ControlUpdates()
+	request.Run(InitPlaylists(), nil)
+	if ran {
+		t.Error("A request abandoned should not run")
+	}
+}
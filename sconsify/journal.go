@@ -0,0 +1,266 @@
+package sconsify
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/schaeferpp/sconsify/infrastructure"
+)
+
+// journalEntry is a line of the events journal, only the fields of its event are
+// set. Durations are written as text, e.g. 2m3s, so the journal is easy to read.
+type journalEntry struct {
+	Time      time.Time          `json:"time"`
+	Event     Topic              `json:"event"`
+	Track     *journalTrack      `json:"track,omitempty"`
+	Playlists []*journalPlaylist `json:"playlists,omitempty"`
+	Artist    string             `json:"artist,omitempty"`
+	Query     string             `json:"query,omitempty"`
+	Duration  string             `json:"duration,omitempty"`
+	Elapsed   string             `json:"elapsed,omitempty"`
+	Level     *int               `json:"level,omitempty"`
+	Volume    *Volume            `json:"volume,omitempty"`
+	Preset    string             `json:"preset,omitempty"`
+	Band      *EqualizerBand     `json:"band,omitempty"`
+	Equalizer *Equalizer         `json:"equalizer,omitempty"`
+}
+
+type journalTrack struct {
+	URI       string `json:"uri"`
+	Name      string `json:"name,omitempty"`
+	Artist    string `json:"artist,omitempty"`
+	ArtistURI string `json:"artistUri,omitempty"`
+	Duration  string `json:"duration,omitempty"`
+}
+
+type journalPlaylist struct {
+	URI       string             `json:"uri"`
+	Name      string             `json:"name"`
+	Search    bool               `json:"search,omitempty"`
+	Tracks    []*journalTrack    `json:"tracks,omitempty"`
+	Playlists []*journalPlaylist `json:"playlists,omitempty"`
+}
+
+// RecordEvents writes every event published to the journal, one JSON object per
+// line, until the engine shuts down. The events are received as a stream so the
+// journal keeps the order they were published in.
+func RecordEvents(publisher *Publisher, journal io.Writer) {
+	// the entries are made while publishing, the values being changed once
+	// the subscribers receive them
+	events := publisher.subscribe(Subscription{Buffer: 64, Stream: true}, func(topic Topic, value interface{}) interface{} {
+		return toJournalEntry(topic, value)
+	})
+	encoder := json.NewEncoder(journal)
+
+	go func() {
+		defer publisher.Unsubscribe(events)
+		for event := range events.StreamUpdates() {
+			entry := event.Value.(*journalEntry)
+			entry.Time = event.Time
+			if err := encoder.Encode(entry); err != nil {
+				infrastructure.Warn("Cannot record the event", "event", entry.Event, "error", err)
+			}
+			if event.Topic == TopicShutdownEngine {
+				return
+			}
+		}
+	}()
+}
+
+func toJournalEntry(topic Topic, value interface{}) *journalEntry {
+	entry := &journalEntry{Event: topic}
+	switch value := value.(type) {
+	case *Track:
+		entry.Track = toJournalTrack(value)
+	case string:
+		if topic == TopicSearch {
+			entry.Query = value
+		} else {
+			entry.Preset = value
+		}
+	case time.Duration:
+		entry.Duration = value.String()
+	case int:
+		entry.Level = &value
+	case Volume:
+		entry.Volume = &value
+	case EqualizerBand:
+		entry.Band = &value
+	case Equalizer:
+		entry.Equalizer = &value
+	case *Artist:
+		entry.Artist = value.URI
+	case *Playlist:
+		entry.Playlists = []*journalPlaylist{toJournalPlaylist(value)}
+	case Playlists:
+		entry.Playlists = toJournalPlaylists(&value)
+	case Position:
+		entry.Elapsed, entry.Duration = value.Elapsed.String(), value.Total.String()
+	case *PlaySource:
+		entry.Track = &journalTrack{URI: value.URI}
+		entry.Playlists = []*journalPlaylist{{Name: value.Playlist}}
+	case *Play:
+		entry.Track = &journalTrack{URI: value.URI, Name: value.Name, Artist: value.Artist, ArtistURI: value.ArtistURI, Duration: value.Duration}
+		entry.Elapsed = value.Listened.String()
+	}
+	return entry
+}
+
+func toJournalTrack(track *Track) *journalTrack {
+	if track == nil {
+		return nil
+	}
+	journalTrack := &journalTrack{URI: track.URI, Name: track.Name, Duration: track.Duration}
+	if track.Artist != nil {
+		journalTrack.Artist, journalTrack.ArtistURI = track.Artist.Name, track.Artist.URI
+	}
+	return journalTrack
+}
+
+func toJournalPlaylists(playlists *Playlists) []*journalPlaylist {
+	journalPlaylists := make([]*journalPlaylist, 0, playlists.Playlists())
+	for _, playlist := range playlists.playlists {
+		journalPlaylists = append(journalPlaylists, toJournalPlaylist(playlist))
+	}
+	return journalPlaylists
+}
+
+func toJournalPlaylist(playlist *Playlist) *journalPlaylist {
+	journalPlaylist := &journalPlaylist{URI: playlist.URI, Name: playlist.OriginalName(), Search: playlist.IsSearch()}
+	if playlist.IsFolder() {
+		for _, subPlaylist := range playlist.playlists {
+			journalPlaylist.Playlists = append(journalPlaylist.Playlists, toJournalPlaylist(subPlaylist))
+		}
+		return journalPlaylist
+	}
+	for _, track := range playlist.tracks {
+		journalPlaylist.Tracks = append(journalPlaylist.Tracks, toJournalTrack(track))
+	}
+	return journalPlaylist
+}
+
+// Journal is a recorded sequence of events.
+type Journal struct {
+	entries []*journalEntry
+}
+
+// ReadJournal reads a journal written by RecordEvents.
+func ReadJournal(reader io.Reader) (*Journal, error) {
+	journal := &Journal{entries: make([]*journalEntry, 0)}
+	scanner := bufio.NewScanner(reader)
+	// a line with the playlists of a large library is long
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		entry := &journalEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, fmt.Errorf("Line %v: %v", line, err)
+		}
+		journal.entries = append(journal.entries, entry)
+	}
+	return journal, scanner.Err()
+}
+
+// Replay publishes again the events the backend published while the journal was
+// recorded, keeping the time between them. The requests of the user interface
+// are in the journal to read what happened but are not replayed, the user
+// interface makes them again while reacting to the replayed events.
+func (journal *Journal) Replay(publisher *Publisher) {
+	var previous time.Time
+	for _, entry := range journal.entries {
+		if !previous.IsZero() && entry.Time.After(previous) {
+			time.Sleep(entry.Time.Sub(previous))
+		}
+		previous = entry.Time
+		replayEntry(publisher, entry)
+	}
+	infrastructure.Debug("Replayed the journal", "events", len(journal.entries))
+}
+
+func replayEntry(publisher *Publisher, entry *journalEntry) {
+	switch entry.Event {
+	case TopicTrackPlaying:
+		publisher.TrackPlaying(fromJournalTrack(entry.Track))
+	case TopicTrackPaused:
+		publisher.TrackPaused(fromJournalTrack(entry.Track))
+	case TopicTrackNotAvailable:
+		publisher.TrackNotAvailable(fromJournalTrack(entry.Track))
+	case TopicNextPlay:
+		publisher.NextPlay()
+	case TopicTrackEnding:
+		publisher.TrackEnding()
+	case TopicPlayTokenLost:
+		publisher.PlayTokenLost()
+	case TopicNewTrackLoaded:
+		publisher.NewTrackLoaded(parseJournalDuration(entry.Duration))
+	case TopicPlaybackPosition:
+		publisher.PlaybackPosition(parseJournalDuration(entry.Elapsed), parseJournalDuration(entry.Duration))
+	case TopicVolumeChanged:
+		if entry.Volume != nil {
+			publisher.VolumeChanged(*entry.Volume)
+		}
+	case TopicEqualizerChanged:
+		if entry.Equalizer != nil {
+			publisher.EqualizerChanged(*entry.Equalizer)
+		}
+	case TopicPlaylists:
+		publisher.NewPlaylist(fromJournalPlaylists(entry.Playlists))
+	case TopicArtistAlbums:
+		if len(entry.Playlists) == 1 {
+			publisher.ArtistAlbums(fromJournalPlaylist(entry.Playlists[0]))
+		}
+	}
+}
+
+func parseJournalDuration(value string) time.Duration {
+	duration, _ := time.ParseDuration(value)
+	return duration
+}
+
+func fromJournalTrack(track *journalTrack) *Track {
+	if track == nil {
+		return nil
+	}
+	if track.Name == "" && track.Artist == "" {
+		return InitPartialTrack(track.URI)
+	}
+	return InitTrack(track.URI, InitArtist(track.ArtistURI, track.Artist), track.Name, track.Duration)
+}
+
+func fromJournalPlaylists(journalPlaylists []*journalPlaylist) *Playlists {
+	playlists := InitPlaylists()
+	for _, journalPlaylist := range journalPlaylists {
+		playlists.AddPlaylist(fromJournalPlaylist(journalPlaylist))
+	}
+	return playlists
+}
+
+func fromJournalPlaylist(journalPlaylist *journalPlaylist) *Playlist {
+	if journalPlaylist.Playlists != nil {
+		subPlaylists := make([]*Playlist, len(journalPlaylist.Playlists))
+		for i, subPlaylist := range journalPlaylist.Playlists {
+			subPlaylists[i] = fromJournalPlaylist(subPlaylist)
+		}
+		return InitFolder(journalPlaylist.URI, journalPlaylist.Name, subPlaylists)
+	}
+
+	tracks := make([]*Track, len(journalPlaylist.Tracks))
+	for i, track := range journalPlaylist.Tracks {
+		tracks[i] = fromJournalTrack(track)
+	}
+	if journalPlaylist.Search {
+		playlist := InitSearchPlaylist(journalPlaylist.URI, journalPlaylist.Name, func(playlist *Playlist) {
+			for _, track := range tracks {
+				playlist.AddTrack(track)
+			}
+		})
+		playlist.ExecuteLoad()
+		return playlist
+	}
+	return InitPlaylist(journalPlaylist.URI, journalPlaylist.Name, tracks)
+}
@@ -0,0 +1,104 @@
+package sconsify
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+type lineWriter struct {
+	lines chan string
+}
+
+func (writer *lineWriter) Write(p []byte) (int, error) {
+	writer.lines <- string(p)
+	return len(p), nil
+}
+
+func TestRecordAndReplayEvents(t *testing.T) {
+	recorded := &Publisher{}
+	writer := &lineWriter{lines: make(chan string, 10)}
+	RecordEvents(recorded, writer)
+
+	artist := InitArtist("artist0", "Bob Marley")
+	track := InitTrack("track0", artist, "Waiting in vain", "2m3s")
+	playlists := InitPlaylists()
+	playlists.AddPlaylist(InitPlaylist("playlist0", "Bob Marley", []*Track{track}))
+
+	recorded.NewPlaylist(playlists)
+	recorded.Play(track)
+	recorded.TrackPlaying(track)
+	recorded.PlaybackPosition(time.Second, 2*time.Minute)
+	recorded.NextPlay()
+	recorded.ShutdownEngine()
+
+	journal := make([]string, 0)
+	for i := 0; i < 6; i++ {
+		select {
+		case line := <-writer.lines:
+			journal = append(journal, line)
+		case <-time.After(time.Second):
+			t.Fatalf("Only %v events recorded", len(journal))
+		}
+	}
+	if !strings.Contains(journal[1], `"event":"play","track":{"uri":"track0","name":"Waiting in vain","artist":"Bob Marley"`) {
+		t.Errorf("Play should be recorded with its track: %v", journal[1])
+	}
+
+	replayed, err := ReadJournal(strings.NewReader(strings.Join(journal, "")))
+	if err != nil {
+		t.Fatalf("Journal should be read: %v", err)
+	}
+	publisher := &Publisher{}
+	events := publisher.Subscribe(Subscription{})
+	go replayed.Replay(publisher)
+
+	newPlaylists := <-events.PlaylistsUpdates()
+	if playlist := newPlaylists.GetByURI("playlist0"); playlist == nil || playlist.Track(0).Name != "Waiting in vain" {
+		t.Errorf("Playlists should be replayed with their tracks")
+	}
+	if playing := <-events.TrackPlayingUpdates(); playing.URI != "track0" || playing.Artist.Name != "Bob Marley" {
+		t.Errorf("Track playing should be replayed but is %+v", playing)
+	}
+	if position := <-events.PlaybackPositionUpdates(); position.Elapsed != time.Second || position.Total != 2*time.Minute {
+		t.Errorf("Position should be replayed but is %v", position)
+	}
+	<-events.NextPlayUpdates()
+
+	// the requests of the user interface and the shutdown are not replayed
+	select {
+	case track := <-events.PlayUpdates():
+		t.Errorf("Play should not be replayed: %v", track.URI)
+	case <-events.ShutdownEngineUpdates():
+		t.Error("Shutdown should not be replayed")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRecordEventsTakesThePlaylistsAsPublished(t *testing.T) {
+	publisher := &Publisher{}
+	writer := &lineWriter{lines: make(chan string, 10)}
+	RecordEvents(publisher, writer)
+
+	playlists := InitPlaylists()
+	playlists.AddPlaylist(InitPlaylist("playlist0", "Bob Marley", []*Track{InitPartialTrack("track0")}))
+	publisher.NewPlaylist(playlists)
+	// the user interface changes the playlists it received
+	playlists.AddPlaylist(InitPlaylist("playlist1", "Peter Tosh", []*Track{InitPartialTrack("track1")}))
+
+	select {
+	case line := <-writer.lines:
+		if !strings.Contains(line, "playlist0") || strings.Contains(line, "playlist1") {
+			t.Errorf("Only the playlists published should be recorded: %v", line)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Playlists should be recorded")
+	}
+	publisher.ShutdownEngine()
+}
+
+func TestReadJournalFailsOnInvalidLine(t *testing.T) {
+	if _, err := ReadJournal(strings.NewReader("{\"event\":\"nextPlay\"}\n\nnot json\n")); err == nil || !strings.HasPrefix(err.Error(), "Line 3") {
+		t.Errorf("Invalid line should fail with its number: %v", err)
+	}
+}
@@ -20,7 +20,7 @@ func StartMainLoop(events *Events, publisher *Publisher, ui UserInterface, askFo
 
 	getNextToPlay := func() {
 		if track := ui.GetNextToPlay(); track != nil {
-			publisher.Play(track)
+			publisher.PlayFrom(track, ui.PlayingPlaylist(track))
 		}
 	}
 
@@ -42,6 +42,10 @@ func StartMainLoop(events *Events, publisher *Publisher, ui UserInterface, askFo
 			}
 		case <-events.NextPlayUpdates():
 			getNextToPlay()
+		case <-events.TrackEndingUpdates():
+			if track := ui.PeekNextToPlay(); track != nil {
+				publisher.Prefetch(track)
+			}
 		case newPlaylist := <-events.PlaylistsUpdates():
 			ui.NewPlaylists(newPlaylist)
 		case playlist := <-events.ArtistAlbumsUpdates():
@@ -50,8 +54,20 @@ func StartMainLoop(events *Events, publisher *Publisher, ui UserInterface, askFo
 			return nil
 		case duration := <-events.NewTrackLoadedUpdate():
 			ui.NewTrackLoaded(duration)
+		case position := <-events.PlaybackPositionUpdates():
+			ui.PlaybackPosition(position)
+		case volume := <-events.VolumeChangedUpdates():
+			ui.VolumeChanged(volume)
+		case equalizer := <-events.EqualizerChangedUpdates():
+			ui.EqualizerChanged(equalizer)
+		case edit := <-events.PlaylistEditedUpdates():
+			ui.PlaylistEdited(edit)
+		case replay := <-events.PlaylistEditsReplayedUpdates():
+			ui.PlaylistEditsReplayed(replay)
+		case play := <-events.PlayRecordedUpdates():
+			ui.PlayRecorded(play)
+		case request := <-events.ControlUpdates():
+			ui.Control(request)
 		}
 	}
-
-	return nil
 }
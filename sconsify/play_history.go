@@ -0,0 +1,159 @@
+package sconsify
+
+import "time"
+
+const (
+	historyPlaylistURI = "History"
+	// historyPlaylistSize is how many plays the *History playlist shows
+	historyPlaylistSize = 200
+)
+
+// Play is a track played, from the moment it started until another track or the
+// shutdown ended it.
+type Play struct {
+	URI       string
+	Name      string
+	Artist    string
+	ArtistURI string
+	// Duration is the duration of the track, as in Track.
+	Duration string
+	// Playlist is the name of the playlist the track was played from, empty
+	// when it is not known.
+	Playlist  string
+	StartedAt time.Time
+	// Listened is how long the track was heard, seeks and pauses left out.
+	Listened time.Duration
+	// Finished is set when the track was played to its end, it was skipped
+	// otherwise.
+	Finished bool
+}
+
+// PlaySource is the playlist a user interface plays a track from.
+type PlaySource struct {
+	URI      string
+	Playlist string
+}
+
+// PlayHistory is the history of the tracks played.
+type PlayHistory interface {
+	PlayStats
+	// Recent returns up to count plays, the most recent first.
+	Recent(count int) []*Play
+}
+
+// Track returns the track played, to play it again.
+func (play *Play) Track() *Track {
+	return InitWebApiTrack(play.URI, InitArtist(play.ArtistURI, play.Artist), play.Name, play.Duration)
+}
+
+// InitHistoryPlaylist returns the *History playlist, the tracks played the most
+// recently first, read from the history again every time it is loaded.
+func InitHistoryPlaylist(history PlayHistory) *Playlist {
+	return InitOnDemandPlaylist(historyPlaylistURI, "*History", false, func(playlist *Playlist) {
+		recent := history.Recent(historyPlaylistSize)
+		tracks := make([]*Track, len(recent))
+		for i, play := range recent {
+			tracks[i] = play.Track()
+		}
+		playlist.tracks = tracks
+	})
+}
+
+// IsHistory tells if the playlist is the *History playlist.
+func (playlist *Playlist) IsHistory() bool {
+	return playlist.URI == historyPlaylistURI
+}
+
+// PlayFrom plays a track of a playlist, telling the history which playlist it
+// is played from before the backend plays it.
+func (publisher *Publisher) PlayFrom(track *Track, playlist string) {
+	publisher.publish(TopicPlaySource, &PlaySource{URI: track.URI, Playlist: playlist})
+	publisher.Play(track)
+}
+
+func (events *Events) PlaySourceUpdates() <-chan *PlaySource {
+	return events.playSource
+}
+
+func (publisher *Publisher) PlayRecorded(play *Play) {
+	publisher.publish(TopicPlayRecorded, play)
+}
+
+func (events *Events) PlayRecordedUpdates() <-chan *Play {
+	return events.playRecorded
+}
+
+// AddHistoryPlaylist adds the *History playlist, loaded at once.
+func (playlists *Playlists) AddHistoryPlaylist(history PlayHistory) {
+	playlist := InitHistoryPlaylist(history)
+	playlist.ExecuteLoad()
+	playlists.AddPlaylist(playlist)
+}
+
+// ReloadPlays loads again the playlists made of the tracks played: the *History
+// playlist and the smart playlists. The playing position follows the track
+// playing, which moves when the playlist playing is one of them.
+func (playlists *Playlists) ReloadPlays() {
+	playlists.keepPlayingPosition(func() {
+		if playlist := playlists.GetByURI(historyPlaylistURI); playlist != nil {
+			playlist.ExecuteLoad()
+		}
+		playlists.evaluateSmartPlaylists()
+	})
+}
+
+// keepPlayingPosition moves the current track to where the track playing is once
+// the playlist playing is rebuilt, or replaced, by reload. When the track playing
+// is gone the position is set before the track that was next, so it is still the
+// next one.
+func (playlists *Playlists) keepPlayingPosition(reload func()) {
+	playlist := playlists.getCurrentPlaylist()
+	if playlists.hasPremadeTracks() || playlist == nil {
+		reload()
+		return
+	}
+	index, before := playlists.currentIndexTrack, playlist.Tracks()
+	playing := playlist.Track(index)
+	next, _ := playlists.PeekNext()
+	reload()
+
+	if playlist = playlists.getCurrentPlaylist(); playing == nil || playlist == nil {
+		return
+	}
+	// tracks are added to or removed from the beginning, the *History playlist
+	// getting the newest play first
+	expected := index + playlist.Tracks() - before
+	if found := indexNear(playlist, playing.URI, expected); found >= 0 {
+		playlists.currentIndexTrack = found
+		return
+	}
+	if next != nil {
+		if found := indexNear(playlist, next.URI, expected+1); found >= 0 {
+			playlists.currentIndexTrack = found - 1
+			return
+		}
+	}
+	if playlists.currentIndexTrack >= playlist.Tracks() {
+		playlists.currentIndexTrack = playlist.Tracks() - 1
+	}
+}
+
+// indexNear returns the index of the track the closest to expected, a track
+// being more than once in the *History playlist. It is -1 when the track is not
+// in the playlist.
+func indexNear(playlist *Playlist, URI string, expected int) int {
+	found := -1
+	for i := 0; i < playlist.Tracks(); i++ {
+		if playlist.Track(i).URI == URI && (found < 0 || distance(i, expected) < distance(found, expected)) {
+			found = i
+		}
+	}
+	return found
+}
+
+func distance(a int, b int) int {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,123 @@
+package sconsify
+
+import (
+	"testing"
+	"time"
+)
+
+type testPlayHistory struct {
+	testPlayStats
+	plays []*Play
+}
+
+func (history *testPlayHistory) Recent(count int) []*Play {
+	if len(history.plays) < count {
+		return history.plays
+	}
+	return history.plays[:count]
+}
+
+func TestHistoryPlaylist(t *testing.T) {
+	playlists, cleanup := createSmartPlaylists(t, `[{"name": "Forgotten", "rule": {"notPlayedInDays": 1}}]`)
+	defer cleanup()
+
+	history := &testPlayHistory{testPlayStats: testPlayStats{lastPlayed: map[string]time.Time{}}}
+	history.plays = []*Play{{URI: "track9", Name: "Natural mystic", Artist: "Bob Marley", ArtistURI: "marley", Duration: "3m28s"}}
+	playlists.AddSmartPlaylists(history)
+	playlists.AddHistoryPlaylist(history)
+
+	playlist := playlists.GetByURI("History")
+	if playlist == nil || playlist.Name() != "*History" || !playlist.IsHistory() || playlist.Tracks() != 1 {
+		t.Fatalf("*History playlist should have the track played: %v", playlist)
+	}
+	if track := playlist.Track(0); track.URI != "track9" || track.GetFullTitle() != "Natural mystic - Bob Marley [3m28s]" {
+		t.Errorf("Track of the history should be track9: %v", track.GetFullTitle())
+	}
+	// the tracks played are not part of the library
+	assertSmartPlaylist(t, playlists, "Forgotten", "track0", "track2", "track1")
+
+	history.plays = append([]*Play{{URI: "track0", Name: "Waiting in vain", Artist: "Bob Marley", ArtistURI: "marley"}}, history.plays...)
+	history.lastPlayed["track0"] = time.Now()
+	playlists.ReloadPlays()
+	if playlist.Tracks() != 2 || playlist.Track(0).URI != "track0" {
+		t.Errorf("*History playlist should have track0 first once reloaded: %v", playlist.Tracks())
+	}
+	assertSmartPlaylist(t, playlists, "Forgotten", "track2", "track1")
+}
+
+func TestPlayingThroughHistoryPlaylist(t *testing.T) {
+	playlists, cleanup := createSmartPlaylists(t, `[]`)
+	defer cleanup()
+
+	history := &testPlayHistory{testPlayStats: testPlayStats{lastPlayed: map[string]time.Time{}}}
+	for _, URI := range []string{"trackA", "trackB", "trackC", "trackD"} {
+		history.plays = append(history.plays, &Play{URI: URI})
+	}
+	playlists.AddHistoryPlaylist(history)
+	if err := playlists.SetCurrents("*History", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"trackC", "trackD"} {
+		played := playlists.GetPlayingTrack()
+		if next, _ := playlists.GetNext(); next.URI != expected {
+			t.Fatalf("Next track should be %v but is %v", expected, next.URI)
+		}
+		history.plays = append([]*Play{{URI: played.URI}}, history.plays...)
+		playlists.ReloadPlays()
+		if playing := playlists.GetPlayingTrack(); playing == nil || playing.URI != expected {
+			t.Fatalf("Track playing should still be %v once the history is reloaded: %v", expected, playing)
+		}
+	}
+	if next, repeating := playlists.GetNext(); !repeating || next.URI != "trackC" {
+		t.Errorf("After the last track the history should start again: %v", next.URI)
+	}
+}
+
+func TestPlayingThroughSmartPlaylistDroppingTracksPlayed(t *testing.T) {
+	playlists, cleanup := createSmartPlaylists(t, `[{"name": "Forgotten", "rule": {"notPlayedInDays": 1}}]`)
+	defer cleanup()
+
+	history := &testPlayHistory{testPlayStats: testPlayStats{lastPlayed: map[string]time.Time{}}}
+	playlists.AddSmartPlaylists(history)
+	assertSmartPlaylist(t, playlists, "Forgotten", "track0", "track2", "track1")
+	playlists.SetCurrents(" Forgotten", 0)
+
+	playlists.GetNext()
+	history.lastPlayed["track0"] = time.Now()
+	playlists.ReloadPlays()
+	if playing := playlists.GetPlayingTrack(); playing.URI != "track2" {
+		t.Fatalf("Track playing should still be track2: %v", playing.URI)
+	}
+
+	// the track playing gone too, the one after it is still next
+	history.lastPlayed["track2"] = time.Now()
+	playlists.ReloadPlays()
+	if next, _ := playlists.GetNext(); next.URI != "track1" {
+		t.Errorf("Next track should be track1 but is %v", next.URI)
+	}
+}
+
+func TestPlaylistOfTrackPlayed(t *testing.T) {
+	playlists, cleanup := createSmartPlaylists(t, `[{"name": "Everything"}]`)
+	defer cleanup()
+
+	history := &testPlayHistory{testPlayStats: testPlayStats{lastPlayed: map[string]time.Time{}}}
+	history.plays = []*Play{{URI: "track1"}, {URI: "track2"}}
+	playlists.AddSmartPlaylists(history)
+	playlists.AddHistoryPlaylist(history)
+
+	if playlist := playlists.PlaylistOf("track1"); playlist == nil || playlist.Name() != "Reggae" {
+		t.Errorf("track1 should be played from Reggae, not the *History or smart playlists: %v", playlist)
+	}
+	if playlist := playlists.PlaylistOf("track2"); playlist == nil || playlist.URI != "ska" {
+		t.Errorf("track2 should be played from Ska: %v", playlist)
+	}
+	playlists.SetCurrents("*History", 0)
+	if playlist := playlists.PlaylistOf("track1"); playlist == nil || !playlist.IsHistory() {
+		t.Errorf("track1 played from the *History playlist should be played from it: %v", playlist)
+	}
+	if playlist := playlists.PlaylistOf("unknown"); playlist != nil {
+		t.Errorf("A track in no playlist should have no playlist: %v", playlist)
+	}
+}
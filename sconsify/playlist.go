@@ -21,7 +21,7 @@ type Playlist struct {
 	loadCallbackOnce sync.Once
 }
 
-type PlaylistByName []Playlist
+type PlaylistByName []*Playlist
 
 func InitPlaylist(URI string, name string, tracks []*Track) *Playlist {
 	return &Playlist{URI: URI, name: name, tracks: tracks}
@@ -190,6 +190,49 @@ func (playlist *Playlist) RemoveTrack(index int) {
 	playlist.tracks = append(playlist.tracks[:index], playlist.tracks[index+1:]...)
 }
 
+// InsertTrack inserts the track at the index, moving the following tracks down.
+func (playlist *Playlist) InsertTrack(index int, track *Track) {
+	if index < 0 || index > len(playlist.tracks) {
+		index = len(playlist.tracks)
+	}
+	playlist.tracks = append(playlist.tracks, nil)
+	copy(playlist.tracks[index+1:], playlist.tracks[index:])
+	playlist.tracks[index] = track
+}
+
+// MoveTracks moves count tracks from the index from so the first ends up at the
+// index to, returning false when they would not be in the playlist.
+func (playlist *Playlist) MoveTracks(from int, count int, to int) bool {
+	return MoveTracksOf(playlist.tracks, from, count, to)
+}
+
+// MoveTracksOf moves count tracks of the slice from the index from so the first
+// ends up at the index to, returning false when they would not be in the slice.
+func MoveTracksOf(tracks []*Track, from int, count int, to int) bool {
+	n := len(tracks)
+	if count < 1 || from < 0 || to < 0 || from+count > n || to+count > n {
+		return false
+	}
+	moved := append([]*Track(nil), tracks[from:from+count]...)
+	others := append(append(make([]*Track, 0, n-count), tracks[:from]...), tracks[from+count:]...)
+	copy(tracks, others[:to])
+	copy(tracks[to:], moved)
+	copy(tracks[to+count:], others[to:])
+	return true
+}
+
+// Rename renames the playlist, keeping the indentation of a playlist in a folder,
+// and returns its previous name.
+func (playlist *Playlist) Rename(name string) string {
+	previous := playlist.name
+	if playlist.subPlaylist {
+		previous = strings.TrimPrefix(previous, " ")
+		name = " " + name
+	}
+	playlist.name = name
+	return previous
+}
+
 func (playlist *Playlist) RemoveAllTracks() {
 	playlist.tracks = make([]*Track, 0)
 }
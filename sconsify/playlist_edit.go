@@ -0,0 +1,154 @@
+package sconsify
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PlaylistEditKind is what a PlaylistEdit changes.
+type PlaylistEditKind int
+
+const (
+	// CreatePlaylist creates a playlist with Name and Tracks.
+	CreatePlaylist PlaylistEditKind = iota
+	// AddTracks appends Tracks to the playlist.
+	AddTracks
+	// RemoveTracks removes Tracks, found one after the other from Position.
+	RemoveTracks
+	// MoveTracks moves Tracks, found one after the other from Position, so the
+	// first ends up at To.
+	MoveTracks
+	// RenamePlaylist renames the playlist to Name.
+	RenamePlaylist
+	// DeletePlaylist deletes the playlist, unfollowing it.
+	DeletePlaylist
+)
+
+var playlistEditKindNames = []string{"create", "add", "remove", "move", "rename", "delete"}
+
+func (kind PlaylistEditKind) String() string {
+	if kind < 0 || int(kind) >= len(playlistEditKindNames) {
+		return fmt.Sprintf("unknown(%d)", int(kind))
+	}
+	return playlistEditKindNames[kind]
+}
+
+// ParsePlaylistEditKind returns the kind named by String.
+func ParsePlaylistEditKind(name string) (PlaylistEditKind, error) {
+	for kind, kindName := range playlistEditKindNames {
+		if kindName == name {
+			return PlaylistEditKind(kind), nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown playlist edit %v", name)
+}
+
+// PlaylistEdit is a change of a playlist already applied by the user interface,
+// which the backend saves. The user interface is told the outcome through
+// PlaylistEdited and rolls the change back when the backend failed.
+type PlaylistEdit struct {
+	Kind PlaylistEditKind
+	// Playlist is the URI of the playlist edited. A playlist created has the URI
+	// the user interface gave it until the backend sets the one it created.
+	Playlist string
+	Name     string
+	// Tracks are URIs of tracks.
+	Tracks   []string
+	Position int
+	To       int
+	// Err is why the backend could not save the edit.
+	Err error
+	// Pending is set when the backend could not reach Spotify and journaled the
+	// edit to save it later.
+	Pending bool
+
+	finish func(edit *PlaylistEdit)
+}
+
+// PlaylistEditor is a backend saving the playlist edits, the edits being kept by
+// the user interface only with the other backends.
+type PlaylistEditor interface {
+	// EditPlaylist saves the edit, setting the URI of a playlist created.
+	EditPlaylist(edit *PlaylistEdit) error
+}
+
+// PlaylistEditsReplay is the outcome of saving the edits journaled by the
+// backend, the edits skipped having their Err set.
+type PlaylistEditsReplay struct {
+	Applied []*PlaylistEdit
+	Skipped []*PlaylistEdit
+}
+
+func (edit *PlaylistEdit) String() string {
+	description := edit.Kind.String() + " " + edit.Playlist
+	if edit.Name != "" {
+		description += " " + edit.Name
+	}
+	if len(edit.Tracks) > 0 {
+		description += " " + strings.Join(edit.Tracks, ",")
+	}
+	return description
+}
+
+// Summary tells how many edits were saved and skipped.
+func (replay *PlaylistEditsReplay) Summary() string {
+	return fmt.Sprintf("Playlist edits made offline: %v saved to Spotify, %v skipped", len(replay.Applied), len(replay.Skipped))
+}
+
+// OnFinish sets what the user interface runs once the backend has handled the
+// edit, from the goroutine owning its playlists.
+func (edit *PlaylistEdit) OnFinish(finish func(edit *PlaylistEdit)) *PlaylistEdit {
+	edit.finish = finish
+	return edit
+}
+
+// Finish runs the function given to OnFinish.
+func (edit *PlaylistEdit) Finish() {
+	if edit.finish != nil {
+		edit.finish(edit)
+	}
+}
+
+// editPlaylists saves the edits published until the shutdown is closed.
+func editPlaylists(backend Backend, events *Events, publisher *Publisher, shutdown <-chan struct{}) {
+	for {
+		select {
+		case edit := <-events.EditPlaylistUpdates():
+			editPlaylist(backend, edit, publisher)
+		case <-shutdown:
+			return
+		}
+	}
+}
+
+// editPlaylist saves the edit if the backend can and tells the user interface.
+func editPlaylist(backend Backend, edit *PlaylistEdit, publisher *Publisher) {
+	if editor, isEditor := backend.(PlaylistEditor); isEditor {
+		edit.Err = editor.EditPlaylist(edit)
+	}
+	publisher.PlaylistEdited(edit)
+}
+
+func (publisher *Publisher) EditPlaylist(edit *PlaylistEdit) {
+	publisher.publish(TopicEditPlaylist, edit)
+}
+
+func (events *Events) EditPlaylistUpdates() <-chan *PlaylistEdit {
+	return events.editPlaylist
+}
+
+func (publisher *Publisher) PlaylistEdited(edit *PlaylistEdit) {
+	publisher.publish(TopicPlaylistEdited, edit)
+}
+
+func (events *Events) PlaylistEditedUpdates() <-chan *PlaylistEdit {
+	return events.playlistEdited
+}
+
+func (publisher *Publisher) PlaylistEditsReplayed(replay *PlaylistEditsReplay) {
+	publisher.publish(TopicPlaylistEditsReplayed, replay)
+}
+
+func (events *Events) PlaylistEditsReplayedUpdates() <-chan *PlaylistEditsReplay {
+	return events.playlistEditsReplayed
+}
@@ -0,0 +1,141 @@
+package sconsify
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type TestPlaylistEditor struct {
+	*TestBackend
+	err error
+	// saving waits for it when set, as for Spotify answering slowly
+	answer chan bool
+}
+
+func (backend *TestPlaylistEditor) EditPlaylist(edit *PlaylistEdit) error {
+	backend.calls <- "EditPlaylist " + edit.Name
+	if backend.answer != nil {
+		<-backend.answer
+	}
+	if backend.err == nil && edit.Kind == CreatePlaylist {
+		edit.Playlist = "spotify:user:bob:playlist:" + edit.Name
+	}
+	return backend.err
+}
+
+func TestStartBackendEditsPlaylists(t *testing.T) {
+	publisher := &Publisher{}
+	events := publisher.Subscribe(Subscription{Topics: BackendTopics})
+	uiEvents := publisher.Subscribe(Subscription{Topics: []Topic{TopicPlaylistEdited}})
+	backend := &TestPlaylistEditor{TestBackend: newTestBackend()}
+
+	go StartBackend(backend, events, publisher)
+	assertBackendCall(t, backend.TestBackend, "LoadPlaylists")
+
+	publisher.EditPlaylist(&PlaylistEdit{Kind: CreatePlaylist, Name: "reggae"})
+	assertBackendCall(t, backend.TestBackend, "EditPlaylist reggae")
+	if edit := waitPlaylistEdited(t, uiEvents); edit.Err != nil || edit.Playlist != "spotify:user:bob:playlist:reggae" {
+		t.Errorf("Playlist should be created as spotify:user:bob:playlist:reggae: %v %v", edit.Playlist, edit.Err)
+	}
+
+	backend.err = errors.New("Insufficient client scope")
+	publisher.EditPlaylist(&PlaylistEdit{Kind: RenamePlaylist, Playlist: "spotify:user:bob:playlist:reggae", Name: "ska"})
+	assertBackendCall(t, backend.TestBackend, "EditPlaylist ska")
+	if edit := waitPlaylistEdited(t, uiEvents); edit.Err != backend.err {
+		t.Errorf("Edit should fail with the error of the backend: %v", edit.Err)
+	}
+}
+
+func TestStartBackendPlaysWhileSavingPlaylistEdits(t *testing.T) {
+	publisher := &Publisher{}
+	events := publisher.Subscribe(Subscription{Topics: BackendTopics})
+	uiEvents := publisher.Subscribe(Subscription{Topics: []Topic{TopicPlaylistEdited}})
+	backend := &TestPlaylistEditor{TestBackend: newTestBackend(), answer: make(chan bool)}
+
+	go StartBackend(backend, events, publisher)
+	assertBackendCall(t, backend.TestBackend, "LoadPlaylists")
+
+	publisher.EditPlaylist(&PlaylistEdit{Kind: RenamePlaylist, Playlist: "spotify:user:bob:playlist:reggae", Name: "ska"})
+	assertBackendCall(t, backend.TestBackend, "EditPlaylist ska")
+	publisher.Pause()
+	assertBackendCall(t, backend.TestBackend, "Pause")
+
+	backend.answer <- true
+	if edit := waitPlaylistEdited(t, uiEvents); edit.Name != "ska" {
+		t.Errorf("Rename to ska should be finished: %v", edit)
+	}
+	publisher.ShutdownSpotify()
+	assertBackendCall(t, backend.TestBackend, "Shutdown")
+}
+
+func TestStartBackendKeepsPlaylistEditsLocal(t *testing.T) {
+	publisher := &Publisher{}
+	events := publisher.Subscribe(Subscription{Topics: BackendTopics})
+	uiEvents := publisher.Subscribe(Subscription{Topics: []Topic{TopicPlaylistEdited}})
+	backend := newTestBackend()
+
+	go StartBackend(backend, events, publisher)
+	assertBackendCall(t, backend, "LoadPlaylists")
+
+	finished := false
+	publisher.EditPlaylist((&PlaylistEdit{Kind: DeletePlaylist, Playlist: "playlist0"}).OnFinish(func(edit *PlaylistEdit) {
+		finished = true
+	}))
+	edit := waitPlaylistEdited(t, uiEvents)
+	if edit.Err != nil {
+		t.Errorf("Edit should not fail without a playlist editor: %v", edit.Err)
+	}
+	edit.Finish()
+	if !finished {
+		t.Error("Finish should run the function given to OnFinish")
+	}
+}
+
+func waitPlaylistEdited(t *testing.T, events *Events) *PlaylistEdit {
+	select {
+	case edit := <-events.PlaylistEditedUpdates():
+		return edit
+	case <-time.After(time.Second):
+		t.Fatal("Playlist edit should be finished")
+	}
+	return nil
+}
+
+func TestPlaylistInsertMoveAndRename(t *testing.T) {
+	artist := InitArtist("artist0", "artist0")
+	playlist := InitSubPlaylist("playlist0", "reggae", []*Track{
+		InitTrack("0", artist, "name0", "duration0"),
+		InitTrack("1", artist, "name1", "duration1"),
+	})
+
+	playlist.InsertTrack(1, InitTrack("2", artist, "name2", "duration2"))
+	playlist.InsertTrack(10, InitTrack("3", artist, "name3", "duration3"))
+	assertTrackURIs(t, playlist, "0", "2", "1", "3")
+
+	if !playlist.MoveTracks(0, 1, 2) {
+		t.Error("Track should be moved")
+	}
+	assertTrackURIs(t, playlist, "2", "1", "0", "3")
+	if playlist.MoveTracks(0, 1, 4) {
+		t.Error("Track should not be moved out of the playlist")
+	}
+
+	if previous := playlist.Rename("ska"); previous != "reggae" {
+		t.Errorf("Previous name should be reggae, it is %v", previous)
+	}
+	if playlist.Name() != " ska" {
+		t.Errorf("Sub playlist should keep its indentation: %q", playlist.Name())
+	}
+}
+
+func assertTrackURIs(t *testing.T, playlist *Playlist, URIs ...string) {
+	if playlist.Tracks() != len(URIs) {
+		t.Fatalf("Playlist should have %v tracks, it has %v", len(URIs), playlist.Tracks())
+	}
+	for i, URI := range URIs {
+		if playlist.Track(i).URI != URI {
+			t.Errorf("Track %v should be %v, it is %v", i, URI, playlist.Track(i).URI)
+		}
+	}
+}
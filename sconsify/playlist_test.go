@@ -33,16 +33,16 @@ func TestPlaylistGetNextTrack(t *testing.T) {
 func TestPlaylistTrack(t *testing.T) {
 	playlist := createDummyPlaylist("testing")
 
-	if track := playlist.Track(0); track.Uri != "0" {
+	if track := playlist.Track(0); track.URI != "0" {
 		t.Errorf("Should be track 0")
 	}
-	if track := playlist.Track(1); track.Uri != "1" {
+	if track := playlist.Track(1); track.URI != "1" {
 		t.Errorf("Should be track 1")
 	}
-	if track := playlist.Track(2); track.Uri != "2" {
+	if track := playlist.Track(2); track.URI != "2" {
 		t.Errorf("Should be track 2")
 	}
-	if track := playlist.Track(3); track.Uri != "3" {
+	if track := playlist.Track(3); track.URI != "3" {
 		t.Errorf("Should be track 3")
 	}
 
@@ -74,8 +74,8 @@ func TestPlaylistIndexByUri(t *testing.T) {
 
 func TestSearchPlaylist(t *testing.T) {
 	tracks := make([]*Track, 1)
-	tracks[0] = InitTrack("0", "artist0", "name0", "duration0")
-	playlist := InitSearchPlaylist("0", "testing", tracks)
+	tracks[0] = InitTrack("0", InitArtist("artist0", "artist0"), "name0", "duration0")
+	playlist := InitSearchPlaylist("0", "testing", func(playlist *Playlist) { playlist.tracks = tracks })
 
 	if !playlist.IsSearch() {
 		t.Errorf("Should be a search playlists")
@@ -282,28 +282,28 @@ func TestRemoveAllTracksFromPlaylist(t *testing.T) {
 
 func createDummyPlaylist(name string) *Playlist {
 	tracks := make([]*Track, 4)
-	tracks[0] = InitTrack("0", "artist0", "name0", "duration0")
-	tracks[1] = InitTrack("1", "artist1", "name1", "duration1")
-	tracks[2] = InitTrack("2", "artist2", "name2", "duration2")
-	tracks[3] = InitTrack("3", "artist3", "name3", "duration3")
+	tracks[0] = InitTrack("0", InitArtist("artist0", "artist0"), "name0", "duration0")
+	tracks[1] = InitTrack("1", InitArtist("artist1", "artist1"), "name1", "duration1")
+	tracks[2] = InitTrack("2", InitArtist("artist2", "artist2"), "name2", "duration2")
+	tracks[3] = InitTrack("3", InitArtist("artist3", "artist3"), "name3", "duration3")
 	return InitPlaylist(name, name, tracks)
 }
 
 func createDummyPlaylistWithId(id string, name string) *Playlist {
 	tracks := make([]*Track, 4)
-	tracks[0] = InitTrack("0", "artist0", "name0", "duration0")
-	tracks[1] = InitTrack("1", "artist1", "name1", "duration1")
-	tracks[2] = InitTrack("2", "artist2", "name2", "duration2")
-	tracks[3] = InitTrack("3", "artist3", "name3", "duration3")
+	tracks[0] = InitTrack("0", InitArtist("artist0", "artist0"), "name0", "duration0")
+	tracks[1] = InitTrack("1", InitArtist("artist1", "artist1"), "name1", "duration1")
+	tracks[2] = InitTrack("2", InitArtist("artist2", "artist2"), "name2", "duration2")
+	tracks[3] = InitTrack("3", InitArtist("artist3", "artist3"), "name3", "duration3")
 	return InitPlaylist(id, name, tracks)
 }
 
 func createSubPlaylist(id string, name string) *Playlist {
 	tracks := make([]*Track, 4)
-	tracks[0] = InitTrack("0", "artist0", "name0", "duration0")
-	tracks[1] = InitTrack("1", "artist1", "name1", "duration1")
-	tracks[2] = InitTrack("2", "artist2", "name2", "duration2")
-	tracks[3] = InitTrack("3", "artist3", "name3", "duration3")
+	tracks[0] = InitTrack("0", InitArtist("artist0", "artist0"), "name0", "duration0")
+	tracks[1] = InitTrack("1", InitArtist("artist1", "artist1"), "name1", "duration1")
+	tracks[2] = InitTrack("2", InitArtist("artist2", "artist2"), "name2", "duration2")
+	tracks[3] = InitTrack("3", InitArtist("artist3", "artist3"), "name3", "duration3")
 	return InitSubPlaylist(id, name, tracks)
 }
 
@@ -315,3 +315,29 @@ func createFolder(id string, name string) *Playlist {
 	playlists[3] = createSubPlaylist("3", "subPlaylist3")
 	return InitFolder(id, name, playlists)
 }
+
+func TestPlaylistMoveTracks(t *testing.T) {
+	playlist := createDummyPlaylist("name")
+	track0, track1, track2, track3 := playlist.Track(0), playlist.Track(1), playlist.Track(2), playlist.Track(3)
+
+	if !playlist.MoveTracks(0, 2, 2) {
+		t.Errorf("Tracks 0 and 1 should be moved down")
+	}
+	if playlist.Track(0) != track2 || playlist.Track(1) != track3 || playlist.Track(2) != track0 || playlist.Track(3) != track1 {
+		t.Errorf("Tracks 0 and 1 should be at 2 and 3")
+	}
+
+	if !playlist.MoveTracks(3, 1, 0) {
+		t.Errorf("Track 3 should be moved up")
+	}
+	if playlist.Track(0) != track1 || playlist.Track(1) != track2 || playlist.Track(2) != track3 || playlist.Track(3) != track0 {
+		t.Errorf("Track 1 should be first")
+	}
+
+	if playlist.MoveTracks(3, 2, 0) || playlist.MoveTracks(0, 2, 3) || playlist.MoveTracks(-1, 1, 0) || playlist.MoveTracks(0, 0, 1) {
+		t.Errorf("Tracks out of the playlist should not be moved")
+	}
+	if count := playlist.Tracks(); count != 4 {
+		t.Errorf("Number of tracks should be 4")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"math/rand"
 	"sort"
 	"strconv"
+	"strings"
 )
 
 type Playlists struct {
@@ -25,6 +26,9 @@ const (
 	SequentialMode
 )
 
+// ModeNames are the names of the play modes, in the order of their constants.
+var ModeNames = []string{"normal", "shuffle", "shuffle_all", "sequential"}
+
 func InitPlaylists() *Playlists {
 	playlists := &Playlists{
 		playlists: make(map[string]*Playlist),
@@ -82,21 +86,27 @@ func (playlists *Playlists) checkDuplicatedNames(newPlaylist *Playlist, original
 	}
 }
 
+// Merge adds the playlists, the searches going in the *Search folder, and
+// evaluates the smart playlists again. The playing position follows the track
+// playing when the playlist playing is replaced or is a smart playlist.
 func (playlists *Playlists) Merge(newPlaylists *Playlists) {
-	for key, newPlaylist := range newPlaylists.playlists {
-		if newPlaylist.IsSearch() {
-			searchPlaylist := playlists.GetByURI("Search")
-			if searchPlaylist == nil {
-				searchPlaylist = InitFolder("Search", "*Search", make([]*Playlist, 0))
-				playlists.AddPlaylist(searchPlaylist)
+	playlists.keepPlayingPosition(func() {
+		for key, newPlaylist := range newPlaylists.playlists {
+			if newPlaylist.IsSearch() {
+				searchPlaylist := playlists.GetByURI("Search")
+				if searchPlaylist == nil {
+					searchPlaylist = InitFolder("Search", "*Search", make([]*Playlist, 0))
+					playlists.AddPlaylist(searchPlaylist)
+				}
+
+				searchPlaylist.AddPlaylist(newPlaylist)
+				searchPlaylist.OpenFolder()
+			} else {
+				playlists.playlists[key] = newPlaylist
 			}
-
-			searchPlaylist.AddPlaylist(newPlaylist)
-			searchPlaylist.OpenFolder()
-		} else {
-			playlists.playlists[key] = newPlaylist
 		}
-	}
+		playlists.evaluateSmartPlaylists()
+	})
 	playlists.buildPlaylistForNewMode()
 }
 
@@ -116,11 +126,24 @@ func (playlists *Playlists) Remove(playlistName string) {
 	}
 }
 
-func (playlists *Playlists) playlistsAsArray() []Playlist {
-	names := make([]Playlist, playlists.Playlists())
+// FolderOf returns the folder with the playlist, nil for a playlist outside of
+// the folders.
+func (playlists *Playlists) FolderOf(playlist *Playlist) *Playlist {
+	for _, folder := range playlists.playlists {
+		for _, subPlaylist := range folder.playlists {
+			if subPlaylist == playlist {
+				return folder
+			}
+		}
+	}
+	return nil
+}
+
+func (playlists *Playlists) playlistsAsArray() []*Playlist {
+	names := make([]*Playlist, playlists.Playlists())
 	i := 0
 	for _, playlist := range playlists.playlists {
-		names[i] = *playlist
+		names[i] = playlist
 		i++
 	}
 	return names
@@ -266,6 +289,15 @@ func (playlists *Playlists) GetNext() (*Track, bool) {
 	return nil, false
 }
 
+// PeekNext returns the track GetNext would return without moving to it.
+func (playlists *Playlists) PeekNext() (*Track, bool) {
+	if playingPlaylist := playlists.GetPlayingPlaylist(); playingPlaylist != nil {
+		nextIndexTrack, repeating := playingPlaylist.GetNextTrack(playlists.currentIndexTrack)
+		return playingPlaylist.Track(nextIndexTrack), repeating
+	}
+	return nil, false
+}
+
 func (playlists *Playlists) GetPlayingTrack() *Track {
 	if playingPlaylist := playlists.GetPlayingPlaylist(); playingPlaylist != nil {
 		return playingPlaylist.Track(playlists.currentIndexTrack)
@@ -308,6 +340,79 @@ func (playlists *Playlists) InvertMode(mode int) int {
 	return playlists.playMode
 }
 
+func (playlists *Playlists) Mode() int {
+	return playlists.playMode
+}
+
+// FindPlaylist returns the playlist, or the playlist in a folder, with the URI or
+// the name, the name of a closed folder being without its brackets.
+func (playlists *Playlists) FindPlaylist(key string) *Playlist {
+	if playlist := playlists.Get(key); playlist != nil {
+		return playlist
+	}
+	for _, playlist := range playlists.playlists {
+		if playlist.URI == key || playlist.OriginalName() == key {
+			return playlist
+		}
+		for _, subPlaylist := range playlist.playlists {
+			if subPlaylist.URI == key {
+				return subPlaylist
+			}
+		}
+	}
+	return nil
+}
+
+// FindTrack returns a playlist, not a folder, with the track and the index of
+// the track in it.
+func (playlists *Playlists) FindTrack(URI string) (*Playlist, int) {
+	return playlists.findTrack(URI, func(playlist *Playlist) bool { return false })
+}
+
+// findTrack is FindTrack leaving out the playlists skipped, and the folders
+// skipped with all their playlists.
+func (playlists *Playlists) findTrack(URI string, skip func(playlist *Playlist) bool) (*Playlist, int) {
+	for _, name := range playlists.Names() {
+		playlist := playlists.Get(name)
+		if skip(playlist) {
+			continue
+		}
+		candidates := playlist.playlists
+		if !playlist.IsFolder() {
+			candidates = []*Playlist{playlist}
+		}
+		for _, candidate := range candidates {
+			if index := candidate.IndexByUri(URI); index >= 0 {
+				return candidate, index
+			}
+		}
+	}
+	return nil, -1
+}
+
+// PlaylistOf returns the playlist chosen by the user the track is played from:
+// the current playlist when it has the track, even while a play mode plays the
+// tracks shuffled, otherwise the first other playlist with it, the *History and
+// the smart playlists left out. It is nil when no playlist has the track.
+func (playlists *Playlists) PlaylistOf(URI string) *Playlist {
+	if playlist := playlists.getCurrentPlaylist(); playlist != nil && playlist.IndexByUri(URI) >= 0 {
+		return playlist
+	}
+	playlist, _ := playlists.findTrack(URI, func(playlist *Playlist) bool {
+		return playlist.IsHistory() || playlist.URI == smartFolderURI
+	})
+	return playlist
+}
+
+// PlaylistNameOf returns the name of the playlist PlaylistOf finds, empty when
+// there is none.
+func (playlists *Playlists) PlaylistNameOf(URI string) string {
+	if playlist := playlists.PlaylistOf(URI); playlist != nil {
+		return strings.TrimSpace(playlist.OriginalName())
+	}
+	return ""
+}
+
 func (playlists *Playlists) HasPlaylistSelected() bool {
 	return playlists.currentPlaylist != ""
 }
@@ -0,0 +1,296 @@
+package sconsify
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/schaeferpp/sconsify/infrastructure"
+)
+
+const smartFolderURI = "Smart"
+
+// smartPlaylistsFileLocation is where the smart playlists are defined, replaced
+// by the tests.
+var smartPlaylistsFileLocation = infrastructure.GetSmartPlaylistsFileLocation
+
+// SmartPlaylist is a playlist of the tracks of the library matching its rule, the
+// library being the tracks of every other playlist loaded.
+type SmartPlaylist struct {
+	Name string     `json:"name"`
+	Rule *SmartRule `json:"rule"`
+}
+
+// SmartRule matches a track when every condition it sets holds, a rule without
+// conditions matching every track.
+type SmartRule struct {
+	// Artist, Album and Name match when found in the names of the track, ignoring
+	// the case.
+	Artist string `json:"artist,omitempty"`
+	Album  string `json:"album,omitempty"`
+	Name   string `json:"name,omitempty"`
+	// MinDuration and MaxDuration are durations such as 3m30s.
+	MinDuration string `json:"minDuration,omitempty"`
+	MaxDuration string `json:"maxDuration,omitempty"`
+	// NotPlayedInDays matches the tracks not played for that many days.
+	NotPlayedInDays int `json:"notPlayedInDays,omitempty"`
+	// MostPlayed matches the tracks among that many most played of the library.
+	MostPlayed int `json:"mostPlayed,omitempty"`
+	// Playlist matches the tracks of the playlist with that name or URI.
+	Playlist string `json:"playlist,omitempty"`
+	// All matches when every rule of it does, Any when one does.
+	All []*SmartRule `json:"all,omitempty"`
+	Any []*SmartRule `json:"any,omitempty"`
+}
+
+// PlayStats tells when and how often the tracks were played, for the smart
+// playlists. Without it every track counts as never played.
+type PlayStats interface {
+	LastPlayed(URI string) time.Time
+	PlayCount(URI string) int
+}
+
+// AddSmartPlaylists adds the smart playlists defined by the user to a *Smart
+// folder. They are evaluated now, whenever Merge brings new playlists and when
+// one is loaded again.
+func (playlists *Playlists) AddSmartPlaylists(stats PlayStats) {
+	definitions := loadSmartPlaylists(smartPlaylistsFileLocation())
+	if len(definitions) == 0 {
+		return
+	}
+	folder := InitFolder(smartFolderURI, "*Smart", make([]*Playlist, 0))
+	for _, definition := range definitions {
+		definition := definition
+		folder.AddPlaylist(InitOnDemandPlaylist("smart:"+definition.Name, " "+definition.Name, false, func(playlist *Playlist) {
+			playlist.tracks = playlists.newSmartLibrary(stats).evaluate(definition.Rule)
+			if folder := playlists.GetByURI(smartFolderURI); folder != nil {
+				folder.LoadFolderTracks()
+			}
+		}))
+	}
+	playlists.AddPlaylist(folder)
+	playlists.evaluateSmartPlaylists()
+}
+
+func (playlists *Playlists) evaluateSmartPlaylists() {
+	if folder := playlists.GetByURI(smartFolderURI); folder != nil {
+		for _, playlist := range folder.playlists {
+			playlist.ExecuteLoad()
+		}
+	}
+}
+
+func loadSmartPlaylists(fileLocation string) []*SmartPlaylist {
+	if fileLocation == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(fileLocation)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			infrastructure.Warn("Cannot read the smart playlists", "file", fileLocation, "error", err)
+		}
+		return nil
+	}
+	var definitions []*SmartPlaylist
+	if err := json.Unmarshal(b, &definitions); err != nil {
+		infrastructure.Warn("Cannot read the smart playlists", "file", fileLocation, "error", err)
+		return nil
+	}
+	valid := make([]*SmartPlaylist, 0, len(definitions))
+	for _, definition := range definitions {
+		if definition.Name == "" {
+			infrastructure.Warn("Skipping a smart playlist without a name", "file", fileLocation)
+			continue
+		}
+		if err := definition.Rule.validate(); err != nil {
+			infrastructure.Warn("Skipping a smart playlist", "playlist", definition.Name, "error", err)
+			continue
+		}
+		valid = append(valid, definition)
+	}
+	return valid
+}
+
+func (rule *SmartRule) validate() error {
+	if rule == nil {
+		return nil
+	}
+	for _, duration := range []string{rule.MinDuration, rule.MaxDuration} {
+		if duration != "" {
+			if _, err := time.ParseDuration(duration); err != nil {
+				return err
+			}
+		}
+	}
+	if rule.NotPlayedInDays < 0 || rule.MostPlayed < 0 {
+		return errors.New("notPlayedInDays and mostPlayed cannot be negative")
+	}
+	for _, subRule := range append(append([]*SmartRule(nil), rule.All...), rule.Any...) {
+		if subRule == nil {
+			return errors.New("all and any cannot have an empty rule")
+		}
+		if err := subRule.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// smartLibrary is what the rules are evaluated against, keeping the tracks of
+// the playlists and the most played tracks once worked out.
+type smartLibrary struct {
+	playlists      *Playlists
+	tracks         []*Track
+	stats          PlayStats
+	now            time.Time
+	playlistTracks map[string]map[string]bool
+	mostPlayed     map[int]map[string]bool
+}
+
+// newSmartLibrary gathers the tracks of the playlists, but the searches, the
+// history and the smart playlists, each track once.
+func (playlists *Playlists) newSmartLibrary(stats PlayStats) *smartLibrary {
+	library := &smartLibrary{
+		playlists:      playlists,
+		stats:          stats,
+		now:            time.Now(),
+		playlistTracks: make(map[string]map[string]bool),
+		mostPlayed:     make(map[int]map[string]bool),
+	}
+	found := make(map[string]bool)
+	for _, name := range playlists.Names() {
+		playlist := playlists.Get(name)
+		if playlist.URI == smartFolderURI || playlist.URI == "Search" || playlist.IsSearch() || playlist.IsHistory() {
+			continue
+		}
+		for _, track := range playlist.tracks {
+			if track.Artist != nil && !found[track.URI] {
+				found[track.URI] = true
+				library.tracks = append(library.tracks, track)
+			}
+		}
+	}
+	return library
+}
+
+func (library *smartLibrary) evaluate(rule *SmartRule) []*Track {
+	tracks := make([]*Track, 0)
+	for _, track := range library.tracks {
+		if library.matches(rule, track) {
+			tracks = append(tracks, track)
+		}
+	}
+	return tracks
+}
+
+func (library *smartLibrary) matches(rule *SmartRule, track *Track) bool {
+	if rule == nil {
+		return true
+	}
+	if rule.Artist != "" && !containsIgnoringCase(track.Artist.Name, rule.Artist) {
+		return false
+	}
+	if rule.Album != "" && (track.Album == nil || !containsIgnoringCase(track.Album.Name, rule.Album)) {
+		return false
+	}
+	if rule.Name != "" && !containsIgnoringCase(track.Name, rule.Name) {
+		return false
+	}
+	if rule.MinDuration != "" || rule.MaxDuration != "" {
+		duration, err := time.ParseDuration(track.Duration)
+		if err != nil {
+			return false
+		}
+		if min, _ := time.ParseDuration(rule.MinDuration); rule.MinDuration != "" && duration < min {
+			return false
+		}
+		if max, _ := time.ParseDuration(rule.MaxDuration); rule.MaxDuration != "" && duration > max {
+			return false
+		}
+	}
+	if rule.NotPlayedInDays > 0 && library.stats != nil {
+		lastPlayed := library.stats.LastPlayed(track.URI)
+		if !lastPlayed.IsZero() && library.now.Sub(lastPlayed) < time.Duration(rule.NotPlayedInDays)*24*time.Hour {
+			return false
+		}
+	}
+	if rule.MostPlayed > 0 && !library.mostPlayedTracks(rule.MostPlayed)[track.URI] {
+		return false
+	}
+	if rule.Playlist != "" && !library.tracksOf(rule.Playlist)[track.URI] {
+		return false
+	}
+	for _, subRule := range rule.All {
+		if !library.matches(subRule, track) {
+			return false
+		}
+	}
+	for _, subRule := range rule.Any {
+		if library.matches(subRule, track) {
+			return true
+		}
+	}
+	return len(rule.Any) == 0
+}
+
+// tracksOf returns the URIs of the tracks of the playlist, or the playlist in a
+// folder, with the URI or the name.
+func (library *smartLibrary) tracksOf(key string) map[string]bool {
+	if URIs, found := library.playlistTracks[key]; found {
+		return URIs
+	}
+	URIs := make(map[string]bool)
+	for _, playlist := range library.playlists.playlists {
+		for _, candidate := range append([]*Playlist{playlist}, playlist.playlists...) {
+			if candidate.URI == key || strings.TrimSpace(candidate.OriginalName()) == key {
+				for _, track := range candidate.tracks {
+					URIs[track.URI] = true
+				}
+			}
+		}
+	}
+	library.playlistTracks[key] = URIs
+	return URIs
+}
+
+// mostPlayedTracks returns the URIs of the count tracks played the most, none
+// without play stats.
+func (library *smartLibrary) mostPlayedTracks(count int) map[string]bool {
+	if URIs, found := library.mostPlayed[count]; found {
+		return URIs
+	}
+	URIs := make(map[string]bool)
+	if library.stats != nil {
+		played := make(tracksByPlayCount, 0)
+		for _, track := range library.tracks {
+			if plays := library.stats.PlayCount(track.URI); plays > 0 {
+				played = append(played, trackPlayCount{track: track, plays: plays})
+			}
+		}
+		sort.Stable(played)
+		for i := 0; i < count && i < len(played); i++ {
+			URIs[played[i].track.URI] = true
+		}
+	}
+	library.mostPlayed[count] = URIs
+	return URIs
+}
+
+type trackPlayCount struct {
+	track *Track
+	plays int
+}
+
+type tracksByPlayCount []trackPlayCount
+
+func (t tracksByPlayCount) Len() int           { return len(t) }
+func (t tracksByPlayCount) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t tracksByPlayCount) Less(i, j int) bool { return t[i].plays > t[j].plays }
+
+func containsIgnoringCase(s string, substring string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substring))
+}
@@ -0,0 +1,166 @@
+package sconsify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testPlayStats struct {
+	lastPlayed map[string]time.Time
+	plays      map[string]int
+}
+
+func (stats *testPlayStats) LastPlayed(URI string) time.Time {
+	return stats.lastPlayed[URI]
+}
+
+func (stats *testPlayStats) PlayCount(URI string) int {
+	return stats.plays[URI]
+}
+
+func createSmartPlaylists(t *testing.T, definitions string) (*Playlists, func()) {
+	dir, err := ioutil.TempDir("", "sconsify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	location := filepath.Join(dir, "smart-playlists.json")
+	ioutil.WriteFile(location, []byte(definitions), 0600)
+	previousFileLocation := smartPlaylistsFileLocation
+	smartPlaylistsFileLocation = func() string { return location }
+
+	marley := InitArtist("marley", "Bob Marley")
+	tosh := InitArtist("tosh", "Peter Tosh")
+	playlists := InitPlaylists()
+	playlists.AddPlaylist(InitPlaylist("reggae", "Reggae", []*Track{
+		InitTrack("track0", marley, "Waiting in vain", "4m16s"),
+		InitTrack("track1", tosh, "Legalize it", "4m38s"),
+	}))
+	playlists.AddPlaylist(InitFolder("folder", "Folder", []*Playlist{
+		InitSubPlaylist("ska", "Ska", []*Track{
+			InitTrack("track0", marley, "Waiting in vain", "4m16s"),
+			InitTrack("track2", marley, "Simmer down", "2m50s"),
+		}),
+	}))
+	return playlists, func() {
+		os.RemoveAll(dir)
+		smartPlaylistsFileLocation = previousFileLocation
+	}
+}
+
+func assertSmartPlaylist(t *testing.T, playlists *Playlists, name string, URIs ...string) {
+	playlist := playlists.Get(" " + name)
+	if playlist == nil {
+		t.Fatalf("Smart playlist %v should be in the *Smart folder", name)
+	}
+	if playlist.Tracks() != len(URIs) {
+		t.Errorf("Smart playlist %v should have %v tracks, it has %v", name, len(URIs), playlist.Tracks())
+		return
+	}
+	for i, URI := range URIs {
+		if playlist.Track(i).URI != URI {
+			t.Errorf("Track %v of %v should be %v, it is %v", i, name, URI, playlist.Track(i).URI)
+		}
+	}
+}
+
+func TestSmartPlaylists(t *testing.T) {
+	playlists, cleanup := createSmartPlaylists(t, `[
+		{"name": "Marley", "rule": {"artist": "marley"}},
+		{"name": "Short", "rule": {"maxDuration": "4m20s"}},
+		{"name": "Ska or Tosh", "rule": {"any": [{"playlist": "Ska"}, {"artist": "Tosh"}]}},
+		{"name": "Long Marley", "rule": {"all": [{"artist": "Marley"}, {"minDuration": "3m"}]}},
+		{"name": "Everything"}
+	]`)
+	defer cleanup()
+
+	playlists.AddSmartPlaylists(nil)
+	assertSmartPlaylist(t, playlists, "Marley", "track0", "track2")
+	assertSmartPlaylist(t, playlists, "Short", "track0", "track2")
+	assertSmartPlaylist(t, playlists, "Ska or Tosh", "track0", "track2", "track1")
+	assertSmartPlaylist(t, playlists, "Long Marley", "track0")
+	assertSmartPlaylist(t, playlists, "Everything", "track0", "track2", "track1")
+	if folder := playlists.GetByURI("Smart"); folder == nil || folder.Name() != "*Smart" || folder.Playlists() != 5 {
+		t.Errorf("*Smart folder should have the 5 smart playlists: %v", folder)
+	}
+}
+
+func TestSmartPlaylistsWithPlayStats(t *testing.T) {
+	playlists, cleanup := createSmartPlaylists(t, `[
+		{"name": "Forgotten", "rule": {"notPlayedInDays": 7}},
+		{"name": "Favourite", "rule": {"mostPlayed": 1}}
+	]`)
+	defer cleanup()
+
+	stats := &testPlayStats{
+		lastPlayed: map[string]time.Time{
+			"track0": time.Now().Add(-time.Hour),
+			"track1": time.Now().Add(-30 * 24 * time.Hour),
+		},
+		plays: map[string]int{"track0": 3, "track1": 1},
+	}
+	playlists.AddSmartPlaylists(stats)
+	assertSmartPlaylist(t, playlists, "Forgotten", "track2", "track1")
+	assertSmartPlaylist(t, playlists, "Favourite", "track0")
+}
+
+func TestSmartPlaylistsAreEvaluatedOnMerge(t *testing.T) {
+	playlists, cleanup := createSmartPlaylists(t, `[{"name": "Marley", "rule": {"artist": "Marley"}}]`)
+	defer cleanup()
+	playlists.AddSmartPlaylists(nil)
+
+	newPlaylists := InitPlaylists()
+	newPlaylists.AddPlaylist(InitPlaylist("roots", "Roots", []*Track{
+		InitTrack("track3", InitArtist("marley", "Bob Marley"), "Natural mystic", "3m28s"),
+	}))
+	playlists.Merge(newPlaylists)
+	assertSmartPlaylist(t, playlists, "Marley", "track0", "track2", "track3")
+	if folder := playlists.GetByURI("Smart"); folder.Tracks() != 3 {
+		t.Errorf("*Smart folder should have the 3 tracks of its playlist, it has %v", folder.Tracks())
+	}
+}
+
+func TestMergeKeepsPlayingThroughSmartPlaylist(t *testing.T) {
+	playlists, cleanup := createSmartPlaylists(t, `[{"name": "Marley", "rule": {"artist": "Marley"}}]`)
+	defer cleanup()
+	playlists.AddSmartPlaylists(nil)
+	playlists.SetCurrents(" Marley", 1)
+
+	newPlaylists := InitPlaylists()
+	newPlaylists.AddPlaylist(InitPlaylist("dub", "Dub", []*Track{
+		InitTrack("track3", InitArtist("marley", "Bob Marley"), "Kaya", "2m39s"),
+	}))
+	playlists.Merge(newPlaylists)
+	assertSmartPlaylist(t, playlists, "Marley", "track3", "track0", "track2")
+	if playing := playlists.GetPlayingTrack(); playing.URI != "track2" {
+		t.Errorf("Track playing should still be track2: %v", playing.URI)
+	}
+}
+
+func TestSmartPlaylistsSkipsInvalidDefinitions(t *testing.T) {
+	playlists, cleanup := createSmartPlaylists(t, `[
+		{"rule": {"artist": "Marley"}},
+		{"name": "Bad duration", "rule": {"minDuration": "four minutes"}},
+		{"name": "Bad any", "rule": {"any": [null]}},
+		{"name": "Marley", "rule": {"artist": "Marley"}}
+	]`)
+	defer cleanup()
+
+	playlists.AddSmartPlaylists(nil)
+	if folder := playlists.GetByURI("Smart"); folder == nil || folder.Playlists() != 1 {
+		t.Fatalf("Only the valid smart playlist should be added: %v", folder)
+	}
+	assertSmartPlaylist(t, playlists, "Marley", "track0", "track2")
+}
+
+func TestSmartPlaylistsWithoutDefinitions(t *testing.T) {
+	playlists, cleanup := createSmartPlaylists(t, `not json`)
+	defer cleanup()
+
+	playlists.AddSmartPlaylists(nil)
+	if playlists.GetByURI("Smart") != nil {
+		t.Error("*Smart folder should not be added without smart playlists")
+	}
+}
@@ -47,7 +47,11 @@ func InitWebApiTrack(URI string, artist *Artist, name string, duration string) *
 func ToSconsifyTrack(track *sp.Track) *Track {
 	spArtist := track.Artist(0)
 	artist := InitArtist(spArtist.Link().String(), spArtist.Name())
-	return InitTrack(track.Link().String(), artist, track.Name(), track.Duration().String())
+	sconsifyTrack := InitTrack(track.Link().String(), artist, track.Name(), track.Duration().String())
+	if spAlbum := track.Album(); spAlbum != nil {
+		sconsifyTrack.Album = InitAlbum(spAlbum.Link().String(), spAlbum.Name(), artist)
+	}
+	return sconsifyTrack
 }
 
 func (track *Track) GetFullTitle() string {
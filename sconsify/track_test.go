@@ -5,7 +5,7 @@ import (
 )
 
 func TestCompletedTrack(t *testing.T) {
-	track := InitTrack("0", "0", "0", "0")
+	track := InitTrack("0", InitArtist("0", "0"), "0", "0")
 
 	if track.IsPartial() {
 		t.Error("Track should be completed")
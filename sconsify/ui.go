@@ -8,8 +8,27 @@ type UserInterface interface {
 	TrackNotAvailable(track *Track)
 	PlayTokenLost() error
 	GetNextToPlay() *Track
+	// PeekNextToPlay returns the track GetNextToPlay would return, without consuming it.
+	PeekNextToPlay() *Track
+	// PlayingPlaylist returns the name of the playlist a track GetNextToPlay
+	// returned is played from, empty when it is not known.
+	PlayingPlaylist(track *Track) string
 	NewPlaylists(playlists Playlists) error
 	ArtistAlbums(folder *Playlist)
 	Shutdown()
 	NewTrackLoaded(duration time.Duration)
+	PlaybackPosition(position Position)
+	VolumeChanged(volume Volume)
+	EqualizerChanged(equalizer Equalizer)
+	// Control runs the request of a remote control with Run, from the goroutine
+	// owning the playlists and the queue.
+	Control(request *ControlRequest)
+	// PlaylistEdited finishes an edit saved, or not, by the backend with Finish,
+	// from the goroutine owning the playlists.
+	PlaylistEdited(edit *PlaylistEdit)
+	// PlaylistEditsReplayed tells the user which of the edits made offline were
+	// saved once the backend could reach Spotify again.
+	PlaylistEditsReplayed(replay *PlaylistEditsReplay)
+	// PlayRecorded tells a track played was added to the history.
+	PlayRecorded(play *Play)
 }
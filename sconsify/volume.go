@@ -0,0 +1,49 @@
+package sconsify
+
+import "fmt"
+
+const (
+	MaxVolume  = 100
+	VolumeStep = 5
+)
+
+// Volume is the software volume applied by the audio output, from 0 to MaxVolume.
+type Volume struct {
+	Level int
+	Muted bool
+}
+
+func InitVolume() Volume {
+	return Volume{Level: MaxVolume}
+}
+
+func (volume Volume) set(level int) Volume {
+	if level < 0 {
+		level = 0
+	} else if level > MaxVolume {
+		level = MaxVolume
+	}
+	return Volume{Level: level, Muted: volume.Muted}
+}
+
+func (volume Volume) up() Volume {
+	return Volume{Level: volume.Level, Muted: false}.set(volume.Level + VolumeStep)
+}
+
+func (volume Volume) down() Volume {
+	return volume.set(volume.Level - VolumeStep)
+}
+
+func (volume Volume) toggleMute() Volume {
+	return Volume{Level: volume.Level, Muted: !volume.Muted}
+}
+
+func (volume Volume) String() string {
+	if volume.Muted {
+		return "[Muted] "
+	}
+	if volume.Level != MaxVolume {
+		return fmt.Sprintf("[Volume %v%%] ", volume.Level)
+	}
+	return ""
+}
@@ -0,0 +1,259 @@
+package spotify
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	sp "github.com/fabiofalci/go-libspotify/spotify"
+	"github.com/gordonklaus/portaudio"
+)
+
+// AudioSink is where the played samples end up: the sound card through portaudio,
+// a file, the standard output, a named pipe or nowhere.
+type AudioSink struct {
+	openStream streamOpener
+	portAudio  bool
+}
+
+// ParseAudioSink reads the -audio-output value: portaudio, wav:/path, raw:/path,
+// pipe, fifo:/path or null.
+func ParseAudioSink(output string) (*AudioSink, error) {
+	name, path := output, ""
+	if i := strings.Index(output, ":"); i >= 0 {
+		name, path = output[:i], output[i+1:]
+		if path == "" {
+			return nil, fmt.Errorf("Audio output %v requires a path, e.g. %v:/tmp/sconsify", name, name)
+		}
+	}
+
+	switch {
+	case name == "portaudio" && path == "":
+		return &AudioSink{openStream: openPortAudioStream, portAudio: true}, nil
+	case name == "wav":
+		return &AudioSink{openStream: wavFileOpener(path)}, nil
+	case name == "raw":
+		return &AudioSink{openStream: pcmOpener(func() (io.Writer, error) {
+			return os.Create(path)
+		})}, nil
+	case name == "pipe" && path == "":
+		stdout := os.Stdout
+		return &AudioSink{openStream: pcmOpener(func() (io.Writer, error) {
+			return stdout, nil
+		})}, nil
+	case name == "fifo":
+		if info, err := os.Stat(path); err != nil || info.Mode()&os.ModeNamedPipe == 0 {
+			return nil, fmt.Errorf("%v is not a named pipe, create it with mkfifo", path)
+		}
+		// opening blocks until the reader, e.g. snapserver, opens it too
+		return &AudioSink{openStream: pcmOpener(func() (io.Writer, error) {
+			return os.OpenFile(path, os.O_WRONLY, 0)
+		})}, nil
+	case name == "null" && path == "":
+		return &AudioSink{openStream: openNullStream}, nil
+	}
+	return nil, fmt.Errorf("Unknown audio output: %v", output)
+}
+
+func (sink *AudioSink) initialise() {
+	if sink.portAudio {
+		portaudio.Initialize()
+	}
+}
+
+func (sink *AudioSink) terminate() {
+	if sink.portAudio {
+		portaudio.Terminate()
+	}
+}
+
+// pcmStream writes the samples as little endian int16 without any header, the raw
+// PCM read by sox, ffmpeg or pacat when told the sample rate and channels.
+type pcmStream struct {
+	writer io.Writer
+	out    []int16
+	data   []byte
+}
+
+func newPCMStream(writer io.Writer, out []int16) *pcmStream {
+	return &pcmStream{writer: writer, out: out, data: make([]byte, len(out)*2)}
+}
+
+func (stream *pcmStream) Write() error {
+	for i, sample := range stream.out {
+		binary.LittleEndian.PutUint16(stream.data[i*2:], uint16(sample))
+	}
+	_, err := stream.writer.Write(stream.data)
+	return err
+}
+
+// Close leaves the writer open, the next stream continues writing to it.
+func (stream *pcmStream) Close() error {
+	return nil
+}
+
+// pcmOpener opens the writer once and keeps it across format changes, raw PCM
+// doesn't record the format so the reader is expected to know it.
+func pcmOpener(open func() (io.Writer, error)) streamOpener {
+	var writer io.Writer
+	return func(format sp.AudioFormat, out []int16) (outputStream, error) {
+		if writer == nil {
+			var err error
+			if writer, err = open(); err != nil {
+				return nil, err
+			}
+		}
+		return newPCMStream(writer, out), nil
+	}
+}
+
+// wavFile is the WAV file written, in the format of the first stream. The sizes
+// in the header are updated after every write, the file stays valid when
+// sconsify exits without closing it.
+type wavFile struct {
+	file   *os.File
+	format sp.AudioFormat
+	size   int64
+}
+
+// wavStream writes its samples to the WAV file, converted when its format is not
+// the one of the file.
+type wavStream struct {
+	*wavFile
+	format sp.AudioFormat
+	out    []int16
+	// samples converted to the format of the file and their bytes
+	converted []int16
+	data      []byte
+	// position of the next frame read when resampling, carried across writes
+	position float64
+}
+
+const wavHeaderSize = 44
+
+// wavFileOpener creates the file for the first format. A WAV file having a single
+// format, the audio of the tracks in another one is converted to it.
+func wavFileOpener(path string) streamOpener {
+	var file *wavFile
+	return func(format sp.AudioFormat, out []int16) (outputStream, error) {
+		if file == nil {
+			created, err := os.Create(path)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := created.Write(wavHeader(format, 0)); err != nil {
+				created.Close()
+				return nil, err
+			}
+			file = &wavFile{file: created, format: format}
+		}
+		return &wavStream{wavFile: file, format: format, out: out}, nil
+	}
+}
+
+func (stream *wavStream) Write() error {
+	samples := stream.convert()
+	if cap(stream.data) < len(samples)*2 {
+		stream.data = make([]byte, len(samples)*2)
+	}
+	data := stream.data[:len(samples)*2]
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(data[i*2:], uint16(sample))
+	}
+	if _, err := stream.file.Write(data); err != nil {
+		return err
+	}
+	stream.size += int64(len(data))
+
+	header := wavHeader(sp.AudioFormat{}, stream.size)
+	if _, err := stream.file.WriteAt(header[4:8], 4); err != nil {
+		return err
+	}
+	_, err := stream.file.WriteAt(header[40:44], 40)
+	return err
+}
+
+// convert returns the samples in the format of the file, picking the nearest
+// frame for another sample rate and mixing or copying the channels.
+func (stream *wavStream) convert() []int16 {
+	from, to := stream.format, stream.wavFile.format
+	if from == to {
+		return stream.out
+	}
+	frames := len(stream.out) / from.Channels
+	step := float64(from.SampleRate) / float64(to.SampleRate)
+	converted := stream.converted[:0]
+	for ; stream.position < float64(frames); stream.position += step {
+		frame := stream.out[int(stream.position)*from.Channels:][:from.Channels]
+		for channel := 0; channel < to.Channels; channel++ {
+			converted = append(converted, channelOf(frame, channel, to.Channels))
+		}
+	}
+	stream.position -= float64(frames)
+	stream.converted = converted
+	return converted
+}
+
+// channelOf returns the sample of the channel out of the given number, mixing
+// all the channels of the frame into mono.
+func channelOf(frame []int16, channel int, channels int) int16 {
+	if channels == 1 && len(frame) > 1 {
+		var sum int
+		for _, sample := range frame {
+			sum += int(sample)
+		}
+		return int16(sum / len(frame))
+	}
+	return frame[channel%len(frame)]
+}
+
+// Close leaves the file open, the stream of the next format continues writing
+// to it.
+func (stream *wavStream) Close() error {
+	return nil
+}
+
+func wavHeader(format sp.AudioFormat, size int64) []byte {
+	header := make([]byte, wavHeaderSize)
+	copy(header[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:8], uint32(36+size))
+	copy(header[8:16], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:20], 16)
+	binary.LittleEndian.PutUint16(header[20:22], 1)
+	binary.LittleEndian.PutUint16(header[22:24], uint16(format.Channels))
+	binary.LittleEndian.PutUint32(header[24:28], uint32(format.SampleRate))
+	binary.LittleEndian.PutUint32(header[28:32], uint32(format.SampleRate*format.Channels*2))
+	binary.LittleEndian.PutUint16(header[32:34], uint16(format.Channels*2))
+	binary.LittleEndian.PutUint16(header[34:36], 16)
+	copy(header[36:40], "data")
+	binary.LittleEndian.PutUint32(header[40:44], uint32(size))
+	return header
+}
+
+// nullStream discards the samples, taking as long as a sound card would to play
+// them so the playback moves in real time.
+type nullStream struct {
+	duration time.Duration
+	until    time.Time
+}
+
+func openNullStream(format sp.AudioFormat, out []int16) (outputStream, error) {
+	return &nullStream{duration: durationOfSamples(len(out), format)}, nil
+}
+
+func (stream *nullStream) Write() error {
+	now := time.Now()
+	if stream.until.Before(now) {
+		stream.until = now
+	}
+	stream.until = stream.until.Add(stream.duration)
+	time.Sleep(stream.until.Sub(now))
+	return nil
+}
+
+func (stream *nullStream) Close() error {
+	return nil
+}
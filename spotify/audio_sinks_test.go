@@ -0,0 +1,124 @@
+package spotify
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	sp "github.com/fabiofalci/go-libspotify/spotify"
+)
+
+func TestParseAudioSink(t *testing.T) {
+	for _, output := range []string{"portaudio", "wav:/tmp/sconsify.wav", "raw:/tmp/sconsify.pcm", "pipe", "null"} {
+		if _, err := ParseAudioSink(output); err != nil {
+			t.Errorf("Audio output %v should be valid: %v", output, err)
+		}
+	}
+	for _, output := range []string{"", "alsa", "wav:", "null:/tmp", "fifo:/tmp"} {
+		if _, err := ParseAudioSink(output); err == nil {
+			t.Errorf("Audio output %v should not be valid", output)
+		}
+	}
+}
+
+func TestWavSink(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "sconsify")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out.wav")
+
+	sink, _ := ParseAudioSink("wav:" + path)
+	mono := sp.AudioFormat{SampleType: sp.SampleTypeInt16NativeEndian, SampleRate: 22050, Channels: 1}
+	out := []int16{1, -1}
+	stream, err := sink.openStream(mono, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Write()
+	stream.Write()
+	stream.Close()
+
+	data, _ := ioutil.ReadFile(path)
+	if len(data) != wavHeaderSize+8 {
+		t.Fatalf("File should have the header and 4 samples but has %v bytes", len(data))
+	}
+	if size := binary.LittleEndian.Uint32(data[40:44]); size != 8 {
+		t.Errorf("Header should have 8 bytes of data but has %v", size)
+	}
+	if rate := binary.LittleEndian.Uint32(data[24:28]); rate != 22050 {
+		t.Errorf("Header should have the sample rate 22050 but has %v", rate)
+	}
+	if sample := int16(binary.LittleEndian.Uint16(data[wavHeaderSize+2:])); sample != -1 {
+		t.Errorf("Second sample should be -1 but is %v", sample)
+	}
+}
+
+func TestWavSinkConvertsFormatChange(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "sconsify")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out.wav")
+
+	sink, _ := ParseAudioSink("wav:" + path)
+	mono := sp.AudioFormat{SampleType: sp.SampleTypeInt16NativeEndian, SampleRate: 22050, Channels: 1}
+	stream, _ := sink.openStream(mono, []int16{1, -1})
+	stream.Write()
+	stream.Close()
+
+	// 4 stereo frames at twice the rate become 2 mono frames mixing both channels
+	stereo := sp.AudioFormat{SampleType: sp.SampleTypeInt16NativeEndian, SampleRate: 44100, Channels: 2}
+	stream, err := sink.openStream(stereo, []int16{10, 20, 11, 21, 30, 40, 31, 41})
+	if err != nil {
+		t.Fatalf("A WAV file should keep being written after a format change: %v", err)
+	}
+	stream.Write()
+	stream.Close()
+
+	data, _ := ioutil.ReadFile(path)
+	if rate := binary.LittleEndian.Uint32(data[24:28]); rate != 22050 {
+		t.Errorf("Header should keep the first sample rate 22050 but has %v", rate)
+	}
+	if size := binary.LittleEndian.Uint32(data[40:44]); size != 8 || len(data) != wavHeaderSize+8 {
+		t.Fatalf("File should have 4 mono samples but has %v bytes of data", size)
+	}
+	expected := []int16{1, -1, 15, 35}
+	for i, sample := range expected {
+		if actual := int16(binary.LittleEndian.Uint16(data[wavHeaderSize+i*2:])); actual != sample {
+			t.Errorf("Sample %v should be %v but is %v", i, sample, actual)
+		}
+	}
+}
+
+func TestRawSinkKeepsWritingAcrossFormats(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "sconsify")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out.pcm")
+
+	sink, _ := ParseAudioSink("raw:" + path)
+	for _, channels := range []int{1, 2} {
+		stream, err := sink.openStream(sp.AudioFormat{SampleRate: 44100, Channels: channels}, []int16{7, 7})
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream.Write()
+		stream.Close()
+	}
+
+	if data, _ := ioutil.ReadFile(path); len(data) != 8 {
+		t.Errorf("File should have the 4 samples written but has %v bytes", len(data))
+	}
+}
+
+func TestNullSinkPlaysInRealTime(t *testing.T) {
+	sink, _ := ParseAudioSink("null")
+	// 10 frames at 100 Hz play for 100ms
+	stream, _ := sink.openStream(sp.AudioFormat{SampleRate: 100, Channels: 1}, make([]int16, 10))
+
+	start := time.Now()
+	stream.Write()
+	stream.Write()
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Writing 200ms of samples should take as long but took %v", elapsed)
+	}
+}
@@ -0,0 +1,114 @@
+package spotify
+
+import (
+	"math"
+
+	sp "github.com/fabiofalci/go-libspotify/spotify"
+	"github.com/schaeferpp/sconsify/sconsify"
+)
+
+// bandwidth of the bands, about an octave each
+const equalizerQ = 1.41
+
+// biquad is a peaking filter boosting or cutting the frequencies around the centre
+// of a band, from the Audio EQ Cookbook by Robert Bristow-Johnson.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+}
+
+type biquadState struct {
+	x1, x2, y1, y2 float64
+}
+
+// equalizer filters the samples with a biquad for every band that isn't flat.
+type equalizer struct {
+	format  sp.AudioFormat
+	gains   []float64
+	filters []biquad
+	active  []bool
+	// states per band and channel, kept when the gains change so there's no click
+	states [][]biquadState
+	// attenuation so the boosted bands don't clip
+	preamp float64
+}
+
+func newEqualizer(format sp.AudioFormat) *equalizer {
+	bands := len(sconsify.EqualizerFrequencies)
+	eq := &equalizer{
+		format:  format,
+		filters: make([]biquad, bands),
+		active:  make([]bool, bands),
+		states:  make([][]biquadState, bands),
+		preamp:  1,
+	}
+	for band := range eq.states {
+		eq.states[band] = make([]biquadState, format.Channels)
+	}
+	return eq
+}
+
+func (eq *equalizer) setGains(gains []float64) {
+	eq.gains = gains
+	maxGain := 0.0
+	for band, frequency := range sconsify.EqualizerFrequencies {
+		gain := 0.0
+		if band < len(gains) {
+			gain = gains[band]
+		}
+		eq.active[band] = gain != 0 && frequency < float64(eq.format.SampleRate)/2
+		if eq.active[band] {
+			eq.filters[band] = peakingFilter(frequency, gain, float64(eq.format.SampleRate))
+			maxGain = math.Max(maxGain, gain)
+		} else {
+			eq.states[band] = make([]biquadState, eq.format.Channels)
+		}
+	}
+	eq.preamp = math.Pow(10, -maxGain/20)
+}
+
+func peakingFilter(frequency float64, gain float64, sampleRate float64) biquad {
+	a := math.Pow(10, gain/40)
+	w0 := 2 * math.Pi * frequency / sampleRate
+	alpha := math.Sin(w0) / (2 * equalizerQ)
+	cos := math.Cos(w0)
+	a0 := 1 + alpha/a
+	return biquad{
+		b0: (1 + alpha*a) / a0,
+		b1: -2 * cos / a0,
+		b2: (1 - alpha*a) / a0,
+		a1: -2 * cos / a0,
+		a2: (1 - alpha/a) / a0,
+	}
+}
+
+// process filters the interleaved samples in place.
+func (eq *equalizer) process(samples []int16) {
+	channels := eq.format.Channels
+	for i, sample := range samples {
+		channel := i % channels
+		value := float64(sample) * eq.preamp
+		for band, filter := range eq.filters {
+			if !eq.active[band] {
+				continue
+			}
+			state := &eq.states[band][channel]
+			filtered := filter.b0*value + filter.b1*state.x1 + filter.b2*state.x2 - filter.a1*state.y1 - filter.a2*state.y2
+			state.x2, state.x1 = state.x1, value
+			state.y2, state.y1 = state.y1, filtered
+			value = filtered
+		}
+		samples[i] = int16(math.Max(math.MinInt16, math.Min(math.MaxInt16, value)))
+	}
+}
+
+func sameGains(gains []float64, other []float64) bool {
+	if len(gains) != len(other) {
+		return false
+	}
+	for i := range gains {
+		if gains[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
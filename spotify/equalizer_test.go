@@ -0,0 +1,60 @@
+package spotify
+
+import (
+	"math"
+	"testing"
+
+	sp "github.com/fabiofalci/go-libspotify/spotify"
+)
+
+func sine(frequency float64, format sp.AudioFormat, frames int) []int16 {
+	samples := make([]int16, frames*format.Channels)
+	for i := range samples {
+		frame := i / format.Channels
+		samples[i] = int16(8000 * math.Sin(2*math.Pi*frequency*float64(frame)/float64(format.SampleRate)))
+	}
+	return samples
+}
+
+func rms(samples []int16) float64 {
+	sum := 0.0
+	for _, sample := range samples {
+		sum += float64(sample) * float64(sample)
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+func gainOfEqualizer(gains []float64, frequency float64) float64 {
+	format := sp.AudioFormat{SampleRate: 44100, Channels: 2}
+	eq := newEqualizer(format)
+	eq.setGains(gains)
+	samples := sine(frequency, format, 44100)
+	before := rms(samples[len(samples)/2:])
+	eq.process(samples)
+	// only the second half, once the filters have settled
+	return 20 * math.Log10(rms(samples[len(samples)/2:])/before)
+}
+
+func TestEqualizerFlat(t *testing.T) {
+	if gain := gainOfEqualizer([]float64{0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, 1000); math.Abs(gain) > 0.01 {
+		t.Errorf("Flat equalizer should not change the samples but changed them by %.2f dB", gain)
+	}
+}
+
+func TestEqualizerBoostedBand(t *testing.T) {
+	gains := []float64{0, 0, 0, 0, 0, 12, 0, 0, 0, 0}
+
+	// the preamp takes 12 dB off everything so the boosted band doesn't clip
+	if gain := gainOfEqualizer(gains, 1000); math.Abs(gain) > 0.5 {
+		t.Errorf("Boosted band should keep its level but changed by %.2f dB", gain)
+	}
+	if gain := gainOfEqualizer(gains, 16000); math.Abs(gain+12) > 1 {
+		t.Errorf("Other bands should be 12 dB lower but changed by %.2f dB", gain)
+	}
+}
+
+func TestEqualizerCutBand(t *testing.T) {
+	if gain := gainOfEqualizer([]float64{0, 0, 0, 0, 0, 0, 0, 0, -12, 0}, 8000); math.Abs(gain+12) > 0.5 {
+		t.Errorf("Cut band should be 12 dB lower but changed by %.2f dB", gain)
+	}
+}
@@ -1,9 +1,17 @@
 package mock
 
 import (
+	"time"
+
 	"github.com/schaeferpp/sconsify/sconsify"
 )
 
+type Mock struct {
+	publisher *sconsify.Publisher
+	// replaying publishes no playlist, they all come from the journal replayed
+	replaying bool
+}
+
 var (
 	bobMarley    = sconsify.InitArtist("Bob Marley:1", "Bob Marley")
 	theRamones   = sconsify.InitArtist("The Ramones:2", "The Ramones")
@@ -11,6 +19,19 @@ var (
 )
 
 func Initialise(events *sconsify.Events, publisher *sconsify.Publisher) {
+	sconsify.StartBackend(&Mock{publisher: publisher}, events, publisher)
+}
+
+// InitialiseReplay starts a mock doing nothing, the events of a journal replayed
+// being the only ones.
+func InitialiseReplay(events *sconsify.Events, publisher *sconsify.Publisher) {
+	sconsify.StartBackend(&Mock{publisher: publisher, replaying: true}, events, publisher)
+}
+
+func (mock *Mock) LoadPlaylists() error {
+	if mock.replaying {
+		return nil
+	}
 	playlists := sconsify.InitPlaylists()
 
 	tracks := make([]*sconsify.Track, 2)
@@ -39,8 +60,8 @@ func Initialise(events *sconsify.Events, publisher *sconsify.Publisher) {
 	tracks[2] = sconsify.InitTrack("ramones5", theRamones, "Judy is a punk", "1m9s")
 	playlists.AddPlaylist(sconsify.InitPlaylist("ramonesplaylist1", "Ramones", tracks))
 
-	publisher.NewPlaylist(playlists)
-	waitForMockEvents(events, publisher)
+	mock.publisher.NewPlaylist(playlists)
+	return nil
 }
 
 func getSearchedPlaylist() *sconsify.Playlists {
@@ -54,16 +75,39 @@ func getSearchedPlaylist() *sconsify.Playlists {
 	return playlists
 }
 
-func waitForMockEvents(events *sconsify.Events, publisher *sconsify.Publisher) {
-	for {
-		select {
-		case <-events.PlayUpdates():
-		case <-events.PauseUpdates():
-		case <-events.ReplayUpdates():
-		case <-events.ShutdownSpotifyUpdates():
-			publisher.ShutdownEngine()
-		case <-events.SearchUpdates():
-			publisher.NewPlaylist(getSearchedPlaylist())
-		}
+func (mock *Mock) Play(track *sconsify.Track) {
+}
+
+func (mock *Mock) Pause() {
+}
+
+func (mock *Mock) PlayPauseToggle() {
+}
+
+func (mock *Mock) Replay() {
+}
+
+func (mock *Mock) Seek(offset time.Duration) {
+}
+
+func (mock *Mock) Prefetch(track *sconsify.Track) {
+}
+
+func (mock *Mock) SetVolume(volume sconsify.Volume) {
+}
+
+func (mock *Mock) SetEqualizer(equalizer sconsify.Equalizer) {
+}
+
+func (mock *Mock) Search(query string) {
+	if mock.replaying {
+		return
 	}
+	mock.publisher.NewPlaylist(getSearchedPlaylist())
+}
+
+func (mock *Mock) ArtistAlbums(artist *sconsify.Artist) {
+}
+
+func (mock *Mock) Shutdown() {
 }
@@ -0,0 +1,284 @@
+package spotify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sync"
+	"time"
+
+	sp "github.com/fabiofalci/go-libspotify/spotify"
+	"github.com/schaeferpp/sconsify/infrastructure"
+)
+
+// Normalisation modes: the loudness of every track is brought to the same level,
+// or the tracks of an album keep their differences and the album is normalised.
+const (
+	NormalisationOff   = "off"
+	NormalisationTrack = "track"
+	NormalisationAlbum = "album"
+)
+
+const (
+	// RMS of the samples the tracks are brought to, about -18 dBFS
+	targetRMS = 4125.0
+	// the gain stays between -12 dB and +12 dB
+	minGain = 0.25
+	maxGain = 4.0
+	// how much of a track is measured before its loudness is trusted
+	measureBefore = 3 * time.Second
+	// part of the way to the target gain moved on every write, so the gain
+	// changes smoothly while the loudness of a new track is measured
+	gainSmoothing = 0.1
+)
+
+// CheckNormalisation returns an error for an unknown -normalisation mode.
+func CheckNormalisation(mode string) error {
+	switch mode {
+	case NormalisationOff, NormalisationTrack, NormalisationAlbum:
+		return nil
+	}
+	return fmt.Errorf("Unknown normalisation: %v", mode)
+}
+
+// loudness is the mean square of the samples measured for a track.
+type loudness struct {
+	Album      string
+	MeanSquare float64
+	Samples    int64
+}
+
+// albumLoudness sums the loudness of the tracks measured of an album.
+type albumLoudness struct {
+	sumSquares float64
+	samples    int64
+}
+
+// normaliser keeps the loudness measured for each track, saved so the next play
+// of a track is normalised from its beginning.
+type normaliser struct {
+	album    bool
+	location string
+	// the tracks to save, a single writer saving only the latest
+	saves   chan []byte
+	written chan struct{}
+
+	mutex  sync.Mutex
+	closed bool
+	tracks map[string]*loudness
+	albums map[string]*albumLoudness
+}
+
+// trackGain normalises the samples of a track while measuring them.
+type trackGain struct {
+	normaliser *normaliser
+	uri        string
+	album      string
+
+	sumSquares float64
+	samples    int64
+	minSamples int64
+	gain       float64
+}
+
+// newNormaliser returns nil when the mode is off, nil normalises nothing.
+func newNormaliser(mode string, location string) *normaliser {
+	if mode == "" || mode == NormalisationOff {
+		return nil
+	}
+	normaliser := &normaliser{
+		album:    mode == NormalisationAlbum,
+		location: location,
+		tracks:   make(map[string]*loudness),
+		albums:   make(map[string]*albumLoudness),
+	}
+	if location != "" {
+		if b, err := ioutil.ReadFile(location); err == nil {
+			tracks := make(map[string]*loudness)
+			if err := json.Unmarshal(b, &tracks); err != nil {
+				infrastructure.Warn("Cannot read the loudness of the tracks", "file", location, "error", err)
+			}
+			for uri, loudness := range tracks {
+				normaliser.keep(uri, loudness)
+			}
+		}
+		normaliser.saves = make(chan []byte, 1)
+		normaliser.written = make(chan struct{})
+		go normaliser.writer()
+	}
+	return normaliser
+}
+
+// keep sets the loudness of the track, replacing its previous one in the album.
+func (normaliser *normaliser) keep(uri string, measured *loudness) {
+	if previous, found := normaliser.tracks[uri]; found && previous.Album != "" {
+		album := normaliser.albums[previous.Album]
+		album.sumSquares -= previous.MeanSquare * float64(previous.Samples)
+		album.samples -= previous.Samples
+	}
+	normaliser.tracks[uri] = measured
+	if measured.Album != "" {
+		album, found := normaliser.albums[measured.Album]
+		if !found {
+			album = &albumLoudness{}
+			normaliser.albums[measured.Album] = album
+		}
+		album.sumSquares += measured.MeanSquare * float64(measured.Samples)
+		album.samples += measured.Samples
+	}
+}
+
+// writer saves the tracks one write after the other, the player never waiting
+// for the disk.
+func (normaliser *normaliser) writer() {
+	defer close(normaliser.written)
+	for b := range normaliser.saves {
+		if err := infrastructure.SaveFileAtomically(normaliser.location, b); err != nil {
+			infrastructure.Warn("Cannot save the loudness of the tracks", "file", normaliser.location, "error", err)
+		}
+	}
+}
+
+// save replaces the tracks waiting to be saved, if any, by the latest ones.
+// Called holding the mutex.
+func (normaliser *normaliser) save(b []byte) {
+	select {
+	case <-normaliser.saves:
+	default:
+	}
+	normaliser.saves <- b
+}
+
+// close stops the writer once it saved the tracks waiting, the loudness measured
+// afterwards being kept in memory only.
+func (normaliser *normaliser) close() {
+	if normaliser == nil || normaliser.saves == nil {
+		return
+	}
+	normaliser.mutex.Lock()
+	if !normaliser.closed {
+		normaliser.closed = true
+		close(normaliser.saves)
+	}
+	normaliser.mutex.Unlock()
+	<-normaliser.written
+}
+
+func (normaliser *normaliser) start(uri string, album string) *trackGain {
+	if normaliser == nil {
+		return nil
+	}
+	stage := &trackGain{normaliser: normaliser, uri: uri, album: album, gain: 1}
+	if target, known := normaliser.target(stage); known {
+		stage.gain = target
+	}
+	return stage
+}
+
+// target is the gain for the track, known once the track or, in album mode, its
+// album has been measured.
+func (normaliser *normaliser) target(stage *trackGain) (float64, bool) {
+	normaliser.mutex.Lock()
+	defer normaliser.mutex.Unlock()
+
+	var sumSquares float64
+	var samples int64
+	add := func(loudness *loudness) {
+		sumSquares += loudness.MeanSquare * float64(loudness.Samples)
+		samples += loudness.Samples
+	}
+
+	measured, cached := normaliser.tracks[stage.uri]
+	if cached {
+		add(measured)
+	} else if stage.samples >= stage.minSamples && stage.samples > 0 {
+		add(&loudness{MeanSquare: stage.sumSquares / float64(stage.samples), Samples: stage.samples})
+	}
+	if album, found := normaliser.albums[stage.album]; normaliser.album && stage.album != "" && found {
+		// the other tracks of the album, the track itself being added above
+		sumSquares += album.sumSquares
+		samples += album.samples
+		if cached && measured.Album == stage.album {
+			sumSquares -= measured.MeanSquare * float64(measured.Samples)
+			samples -= measured.Samples
+		}
+	}
+
+	if samples == 0 {
+		return 1, false
+	}
+	return gainOf(sumSquares / float64(samples)), true
+}
+
+func gainOf(meanSquare float64) float64 {
+	if meanSquare <= 0 {
+		return 1
+	}
+	return math.Max(minGain, math.Min(maxGain, targetRMS/math.Sqrt(meanSquare)))
+}
+
+// finish keeps the loudness measured if it covers more of the track than the one
+// known so far.
+func (normaliser *normaliser) finish(stage *trackGain) {
+	if stage.samples == 0 || stage.samples < stage.minSamples {
+		return
+	}
+	normaliser.mutex.Lock()
+	defer normaliser.mutex.Unlock()
+
+	if known, found := normaliser.tracks[stage.uri]; found && known.Samples >= stage.samples {
+		return
+	}
+	normaliser.keep(stage.uri, &loudness{
+		Album:      stage.album,
+		MeanSquare: stage.sumSquares / float64(stage.samples),
+		Samples:    stage.samples,
+	})
+	if normaliser.saves != nil && !normaliser.closed {
+		if b, err := json.Marshal(normaliser.tracks); err == nil {
+			normaliser.save(b)
+		}
+	}
+}
+
+// apply measures the samples and changes them in place by the gain, moving it a
+// bit closer to the target gain on every call.
+func (stage *trackGain) apply(samples []int16, format sp.AudioFormat) []int16 {
+	if stage == nil || len(samples) == 0 {
+		return samples
+	}
+	if stage.minSamples == 0 {
+		stage.minSamples = int64(measureBefore.Seconds() * float64(format.SampleRate*format.Channels))
+	}
+	for _, sample := range samples {
+		stage.sumSquares += float64(sample) * float64(sample)
+	}
+	stage.samples += int64(len(samples))
+
+	gain := stage.gain
+	if target, known := stage.normaliser.target(stage); known {
+		gain += (target - gain) * gainSmoothing
+	}
+	for i, sample := range samples {
+		value := float64(sample) * (stage.gain + (gain-stage.gain)*float64(i)/float64(len(samples)))
+		samples[i] = int16(math.Max(math.MinInt16, math.Min(math.MaxInt16, value)))
+	}
+	stage.gain = gain
+	return samples
+}
+
+// restart forgets what was measured, the track is going to be written again from
+// its beginning.
+func (stage *trackGain) restart() *trackGain {
+	if stage == nil {
+		return nil
+	}
+	return stage.normaliser.start(stage.uri, stage.album)
+}
+
+func (stage *trackGain) finish() {
+	if stage != nil {
+		stage.normaliser.finish(stage)
+	}
+}
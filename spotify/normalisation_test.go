@@ -0,0 +1,122 @@
+package spotify
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	sp "github.com/fabiofalci/go-libspotify/spotify"
+)
+
+var testFormat = sp.AudioFormat{SampleRate: 1000, Channels: 1}
+
+func constantSamples(samples int, value int16) []int16 {
+	constant := make([]int16, samples)
+	for i := range constant {
+		constant[i] = value
+	}
+	return constant
+}
+
+func TestNormalisationOff(t *testing.T) {
+	normaliser := newNormaliser(NormalisationOff, "")
+	if normaliser != nil {
+		t.Fatal("Normalisation off should not create a normaliser")
+	}
+	if samples := normaliser.start("track", "album").apply([]int16{1000}, testFormat); samples[0] != 1000 {
+		t.Errorf("Samples should not change but are %v", samples)
+	}
+}
+
+func TestTrackGainMovesToTarget(t *testing.T) {
+	stage := newNormaliser(NormalisationTrack, "").start("track", "album")
+
+	// 1000 is about 4 times quieter than the target, the maximum gain
+	var samples []int16
+	for i := 0; i < 100; i++ {
+		samples = stage.apply(constantSamples(1000, 1000), testFormat)
+		if i == 1 && samples[999] != 1000 {
+			t.Errorf("Gain should not change before %v are measured but is %v", measureBefore, stage.gain)
+		}
+	}
+	if math.Abs(stage.gain-maxGain) > 0.01 || samples[999] < 3990 {
+		t.Errorf("Gain should reach %v but is %v", maxGain, stage.gain)
+	}
+}
+
+func TestTrackGainFromMeasuredTrack(t *testing.T) {
+	normaliser := newNormaliser(NormalisationTrack, "")
+	stage := normaliser.start("track", "album")
+	for i := 0; i < 5; i++ {
+		stage.apply(constantSamples(1000, 8250), testFormat)
+	}
+	stage.finish()
+
+	if again := normaliser.start("track", "album"); again.gain != 0.5 {
+		t.Errorf("A measured track should start with its gain 0.5 but starts with %v", again.gain)
+	}
+	if other := normaliser.start("other", "album"); other.gain != 1 {
+		t.Errorf("In track mode another track of the album should start without gain but starts with %v", other.gain)
+	}
+}
+
+func TestAlbumGain(t *testing.T) {
+	normaliser := newNormaliser(NormalisationAlbum, "")
+	normaliser.keep("quiet", &loudness{Album: "album", MeanSquare: 2000 * 2000, Samples: 100})
+	normaliser.keep("loud", &loudness{Album: "album", MeanSquare: 4000 * 4000, Samples: 100})
+	normaliser.keep("elsewhere", &loudness{Album: "other", MeanSquare: 100 * 100, Samples: 100})
+
+	expected := targetRMS / math.Sqrt((2000*2000+4000*4000)/2)
+	for _, uri := range []string{"quiet", "loud", "new"} {
+		if stage := normaliser.start(uri, "album"); math.Abs(stage.gain-expected) > 0.0001 {
+			t.Errorf("Track %v should have the album gain %v but has %v", uri, expected, stage.gain)
+		}
+	}
+}
+
+func TestAlbumGainOfTrackMeasuredAgain(t *testing.T) {
+	normaliser := newNormaliser(NormalisationAlbum, "")
+	normaliser.keep("quiet", &loudness{Album: "album", MeanSquare: 100 * 100, Samples: 100})
+	normaliser.keep("quiet", &loudness{Album: "album", MeanSquare: 2000 * 2000, Samples: 100})
+	normaliser.keep("loud", &loudness{Album: "album", MeanSquare: 4000 * 4000, Samples: 100})
+
+	expected := targetRMS / math.Sqrt((2000*2000+4000*4000)/2)
+	if stage := normaliser.start("loud", "album"); math.Abs(stage.gain-expected) > 0.0001 {
+		t.Errorf("The album gain should only count the last loudness of a track, %v but is %v", expected, stage.gain)
+	}
+}
+
+func TestNormaliserSavesMeasuredTracks(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "sconsify")
+	defer os.RemoveAll(dir)
+	location := filepath.Join(dir, "normalisation.json")
+
+	normaliser := newNormaliser(NormalisationTrack, location)
+	stage := normaliser.start("track", "album")
+	for i := 0; i < 5; i++ {
+		stage.apply(constantSamples(1000, 8250), testFormat)
+	}
+	stage.finish()
+	normaliser.close()
+
+	again := newNormaliser(NormalisationTrack, location)
+	defer again.close()
+	if stage := again.start("track", "album"); stage.gain != 0.5 {
+		t.Errorf("The loudness measured should be saved, gain 0.5 but is %v", stage.gain)
+	}
+}
+
+func TestNormaliserReadsMeasuredTracks(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "sconsify")
+	defer os.RemoveAll(dir)
+	location := filepath.Join(dir, "normalisation.json")
+	ioutil.WriteFile(location, []byte(`{"track":{"Album":"album","MeanSquare":68062500,"Samples":5000}}`), 0600)
+
+	normaliser := newNormaliser(NormalisationTrack, location)
+	defer normaliser.close()
+	if stage := normaliser.start("track", "album"); stage.gain != 0.5 {
+		t.Errorf("Track measured before should start with its gain 0.5 but starts with %v", stage.gain)
+	}
+}
@@ -2,70 +2,500 @@
 package spotify
 
 import (
+	"math"
+	"sync"
+	"time"
+
 	sp "github.com/fabiofalci/go-libspotify/spotify"
 	"github.com/gordonklaus/portaudio"
+	"github.com/schaeferpp/sconsify/infrastructure"
+	"github.com/schaeferpp/sconsify/sconsify"
 )
 
+// AudioOutput plays the frames written by a backend and is the playback clock,
+// counting the frames actually written to the stream.
+type AudioOutput interface {
+	sp.AudioConsumer
+
+	// MarkPosition sets the clock once the frames written before it are played,
+	// when a new track starts or after a seek.
+	MarkPosition(elapsed time.Duration, total time.Duration)
+	// Position is the position played, or the one marked last until it plays.
+	Position() time.Duration
+	SetVolume(volume sconsify.Volume)
+	SetEqualizer(equalizer sconsify.Equalizer)
+	// MarkTrack tells the frames written after it belong to the track, which
+	// are normalised with its own gain.
+	MarkTrack(uri string, album string)
+	// MarkNextTrack tells the frames written with WriteNextAudio after it belong
+	// to the track.
+	MarkNextTrack(uri string, album string)
+
+	// WriteNextAudio writes the beginning of the next track, which is mixed with
+	// the end of the current one during the crossfade.
+	WriteNextAudio(format sp.AudioFormat, frames []byte) int
+	// SwitchToNext continues with the next track once the frames of the current
+	// one written before it are played.
+	SwitchToNext(total time.Duration)
+	// DropNext discards the frames of the next track written so far.
+	DropNext()
+	// Close stops playing, saving the loudness measured of the track playing.
+	Close()
+}
+
 type audio struct {
 	format sp.AudioFormat
 	frames []byte
+	mark   *mark
+}
+
+type mark struct {
+	elapsed      time.Duration
+	total        time.Duration
+	switchToNext bool
+	dropNext     bool
+	close        bool
+	track        *markedTrack
+	nextTrack    *markedTrack
+}
+
+type markedTrack struct {
+	uri   string
+	album string
+}
+
+// AudioInitConf configures the audio output shared by the backends.
+type AudioInitConf struct {
+	Sink          *AudioSink
+	Crossfade     time.Duration
+	Normalisation string
 }
 
 type portAudio struct {
-	buffer chan *audio
+	buffer     chan *audio
+	nextBuffer chan *audio
+	publisher  *sconsify.Publisher
+	crossfade  time.Duration
+	openStream streamOpener
+	normaliser *normaliser
+	closed     chan struct{}
+
+	mutex   sync.Mutex
+	elapsed time.Duration
+	total   time.Duration
+	ending  bool
+	gain    int
+	// band gains of the equalizer, nil when flat
+	equalizerGains []float64
+	// the position marks written but not played yet and the latest of them,
+	// which a seek made meanwhile continues from
+	pendingMarks    int
+	pendingPosition time.Duration
 }
 
-func newPortAudio() *portAudio {
-	return &portAudio{buffer: make(chan *audio, 8)}
+// outputStream is where the samples are played, a portaudio stream outside of tests.
+type outputStream interface {
+	Write() error
+	Close() error
 }
 
-func (pa *portAudio) player() {
-	out := make([]int16, 2048*2)
-
-	stream, err := portaudio.OpenDefaultStream(
-		0,
-		2,     // audio.format.Channels,
-		44100, // float64(audio.format.SampleRate),
-		len(out),
-		&out,
-	)
+// streamOpener opens a stream for the format, which plays the samples in out on
+// every Write.
+type streamOpener func(format sp.AudioFormat, out []int16) (outputStream, error)
+
+type portAudioStream struct {
+	*portaudio.Stream
+}
+
+const (
+	// frames written to the stream at once, the same libspotify delivers
+	framesPerBuffer = 2048
+	// how long before the end of a track the next one is prefetched, at least
+	prefetchBefore = 10 * time.Second
+	// how long a partial buffer waits for more frames before it is played
+	flushAfter = 100 * time.Millisecond
+	// how often the failures to write the stream, e.g. underflows repeating for
+	// every buffer, are warned about
+	writeWarningInterval = time.Minute
+)
+
+func newPortAudio(publisher *sconsify.Publisher, initConf *AudioInitConf) *portAudio {
+	return &portAudio{
+		buffer:     make(chan *audio, 8),
+		nextBuffer: make(chan *audio, 8),
+		publisher:  publisher,
+		crossfade:  initConf.Crossfade,
+		openStream: initConf.Sink.openStream,
+		normaliser: newNormaliser(initConf.Normalisation, infrastructure.GetNormalisationFileLocation()),
+		closed:     make(chan struct{}),
+		gain:       sconsify.MaxVolume,
+	}
+}
+
+// InitialiseAudio starts the sink and returns the output playing the frames written
+// to it, so backends other than libspotify share the same audio path. A crossfade
+// greater than zero mixes the frames written with WriteNextAudio.
+func InitialiseAudio(publisher *sconsify.Publisher, initConf *AudioInitConf) AudioOutput {
+	pa := newPortAudio(publisher, initConf)
+	initConf.Sink.initialise()
+	go pa.player()
+	return pa
+}
+
+// TerminateAudio closes the output InitialiseAudio returned and stops the sink.
+func TerminateAudio(output AudioOutput, initConf *AudioInitConf) {
+	output.Close()
+	initConf.Sink.terminate()
+}
+
+func openPortAudioStream(format sp.AudioFormat, out []int16) (outputStream, error) {
+	stream, err := portaudio.OpenDefaultStream(0, format.Channels, float64(format.SampleRate), len(out)/format.Channels, &out)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	if err := stream.Start(); err != nil {
+		stream.Close()
+		return nil, err
 	}
-	defer stream.Close()
+	return &portAudioStream{stream}, nil
+}
+
+func (stream *portAudioStream) Close() error {
+	stream.Stop()
+	return stream.Stream.Close()
+}
 
-	stream.Start()
-	defer stream.Stop()
+// player writes the frames to a stream opened for their format, opening it again
+// whenever the sample rate or the channels change.
+func (pa *portAudio) player() {
+	var stream outputStream
+	var format sp.AudioFormat
+	var out []int16
+	var current, next *trackGain
+	var eq *equalizer
+	var failedWrites int
+	var lastWriteWarning time.Time
+	mixer := &mixer{}
+	defer func() {
+		if stream != nil {
+			stream.Close()
+		}
+		close(pa.closed)
+	}()
+
+	// Partial buffers are not written straight away: the end of a track is
+	// completed with the beginning of the next one so there is no gap between
+	// them. Only when nothing else comes the rest is filled with silence.
+	write := func(samples int) {
+		mixer.next = pa.receiveNext(mixer.next, samples, next)
+		blended := mixer.blend(samples)
+		if stream == nil {
+			return
+		}
+		if gains := pa.currentEqualizerGains(); gains == nil {
+			eq = nil
+		} else {
+			if eq == nil || eq.format != format {
+				eq = newEqualizer(format)
+			}
+			if !sameGains(eq.gains, gains) {
+				eq.setGains(gains)
+			}
+			eq.process(blended)
+		}
+		gain := pa.currentGain()
+		for i := range out {
+			out[i] = 0
+			if i < len(blended) {
+				out[i] = int16(int32(blended[i]) * gain / sconsify.MaxVolume)
+			}
+		}
+		if err := stream.Write(); err != nil {
+			failedWrites++
+			if now := time.Now(); now.Sub(lastWriteWarning) >= writeWarningInterval {
+				infrastructure.Warn("Cannot write the audio stream", "failures", failedWrites, "error", err)
+				failedWrites, lastWriteWarning = 0, now
+			}
+		}
+		pa.played(durationOfSamples(samples, format))
+	}
+
+	reopen := func(newFormat sp.AudioFormat) {
+		if len(mixer.current) > 0 {
+			write(len(mixer.current))
+		}
+		if stream != nil {
+			stream.Close()
+		}
+		format = newFormat
+		out = make([]int16, framesPerBuffer*format.Channels)
+		mixer.fadeSamples = int(pa.crossfade*time.Duration(format.SampleRate)/time.Second) * format.Channels
+
+		var err error
+		if stream, err = pa.openStream(format, out); err != nil {
+			// the tracks still play in real time, only without sound
+			infrastructure.Error("Cannot open the audio stream, playing silently", "sampleRate", format.SampleRate, "channels", format.Channels, "error", err)
+			stream, _ = openNullStream(format, out)
+		}
+	}
 
 	for {
-		// Decode the incoming data which is expected to be 2 channels and
-		// delivered as int16 in []byte, hence we need to convert it.
+		var flush <-chan time.Time
+		if len(mixer.current) > 0 {
+			flush = time.After(flushAfter)
+		}
 
 		select {
 		case audio := <-pa.buffer:
-			if len(audio.frames) != 2048*2*2 {
-				// panic("unexpected")
-				// don't know if it's a panic or track just ended
-				break
+			switch {
+			case audio.mark == nil:
+				if audio.format != format {
+					reopen(audio.format)
+				}
+				mixer.current = append(mixer.current, current.apply(toSamples(audio.frames), audio.format)...)
+			case audio.mark.track != nil:
+				current.finish()
+				current = pa.normaliser.start(audio.mark.track.uri, audio.mark.track.album)
+			case audio.mark.nextTrack != nil:
+				next = pa.normaliser.start(audio.mark.nextTrack.uri, audio.mark.nextTrack.album)
+			case audio.mark.switchToNext:
+				mixer.next = pa.receiveNext(mixer.next, math.MaxInt32, next)
+				faded := mixer.switchToNext()
+				current.finish()
+				current, next = next, nil
+				pa.setPosition(durationOfSamples(faded, format), audio.mark.total, false)
+			case audio.mark.dropNext:
+				pa.receiveNext(nil, math.MaxInt32, nil)
+				mixer.dropNext()
+				next = next.restart()
+			case audio.mark.close:
+				current.finish()
+				pa.normaliser.close()
+				return
+			default:
+				pa.setPosition(audio.mark.elapsed, audio.mark.total, true)
 			}
-
-			j := 0
-			for i := 0; i < len(audio.frames); i += 2 {
-				out[j] = int16(audio.frames[i]) | int16(audio.frames[i+1])<<8
-				j++
+			for len(out) > 0 && len(mixer.current) >= len(out) {
+				write(len(out))
 			}
+		case <-flush:
+			write(len(mixer.current))
+		}
+	}
+}
+
+func durationOfSamples(samples int, format sp.AudioFormat) time.Duration {
+	if format.Channels <= 0 || format.SampleRate <= 0 {
+		return 0
+	}
+	return time.Duration(samples/format.Channels) * time.Second / time.Duration(format.SampleRate)
+}
+
+// receiveNext appends the frames of the next track written so far until there
+// are the wanted samples, normalised by its gain.
+func (pa *portAudio) receiveNext(samples []int16, wanted int, next *trackGain) []int16 {
+	for len(samples) < wanted {
+		select {
+		case audio := <-pa.nextBuffer:
+			samples = append(samples, next.apply(toSamples(audio.frames), audio.format)...)
+		default:
+			return samples
+		}
+	}
+	return samples
+}
+
+// toSamples decodes the frames, which are delivered as int16 in []byte.
+func toSamples(frames []byte) []int16 {
+	samples := make([]int16, len(frames)/2)
+	for i := range samples {
+		samples[i] = int16(frames[i*2]) | int16(frames[i*2+1])<<8
+	}
+	return samples
+}
+
+// mixer holds the samples waiting to be played: the current track and, while
+// crossfading, the beginning of the next one.
+type mixer struct {
+	current []int16
+	next    []int16
+	// samples of the next track mixed so far and how many the crossfade lasts
+	faded       int
+	fadeSamples int
+}
+
+// blend fades the given number of samples of the current track into the next one,
+// if there is any, and returns them.
+func (mixer *mixer) blend(samples int) []int16 {
+	mixed := 0
+	if mixer.fadeSamples > 0 {
+		mixed = len(mixer.next)
+		if mixed > samples {
+			mixed = samples
+		}
+	}
 
-			stream.Write()
+	fade := int64(mixer.fadeSamples)
+	for i := 0; i < mixed; i++ {
+		weight := int64(mixer.faded + i)
+		if weight > fade {
+			weight = fade
 		}
+		mixer.current[i] = int16((int64(mixer.current[i])*(fade-weight) + int64(mixer.next[i])*weight) / fade)
+	}
+
+	blended := mixer.current[:samples]
+	mixer.current = mixer.current[samples:]
+	mixer.next = mixer.next[mixed:]
+	mixer.faded += mixed
+	return blended
+}
+
+// switchToNext continues with the next track when the current one ended and
+// returns how many of its samples were already played.
+func (mixer *mixer) switchToNext() int {
+	faded := mixer.faded
+	blended := mixer.blend(len(mixer.current))
+	mixer.current = append(blended, mixer.next...)
+	mixer.dropNext()
+	return faded
+}
+
+func (mixer *mixer) dropNext() {
+	mixer.next = nil
+	mixer.faded = 0
+}
+
+// setPosition sets the clock, marked being set when a position mark is played.
+func (pa *portAudio) setPosition(elapsed time.Duration, total time.Duration, marked bool) {
+	pa.mutex.Lock()
+	if marked {
+		pa.pendingMarks--
+	}
+	pa.elapsed = elapsed
+	pa.total = total
+	pa.ending = false
+	pa.mutex.Unlock()
+	pa.publisher.PlaybackPosition(elapsed, total)
+}
+
+// played advances the clock by the duration of the frames written to the stream,
+// publishing the position every new second and once when the track is about to end.
+func (pa *portAudio) played(duration time.Duration) {
+	pa.mutex.Lock()
+	before := pa.elapsed
+	pa.elapsed += duration
+	elapsed, total := pa.elapsed, pa.total
+	ending := !pa.ending && total > 0 && total-elapsed <= pa.prefetchBefore()
+	if ending {
+		pa.ending = true
+	}
+	pa.mutex.Unlock()
+
+	if elapsed/time.Second != before/time.Second {
+		pa.publisher.PlaybackPosition(elapsed, total)
+	}
+	if ending {
+		pa.publisher.TrackEnding()
 	}
 }
 
+// prefetchBefore leaves time to prefetch the next track before the crossfade starts.
+func (pa *portAudio) prefetchBefore() time.Duration {
+	if pa.crossfade+5*time.Second > prefetchBefore {
+		return pa.crossfade + 5*time.Second
+	}
+	return prefetchBefore
+}
+
+func (pa *portAudio) MarkPosition(elapsed time.Duration, total time.Duration) {
+	pa.mutex.Lock()
+	pa.pendingMarks++
+	pa.pendingPosition = elapsed
+	pa.mutex.Unlock()
+	pa.buffer <- &audio{mark: &mark{elapsed: elapsed, total: total}}
+}
+
+func (pa *portAudio) SwitchToNext(total time.Duration) {
+	pa.buffer <- &audio{mark: &mark{total: total, switchToNext: true}}
+}
+
+func (pa *portAudio) DropNext() {
+	pa.buffer <- &audio{mark: &mark{dropNext: true}}
+}
+
+func (pa *portAudio) Close() {
+	pa.buffer <- &audio{mark: &mark{close: true}}
+	<-pa.closed
+}
+
+func (pa *portAudio) MarkTrack(uri string, album string) {
+	if pa.normaliser != nil {
+		pa.buffer <- &audio{mark: &mark{track: &markedTrack{uri: uri, album: album}}}
+	}
+}
+
+func (pa *portAudio) MarkNextTrack(uri string, album string) {
+	if pa.normaliser != nil {
+		pa.buffer <- &audio{mark: &mark{nextTrack: &markedTrack{uri: uri, album: album}}}
+	}
+}
+
+// Position returns the position played, or the one marked last while it waits
+// to be played, so seeks made one after the other add up.
+func (pa *portAudio) Position() time.Duration {
+	pa.mutex.Lock()
+	defer pa.mutex.Unlock()
+	if pa.pendingMarks > 0 {
+		return pa.pendingPosition
+	}
+	return pa.elapsed
+}
+
+// SetEqualizer changes the band gains, applied from the next samples played.
+func (pa *portAudio) SetEqualizer(equalizer sconsify.Equalizer) {
+	pa.mutex.Lock()
+	defer pa.mutex.Unlock()
+	if equalizer.IsFlat() {
+		pa.equalizerGains = nil
+	} else {
+		pa.equalizerGains = append([]float64(nil), equalizer.Gains...)
+	}
+}
+
+func (pa *portAudio) currentEqualizerGains() []float64 {
+	pa.mutex.Lock()
+	defer pa.mutex.Unlock()
+	return pa.equalizerGains
+}
+
+// SetVolume changes the gain applied to the samples, from 0 to sconsify.MaxVolume.
+func (pa *portAudio) SetVolume(volume sconsify.Volume) {
+	pa.mutex.Lock()
+	defer pa.mutex.Unlock()
+	if volume.Muted {
+		pa.gain = 0
+	} else {
+		pa.gain = volume.Level
+	}
+}
+
+func (pa *portAudio) currentGain() int32 {
+	pa.mutex.Lock()
+	defer pa.mutex.Unlock()
+	return int32(pa.gain)
+}
+
 func (pa *portAudio) WriteAudio(format sp.AudioFormat, frames []byte) int {
-	audio := &audio{format, frames}
+	audio := &audio{format: format, frames: frames}
 
 	if len(frames) == 0 {
 		return 0
 	}
+	if format.Channels <= 0 || format.SampleRate <= 0 {
+		// nothing can play them, they are dropped
+		return len(frames)
+	}
 
 	select {
 	case pa.buffer <- audio:
@@ -74,3 +504,16 @@ func (pa *portAudio) WriteAudio(format sp.AudioFormat, frames []byte) int {
 		return 0
 	}
 }
+
+func (pa *portAudio) WriteNextAudio(format sp.AudioFormat, frames []byte) int {
+	if len(frames) == 0 {
+		return 0
+	}
+
+	select {
+	case pa.nextBuffer <- &audio{format: format, frames: frames}:
+		return len(frames)
+	default:
+		return 0
+	}
+}
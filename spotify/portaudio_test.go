@@ -0,0 +1,245 @@
+package spotify
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	sp "github.com/fabiofalci/go-libspotify/spotify"
+	"github.com/schaeferpp/sconsify/sconsify"
+)
+
+type testStream struct {
+	format sp.AudioFormat
+	out    []int16
+	writes chan<- []int16
+}
+
+func (stream *testStream) Write() error {
+	stream.writes <- append([]int16(nil), stream.out...)
+	return nil
+}
+
+func (stream *testStream) Close() error {
+	return nil
+}
+
+// startTestPlayer runs a player whose streams are reported on opened and whose
+// writes are copied to writes.
+func startTestPlayer() (*portAudio, chan sp.AudioFormat, chan []int16) {
+	opened := make(chan sp.AudioFormat, 10)
+	writes := make(chan []int16, 10)
+	pa := newPortAudio(&sconsify.Publisher{}, &AudioInitConf{Sink: &AudioSink{}})
+	pa.openStream = func(format sp.AudioFormat, out []int16) (outputStream, error) {
+		opened <- format
+		return &testStream{format: format, out: out, writes: writes}, nil
+	}
+	go pa.player()
+	return pa, opened, writes
+}
+
+func createFrames(frames int, channels int, value int16) []byte {
+	data := make([]byte, frames*channels*2)
+	for i := 0; i < len(data); i += 2 {
+		binary.LittleEndian.PutUint16(data[i:], uint16(value))
+	}
+	return data
+}
+
+func expectOpened(t *testing.T, opened <-chan sp.AudioFormat, expected sp.AudioFormat) {
+	select {
+	case format := <-opened:
+		if format != expected {
+			t.Fatalf("Stream should be opened for %+v but was for %+v", expected, format)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Stream should be opened for %+v", expected)
+	}
+}
+
+func expectWrite(t *testing.T, writes <-chan []int16) []int16 {
+	select {
+	case out := <-writes:
+		return out
+	case <-time.After(time.Second):
+		t.Fatal("Samples should be written to the stream")
+	}
+	return nil
+}
+
+func TestToSamples(t *testing.T) {
+	samples := toSamples([]byte{0x01, 0x00, 0xff, 0xff, 0x00, 0x80})
+	if len(samples) != 3 || samples[0] != 1 || samples[1] != -1 || samples[2] != -32768 {
+		t.Errorf("Frames should be decoded as little endian int16 but are %v", samples)
+	}
+}
+
+func TestMixerWithoutNextTrack(t *testing.T) {
+	mixer := &mixer{current: []int16{1, 2, 3, 4}}
+
+	if blended := mixer.blend(2); len(blended) != 2 || blended[0] != 1 || blended[1] != 2 {
+		t.Errorf("Samples should be played as they are: %v", blended)
+	}
+	if len(mixer.current) != 2 {
+		t.Errorf("Blended samples should be consumed, %v left", len(mixer.current))
+	}
+}
+
+func TestMixerCrossfade(t *testing.T) {
+	mixer := &mixer{
+		current:     []int16{1000, 1000, 1000, 1000},
+		next:        []int16{2000, 2000, 2000, 2000, 2000, 2000},
+		fadeSamples: 4,
+	}
+
+	blended := mixer.blend(2)
+	if blended[0] != 1000 || blended[1] != 1250 {
+		t.Errorf("Current track should fade into the next one: %v", blended)
+	}
+
+	if faded := mixer.switchToNext(); faded != 2 {
+		t.Errorf("2 samples of the next track should be played but %v were", faded)
+	}
+	expected := []int16{1500, 1750, 2000, 2000}
+	for i, sample := range expected {
+		if mixer.current[i] != sample {
+			t.Fatalf("After switching the rest of the next track should follow the fade: %v", mixer.current)
+		}
+	}
+	if len(mixer.current) != 4 || len(mixer.next) != 0 || mixer.faded != 0 {
+		t.Errorf("Next track should become the current one: %v %v", mixer.current, mixer.next)
+	}
+}
+
+func TestPlayerOpensStreamForFormat(t *testing.T) {
+	pa, opened, writes := startTestPlayer()
+	defer pa.Close()
+	mono := sp.AudioFormat{SampleType: sp.SampleTypeInt16NativeEndian, SampleRate: 22050, Channels: 1}
+
+	pa.WriteAudio(mono, createFrames(framesPerBuffer, 1, 7))
+
+	expectOpened(t, opened, mono)
+	if out := expectWrite(t, writes); len(out) != framesPerBuffer || out[0] != 7 || out[len(out)-1] != 7 {
+		t.Errorf("A full buffer of mono samples should be written but was %v samples", len(out))
+	}
+}
+
+func TestPlayerPlaysPartialBuffers(t *testing.T) {
+	pa, opened, writes := startTestPlayer()
+	defer pa.Close()
+	stereo := sp.AudioFormat{SampleType: sp.SampleTypeInt16NativeEndian, SampleRate: 44100, Channels: 2}
+
+	pa.WriteAudio(stereo, createFrames(100, 2, 7))
+
+	expectOpened(t, opened, stereo)
+	out := expectWrite(t, writes)
+	if len(out) != framesPerBuffer*2 {
+		t.Fatalf("The stream buffer should have %v samples but has %v", framesPerBuffer*2, len(out))
+	}
+	if out[199] != 7 || out[200] != 0 {
+		t.Errorf("The 100 frames should be played followed by silence")
+	}
+}
+
+func TestPlayerReopensStreamOnFormatChange(t *testing.T) {
+	pa, opened, writes := startTestPlayer()
+	defer pa.Close()
+	stereo := sp.AudioFormat{SampleType: sp.SampleTypeInt16NativeEndian, SampleRate: 44100, Channels: 2}
+	mono := sp.AudioFormat{SampleType: sp.SampleTypeInt16NativeEndian, SampleRate: 48000, Channels: 1}
+
+	pa.WriteAudio(stereo, createFrames(100, 2, 7))
+	pa.WriteAudio(mono, createFrames(framesPerBuffer, 1, 9))
+
+	expectOpened(t, opened, stereo)
+	if out := expectWrite(t, writes); out[199] != 7 || out[200] != 0 {
+		t.Errorf("The end of the stereo track should be played before the stream is reopened")
+	}
+	expectOpened(t, opened, mono)
+	if out := expectWrite(t, writes); len(out) != framesPerBuffer || out[0] != 9 {
+		t.Errorf("The mono samples should be played on the reopened stream")
+	}
+}
+
+func TestPlayerKeepsPlayingWithoutStream(t *testing.T) {
+	pa := newPortAudio(&sconsify.Publisher{}, &AudioInitConf{Sink: &AudioSink{}})
+	pa.openStream = func(format sp.AudioFormat, out []int16) (outputStream, error) {
+		return nil, errors.New("format not supported")
+	}
+	go pa.player()
+	defer pa.Close()
+	// 2048 frames at 20480 Hz play for 100ms
+	mono := sp.AudioFormat{SampleType: sp.SampleTypeInt16NativeEndian, SampleRate: 20480, Channels: 1}
+
+	start := time.Now()
+	pa.WriteAudio(mono, createFrames(framesPerBuffer, 1, 7))
+	pa.WriteAudio(mono, createFrames(framesPerBuffer, 1, 7))
+	for pa.Position() < 200*time.Millisecond && time.Since(start) < time.Second {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if position := pa.Position(); position != 200*time.Millisecond {
+		t.Fatalf("The position should move with the frames played silently, 200ms but is %v", position)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("The frames should play in real time but took %v", elapsed)
+	}
+}
+
+func TestPositionOfSeeksNotPlayedYet(t *testing.T) {
+	pa := newPortAudio(&sconsify.Publisher{}, &AudioInitConf{Sink: &AudioSink{}})
+
+	pa.MarkPosition(10*time.Second, time.Minute)
+	pa.MarkPosition(pa.Position()+5*time.Second, time.Minute)
+	if position := pa.Position(); position != 15*time.Second {
+		t.Errorf("Seeks before the marks are played should add up to 15s but are at %v", position)
+	}
+
+	pending := func() int {
+		pa.mutex.Lock()
+		defer pa.mutex.Unlock()
+		return pa.pendingMarks
+	}
+	go pa.player()
+	defer pa.Close()
+	for i := 0; i < 100 && pending() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if position := pa.Position(); position != 15*time.Second {
+		t.Errorf("The marks played should leave the position at 15s but it is %v", position)
+	}
+}
+
+func TestPlayerSavesLoudnessWhenClosed(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "sconsify")
+	defer os.RemoveAll(dir)
+	location := filepath.Join(dir, "normalisation.json")
+
+	pa, opened, writes := startTestPlayer()
+	pa.normaliser = newNormaliser(NormalisationTrack, location)
+	pa.MarkTrack("track", "album")
+	pa.WriteAudio(testFormat, createFrames(5000, 1, 8250))
+	expectOpened(t, opened, testFormat)
+	expectWrite(t, writes)
+	pa.Close()
+
+	normaliser := newNormaliser(NormalisationTrack, location)
+	defer normaliser.close()
+	if stage := normaliser.start("track", "album"); stage.gain != 0.5 {
+		t.Errorf("The loudness of the track playing should be saved when closing, gain 0.5 but is %v", stage.gain)
+	}
+}
+
+func TestWriteAudioDropsUnplayableFormat(t *testing.T) {
+	pa := newPortAudio(&sconsify.Publisher{}, &AudioInitConf{Sink: &AudioSink{}})
+	frames := createFrames(10, 2, 7)
+
+	if n := pa.WriteAudio(sp.AudioFormat{SampleRate: 44100}, frames); n != len(frames) {
+		t.Errorf("Frames without channels should be consumed but %v were", n)
+	}
+	if len(pa.buffer) != 0 {
+		t.Error("Frames without channels should not reach the player")
+	}
+}
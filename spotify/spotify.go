@@ -2,19 +2,18 @@ package spotify
 
 import (
 	"errors"
-	"fmt"
 	"time"
 
 	sp "github.com/fabiofalci/go-libspotify/spotify"
 	"github.com/schaeferpp/sconsify/infrastructure"
 	"github.com/schaeferpp/sconsify/sconsify"
 	"github.com/schaeferpp/sconsify/webapi"
-	"github.com/gordonklaus/portaudio"
 	webspotify "github.com/zmb3/spotify"
 )
 
 type Spotify struct {
 	currentTrack       *sconsify.Track
+	currentDuration    time.Duration
 	paused             bool
 	events             *sconsify.Events
 	publisher          *sconsify.Publisher
@@ -23,6 +22,8 @@ type Spotify struct {
 	appKey             []byte
 	playlistFilter     []string
 	client             *webspotify.Client
+	playlistSync       *webapi.PlaylistSync
+	editJournal        *webapi.EditJournal
 	cacheWebApiContent bool
 }
 
@@ -35,11 +36,12 @@ type SpotifyInitConf struct {
 	SpotifyClientId    string
 	AuthRedirectUrl    string
 	OpenBrowserCommand string
+	Audio              *AudioInitConf
 }
 
 func Initialise(initConf *SpotifyInitConf, username string, pass []byte, events *sconsify.Events, publisher *sconsify.Publisher) {
 	if err := initialiseSpotify(initConf, username, pass, events, publisher); err != nil {
-		fmt.Printf("Error: %v\n", err)
+		infrastructure.Error("Cannot start the spotify backend", "error", err)
 		publisher.ShutdownEngine()
 	}
 }
@@ -48,10 +50,12 @@ func initialiseSpotify(initConf *SpotifyInitConf, username string, pass []byte,
 	spotify := &Spotify{events: events, publisher: publisher}
 	spotify.setPlaylistFilter(initConf.PlaylistFilter)
 	spotify.cacheWebApiContent = initConf.CacheWebApiContent
+	spotify.editJournal = webapi.OpenEditJournal(infrastructure.GetPlaylistEditsFileLocation())
 	if err := spotify.initKey(); err != nil {
 		return err
 	}
-	pa := newPortAudio()
+	pa := newPortAudio(publisher, initConf.Audio)
+	spotify.pa = pa
 
 	cacheLocation, err := spotify.initCache()
 	if err == nil {
@@ -155,46 +159,29 @@ func (spotify *Spotify) finishInitialisation(initConf *SpotifyInitConf, pa *port
 				if privateUser.ID != spotify.session.LoginUsername() {
 					return errors.New("Username doesn't match with web-api authorization")
 				}
+				spotify.playlistSync = webapi.InitPlaylistSync(spotify.client, privateUser.ID)
 			} else {
 				spotify.client = nil
 			}
 		}
 	}
-	// init audio could happen after initPlaylist but this logs to output therefore
+	// init audio could happen after LoadPlaylists but this logs to output therefore
 	// the screen isn't built properly
-	portaudio.Initialize()
+	initConf.Audio.Sink.initialise()
 	go pa.player()
-	defer portaudio.Terminate()
+	defer TerminateAudio(pa, initConf.Audio)
 
-	if err := spotify.initPlaylist(); err != nil {
-		return err
-	}
-
-	spotify.waitForEvents()
-	return nil
+	go spotify.waitForSessionEvents()
+	return sconsify.StartBackend(spotify, spotify.events, spotify.publisher)
 }
 
-func (spotify *Spotify) waitForEvents() {
+func (spotify *Spotify) waitForSessionEvents() {
 	for {
 		select {
 		case <-spotify.session.EndOfTrackUpdates():
 			spotify.publisher.NextPlay()
 		case <-spotify.session.PlayTokenLostUpdates():
 			spotify.publisher.PlayTokenLost()
-		case track := <-spotify.events.PlayUpdates():
-			spotify.play(track)
-		case <-spotify.events.PauseUpdates():
-			spotify.pause()
-		case <-spotify.events.PlayPauseToggleUpdates():
-			spotify.playPauseToggle()
-		case <-spotify.events.ReplayUpdates():
-			spotify.play(spotify.currentTrack)
-		case <-spotify.events.ShutdownSpotifyUpdates():
-			spotify.shutdownSpotify()
-		case query := <-spotify.events.SearchUpdates():
-			spotify.search(query)
-		case artist := <-spotify.events.GetArtistAlbumsUpdates():
-			spotify.artistAlbums(artist)
 		}
 	}
 }
@@ -9,14 +9,13 @@ import (
 	"time"
 )
 
-func (spotify *Spotify) shutdownSpotify() {
+func (spotify *Spotify) Shutdown() {
 	spotify.session.Logout()
 	spotify.session.Close()
 	spotify.initCache()
-	spotify.publisher.ShutdownEngine()
 }
 
-func (spotify *Spotify) play(trackUri *sconsify.Track) {
+func (spotify *Spotify) Play(trackUri *sconsify.Track) {
 
 	player := spotify.session.Player()
 	if !spotify.paused || spotify.currentTrack != trackUri {
@@ -51,6 +50,9 @@ func (spotify *Spotify) play(trackUri *sconsify.Track) {
 		if err := player.Load(track); err != nil {
 			return
 		}
+		spotify.currentDuration = track.Duration()
+		spotify.pa.MarkTrack(trackUri.URI, track.Album().Link().String())
+		spotify.pa.MarkPosition(0, track.Duration())
 		spotify.publisher.NewTrackLoaded(track.Duration())
 	}
 	player.Play()
@@ -61,11 +63,55 @@ func (spotify *Spotify) play(trackUri *sconsify.Track) {
 	return
 }
 
+func (spotify *Spotify) Replay() {
+	if spotify.currentTrack != nil {
+		spotify.Play(spotify.currentTrack)
+	}
+}
+
+func (spotify *Spotify) Seek(offset time.Duration) {
+	if spotify.currentTrack == nil {
+		return
+	}
+	position := spotify.pa.Position() + offset
+	if position < 0 {
+		position = 0
+	} else if position > spotify.currentDuration {
+		position = spotify.currentDuration
+	}
+	spotify.pa.MarkPosition(position, spotify.currentDuration)
+	spotify.session.Player().Seek(position)
+}
+
+// Prefetch asks libspotify to download the track ahead, so loading it when the
+// current one ends doesn't leave a gap.
+func (spotify *Spotify) Prefetch(trackUri *sconsify.Track) {
+	link, err := spotify.session.ParseLink(trackUri.URI)
+	if err != nil {
+		return
+	}
+	track, err := link.Track()
+	if err != nil || !spotify.isTrackAvailable(track) {
+		return
+	}
+	if err := spotify.session.Player().Prefetch(track); err != nil {
+		infrastructure.Warn("Cannot prefetch", "track", trackUri.URI, "error", err)
+	}
+}
+
+func (spotify *Spotify) SetVolume(volume sconsify.Volume) {
+	spotify.pa.SetVolume(volume)
+}
+
+func (spotify *Spotify) SetEqualizer(equalizer sconsify.Equalizer) {
+	spotify.pa.SetEqualizer(equalizer)
+}
+
 func (spotify *Spotify) isTrackAvailable(track *sp.Track) bool {
 	return track.Availability() == sp.TrackAvailabilityAvailable
 }
 
-func (spotify *Spotify) search(query string) {
+func (spotify *Spotify) Search(query string) {
 	playlists := sconsify.InitPlaylists()
 
 	query = checkAlias(query)
@@ -80,11 +126,13 @@ func (spotify *Spotify) search(query string) {
 			for _, track := range searchResult.Tracks.Tracks {
 				webArtist := track.Artists[0]
 				artist := sconsify.InitArtist(string(webArtist.URI), webArtist.Name)
-				playlist.AddTrack(sconsify.InitWebApiTrack(string(track.URI), artist, track.Name, track.TimeDuration().String()))
+				sconsifyTrack := sconsify.InitWebApiTrack(string(track.URI), artist, track.Name, track.TimeDuration().String())
+				sconsifyTrack.Album = toAlbum(track.Album, artist)
+				playlist.AddTrack(sconsifyTrack)
 				infrastructure.Debugf("\tTrack '%v' (%v)", track.URI, track.Name)
 			}
 		} else {
-			infrastructure.Debugf("Spotify search returning error: %v", err)
+			infrastructure.Warn("Spotify search failed", "query", query, "error", err)
 		}
 	})
 	playlist.ExecuteLoad()
@@ -104,17 +152,17 @@ func checkAlias(query string) string {
 	return query
 }
 
-func (spotify *Spotify) playPauseToggle() {
+func (spotify *Spotify) PlayPauseToggle() {
 	if spotify.currentTrack != nil {
 		if spotify.paused {
-			spotify.play(spotify.currentTrack)
+			spotify.Play(spotify.currentTrack)
 		} else {
 			spotify.pauseCurrentTrack()
 		}
 	}
 }
 
-func (spotify *Spotify) pause() {
+func (spotify *Spotify) Pause() {
 	if spotify.currentTrack != nil && !spotify.paused {
 		spotify.pauseCurrentTrack()
 	}
@@ -127,7 +175,7 @@ func (spotify *Spotify) pauseCurrentTrack() {
 	spotify.paused = true
 }
 
-func (spotify *Spotify) artistAlbums(artist *sconsify.Artist) {
+func (spotify *Spotify) ArtistAlbums(artist *sconsify.Artist) {
 	if simpleAlbumPage, err := spotify.client.GetArtistAlbums(webspotify.ID(artist.GetSpotifyID())); err == nil {
 		folder := sconsify.InitFolder(artist.URI, "*"+artist.Name, make([]*sconsify.Playlist, 0))
 
@@ -135,6 +183,7 @@ func (spotify *Spotify) artistAlbums(artist *sconsify.Artist) {
 			tracks := make([]*sconsify.Track, len(fullTracks))
 			for i, track := range fullTracks {
 				tracks[i] = sconsify.InitWebApiTrack(string(track.URI), artist, track.Name, track.TimeDuration().String())
+				tracks[i].Album = toAlbum(track.Album, artist)
 			}
 
 			folder.AddPlaylist(sconsify.InitPlaylist(artist.URI, " "+artist.Name+" Top Tracks", tracks))
@@ -143,12 +192,15 @@ func (spotify *Spotify) artistAlbums(artist *sconsify.Artist) {
 		infrastructure.Debugf("# of albums %v", len(simpleAlbumPage.Albums))
 		for _, simpleAlbum := range simpleAlbumPage.Albums {
 			infrastructure.Debugf("AlbumsID %v = %v", simpleAlbum.URI, simpleAlbum.Name)
+			album := toAlbum(simpleAlbum, artist)
 			playlist := sconsify.InitOnDemandPlaylist(string(simpleAlbum.URI), " "+simpleAlbum.Name, true, func(playlist *sconsify.Playlist) {
 				infrastructure.Debugf("Album id %v", playlist.ToSpotifyID())
 				if simpleTrackPage, err := spotify.client.GetAlbumTracks(webspotify.ID(playlist.ToSpotifyID())); err == nil {
 					infrastructure.Debugf("# of tracks %v", len(simpleTrackPage.Tracks))
 					for _, track := range simpleTrackPage.Tracks {
-						playlist.AddTrack(sconsify.InitWebApiTrack(string(track.URI), artist, track.Name, track.TimeDuration().String()))
+						sconsifyTrack := sconsify.InitWebApiTrack(string(track.URI), artist, track.Name, track.TimeDuration().String())
+						sconsifyTrack.Album = album
+						playlist.AddTrack(sconsifyTrack)
 					}
 				}
 			})
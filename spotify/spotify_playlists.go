@@ -4,15 +4,21 @@ import (
 	"errors"
 	"strings"
 
-	"fmt"
 	sp "github.com/fabiofalci/go-libspotify/spotify"
 	"github.com/schaeferpp/sconsify/infrastructure"
 	"github.com/schaeferpp/sconsify/sconsify"
+	"github.com/schaeferpp/sconsify/webapi"
 	webspotify "github.com/zmb3/spotify"
 	"strconv"
 )
 
-func (spotify *Spotify) initPlaylist() error {
+func (spotify *Spotify) LoadPlaylists() error {
+	// the edits made offline are saved first so the playlists loaded have them
+	var replay *sconsify.PlaylistEditsReplay
+	if spotify.playlistSync != nil && spotify.editJournal.Pending() {
+		replay = spotify.playlistSync.Replay(spotify.editJournal)
+	}
+
 	playlists := sconsify.InitPlaylists()
 
 	if spotify.client != nil {
@@ -64,9 +70,35 @@ func (spotify *Spotify) initPlaylist() error {
 	}
 
 	spotify.publisher.NewPlaylist(playlists)
+	if replay != nil && len(replay.Applied)+len(replay.Skipped) > 0 {
+		spotify.publisher.PlaylistEditsReplayed(replay)
+	}
 	return nil
 }
 
+// EditPlaylist saves the edit to Spotify through the web api. The playlists not
+// from Spotify, e.g. the search results, are only edited in sconsify. Without the
+// web api, or when Spotify cannot be reached, the edit is journaled and saved
+// once the web api is authorised again, the next edits waiting behind it.
+func (spotify *Spotify) EditPlaylist(edit *sconsify.PlaylistEdit) error {
+	if edit.Kind != sconsify.CreatePlaylist && !webapi.IsPlaylistURI(edit.Playlist) && !spotify.editJournal.Creates(edit.Playlist) {
+		return nil
+	}
+	if spotify.playlistSync == nil {
+		// the journal is only replayed with the web-api
+		return errors.New("Playlists are only saved to Spotify with the web-api")
+	}
+	if spotify.editJournal.Pending() {
+		return spotify.editJournal.Record(edit)
+	}
+	err := spotify.playlistSync.Apply(edit)
+	if webapi.IsUnreachable(err) {
+		infrastructure.Info("Spotify cannot be reached, journaling the playlist edit", "edit", edit.String(), "error", err)
+		return spotify.editJournal.Record(edit)
+	}
+	return err
+}
+
 func (spotify *Spotify) initWebApiPlaylist(playlists *sconsify.Playlists) error {
 	if privateUser, err := spotify.client.CurrentUser(); err == nil {
 		offset := 0
@@ -74,9 +106,9 @@ func (spotify *Spotify) initWebApiPlaylist(playlists *sconsify.Playlists) error
 		for offset <= total {
 			offset, total = spotify.loadPlaylists(offset, privateUser, playlists)
 			if offset > total {
-				fmt.Printf("Loaded %v from %v playlists\n", total, total)
+				infrastructure.Info("Loaded playlists", "loaded", total, "total", total)
 			} else {
-				fmt.Printf("Loaded %v from %v playlists\n", offset, total)
+				infrastructure.Info("Loaded playlists", "loaded", offset, "total", total)
 			}
 			if total == 0 {
 				return errors.New("No playlist to load")
@@ -90,7 +122,7 @@ func (spotify *Spotify) initWebApiPlaylist(playlists *sconsify.Playlists) error
 }
 
 func (spotify *Spotify) initLibspotifyPlaylist(playlists *sconsify.Playlists) error {
-	fmt.Print("Warning: not using -web-api flag. Sconsify will load playlists using deprecated libspotify API. If not working try -web-api flag.\n")
+	infrastructure.Warn("Not using -web-api flag. Sconsify will load playlists using deprecated libspotify API. If not working try -web-api flag.")
 	allPlaylists, err := spotify.session.Playlists()
 	if err != nil {
 		return err
@@ -176,10 +208,11 @@ func (spotify *Spotify) loadPlaylistTracks(webPlaylist *webspotify.SimplePlaylis
 			if len(track.Track.Artists) > 0 {
 				webArtist := track.Track.Artists[0]
 				artist := sconsify.InitArtist(string(webArtist.URI), webArtist.Name)
-				track := sconsify.InitWebApiTrack(string(track.Track.URI), artist, track.Track.Name, track.Track.TimeDuration().String())
-				playlist.AddTrack(track)
+				sconsifyTrack := sconsify.InitWebApiTrack(string(track.Track.URI), artist, track.Track.Name, track.Track.TimeDuration().String())
+				sconsifyTrack.Album = toAlbum(track.Track.Album, artist)
+				playlist.AddTrack(sconsifyTrack)
 			} else {
-				infrastructure.Debugf("%v: track will be ignored as it doesn't have artist\n", track.Track.URI)
+				infrastructure.Debug("Ignoring track without artist", "track", track.Track.URI, "playlist", playlist.Name())
 			}
 		}
 
@@ -187,9 +220,9 @@ func (spotify *Spotify) loadPlaylistTracks(webPlaylist *webspotify.SimplePlaylis
 		total = playlistTrackPage.Total
 
 		if offset > total {
-			infrastructure.Debugf("%v: loaded %v from %v tracks\n", playlist.Name(), total, total)
+			infrastructure.Debug("Loaded playlist tracks", "playlist", playlist.Name(), "loaded", total, "total", total)
 		} else {
-			infrastructure.Debugf("%v: loaded %v from %v tracks\n", playlist.Name(), offset, total)
+			infrastructure.Debug("Loaded playlist tracks", "playlist", playlist.Name(), "loaded", offset, "total", total)
 		}
 	}
 
@@ -213,10 +246,15 @@ func (spotify *Spotify) loadAlbums(playlist *sconsify.Playlist, webApiCache *Web
 	if webApiCache.Albums != nil {
 		for _, album := range webApiCache.Albums {
 			tracks := make([]*sconsify.Track, len(album.Tracks.Tracks))
+			var sconsifyAlbum *sconsify.Album
 			for j, track := range album.Tracks.Tracks {
 				webArtist := track.Artists[0]
 				artist := sconsify.InitArtist(string(webArtist.URI), webArtist.Name)
+				if sconsifyAlbum == nil {
+					sconsifyAlbum = toAlbum(album.SimpleAlbum, artist)
+				}
 				tracks[j] = sconsify.InitWebApiTrack(string(track.URI), artist, track.Name, track.TimeDuration().String())
+				tracks[j].Album = sconsifyAlbum
 			}
 			playlist.AddPlaylist(sconsify.InitSubPlaylist(string(album.URI), album.Name, tracks))
 		}
@@ -245,7 +283,9 @@ func (spotify *Spotify) loadSongs(playlist *sconsify.Playlist, webApiCache *WebA
 			webApiCache.Songs[i] = track
 			webArtist := track.Artists[0]
 			artist := sconsify.InitArtist(string(webArtist.URI), webArtist.Name)
-			playlist.AddTrack(sconsify.InitWebApiTrack(string(track.URI), artist, track.Name, track.TimeDuration().String()))
+			sconsifyTrack := sconsify.InitWebApiTrack(string(track.URI), artist, track.Name, track.TimeDuration().String())
+			sconsifyTrack.Album = toAlbum(track.Album, artist)
+			playlist.AddTrack(sconsifyTrack)
 		}
 	}
 }
@@ -269,6 +309,7 @@ func (spotify *Spotify) loadNewReleases(playlist *sconsify.Playlist, webApiCache
 				webArtist := track.Track.Artists[0]
 				artist := sconsify.InitArtist(string(webArtist.URI), webArtist.Name)
 				tracks[i] = sconsify.InitWebApiTrack(string(track.Track.URI), artist, track.Track.Name, track.Track.TimeDuration().String())
+				tracks[i].Album = toAlbum(track.Track.Album, artist)
 			}
 			playlist.AddPlaylist(sconsify.InitSubPlaylist(string(fullPlaylist.URI), fullPlaylist.Name, tracks))
 		}
@@ -276,6 +317,15 @@ func (spotify *Spotify) loadNewReleases(playlist *sconsify.Playlist, webApiCache
 	}
 }
 
+// toAlbum returns the album of a track loaded through the web api, nil when the
+// web api did not give it.
+func toAlbum(webAlbum webspotify.SimpleAlbum, artist *sconsify.Artist) *sconsify.Album {
+	if webAlbum.URI == "" {
+		return nil
+	}
+	return sconsify.InitAlbum(string(webAlbum.URI), webAlbum.Name, artist)
+}
+
 func createWebSpotifyOptions(limit int, offset int) *webspotify.Options {
 	return &webspotify.Options{Limit: &limit, Offset: &offset}
 }
@@ -286,6 +336,9 @@ func (spotify *Spotify) initTrack(playlistTrack *sp.PlaylistTrack) *sconsify.Tra
 	for i := 0; i < track.Artists(); i++ {
 		track.Artist(i).Wait()
 	}
+	if album := track.Album(); album != nil {
+		album.Wait()
+	}
 	infrastructure.Debugf("\tTrack '%v' (%v)", track.Link().String(), track.Name())
 	return sconsify.ToSconsifyTrack(track)
 }
@@ -31,20 +31,21 @@ func main() {
 	flag.Parse()
 
 	fmt.Println("Sconsify - your awesome Spotify music service in a text-mode interface.")
-	events := sconsify.InitialiseEvents()
 	publisher := &sconsify.Publisher{}
+	backendEvents := publisher.Subscribe(sconsify.Subscription{Topics: sconsify.BackendTopics})
+	uiEvents := publisher.Subscribe(sconsify.Subscription{Topics: sconsify.UserInterfaceTopics})
 
-	infrastructure.InitialiseLogger()
+	infrastructure.InitialiseLogger("debug", infrastructure.LogFormatText)
 	defer infrastructure.CloseLogger()
 
-	go mock.Initialise(events, publisher)
+	go mock.Initialise(backendEvents, publisher)
 
 	if *runTest {
 		go runTests()
 	}
 
-	ui := simple.InitialiseConsoleUserInterface(events, publisher, false)
-	sconsify.StartMainLoop(events, publisher, ui, false)
+	ui := simple.InitialiseConsoleUserInterface(uiEvents, publisher, false, nil)
+	sconsify.StartMainLoop(uiEvents, publisher, ui, false)
 	println(output.String())
 	sleep() // otherwise gocui eventually fails to quit properly
 }
@@ -73,6 +73,19 @@ func (noui *NoUi) GetNextToPlay() *sconsify.Track {
 	return nil
 }
 
+func (noui *NoUi) PeekNextToPlay() *sconsify.Track {
+	if noui.playlists != nil {
+		if track, repeating := noui.playlists.PeekNext(); !repeating || noui.repeatOn {
+			return track
+		}
+	}
+	return nil
+}
+
+func (noui *NoUi) PlayingPlaylist(track *sconsify.Track) string {
+	return noui.playlists.PlaylistNameOf(track.URI)
+}
+
 func (noui *NoUi) NewPlaylists(playlists sconsify.Playlists) error {
 	if playlists.Tracks() == 0 {
 		noui.output.Print("No track selected\n")
@@ -124,6 +137,12 @@ func (noui *NoUi) listenForKeyboardEvents() {
 		} else if key == "p" {
 			fmt.Println("")
 			noui.publisher.PlayPauseToggle()
+		} else if key == "+" {
+			noui.publisher.VolumeUp()
+		} else if key == "-" {
+			noui.publisher.VolumeDown()
+		} else if key == "m" {
+			noui.publisher.ToggleMute()
 		} else if key == "q" {
 			noui.Shutdown()
 		}
@@ -134,6 +153,33 @@ func (noui *NoUi) NewTrackLoaded(duration time.Duration) {
 
 }
 
+func (noui *NoUi) PlaybackPosition(position sconsify.Position) {
+}
+
+func (noui *NoUi) VolumeChanged(volume sconsify.Volume) {
+}
+
+func (noui *NoUi) EqualizerChanged(equalizer sconsify.Equalizer) {
+}
+
+func (noui *NoUi) Control(request *sconsify.ControlRequest) {
+	request.Run(noui.playlists, nil)
+}
+
+func (noui *NoUi) PlaylistEdited(edit *sconsify.PlaylistEdit) {
+	edit.Finish()
+}
+
+func (noui *NoUi) PlaylistEditsReplayed(replay *sconsify.PlaylistEditsReplay) {
+	noui.output.Print(replay.Summary() + "\n")
+	for _, edit := range replay.Skipped {
+		noui.output.Print(fmt.Sprintf("Skipped %v: %v\n", edit, edit.Err))
+	}
+}
+
+func (noui *NoUi) PlayRecorded(play *sconsify.Play) {
+}
+
 func (p *SilentPrinter) Print(message string) {
 }
 
@@ -20,15 +20,15 @@ func (p *TestPrinter) Print(message string) {
 func TestNoUiEmptyPlaylists(t *testing.T) {
 	repeatOn := true
 	shuffle := true
-	events := sconsify.InitialiseEvents()
+	publisher, events, _ := subscribe()
 
 	go func() {
 		playlists := sconsify.InitPlaylists()
-		events.NewPlaylist(playlists)
+		publisher.NewPlaylist(playlists)
 	}()
 
-	ui := InitialiseNoUserInterface(events, nil, &repeatOn, &shuffle)
-	err := sconsify.StartMainLoop(events, ui, true)
+	ui := InitialiseNoUserInterface(events, publisher, nil, &repeatOn, &shuffle)
+	err := sconsify.StartMainLoop(events, publisher, ui, true)
 	if err == nil {
 		t.Errorf("No track selected should return an error")
 	}
@@ -37,47 +37,47 @@ func TestNoUiEmptyPlaylists(t *testing.T) {
 func TestNoUiSequentialAndRepeating(t *testing.T) {
 	repeatOn := true
 	shuffle := false
-	events := sconsify.InitialiseEvents()
+	publisher, events, backend := subscribe()
 	output := &TestPrinter{message: make(chan string)}
-	ui := InitialiseNoUserInterface(events, output, &repeatOn, &shuffle)
+	ui := InitialiseNoUserInterface(events, publisher, output, &repeatOn, &shuffle)
 
 	finished := make(chan bool)
 	go func() {
-		err := sconsify.StartMainLoop(events, ui, true)
+		err := sconsify.StartMainLoop(events, publisher, ui, true)
 		finished <- err == nil
 	}()
 
-	sendNewPlaylist(events)
+	sendNewPlaylist(publisher)
 
-	assertPrintFourTracks(t, events, output)
+	assertPrintFourTracks(t, publisher, backend, output)
 
-	assertFirstTrack(t, events, output)
-	assertNextThreeTracks(t, events, output)
-	assertRepeatingAllFourTracks(t, events, output)
+	assertFirstTrack(t, publisher, backend, output)
+	assertNextThreeTracks(t, publisher, backend, output)
+	assertRepeatingAllFourTracks(t, publisher, backend, output)
 
-	assertShutdown(t, ui, events, finished)
+	assertShutdown(t, ui, publisher, backend, finished)
 }
 
 func TestNoUiSequentialAndNotRepeating(t *testing.T) {
 	repeatOn := false
 	shuffle := false
-	events := sconsify.InitialiseEvents()
+	publisher, events, backend := subscribe()
 	output := &TestPrinter{message: make(chan string)}
-	ui := InitialiseNoUserInterface(events, output, &repeatOn, &shuffle)
+	ui := InitialiseNoUserInterface(events, publisher, output, &repeatOn, &shuffle)
 
 	finished := make(chan bool)
 	go func() {
-		sconsify.StartMainLoop(events, ui, true)
+		sconsify.StartMainLoop(events, publisher, ui, true)
 		finished <- true
 	}()
 
-	sendNewPlaylist(events)
+	sendNewPlaylist(publisher)
 
-	assertPrintFourTracks(t, events, output)
+	assertPrintFourTracks(t, publisher, backend, output)
 
-	assertFirstTrack(t, events, output)
-	assertNextThreeTracks(t, events, output)
-	assertNoNextTrack(events, finished)
+	assertFirstTrack(t, publisher, backend, output)
+	assertNextThreeTracks(t, publisher, backend, output)
+	assertNoNextTrack(publisher, backend, finished)
 }
 
 func TestNoUiShuffleAndRepeating(t *testing.T) {
@@ -85,25 +85,25 @@ func TestNoUiShuffleAndRepeating(t *testing.T) {
 
 	repeatOn := true
 	shuffle := true
-	events := sconsify.InitialiseEvents()
+	publisher, events, backend := subscribe()
 	output := &TestPrinter{message: make(chan string)}
-	ui := InitialiseNoUserInterface(events, output, &repeatOn, &shuffle)
+	ui := InitialiseNoUserInterface(events, publisher, output, &repeatOn, &shuffle)
 
 	finished := make(chan bool)
 	go func() {
-		err := sconsify.StartMainLoop(events, ui, true)
+		err := sconsify.StartMainLoop(events, publisher, ui, true)
 		finished <- err == nil
 	}()
 
-	sendNewPlaylist(events)
+	sendNewPlaylist(publisher)
 
-	assertPrintFourTracks(t, events, output)
+	assertPrintFourTracks(t, publisher, backend, output)
 
-	assertShuffleFirstTrack(t, events, output)
-	assertShuffleNextThreeTracks(t, events, output)
-	assertShuffleRepeatingAllFourTracks(t, events, output)
+	assertShuffleFirstTrack(t, publisher, backend, output)
+	assertShuffleNextThreeTracks(t, publisher, backend, output)
+	assertShuffleRepeatingAllFourTracks(t, publisher, backend, output)
 
-	assertShutdown(t, ui, events, finished)
+	assertShutdown(t, ui, publisher, backend, finished)
 }
 
 func TestNoUiShuffleAndNotRepeating(t *testing.T) {
@@ -111,98 +111,107 @@ func TestNoUiShuffleAndNotRepeating(t *testing.T) {
 
 	repeatOn := false
 	shuffle := true
-	events := sconsify.InitialiseEvents()
+	publisher, events, backend := subscribe()
 	output := &TestPrinter{message: make(chan string)}
-	ui := InitialiseNoUserInterface(events, output, &repeatOn, &shuffle)
+	ui := InitialiseNoUserInterface(events, publisher, output, &repeatOn, &shuffle)
 
 	finished := make(chan bool)
 	go func() {
-		sconsify.StartMainLoop(events, ui, true)
+		sconsify.StartMainLoop(events, publisher, ui, true)
 		finished <- true
 	}()
 
-	sendNewPlaylist(events)
+	sendNewPlaylist(publisher)
 
-	assertPrintFourTracks(t, events, output)
+	assertPrintFourTracks(t, publisher, backend, output)
 
-	assertShuffleFirstTrack(t, events, output)
-	assertShuffleNextThreeTracks(t, events, output)
-	assertNoNextTrack(events, finished)
+	assertShuffleFirstTrack(t, publisher, backend, output)
+	assertShuffleNextThreeTracks(t, publisher, backend, output)
+	assertNoNextTrack(publisher, backend, finished)
 }
 
-func sendNewPlaylist(events *sconsify.Events) {
+// subscribe returns the publisher with the updates of the user interface and the
+// requests to the backend, played by the tests.
+func subscribe() (*sconsify.Publisher, *sconsify.Events, *sconsify.Events) {
+	publisher := &sconsify.Publisher{}
+	events := publisher.Subscribe(sconsify.Subscription{Topics: sconsify.UserInterfaceTopics})
+	backend := publisher.Subscribe(sconsify.Subscription{Topics: sconsify.BackendTopics})
+	return publisher, events, backend
+}
+
+func sendNewPlaylist(publisher *sconsify.Publisher) {
 	playlists := sconsify.InitPlaylists()
 	playlists.AddPlaylist(createDummyPlaylist())
-	events.NewPlaylist(playlists)
+	publisher.NewPlaylist(playlists)
 }
 
-func assertShutdown(t *testing.T, ui sconsify.UserInterface, events *sconsify.Events, finished chan bool) {
+func assertShutdown(t *testing.T, ui sconsify.UserInterface, publisher *sconsify.Publisher, backend *sconsify.Events, finished chan bool) {
 	go ui.Shutdown()
 
 	// playing spotify shutdown here
-	<-events.ShutdownSpotifyUpdates()
-	events.ShutdownEngine()
+	<-backend.ShutdownSpotifyUpdates()
+	publisher.ShutdownEngine()
 
 	if !<-finished {
 		t.Errorf("Not properly finished")
 	}
 }
 
-func assertPrintFourTracks(t *testing.T, events *sconsify.Events, output *TestPrinter) {
+func assertPrintFourTracks(t *testing.T, publisher *sconsify.Publisher, backend *sconsify.Events, output *TestPrinter) {
 	message := <-output.message
 	if message != "4 track(s)" {
 		t.Errorf("Should be playing 4 tracks")
 	}
 }
 
-func assertNoNextTrack(events *sconsify.Events, finished chan bool) {
-	events.NextPlay()
+func assertNoNextTrack(publisher *sconsify.Publisher, backend *sconsify.Events, finished chan bool) {
+	publisher.NextPlay()
 
 	// playing spotify shutdown here
-	<-events.ShutdownSpotifyUpdates()
-	events.ShutdownEngine()
+	<-backend.ShutdownSpotifyUpdates()
+	publisher.ShutdownEngine()
 
 	<-finished
 }
 
-func assertFirstTrack(t *testing.T, events *sconsify.Events, output *TestPrinter) {
-	events.TrackPlaying(<-events.PlayUpdates())
+func assertFirstTrack(t *testing.T, publisher *sconsify.Publisher, backend *sconsify.Events, output *TestPrinter) {
+	publisher.TrackPlaying(<-backend.PlayUpdates())
 	message := <-output.message
-	if message != "Playing: artist0 - name0 [duration0]" {
+	if message != "Playing: name0 - artist0 [duration0]" {
 		t.Errorf("Should be showing track0 instead is showing [%v]", message)
 	}
 }
 
-func assertShuffleFirstTrack(t *testing.T, events *sconsify.Events, output *TestPrinter) {
-	events.TrackPlaying(<-events.PlayUpdates())
+func assertShuffleFirstTrack(t *testing.T, publisher *sconsify.Publisher, backend *sconsify.Events, output *TestPrinter) {
+	publisher.TrackPlaying(<-backend.PlayUpdates())
 	message := <-output.message
-	if message != "Playing: artist3 - name3 [duration3]" {
+	if message != "Playing: name3 - artist3 [duration3]" {
 		t.Errorf("Should be showing track3 instead is showing [%v]", message)
 	}
 }
 
-func assertNextThreeTracks(t *testing.T, events *sconsify.Events, output *TestPrinter) {
-	playNext(t, events, output, []string{"1", "2", "3"})
+func assertNextThreeTracks(t *testing.T, publisher *sconsify.Publisher, backend *sconsify.Events, output *TestPrinter) {
+	playNext(t, publisher, backend, output, []string{"1", "2", "3"})
 }
 
-func assertShuffleNextThreeTracks(t *testing.T, events *sconsify.Events, output *TestPrinter) {
-	playNext(t, events, output, []string{"0", "2", "1"})
+func assertShuffleNextThreeTracks(t *testing.T, publisher *sconsify.Publisher, backend *sconsify.Events, output *TestPrinter) {
+	playNext(t, publisher, backend, output, []string{"0", "2", "1"})
 }
 
-func assertRepeatingAllFourTracks(t *testing.T, events *sconsify.Events, output *TestPrinter) {
-	playNext(t, events, output, []string{"0", "1", "2", "3"})
+func assertRepeatingAllFourTracks(t *testing.T, publisher *sconsify.Publisher, backend *sconsify.Events, output *TestPrinter) {
+	playNext(t, publisher, backend, output, []string{"0", "1", "2", "3"})
 }
 
-func assertShuffleRepeatingAllFourTracks(t *testing.T, events *sconsify.Events, output *TestPrinter) {
-	playNext(t, events, output, []string{"3", "0", "2", "1"})
+func assertShuffleRepeatingAllFourTracks(t *testing.T, publisher *sconsify.Publisher, backend *sconsify.Events, output *TestPrinter) {
+	playNext(t, publisher, backend, output, []string{"3", "0", "2", "1"})
 }
 
-func playNext(t *testing.T, events *sconsify.Events, output *TestPrinter, tracks []string) {
+func playNext(t *testing.T, publisher *sconsify.Publisher, backend *sconsify.Events, output *TestPrinter, tracks []string) {
 	for _, track := range tracks {
-		events.NextPlay()
-		events.TrackPlaying(<-events.PlayUpdates())
+		publisher.NextPlay()
+		publisher.TrackPlaying(<-backend.PlayUpdates())
 		message := <-output.message
-		expectedMessage := fmt.Sprintf("Playing: artist%v - name%v [duration%v]", track, track, track)
+		expectedMessage := fmt.Sprintf("Playing: name%v - artist%v [duration%v]", track, track, track)
 		if message != expectedMessage {
 			t.Errorf("Should be showing track%v instead is showing [%v]", track, message)
 		}
@@ -211,9 +220,9 @@ func playNext(t *testing.T, events *sconsify.Events, output *TestPrinter, tracks
 
 func createDummyPlaylist() *sconsify.Playlist {
 	tracks := make([]*sconsify.Track, 4)
-	tracks[0] = sconsify.InitTrack("0", "artist0", "name0", "duration0")
-	tracks[1] = sconsify.InitTrack("1", "artist1", "name1", "duration1")
-	tracks[2] = sconsify.InitTrack("2", "artist2", "name2", "duration2")
-	tracks[3] = sconsify.InitTrack("3", "artist3", "name3", "duration3")
+	tracks[0] = sconsify.InitTrack("0", sconsify.InitArtist("artist0", "artist0"), "name0", "duration0")
+	tracks[1] = sconsify.InitTrack("1", sconsify.InitArtist("artist1", "artist1"), "name1", "duration1")
+	tracks[2] = sconsify.InitTrack("2", sconsify.InitArtist("artist2", "artist2"), "name2", "duration2")
+	tracks[3] = sconsify.InitTrack("3", sconsify.InitArtist("artist3", "artist3"), "name3", "duration3")
 	return sconsify.InitPlaylist("0", "test", tracks)
 }
@@ -6,6 +6,8 @@ import (
 
 type Queue struct {
 	queue []*sconsify.Track
+	// changed is called after every change of the queue, when set
+	changed func()
 }
 
 const QUEUE_MAX_ELEMENTS = 100
@@ -14,12 +16,24 @@ func InitQueue() *Queue {
 	return &Queue{queue: make([]*sconsify.Track, 0, 0)}
 }
 
+// OnChange sets what is called after every change of the queue.
+func (queue *Queue) OnChange(changed func()) {
+	queue.changed = changed
+}
+
+func (queue *Queue) notifyChange() {
+	if queue.changed != nil {
+		queue.changed()
+	}
+}
+
 func (queue *Queue) Add(track *sconsify.Track) *sconsify.Track {
 	n := len(queue.queue)
 	if n >= QUEUE_MAX_ELEMENTS {
 		return nil
 	}
 	queue.queue = append(queue.queue, track)
+	queue.notifyChange()
 
 	return queue.queue[n]
 }
@@ -34,25 +48,64 @@ func (queue *Queue) Insert(track *sconsify.Track) *sconsify.Track {
 
 	copy(queue.queue[1:], queue.queue)
 	queue.queue[0] = track
+	queue.notifyChange()
 
 	return queue.queue[0]
 }
 
+// InsertAt inserts the track at the index, moving the following tracks down. It
+// returns nil when the queue is full.
+func (queue *Queue) InsertAt(index int, track *sconsify.Track) *sconsify.Track {
+	n := len(queue.queue)
+	if n >= QUEUE_MAX_ELEMENTS {
+		return nil
+	}
+	if index < 0 || index > n {
+		index = n
+	}
+	queue.queue = append(queue.queue, nil)
+	copy(queue.queue[index+1:], queue.queue[index:])
+	queue.queue[index] = track
+	queue.notifyChange()
+
+	return queue.queue[index]
+}
+
+// Move moves count tracks from the index from so the first ends up at the index
+// to, returning false when they would not be in the queue.
+func (queue *Queue) Move(from int, count int, to int) bool {
+	if !sconsify.MoveTracksOf(queue.queue, from, count, to) {
+		return false
+	}
+	queue.notifyChange()
+	return true
+}
+
 func (queue *Queue) Pop() *sconsify.Track {
 	if len(queue.queue) == 0 {
 		return nil
 	}
 	track := queue.queue[0]
 	queue.queue = queue.queue[1:len(queue.queue)]
+	queue.notifyChange()
 	return track
 }
 
+// Peek returns the track Pop would return without removing it.
+func (queue *Queue) Peek() *sconsify.Track {
+	if len(queue.queue) == 0 {
+		return nil
+	}
+	return queue.queue[0]
+}
+
 func (queue *Queue) RemoveAll() {
 	if len(queue.queue) == 0 {
 		return
 	}
 
 	queue.queue = make([]*sconsify.Track, 0, 0)
+	queue.notifyChange()
 }
 
 func (queue *Queue) Remove(index int) *sconsify.Track {
@@ -61,6 +114,7 @@ func (queue *Queue) Remove(index int) *sconsify.Track {
 	}
 	track := queue.queue[index]
 	queue.queue = append(queue.queue[:index], queue.queue[index+1:]...)
+	queue.notifyChange()
 	return track
 }
 
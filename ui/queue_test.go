@@ -21,7 +21,7 @@ func TestQueueAddPopEmptyAndContents(t *testing.T) {
 	queue.Add(track0)
 	queue.Add(track1)
 
-	if queue.isEmpty() {
+	if queue.IsEmpty() {
 		t.Error("Queue is not adding elements")
 	}
 
@@ -134,20 +134,20 @@ func TestQueueRemoveAll(t *testing.T) {
 	track1 := &sconsify.Track{}
 	queue.Add(track1)
 
-	if queue.isEmpty() {
+	if queue.IsEmpty() {
 		t.Error("Queue is not empty")
 	}
 
 	queue.RemoveAll()
 
-	if !queue.isEmpty() {
+	if !queue.IsEmpty() {
 		t.Error("Queue is empty")
 	}
 }
 
 func TestQueueEmpty(t *testing.T) {
 	queue := InitQueue()
-	if !queue.isEmpty() {
+	if !queue.IsEmpty() {
 		t.Error("Queue should be empty after init")
 	}
 
@@ -231,3 +231,127 @@ func TestQueueAddAndPopToLimit(t *testing.T) {
 		t.Error("Queue reached its limit, it should not add anymore")
 	}
 }
+
+func TestQueuePeek(t *testing.T) {
+	queue := InitQueue()
+	if queue.Peek() != nil {
+		t.Error("Empty queue should not peek any element")
+	}
+
+	track0 := &sconsify.Track{}
+	track1 := &sconsify.Track{}
+	queue.Add(track0)
+	queue.Add(track1)
+
+	if queue.Peek() != track0 || len(queue.Contents()) != 2 {
+		t.Error("Queue peek should return the first element without removing it")
+	}
+	if queue.Pop() != track0 || queue.Peek() != track1 {
+		t.Error("Queue peek should return the element pop returns")
+	}
+}
+
+func TestQueueInsertAt(t *testing.T) {
+	queue := InitQueue()
+
+	track0 := &sconsify.Track{}
+	queue.Add(track0)
+
+	track1 := &sconsify.Track{}
+	queue.Add(track1)
+
+	track2 := &sconsify.Track{}
+	if queue.InsertAt(1, track2) != track2 {
+		t.Error("Queue insert at should return the very same element")
+	}
+
+	track3 := &sconsify.Track{}
+	queue.InsertAt(10, track3)
+
+	contents := queue.Contents()
+	if contents[0] != track0 || contents[1] != track2 || contents[2] != track1 || contents[3] != track3 {
+		t.Error("Queue content is not correct")
+	}
+
+	for len(queue.Contents()) < QUEUE_MAX_ELEMENTS {
+		queue.Add(&sconsify.Track{})
+	}
+	if queue.InsertAt(0, &sconsify.Track{}) != nil {
+		t.Error("Queue reached its limit, it should not insert anymore")
+	}
+}
+
+func TestQueueMove(t *testing.T) {
+	queue := InitQueue()
+
+	tracks := make([]*sconsify.Track, 5)
+	for i := range tracks {
+		tracks[i] = &sconsify.Track{}
+		queue.Add(tracks[i])
+	}
+
+	if !queue.Move(1, 2, 3) {
+		t.Error("Queue should move tracks 1 and 2 down")
+	}
+	contents := queue.Contents()
+	if contents[0] != tracks[0] || contents[1] != tracks[3] || contents[2] != tracks[4] || contents[3] != tracks[1] || contents[4] != tracks[2] {
+		t.Error("Queue content is not correct")
+	}
+
+	if !queue.Move(3, 2, 0) {
+		t.Error("Queue should move tracks 1 and 2 back up")
+	}
+	contents = queue.Contents()
+	if contents[0] != tracks[1] || contents[1] != tracks[2] || contents[2] != tracks[0] || contents[3] != tracks[3] || contents[4] != tracks[4] {
+		t.Error("Queue content is not correct")
+	}
+}
+
+func TestQueueMoveOutOfBounds(t *testing.T) {
+	queue := InitQueue()
+
+	queue.Add(&sconsify.Track{})
+	queue.Add(&sconsify.Track{})
+	queue.Add(&sconsify.Track{})
+
+	if queue.Move(-1, 1, 0) {
+		t.Error("Index -1 is not valid for moving")
+	}
+	if queue.Move(2, 2, 0) {
+		t.Error("Tracks 2 and 3 are not valid for moving because Size is 3")
+	}
+	if queue.Move(0, 2, 2) {
+		t.Error("Tracks cannot be moved to 2 and 3 because Size is 3")
+	}
+	if queue.Move(0, 0, 1) {
+		t.Error("No track is not valid for moving")
+	}
+	if !queue.Move(0, 2, 1) {
+		t.Error("Tracks 0 and 1 are valid for moving to 1 and 2")
+	}
+}
+
+func TestQueueOnChange(t *testing.T) {
+	queue := InitQueue()
+	changes := 0
+	queue.OnChange(func() { changes++ })
+
+	queue.Add(&sconsify.Track{})
+	queue.Insert(&sconsify.Track{})
+	queue.InsertAt(1, &sconsify.Track{})
+	queue.Move(0, 1, 2)
+	queue.Remove(0)
+	queue.Pop()
+	queue.RemoveAll()
+	if changes != 7 {
+		t.Errorf("Every change should be told, %v were", changes)
+	}
+
+	queue.Pop()
+	queue.Remove(0)
+	queue.Move(0, 1, 1)
+	queue.RemoveAll()
+	if changes != 7 {
+		t.Errorf("Nothing changed in an empty queue, %v changes were told", changes)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/schaeferpp/sconsify/infrastructure"
 	"github.com/schaeferpp/sconsify/sconsify"
 	"github.com/schaeferpp/sconsify/ui"
 	"github.com/jroimartin/gocui"
@@ -21,7 +22,7 @@ var (
 	consoleUserInterface sconsify.UserInterface
 	player               Player
 	loadStateWhenInit    bool
-	timeLeftChannels     *TimeLeftChannels
+	playHistory          sconsify.PlayHistory
 )
 
 const (
@@ -30,15 +31,11 @@ const (
 	VIEW_QUEUE     = "queue"
 	VIEW_STATUS    = "status"
 	VIEW_TIME_LEFT = "time_left"
+	VIEW_EQUALIZER = "equalizer"
 )
 
 type ConsoleUserInterface struct{}
 
-type TimeLeftChannels struct {
-	time_left   chan time.Duration
-	song_paused chan bool
-}
-
 type Gui struct {
 	g             *gocui.Gui
 	playlistsView *gocui.View
@@ -46,29 +43,32 @@ type Gui struct {
 	statusView    *gocui.View
 	queueView     *gocui.View
 	timeLeftView  *gocui.View
+	equalizerView *gocui.View
 
 	currentMessage string
 	initialised    bool
 	PlayingTrack   *sconsify.Track
+	volume         sconsify.Volume
+	equalizer      sconsify.Equalizer
 }
 
-func InitialiseConsoleUserInterface(ev *sconsify.Events, p *sconsify.Publisher, loadState bool) sconsify.UserInterface {
+// InitialiseConsoleUserInterface creates the console user interface, showing the
+// tracks played in a *History playlist when there is a history.
+func InitialiseConsoleUserInterface(ev *sconsify.Events, p *sconsify.Publisher, loadState bool, history sconsify.PlayHistory) sconsify.UserInterface {
 	events = ev
 	publisher = p
-	gui = &Gui{}
+	gui = &Gui{volume: sconsify.InitVolume()}
 	consoleUserInterface = &ConsoleUserInterface{}
 	queue = ui.InitQueue()
+	queue.OnChange(publisher.QueueChanged)
 	player = &RegularPlayer{}
 	loadStateWhenInit = loadState
+	playHistory = history
 	return consoleUserInterface
 }
 
 func (cui *ConsoleUserInterface) TrackPaused(track *sconsify.Track) {
 	gui.setStatus("Paused: " + track.GetFullTitle())
-	select {
-	case timeLeftChannels.song_paused <- true:
-	default:
-	}
 }
 
 func (cui *ConsoleUserInterface) TrackPlaying(track *sconsify.Track) {
@@ -76,10 +76,6 @@ func (cui *ConsoleUserInterface) TrackPlaying(track *sconsify.Track) {
 		gui.PlayingTrack = track
 		gui.setStatus("Playing: " + track.GetFullTitle())
 		gui.updateTracksView()
-		select {
-		case timeLeftChannels.song_paused <- false:
-		default:
-		}
 		return nil
 	})
 }
@@ -110,9 +106,27 @@ func (cui *ConsoleUserInterface) GetNextToPlay() *sconsify.Track {
 	return nil
 }
 
+func (cui *ConsoleUserInterface) PeekNextToPlay() *sconsify.Track {
+	if !queue.IsEmpty() {
+		return queue.Peek()
+	} else if playlists.HasPlaylistSelected() {
+		track, _ := playlists.PeekNext()
+		return track
+	}
+	return nil
+}
+
+func (cui *ConsoleUserInterface) PlayingPlaylist(track *sconsify.Track) string {
+	return playlists.PlaylistNameOf(track.URI)
+}
+
 func (cui *ConsoleUserInterface) NewPlaylists(newPlaylist sconsify.Playlists) error {
 	if playlists == nil {
 		playlists = &newPlaylist
+		playlists.AddSmartPlaylists(playHistory)
+		if playHistory != nil {
+			playlists.AddHistoryPlaylist(playHistory)
+		}
 		go gui.startGui()
 	} else {
 		gui.g.Update(func(g *gocui.Gui) error {
@@ -135,42 +149,88 @@ func (cui *ConsoleUserInterface) ArtistAlbums(folder *sconsify.Playlist) {
 }
 
 func (cui *ConsoleUserInterface) NewTrackLoaded(duration time.Duration) {
-	select {
-	case timeLeftChannels.time_left <- duration:
-	default:
-	}
 }
 
-func (gui *Gui) countdown() {
+func (cui *ConsoleUserInterface) PlaybackPosition(position sconsify.Position) {
+	gui.g.Update(func(g *gocui.Gui) error {
+		gui.clearTimeLeftView()
+		fmt.Fprint(gui.timeLeftView, position.Left())
+		return nil
+	})
+}
+
+func (cui *ConsoleUserInterface) VolumeChanged(volume sconsify.Volume) {
+	gui.g.Update(func(g *gocui.Gui) error {
+		gui.volume = volume
+		gui.updateCurrentStatus()
+		return nil
+	})
+}
 
-	var time_left time.Duration
-	active := false
-	for {
-		select {
-		case paused := <-timeLeftChannels.song_paused:
-			active = !paused
-		case duration := <-timeLeftChannels.time_left:
-			time_left = duration
-			//active = true
-		default:
-		}
+func (cui *ConsoleUserInterface) EqualizerChanged(equalizer sconsify.Equalizer) {
+	gui.g.Update(func(g *gocui.Gui) error {
+		gui.equalizer = equalizer
+		gui.updateEqualizerView()
+		gui.updateCurrentStatus()
+		return nil
+	})
+}
 
-		if active {
-			time_left_copy := time_left
-			gui.g.Update(func(g *gocui.Gui) error {
-				gui.clearTimeLeftView()
-				fmt.Fprintf(gui.timeLeftView, time_left_copy.String())
-				return nil
-			})
-		}
+func (cui *ConsoleUserInterface) Control(request *sconsify.ControlRequest) {
+	if playlists == nil || gui.g == nil {
+		request.Run(nil, nil)
+		return
+	}
+	gui.g.Update(func(g *gocui.Gui) error {
+		request.Run(playlists, queue)
+		gui.updatePlaylistsView()
+		gui.updateTracksView()
+		gui.updateQueueView()
+		gui.updateCurrentStatus()
+		return nil
+	})
+}
 
-		then := time.Now().Round(time.Second)
-		time.Sleep(1 * time.Second)
-		diff := time.Now().Round(time.Second).Sub(then)
-		if active {
-			time_left = time_left - diff
+// PlaylistEdited finishes the edit, which rolls it back when it was not saved.
+func (cui *ConsoleUserInterface) PlaylistEdited(edit *sconsify.PlaylistEdit) {
+	gui.g.Update(func(g *gocui.Gui) error {
+		edit.Finish()
+		if edit.Err != nil {
+			infrastructure.Warn("Cannot save the playlist", "playlist", edit.Playlist, "error", edit.Err)
+			gui.flash(fmt.Sprintf("Not saved to Spotify: %v", edit.Err))
+		} else if edit.Pending {
+			gui.flash("Spotify cannot be reached, the change is saved at the next start with the web-api")
 		}
+		gui.updatePlaylistsView()
+		gui.updateTracksView()
+		gui.updateQueueView()
+		return nil
+	})
+}
+
+// PlaylistEditsReplayed shows how many offline edits were saved, the skipped ones
+// being logged with the reason.
+func (cui *ConsoleUserInterface) PlaylistEditsReplayed(replay *sconsify.PlaylistEditsReplay) {
+	for _, edit := range replay.Skipped {
+		infrastructure.Info("Skipped the playlist edit made offline", "edit", edit.String(), "reason", edit.Err)
 	}
+	gui.g.Update(func(g *gocui.Gui) error {
+		gui.flash(replay.Summary())
+		return nil
+	})
+}
+
+// PlayRecorded loads again the *History playlist and the smart playlists, the
+// track played changing what they hold.
+func (cui *ConsoleUserInterface) PlayRecorded(play *sconsify.Play) {
+	gui.g.Update(func(g *gocui.Gui) error {
+		if playlists != nil {
+			playlists.ReloadPlays()
+			gui.updatePlaylistsView()
+			gui.redrawKeepingCursor(gui.tracksView)
+		}
+		return nil
+	})
 }
 
 func (gui *Gui) startGui() {
@@ -179,7 +239,13 @@ func (gui *Gui) startGui() {
 	if err != nil {
 		log.Panicln(err)
 	}
-	defer gui.g.Close()
+	// the messages logged while the screen belongs to the user interface only go
+	// to the log file
+	infrastructure.LogToConsole(false)
+	defer func() {
+		gui.g.Close()
+		infrastructure.LogToConsole(true)
+	}()
 
 	gui.g.SetManagerFunc(layout)
 	if err := keybindings(); err != nil {
@@ -189,13 +255,6 @@ func (gui *Gui) startGui() {
 	gui.g.SelFgColor = gocui.ColorBlack
 	gui.g.Cursor = true
 
-	// Time left counter thread
-	timeLeftChannels = &TimeLeftChannels{
-		time_left:   make(chan time.Duration, 1),
-		song_paused: make(chan bool, 1),
-	}
-	go gui.countdown()
-
 	if err := gui.g.MainLoop(); err != nil && err != gocui.ErrQuit {
 		log.Panicln(err)
 	}
@@ -224,7 +283,7 @@ func (gui *Gui) updateCurrentStatus() {
 func (gui *Gui) updateStatus(message string) {
 	gui.g.Update(func(g *gocui.Gui) error {
 		gui.clearStatusView()
-		fmt.Fprintf(gui.statusView, playlists.GetModeAsString()+"%v\n", message)
+		fmt.Fprintf(gui.statusView, playlists.GetModeAsString()+gui.volume.String()+gui.equalizer.String()+"%v\n", message)
 		return nil
 	})
 }
@@ -279,30 +338,237 @@ func (gui *Gui) replay() {
 	publisher.Replay()
 }
 
+func (gui *Gui) seek(offset time.Duration) {
+	publisher.Seek(offset)
+}
+
+// createPlaylistFromQueue creates a playlist with the tracks of the queue and
+// empties it. The queue comes back if the playlist cannot be saved.
 func (gui *Gui) createPlaylistFromQueue(playlistName string) {
 	gui.g.Update(func(g *gocui.Gui) error {
-		unsavedFolder := playlists.Get("*Unsaved")
-		if unsavedFolder == nil {
-			unsavedFolder = sconsify.InitFolder("*Unsaved", "*Unsaved", make([]*sconsify.Playlist, 0))
-			playlists.AddPlaylist(unsavedFolder)
+		queued := queue.Contents()
+		tracks := make([]*sconsify.Track, len(queued))
+		for i, track := range queued {
+			tracks[i] = sconsify.InitWebApiTrack(string(track.URI), track.Artist, track.Name, track.Duration)
+		}
+		// the playlist has a URI of its own until the backend saves it
+		playlist := sconsify.InitPlaylist(fmt.Sprintf("unsaved:%v", time.Now().UnixNano()), playlistName, tracks)
+		playlists.AddPlaylist(playlist)
+		gui.clearQueueView()
+		gui.updatePlaylistsView()
+		gui.updateTracksView()
+
+		edit := &sconsify.PlaylistEdit{Kind: sconsify.CreatePlaylist, Playlist: playlist.URI, Name: playlistName, Tracks: toURIs(tracks)}
+		publisher.EditPlaylist(edit.OnFinish(func(edit *sconsify.PlaylistEdit) {
+			if edit.Err != nil {
+				playlists.Remove(playlist.Name())
+				for _, track := range queued {
+					queue.Add(track)
+				}
+			} else if edit.Playlist != playlist.URI {
+				playlists.Remove(playlist.Name())
+				playlist.URI = edit.Playlist
+				playlists.AddPlaylist(playlist)
+			}
+		}))
+		return nil
+	})
+}
+
+// removeTracks removes tracks from the playlist, starting at the index. They come
+// back if the change cannot be saved.
+func (gui *Gui) removeTracks(playlist *sconsify.Playlist, index int, count int) {
+	removed := make([]*sconsify.Track, 0, count)
+	for i := index; i < index+count && i < playlist.Tracks(); i++ {
+		removed = append(removed, playlist.Track(i))
+	}
+	if len(removed) == 0 {
+		return
+	}
+
+	edit := &sconsify.PlaylistEdit{Kind: sconsify.RemoveTracks, Playlist: playlist.URI, Tracks: toURIs(removed), Position: index}
+	editTracks(playlist, edit, func() bool {
+		if !hasTracksAt(playlist, index, removed) {
+			return false
+		}
+		for range removed {
+			playlist.RemoveTrack(index)
 		}
+		return true
+	}, func() {
+		for i, track := range removed {
+			playlist.InsertTrack(index+i, track)
+		}
+	})
+}
+
+// deletePlaylist deletes the playlist, which comes back if the change cannot be
+// saved.
+func (gui *Gui) deletePlaylist(playlist *sconsify.Playlist) {
+	folder := playlists.FolderOf(playlist)
+	playlists.Remove(playlist.Name())
 
-		playlist := unsavedFolder.GetPlaylist(" " + playlistName)
-		if playlist == nil {
-			playlist = sconsify.InitPlaylist(playlistName, " "+playlistName, make([]*sconsify.Track, 0))
-			unsavedFolder.AddPlaylist(playlist)
+	edit := &sconsify.PlaylistEdit{Kind: sconsify.DeletePlaylist, Playlist: playlist.URI}
+	publisher.EditPlaylist(edit.OnFinish(func(edit *sconsify.PlaylistEdit) {
+		if edit.Err == nil {
+			return
 		}
+		if folder != nil {
+			folder.AddPlaylist(playlist)
+			folder.LoadFolderTracks()
+		} else {
+			playlists.AddPlaylist(playlist)
+		}
+	}))
+}
 
-		for _, track := range queue.Contents() {
-			playlist.AddTrack(sconsify.InitWebApiTrack(string(track.URI), track.Artist, track.Name, track.Duration))
+// renamePlaylist renames the playlist, the previous name coming back if the
+// change cannot be saved.
+func (gui *Gui) renamePlaylist(playlist *sconsify.Playlist, name string) {
+	previous := playlist.Rename(name)
+
+	edit := &sconsify.PlaylistEdit{Kind: sconsify.RenamePlaylist, Playlist: playlist.URI, Name: name}
+	publisher.EditPlaylist(edit.OnFinish(func(edit *sconsify.PlaylistEdit) {
+		if edit.Err != nil {
+			playlist.Rename(previous)
 		}
+	}))
+}
 
-		gui.clearQueueView()
-		gui.updatePlaylistsView()
-		gui.updateTracksView()
-		return nil
+// moveTracks moves count tracks of the playlist from the index so the first ends
+// up at to. They move back if the change cannot be saved.
+func (gui *Gui) moveTracks(playlist *sconsify.Playlist, index int, count int, to int) bool {
+	moved := make([]*sconsify.Track, 0, count)
+	for i := index; i < index+count && i < playlist.Tracks(); i++ {
+		moved = append(moved, playlist.Track(i))
+	}
+
+	edit := &sconsify.PlaylistEdit{Kind: sconsify.MoveTracks, Playlist: playlist.URI, Tracks: toURIs(moved), Position: index, To: to}
+	return editTracks(playlist, edit, func() bool {
+		return hasTracksAt(playlist, index, moved) && playlist.MoveTracks(index, count, to)
+	}, func() {
+		playlist.MoveTracks(to, count, index)
 	})
+}
+
+// insertTracks inserts copies of the tracks in the playlist at the index. They
+// are saved as added at the end then moved, and removed again if the change
+// cannot be saved.
+func (gui *Gui) insertTracks(playlist *sconsify.Playlist, index int, tracks []*sconsify.Track) {
+	end := playlist.Tracks()
+	if index > end {
+		index = end
+	}
+	inserted := make([]*sconsify.Track, len(tracks))
+	for i, track := range tracks {
+		inserted[i] = sconsify.InitWebApiTrack(track.URI, track.Artist, track.Name, track.Duration)
+	}
+
+	add := &sconsify.PlaylistEdit{Kind: sconsify.AddTracks, Playlist: playlist.URI, Tracks: toURIs(inserted)}
+	editTracks(playlist, add, func() bool {
+		for _, track := range inserted {
+			playlist.InsertTrack(playlist.Tracks(), track)
+		}
+		return true
+	}, func() {
+		removeInserted(playlist, inserted)
+	})
+	if index == end {
+		return
+	}
+	// the tracks added stay at the end, as on Spotify, if the move cannot be saved
+	move := &sconsify.PlaylistEdit{Kind: sconsify.MoveTracks, Playlist: playlist.URI, Tracks: add.Tracks, Position: end, To: index}
+	editTracks(playlist, move, func() bool {
+		return hasTracksAt(playlist, end, inserted) && playlist.MoveTracks(end, len(inserted), index)
+	}, func() {
+		playlist.MoveTracks(index, len(inserted), end)
+	})
+}
+
+// trackEdit is an edit of the tracks of a playlist waiting to be saved. It is
+// made by redo and taken back by undo.
+type trackEdit struct {
+	redo    func() bool
+	undo    func()
+	applied bool
+}
+
+// trackEdits are the edits of the tracks of each playlist waiting to be saved,
+// in the order they were made.
+var trackEdits = make(map[*sconsify.Playlist][]*trackEdit)
 
+// editTracks makes an edit of the tracks of the playlist with redo, returning
+// false when it cannot be made, and publishes it. When it cannot be saved the
+// edits made since are undone, newest first, so the edit is undone on the
+// tracks it was made on, and then made again where their tracks still are.
+func editTracks(playlist *sconsify.Playlist, edit *sconsify.PlaylistEdit, redo func() bool, undo func()) bool {
+	if !redo() {
+		return false
+	}
+	pending := &trackEdit{redo: redo, undo: undo, applied: true}
+	trackEdits[playlist] = append(trackEdits[playlist], pending)
+
+	publisher.EditPlaylist(edit.OnFinish(func(edit *sconsify.PlaylistEdit) {
+		edits := trackEdits[playlist]
+		at := 0
+		for edits[at] != pending {
+			at++
+		}
+		if edit.Err != nil && pending.applied {
+			later := edits[at+1:]
+			for i := len(later) - 1; i >= 0; i-- {
+				if later[i].applied {
+					later[i].undo()
+				}
+			}
+			pending.undo()
+			for _, laterEdit := range later {
+				laterEdit.applied = laterEdit.applied && laterEdit.redo()
+			}
+		}
+		if edits = append(edits[:at:at], edits[at+1:]...); len(edits) > 0 {
+			trackEdits[playlist] = edits
+		} else {
+			delete(trackEdits, playlist)
+		}
+	}))
+	return true
+}
+
+// hasTracksAt tells if the tracks are in the playlist one after the other from
+// the index.
+func hasTracksAt(playlist *sconsify.Playlist, index int, tracks []*sconsify.Track) bool {
+	for i, track := range tracks {
+		if index+i >= playlist.Tracks() || playlist.Track(index+i) != track {
+			return false
+		}
+	}
+	return true
+}
+
+func removeInserted(playlist *sconsify.Playlist, inserted []*sconsify.Track) {
+	for _, track := range inserted {
+		if at := indexOfTrack(playlist, track); at > -1 {
+			playlist.RemoveTrack(at)
+		}
+	}
+}
+
+func indexOfTrack(playlist *sconsify.Playlist, track *sconsify.Track) int {
+	for i := 0; i < playlist.Tracks(); i++ {
+		if playlist.Track(i) == track {
+			return i
+		}
+	}
+	return -1
+}
+
+func toURIs(tracks []*sconsify.Track) []string {
+	URIs := make([]string, len(tracks))
+	for i, track := range tracks {
+		URIs[i] = track.URI
+	}
+	return URIs
 }
 
 func (gui *Gui) getSelectedPlaylistAndTrack() (*sconsify.Playlist, int) {
@@ -323,6 +589,7 @@ func (gui *Gui) getSelectedPlaylistAndTrack() (*sconsify.Playlist, int) {
 
 func (gui *Gui) updateTracksView() {
 	gui.tracksView.Clear()
+	first, count := visualSelection(gui.tracksView)
 	cx, cy := gui.tracksView.Cursor()
 	ox, oy := gui.tracksView.Origin()
 	gui.tracksView.SetCursor(0, 0)
@@ -335,6 +602,8 @@ func (gui *Gui) updateTracksView() {
 			if track == gui.PlayingTrack {
 				PlayingTrackOnView = true
 				fmt.Fprintf(gui.tracksView, "%v. <<%v>>\n", (i + 1), track.GetTitle())
+			} else if i >= first && i < first+count {
+				fmt.Fprintf(gui.tracksView, "%v. * %v\n", (i + 1), track.GetTitle())
 			} else {
 				fmt.Fprintf(gui.tracksView, "%v. %v\n", (i + 1), track.GetTitle())
 			}
@@ -371,8 +640,13 @@ func (gui *Gui) clearQueueView() {
 func (gui *Gui) updateQueueView() {
 	gui.queueView.Clear()
 	if !queue.IsEmpty() {
-		for _, track := range queue.Contents() {
-			fmt.Fprintf(gui.queueView, "%v\n", track.GetTitle())
+		first, count := visualSelection(gui.queueView)
+		for i, track := range queue.Contents() {
+			if i >= first && i < first+count {
+				fmt.Fprintf(gui.queueView, "* %v\n", track.GetTitle())
+			} else {
+				fmt.Fprintf(gui.queueView, "%v\n", track.GetTitle())
+			}
 		}
 	}
 }
@@ -436,6 +710,24 @@ func loadInitialState() {
 	loadPlaylistFromState(state)
 	loadTrackFromState(state)
 	loadQueueFromState(state)
+	loadVolumeFromState(state)
+}
+
+// loadVolumeFromState sets the volume saved, the audio starting unmuted at
+// MaxVolume.
+func loadVolumeFromState(state *State) {
+	if state.Volume == nil {
+		return
+	}
+	level, muted := *state.Volume, state.Muted
+	go func() {
+		if level != sconsify.MaxVolume {
+			publisher.SetVolume(level)
+		}
+		if muted {
+			publisher.ToggleMute()
+		}
+	}()
 }
 
 func loadQueueFromState(state *State) {
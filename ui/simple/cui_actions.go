@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"strings"
+	"time"
 
 	"github.com/schaeferpp/sconsify/infrastructure"
 	"github.com/schaeferpp/sconsify/sconsify"
@@ -57,8 +58,24 @@ const (
 	OpenCloseFolder    string = "OpenCloseFolder"
 	ArtistAlbums       string = "ArtistAlbums"
 	CreatePlaylist     string = "CreatePlaylist"
+	RenamePlaylist     string = "RenamePlaylist"
+	SeekForward        string = "SeekForward"
+	SeekBackward       string = "SeekBackward"
+	VolumeUp           string = "VolumeUp"
+	VolumeDown         string = "VolumeDown"
+	Mute               string = "Mute"
+	Equalizer          string = "Equalizer"
+	VisualMode         string = "VisualMode"
+	MoveTracksUp       string = "MoveTracksUp"
+	MoveTracksDown     string = "MoveTracksDown"
+	CutTracks          string = "CutTracks"
+	CopyTracks         string = "CopyTracks"
+	PasteTracks        string = "PasteTracks"
 )
 
+// seekStep is how far SeekForward and SeekBackward move, multiplied by the typed number
+const seekStep = 10 * time.Second
+
 var multipleKeysBuffer []rune
 var multipleKeysNumber int
 var keyboard *Keyboard
@@ -136,6 +153,45 @@ func (keyboard *Keyboard) defaultValues() {
 	if !keyboard.UsedFunctions[CreatePlaylist] {
 		keyboard.addKey("c", CreatePlaylist)
 	}
+	if !keyboard.UsedFunctions[RenamePlaylist] {
+		keyboard.addKey("R", RenamePlaylist)
+	}
+	if !keyboard.UsedFunctions[SeekForward] {
+		keyboard.addKey("f", SeekForward)
+	}
+	if !keyboard.UsedFunctions[SeekBackward] {
+		keyboard.addKey("b", SeekBackward)
+	}
+	if !keyboard.UsedFunctions[VolumeUp] {
+		keyboard.addKey("+", VolumeUp)
+	}
+	if !keyboard.UsedFunctions[VolumeDown] {
+		keyboard.addKey("-", VolumeDown)
+	}
+	if !keyboard.UsedFunctions[Mute] {
+		keyboard.addKey("m", Mute)
+	}
+	if !keyboard.UsedFunctions[Equalizer] {
+		keyboard.addKey("e", Equalizer)
+	}
+	if !keyboard.UsedFunctions[VisualMode] {
+		keyboard.addKey("V", VisualMode)
+	}
+	if !keyboard.UsedFunctions[MoveTracksUp] {
+		keyboard.addKey("K", MoveTracksUp)
+	}
+	if !keyboard.UsedFunctions[MoveTracksDown] {
+		keyboard.addKey("J", MoveTracksDown)
+	}
+	if !keyboard.UsedFunctions[CutTracks] {
+		keyboard.addKey("x", CutTracks)
+	}
+	if !keyboard.UsedFunctions[CopyTracks] {
+		keyboard.addKey("y", CopyTracks)
+	}
+	if !keyboard.UsedFunctions[PasteTracks] {
+		keyboard.addKey("P", PasteTracks)
+	}
 }
 
 func (keyboard *Keyboard) loadKeyFunctions() {
@@ -215,7 +271,7 @@ func keybindings() error {
 			}))
 		}
 
-		for _, value := range []rune{'>', '<', '/'} {
+		for _, value := range []rune{'>', '<', '/', '+', '-'} {
 			key := value
 			addKeyBinding(&keyboard.Keys, newKeyMapping(key, view, func(g *gocui.Gui, v *gocui.View) error {
 				return keyPressed(key, g, v)
@@ -238,6 +294,12 @@ func keybindings() error {
 		keyboard.configureKey(setShuffleAllMode, ShuffleAllMode, view)
 		keyboard.configureKey(nextTrackCommand, NextTrack, view)
 		keyboard.configureKey(replayTrackCommand, ReplayTrack, view)
+		keyboard.configureKey(seekForwardCommand, SeekForward, view)
+		keyboard.configureKey(seekBackwardCommand, SeekBackward, view)
+		keyboard.configureKey(volumeUpCommand, VolumeUp, view)
+		keyboard.configureKey(volumeDownCommand, VolumeDown, view)
+		keyboard.configureKey(muteCommand, Mute, view)
+		keyboard.configureKey(enableEqualizerCommand, Equalizer, view)
 		keyboard.configureKey(enableSearchInputCommand, Search, view)
 		keyboard.configureKey(repeatPlayingTrackCommand, RepeatPlayingTrack, view)
 		keyboard.configureKey(quit, Quit, view)
@@ -266,6 +328,9 @@ func keybindings() error {
 	keyboard.configureKey(artistAlbums, ArtistAlbums, VIEW_TRACKS)
 	addKeyBinding(&keyboard.Keys, newKeyMapping(gocui.KeyCtrlC, "", quit))
 	keyboard.configureKey(enableCreatePlaylistCommand, CreatePlaylist, VIEW_QUEUE)
+	keyboard.configureKey(enableRenamePlaylistCommand, RenamePlaylist, VIEW_PLAYLISTS)
+	equalizerKeybindings()
+	visualKeybindings()
 
 	// numbers
 	for i := 0; i < 10; i++ {
@@ -282,7 +347,9 @@ func keybindings() error {
 		keyCopy := key
 		if err := gui.g.SetKeybinding(key.view, key.key, key.mod,
 			func(g *gocui.Gui, v *gocui.View) error {
-				return keyCopy.h(g, v)
+				err := keyCopy.h(g, v)
+				gui.updateVisualMode()
+				return err
 			}); err != nil {
 			return err
 		}
@@ -368,6 +435,31 @@ func replayTrackCommand(g *gocui.Gui, v *gocui.View) error {
 	return nil
 }
 
+func seekForwardCommand(g *gocui.Gui, v *gocui.View) error {
+	gui.seek(time.Duration(getOffsetFromTypedNumbers()) * seekStep)
+	return nil
+}
+
+func seekBackwardCommand(g *gocui.Gui, v *gocui.View) error {
+	gui.seek(-time.Duration(getOffsetFromTypedNumbers()) * seekStep)
+	return nil
+}
+
+func volumeUpCommand(g *gocui.Gui, v *gocui.View) error {
+	publisher.VolumeUp()
+	return nil
+}
+
+func volumeDownCommand(g *gocui.Gui, v *gocui.View) error {
+	publisher.VolumeDown()
+	return nil
+}
+
+func muteCommand(g *gocui.Gui, v *gocui.View) error {
+	publisher.ToggleMute()
+	return nil
+}
+
 func queueTrackCommand(g *gocui.Gui, v *gocui.View) error {
 	if playlist, trackIndex := gui.getSelectedPlaylistAndTrack(); playlist != nil {
 		for i := 1; i <= getOffsetFromTypedNumbers(); i++ {
@@ -427,7 +519,10 @@ func removeAllTracksCommand(g *gocui.Gui, v *gocui.View) error {
 	case VIEW_PLAYLISTS:
 	case VIEW_TRACKS:
 		if playlist, index := gui.getSelectedPlaylistAndTrack(); index > -1 {
-			playlist.RemoveAllTracks()
+			if !canEditTracks(playlist, "removed") {
+				return nil
+			}
+			gui.removeTracks(playlist, 0, playlist.Tracks())
 			gui.updateTracksView()
 			return gui.enableSideView()
 		}
@@ -442,26 +537,32 @@ func removeTrackCommand(g *gocui.Gui, v *gocui.View) error {
 	switch v.Name() {
 	case VIEW_PLAYLISTS:
 		if playlist := gui.getSelectedPlaylist(); playlist != nil {
-			playlists.Remove(playlist.Name())
+			gui.deletePlaylist(playlist)
 			gui.updatePlaylistsView()
 			gui.updateTracksView()
 		}
 	case VIEW_TRACKS:
 		if playlist, index := gui.getSelectedPlaylistAndTrack(); index > -1 {
-			for i := 1; i <= getOffsetFromTypedNumbers(); i++ {
-				playlist.RemoveTrack(index)
+			if !canEditTracks(playlist, "removed") {
+				return nil
 			}
+			index, count := selectedLines(v, getOffsetFromTypedNumbers())
+			leaveVisualMode()
+			gui.removeTracks(playlist, index, count)
 			gui.updateTracksView()
 			goTo(g, v, index+1)
 		}
 	case VIEW_QUEUE:
 		if index := gui.getQueueSelectedTrackIndex(); index > -1 {
-			for i := 1; i <= getOffsetFromTypedNumbers(); i++ {
+			index, count := selectedLines(v, getOffsetFromTypedNumbers())
+			leaveVisualMode()
+			for i := 1; i <= count; i++ {
 				if queue.Remove(index) != nil {
 					continue
 				}
 			}
 			gui.updateQueueView()
+			goTo(g, v, index+1)
 		}
 	}
 	return nil
@@ -505,6 +606,37 @@ func createPlaylistCommand(g *gocui.Gui, v *gocui.View) error {
 	return nil
 }
 
+func enableRenamePlaylistCommand(g *gocui.Gui, v *gocui.View) error {
+	if playlist := gui.getSelectedPlaylist(); playlist == nil || playlist.IsFolder() {
+		return nil
+	}
+	gui.clearStatusView()
+	gui.statusView.Editable = true
+	gui.g.SetCurrentView(VIEW_STATUS)
+	actionBeingExecuted = RenamePlaylist
+	return nil
+}
+
+func renamePlaylistCommand(g *gocui.Gui, v *gocui.View) error {
+	name := getTypedCommand()
+	playlist := gui.getSelectedPlaylist()
+	gui.enableSideView()
+	gui.clearStatusView()
+	gui.statusView.Editable = false
+	gui.updateCurrentStatus()
+	if name == "" || playlist == nil {
+		return nil
+	}
+	// playlists are found by their names
+	if playlists.Get(name) != nil || playlists.Get(" "+name) != nil {
+		gui.flash(fmt.Sprintf("A playlist is already named %v", name))
+		return nil
+	}
+	gui.renamePlaylist(playlist, name)
+	gui.updatePlaylistsView()
+	return nil
+}
+
 func getTypedCommand() string {
 	typed, _ := gui.statusView.Line(0)
 	return strings.Trim(typed, " \x00")
@@ -515,6 +647,8 @@ func executeAction(g *gocui.Gui, v *gocui.View) error {
 		return searchCommand(g, v)
 	} else if actionBeingExecuted == CreatePlaylist {
 		return createPlaylistCommand(g, v)
+	} else if actionBeingExecuted == RenamePlaylist {
+		return renamePlaylistCommand(g, v)
 	}
 	return nil
 }
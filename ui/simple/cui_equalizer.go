@@ -0,0 +1,130 @@
+package simple
+
+import (
+	"fmt"
+
+	"github.com/jroimartin/gocui"
+	"github.com/schaeferpp/sconsify/sconsify"
+)
+
+const equalizerViewWidth = 64
+
+var (
+	// band selected in the equalizer view
+	equalizerBand int
+	// view to go back to when the equalizer view is closed
+	viewBeforeEqualizer string
+)
+
+func equalizerKeybindings() {
+	for _, key := range []interface{}{'h', gocui.KeyArrowLeft} {
+		addKeyBinding(&keyboard.Keys, newKeyMapping(key, VIEW_EQUALIZER, previousEqualizerBand))
+	}
+	for _, key := range []interface{}{'l', gocui.KeyArrowRight} {
+		addKeyBinding(&keyboard.Keys, newKeyMapping(key, VIEW_EQUALIZER, nextEqualizerBand))
+	}
+	for _, key := range []interface{}{'k', '+', gocui.KeyArrowUp} {
+		addKeyBinding(&keyboard.Keys, newKeyMapping(key, VIEW_EQUALIZER, equalizerBandUp))
+	}
+	for _, key := range []interface{}{'j', '-', gocui.KeyArrowDown} {
+		addKeyBinding(&keyboard.Keys, newKeyMapping(key, VIEW_EQUALIZER, equalizerBandDown))
+	}
+	addKeyBinding(&keyboard.Keys, newKeyMapping('p', VIEW_EQUALIZER, nextEqualizerPreset))
+	for _, key := range []interface{}{'e', 'q', gocui.KeyEsc, gocui.KeyEnter} {
+		addKeyBinding(&keyboard.Keys, newKeyMapping(key, VIEW_EQUALIZER, closeEqualizerCommand))
+	}
+}
+
+func enableEqualizerCommand(g *gocui.Gui, v *gocui.View) error {
+	maxX, maxY := g.Size()
+	x0, y0 := (maxX-equalizerViewWidth)/2, maxY/2-3
+	view, err := g.SetView(VIEW_EQUALIZER, x0, y0, x0+equalizerViewWidth, y0+6)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	view.Title = "Equalizer"
+	gui.equalizerView = view
+	viewBeforeEqualizer = v.Name()
+	gui.updateEqualizerView()
+	_, err = g.SetCurrentView(VIEW_EQUALIZER)
+	return err
+}
+
+func closeEqualizerCommand(g *gocui.Gui, v *gocui.View) error {
+	gui.equalizerView = nil
+	if err := g.DeleteView(VIEW_EQUALIZER); err != nil {
+		return err
+	}
+	_, err := g.SetCurrentView(viewBeforeEqualizer)
+	return err
+}
+
+func previousEqualizerBand(g *gocui.Gui, v *gocui.View) error {
+	if equalizerBand > 0 {
+		equalizerBand--
+		gui.updateEqualizerView()
+	}
+	return nil
+}
+
+func nextEqualizerBand(g *gocui.Gui, v *gocui.View) error {
+	if equalizerBand < len(sconsify.EqualizerFrequencies)-1 {
+		equalizerBand++
+		gui.updateEqualizerView()
+	}
+	return nil
+}
+
+func equalizerBandUp(g *gocui.Gui, v *gocui.View) error {
+	return changeEqualizerBand(sconsify.EqualizerStep)
+}
+
+func equalizerBandDown(g *gocui.Gui, v *gocui.View) error {
+	return changeEqualizerBand(-sconsify.EqualizerStep)
+}
+
+func changeEqualizerBand(step float64) error {
+	if equalizerBand < len(gui.equalizer.Gains) {
+		publisher.SetEqualizerBand(equalizerBand, gui.equalizer.Gains[equalizerBand]+step)
+	}
+	return nil
+}
+
+func nextEqualizerPreset(g *gocui.Gui, v *gocui.View) error {
+	presets := gui.equalizer.Presets
+	for i, preset := range presets {
+		if preset == gui.equalizer.Preset {
+			publisher.SetEqualizerPreset(presets[(i+1)%len(presets)])
+			return nil
+		}
+	}
+	if len(presets) > 0 {
+		publisher.SetEqualizerPreset(presets[0])
+	}
+	return nil
+}
+
+func (gui *Gui) updateEqualizerView() {
+	if gui.equalizerView == nil {
+		return
+	}
+	gui.equalizerView.Clear()
+	fmt.Fprintf(gui.equalizerView, " Preset: %v\n\n", gui.equalizer.Preset)
+	for _, frequency := range sconsify.EqualizerFrequencies {
+		if frequency >= 1000 {
+			fmt.Fprintf(gui.equalizerView, "%6v", fmt.Sprintf("%vk", frequency/1000))
+		} else {
+			fmt.Fprintf(gui.equalizerView, "%6v", frequency)
+		}
+	}
+	fmt.Fprintln(gui.equalizerView)
+	for band, gain := range gui.equalizer.Gains {
+		value := sconsify.FormatEqualizerGain(gain)
+		if band == equalizerBand {
+			value = "[" + value + "]"
+		}
+		fmt.Fprintf(gui.equalizerView, "%6v", value)
+	}
+	fmt.Fprintln(gui.equalizerView)
+	fmt.Fprint(gui.equalizerView, " h/l band, j/k gain, p next preset, e close")
+}
@@ -35,7 +35,7 @@ func (p *RegularPlayer) Play() {
 		} else {
 			track := playlist.Track(trackIndex)
 			playlists.SetCurrents(playlist.Name(), trackIndex)
-			publisher.Play(track)
+			publisher.PlayFrom(track, playlists.PlaylistNameOf(track.URI))
 		}
 	}
 }
@@ -18,6 +18,10 @@ type State struct {
 
 	ClosedFolders []string
 	Queue         []*sconsify.Track
+
+	// Volume is nil in the states saved before the volume was
+	Volume *int
+	Muted  bool
 }
 
 func loadState() *State {
@@ -67,6 +71,9 @@ func persistState() {
 		state.Queue = append(state.Queue, track)
 	}
 
+	level := gui.volume.Level
+	state.Volume, state.Muted = &level, gui.volume.Muted
+
 	if b, err := json.Marshal(state); err == nil {
 		if fileLocation := infrastructure.GetStateFileLocation(); fileLocation != "" {
 			infrastructure.SaveFile(fileLocation, b)
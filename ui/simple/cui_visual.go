@@ -0,0 +1,253 @@
+package simple
+
+import (
+	"fmt"
+
+	"github.com/jroimartin/gocui"
+	"github.com/schaeferpp/sconsify/sconsify"
+)
+
+var (
+	// view in visual mode, empty when it is off
+	visualView string
+	// line the visual mode started on, the lines from it to the cursor are selected
+	visualStart int
+	// tracks cut or copied, for PasteTracks
+	clipboard []*sconsify.Track
+)
+
+func visualKeybindings() {
+	for _, view := range []string{VIEW_TRACKS, VIEW_QUEUE} {
+		keyboard.configureKey(visualModeCommand, VisualMode, view)
+		keyboard.configureKey(moveTracksUpCommand, MoveTracksUp, view)
+		keyboard.configureKey(moveTracksDownCommand, MoveTracksDown, view)
+		keyboard.configureKey(cutTracksCommand, CutTracks, view)
+		keyboard.configureKey(copyTracksCommand, CopyTracks, view)
+		keyboard.configureKey(pasteTracksCommand, PasteTracks, view)
+		addKeyBinding(&keyboard.Keys, newKeyMapping(gocui.KeyEsc, view, leaveVisualModeCommand))
+	}
+}
+
+func currentLine(v *gocui.View) int {
+	_, oy := v.Origin()
+	_, cy := v.Cursor()
+	return oy + cy
+}
+
+// selectedLines returns the first line selected in the view and how many are:
+// the lines of the visual mode, or count lines from the cursor without it.
+func selectedLines(v *gocui.View, count int) (int, int) {
+	line := currentLine(v)
+	if visualView != v.Name() {
+		return line, count
+	}
+	if line < visualStart {
+		return line, visualStart - line + 1
+	}
+	return visualStart, line - visualStart + 1
+}
+
+// visualSelection returns the lines selected by the visual mode in the view,
+// none when it is not in visual mode.
+func visualSelection(v *gocui.View) (int, int) {
+	if v == nil || visualView != v.Name() {
+		return 0, 0
+	}
+	return selectedLines(v, 0)
+}
+
+func visualModeCommand(g *gocui.Gui, v *gocui.View) error {
+	if visualView == v.Name() {
+		return leaveVisualModeCommand(g, v)
+	}
+	visualView = v.Name()
+	visualStart = currentLine(v)
+	return nil
+}
+
+func leaveVisualModeCommand(g *gocui.Gui, v *gocui.View) error {
+	if visualView != "" {
+		leaveVisualMode()
+		gui.redrawKeepingCursor(v)
+	}
+	return nil
+}
+
+func leaveVisualMode() {
+	visualView = ""
+}
+
+// updateVisualMode marks the lines selected after every key, leaving the visual
+// mode once another view is current.
+func (gui *Gui) updateVisualMode() {
+	if visualView == "" {
+		return
+	}
+	v := gui.g.CurrentView()
+	if v == nil || v.Name() != visualView {
+		previous, _ := gui.g.View(visualView)
+		leaveVisualMode()
+		if previous != nil {
+			gui.redrawKeepingCursor(previous)
+		}
+		return
+	}
+	gui.redrawKeepingCursor(v)
+}
+
+// redrawKeepingCursor redraws the tracks or queue view, which would otherwise
+// move the cursor back to the top.
+func (gui *Gui) redrawKeepingCursor(v *gocui.View) {
+	cx, cy := v.Cursor()
+	ox, oy := v.Origin()
+	switch v {
+	case gui.tracksView:
+		gui.updateTracksView()
+	case gui.queueView:
+		gui.updateQueueView()
+	}
+	v.SetOrigin(ox, oy)
+	v.SetCursor(cx, cy)
+}
+
+// selectedTracks returns the playlist of the tracks view, nil for the queue view,
+// the index of the first track selected and the tracks selected.
+func (gui *Gui) selectedTracks(v *gocui.View, count int) (*sconsify.Playlist, int, []*sconsify.Track) {
+	index, count := selectedLines(v, count)
+	switch v.Name() {
+	case VIEW_TRACKS:
+		if playlist, current := gui.getSelectedPlaylistAndTrack(); current > -1 {
+			tracks := make([]*sconsify.Track, 0, count)
+			for i := index; i < index+count && i < playlist.Tracks(); i++ {
+				tracks = append(tracks, playlist.Track(i))
+			}
+			return playlist, index, tracks
+		}
+	case VIEW_QUEUE:
+		contents := queue.Contents()
+		if index < len(contents) {
+			if index+count > len(contents) {
+				count = len(contents) - index
+			}
+			return nil, index, contents[index : index+count]
+		}
+	}
+	return nil, index, nil
+}
+
+func moveTracksUpCommand(g *gocui.Gui, v *gocui.View) error {
+	return moveSelectedTracks(g, v, -getOffsetFromTypedNumbers())
+}
+
+func moveTracksDownCommand(g *gocui.Gui, v *gocui.View) error {
+	return moveSelectedTracks(g, v, getOffsetFromTypedNumbers())
+}
+
+// moveSelectedTracks moves the tracks selected by offset lines, the cursor and
+// the visual mode following them.
+func moveSelectedTracks(g *gocui.Gui, v *gocui.View, offset int) error {
+	playlist, index, tracks := gui.selectedTracks(v, 1)
+	if len(tracks) == 0 || index+offset < 0 {
+		return nil
+	}
+	switch v.Name() {
+	case VIEW_TRACKS:
+		if !canEditTracks(playlist, "moved") {
+			return nil
+		}
+		if !gui.moveTracks(playlist, index, len(tracks), index+offset) {
+			return nil
+		}
+	case VIEW_QUEUE:
+		if !queue.Move(index, len(tracks), index+offset) {
+			return nil
+		}
+	}
+	line := currentLine(v) + offset
+	if visualView == v.Name() {
+		visualStart += offset
+	}
+	gui.redrawKeepingCursor(v)
+	return goTo(g, v, line+1)
+}
+
+func copyTracksCommand(g *gocui.Gui, v *gocui.View) error {
+	if _, _, tracks := gui.selectedTracks(v, getOffsetFromTypedNumbers()); len(tracks) > 0 {
+		clipboard = append([]*sconsify.Track(nil), tracks...)
+		leaveVisualMode()
+		gui.redrawKeepingCursor(v)
+		gui.flash(fmt.Sprintf("%v tracks copied", len(clipboard)))
+	}
+	return nil
+}
+
+func cutTracksCommand(g *gocui.Gui, v *gocui.View) error {
+	playlist, index, tracks := gui.selectedTracks(v, getOffsetFromTypedNumbers())
+	if len(tracks) == 0 || (v.Name() == VIEW_TRACKS && !canEditTracks(playlist, "cut")) {
+		return nil
+	}
+	clipboard = append([]*sconsify.Track(nil), tracks...)
+	leaveVisualMode()
+	switch v.Name() {
+	case VIEW_TRACKS:
+		gui.removeTracks(playlist, index, len(tracks))
+		gui.updateTracksView()
+	case VIEW_QUEUE:
+		for range tracks {
+			queue.Remove(index)
+		}
+		gui.updateQueueView()
+	}
+	gui.flash(fmt.Sprintf("%v tracks cut", len(clipboard)))
+	return goTo(g, v, index+1)
+}
+
+// canEditTracks tells if the tracks of the playlist can be changed, flashing why
+// not when they cannot: a folder shows the tracks of its playlists and an on
+// demand playlist is made again when loaded.
+func canEditTracks(playlist *sconsify.Playlist, edit string) bool {
+	if playlist.IsFolder() || playlist.IsOnDemand() {
+		gui.flash("Tracks cannot be " + edit + " in " + playlist.Name())
+		return false
+	}
+	return true
+}
+
+// pasteTracksCommand inserts the tracks cut or copied before the cursor.
+func pasteTracksCommand(g *gocui.Gui, v *gocui.View) error {
+	if len(clipboard) == 0 {
+		return nil
+	}
+	leaveVisualMode()
+	index := currentLine(v)
+	switch v.Name() {
+	case VIEW_TRACKS:
+		playlist, current := gui.getSelectedPlaylistAndTrack()
+		if playlist == nil {
+			// an empty playlist has no track to paste before
+			if playlist = gui.getSelectedPlaylist(); playlist == nil {
+				return nil
+			}
+			index = playlist.Tracks()
+		} else if current > -1 {
+			index = current
+		}
+		if !canEditTracks(playlist, "pasted") {
+			return nil
+		}
+		gui.insertTracks(playlist, index, clipboard)
+		gui.updateTracksView()
+	case VIEW_QUEUE:
+		if index > len(queue.Contents()) {
+			index = len(queue.Contents())
+		}
+		for i, track := range clipboard {
+			if queue.InsertAt(index+i, track) == nil {
+				gui.flash("Queue is full")
+				break
+			}
+		}
+		gui.updateQueueView()
+	}
+	return goTo(g, v, index+1)
+}
@@ -1,62 +1,230 @@
 package ui
 
 import (
-	"github.com/schaeferpp/sconsify/sconsify"
-	"text/template"
-	"io/ioutil"
 	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/template"
+	"time"
+
+	"github.com/schaeferpp/sconsify/infrastructure"
+	"github.com/schaeferpp/sconsify/sconsify"
+)
+
+const (
+	StatusFormatText = "text"
+	StatusFormatJson = "json"
+
+	// DefaultStatusTemplate leaves the file empty when nothing plays.
+	DefaultStatusTemplate = "{{if .Track}}{{.Action}}: {{.Track}} - {{.Artist}}\n{{end}}"
+)
+
+// the actions of a StatusTrack
+const (
+	ActionPlaying       = "Playing"
+	ActionPaused        = "Paused"
+	ActionNotAvailable  = "Not available"
+	ActionPlayTokenLost = "Play token lost"
+	ActionStopped       = "Stopped"
 )
 
+// StatusTrack is what the status files are written with, the playlist, the mode
+// and the queue being those of the last track change.
 type StatusTrack struct {
-	Action string
-	Track  string
-	Artist string
-}
-
-var fileName string
-
-func toFile(content []byte) {
-	ioutil.WriteFile(fileName, content, 0600)
-}
-
-func cleanStatusFile() {
-	toFile([]byte(""))
-}
-
-func ToStatusFile(file string, text string) {
-	fileName = file
-	toFileEvents := sconsify.InitialiseEvents()
-
-	t := template.Must(template.New("statusTemplate").Parse(text))
-
-	cleanStatusFile()
-	for {
-		select {
-		case track := <-toFileEvents.TrackPausedUpdates():
-			var b bytes.Buffer
-			t.Execute(&b, StatusTrack{Action: "Paused", Track: track.Name, Artist: track.Artist.Name})
-			toFile(b.Bytes())
-		case track := <-toFileEvents.TrackPlayingUpdates():
-			var b bytes.Buffer
-			t.Execute(&b, StatusTrack{Action: "Playing", Track: track.Name, Artist: track.Artist.Name})
-			toFile(b.Bytes())
-		case <-toFileEvents.ShutdownEngineUpdates():
-			cleanStatusFile()
-			break
-		case <-toFileEvents.TrackNotAvailableUpdates():
-		case <-toFileEvents.PlayTokenLostUpdates():
-		case <-toFileEvents.NextPlayUpdates():
-		case <-toFileEvents.PlaylistsUpdates():
-		case <-toFileEvents.ArtistAlbumsUpdates():
-		case <-toFileEvents.NewTrackLoadedUpdate():
-		case <-toFileEvents.ShutdownSpotifyUpdates():
-		case <-toFileEvents.SearchUpdates():
-		case <-toFileEvents.PlayUpdates():
-		case <-toFileEvents.ReplayUpdates():
-		case <-toFileEvents.PauseUpdates():
-		case <-toFileEvents.PlayPauseToggleUpdates():
-		case <-toFileEvents.GetArtistAlbumsUpdates():
+	Action    string `json:"action"`
+	Track     string `json:"track"`
+	Artist    string `json:"artist"`
+	Album     string `json:"album"`
+	URI       string `json:"uri"`
+	Elapsed   string `json:"elapsed"`
+	Remaining string `json:"remaining"`
+	Duration  string `json:"duration"`
+	Playlist  string `json:"playlist"`
+	Mode      string `json:"mode"`
+	Queue     int    `json:"queue"`
+	Volume    int    `json:"volume"`
+	Muted     bool   `json:"muted"`
+}
+
+// StatusFile is a file kept up to date with the status, formatted by a template
+// or as JSON.
+type StatusFile struct {
+	Name     string
+	Format   string
+	Template string
+
+	template *template.Template
+	content  []byte
+}
+
+// InitStatusFiles pairs the files with the templates and the formats in the
+// order given, a file without a template or a format of its own taking the last
+// one given.
+func InitStatusFiles(names []string, templates []string, formats []string) ([]*StatusFile, error) {
+	files := make([]*StatusFile, len(names))
+	for i, name := range names {
+		file := &StatusFile{
+			Name:     name,
+			Format:   pick(formats, i, StatusFormatText),
+			Template: pick(templates, i, DefaultStatusTemplate),
+		}
+		switch file.Format {
+		case StatusFormatText:
+			t, err := template.New(name).Parse(file.Template)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid status file template: %v", err)
+			}
+			file.template = t
+		case StatusFormatJson:
+		default:
+			return nil, fmt.Errorf("Unknown status file format %v, available: text, json", file.Format)
+		}
+		files[i] = file
+	}
+	return files, nil
+}
+
+func pick(values []string, i int, defaultValue string) string {
+	if len(values) == 0 {
+		return defaultValue
+	}
+	if i < len(values) {
+		return values[i]
+	}
+	return values[len(values)-1]
+}
+
+// write writes the status when its content changes, positions arriving every
+// second. The file is replaced by a rename so it is never read half written.
+func (file *StatusFile) write(status *StatusTrack) {
+	var b bytes.Buffer
+	if file.template != nil {
+		if err := file.template.Execute(&b, status); err != nil {
+			infrastructure.Debug("Cannot execute the status file template", "file", file.Name, "error", err)
+			return
 		}
+	} else {
+		content, _ := json.Marshal(status)
+		b.Write(content)
+		b.WriteByte('\n')
 	}
+	if bytes.Equal(b.Bytes(), file.content) {
+		return
+	}
+	file.content = b.Bytes()
+	if err := infrastructure.SaveFileAtomically(file.Name, file.content); err != nil {
+		infrastructure.Debug("Cannot write the status file", "file", file.Name, "error", err)
+	}
+}
+
+// ToStatusFiles keeps the files up to date with the track playing. It only
+// subscribes to the updates it writes and drops the old ones, a slow disk never
+// holds up the playback. The channel returned is closed once the stopped status
+// is written, when the engine shuts down.
+func ToStatusFiles(publisher *sconsify.Publisher, files []*StatusFile) <-chan struct{} {
+	toFileEvents := publisher.Subscribe(sconsify.Subscription{
+		Topics: []sconsify.Topic{
+			sconsify.TopicTrackPaused,
+			sconsify.TopicTrackPlaying,
+			sconsify.TopicTrackNotAvailable,
+			sconsify.TopicPlayTokenLost,
+			sconsify.TopicPlaybackPosition,
+			sconsify.TopicVolumeChanged,
+			sconsify.TopicShutdownEngine,
+		},
+		Buffer: 4,
+		Policy: sconsify.DropOldest,
+	})
+
+	status := &StatusTrack{Action: ActionStopped}
+	status.setVolume(publisher.CurrentVolume())
+	write := func() {
+		for _, file := range files {
+			file.write(status)
+		}
+	}
+
+	write()
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		defer publisher.Unsubscribe(toFileEvents)
+
+		for {
+			select {
+			case track := <-toFileEvents.TrackPausedUpdates():
+				status.setTrack(ActionPaused, track)
+				status.setPlaylist(publisher, track)
+			case track := <-toFileEvents.TrackPlayingUpdates():
+				status.setTrack(ActionPlaying, track)
+				status.setPlaylist(publisher, track)
+			case track := <-toFileEvents.TrackNotAvailableUpdates():
+				status.setTrack(ActionNotAvailable, track)
+				status.setPosition(sconsify.Position{})
+			case <-toFileEvents.PlayTokenLostUpdates():
+				status.Action = ActionPlayTokenLost
+			case position := <-toFileEvents.PlaybackPositionUpdates():
+				status.setPosition(position)
+			case volume := <-toFileEvents.VolumeChangedUpdates():
+				status.setVolume(volume)
+			case <-toFileEvents.ShutdownEngineUpdates():
+				*status = StatusTrack{Action: ActionStopped}
+				write()
+				return
+			}
+			write()
+		}
+	}()
+	return stopped
+}
+
+// setTrack sets the track, the position of another track being unknown until
+// the next update. A track paused or resumed keeps its position.
+func (status *StatusTrack) setTrack(action string, track *sconsify.Track) {
+	if track.URI != status.URI {
+		status.Elapsed, status.Remaining, status.Duration = "", "", ""
+	}
+	status.Action, status.Track, status.URI = action, track.Name, track.URI
+	status.Artist, status.Album = "", ""
+	if track.Artist != nil {
+		status.Artist = track.Artist.Name
+	}
+	if track.Album != nil {
+		status.Album = track.Album.Name
+	}
+	if duration, err := time.ParseDuration(track.Duration); err == nil {
+		status.Duration = duration.String()
+	}
+}
+
+func (status *StatusTrack) setPosition(position sconsify.Position) {
+	status.Elapsed = (position.Elapsed / time.Second * time.Second).String()
+	status.Duration = (position.Total / time.Second * time.Second).String()
+	status.Remaining = position.Left().String()
 }
 
+func (status *StatusTrack) setVolume(volume sconsify.Volume) {
+	status.Volume, status.Muted = volume.Level, volume.Muted
+}
+
+// setPlaylist asks the user interface for the playlist chosen the track is played
+// from, the mode and the length of the queue, keeping the last ones when it does
+// not answer.
+func (status *StatusTrack) setPlaylist(publisher *sconsify.Publisher, track *sconsify.Track) {
+	result, err := publisher.Control(func(playlists *sconsify.Playlists, queue sconsify.TrackQueue) (interface{}, error) {
+		current := &StatusTrack{Mode: sconsify.ModeNames[playlists.Mode()]}
+		if playlist := playlists.PlaylistOf(track.URI); playlist != nil {
+			current.Playlist = playlist.OriginalName()
+		}
+		if queue != nil {
+			current.Queue = len(queue.Contents())
+		}
+		return current, nil
+	})
+	if err != nil {
+		infrastructure.Debug("No playlist for the status files", "error", err)
+		return
+	}
+	current := result.(*StatusTrack)
+	status.Playlist, status.Mode, status.Queue = current.Playlist, current.Mode, current.Queue
+}
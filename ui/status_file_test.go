@@ -0,0 +1,101 @@
+package ui
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/schaeferpp/sconsify/sconsify"
+)
+
+func TestInitStatusFiles(t *testing.T) {
+	files, err := InitStatusFiles([]string{"tmux", "bar", "other"}, []string{"{{.Track}}"}, []string{StatusFormatText, StatusFormatJson})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files[0].Format != StatusFormatText || files[0].Template != "{{.Track}}" || files[1].Format != StatusFormatJson || files[2].Format != StatusFormatJson {
+		t.Errorf("Wrong pairing %+v %+v %+v", files[0], files[1], files[2])
+	}
+	if _, err := InitStatusFiles([]string{"tmux"}, []string{"{{.Track"}, nil); err == nil {
+		t.Error("Invalid template should fail")
+	}
+	if _, err := InitStatusFiles([]string{"tmux"}, nil, []string{"xml"}); err == nil {
+		t.Error("Unknown format should fail")
+	}
+}
+
+// waitForContent waits for the file to have the content, the files being written
+// in the background.
+func waitForContent(t *testing.T, name string, content string) {
+	for i := 0; i < 100; i++ {
+		if b, _ := ioutil.ReadFile(name); string(b) == content {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	b, _ := ioutil.ReadFile(name)
+	t.Fatalf("File %v should be %q but is %q", filepath.Base(name), content, b)
+}
+
+func TestToStatusFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sconsify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	publisher := &sconsify.Publisher{}
+	uiEvents := publisher.Subscribe(sconsify.Subscription{Topics: []sconsify.Topic{sconsify.TopicControl}})
+	track := sconsify.InitTrack("track0", sconsify.InitArtist("artist0", "Bob Marley"), "Waiting in vain", "4m16s")
+	other := sconsify.InitTrack("track1", sconsify.InitArtist("artist0", "Bob Marley"), "Natural mystic", "3m28s")
+	playlists := sconsify.InitPlaylists()
+	playlists.AddPlaylist(sconsify.InitPlaylist("playlist0", "Bob Marley", []*sconsify.Track{track, other}))
+	playlists.SetCurrents("Bob Marley", 0)
+	queue := InitQueue()
+	go func() {
+		for request := range uiEvents.ControlUpdates() {
+			request.Run(playlists, queue)
+		}
+	}()
+
+	text, jsonFile := filepath.Join(dir, "tmux"), filepath.Join(dir, "bar.json")
+	files, _ := InitStatusFiles([]string{text, jsonFile}, []string{"{{.Action}} {{.Track}} {{.Remaining}}"}, []string{StatusFormatText, StatusFormatJson})
+	stopped := ToStatusFiles(publisher, files)
+	waitForContent(t, text, "Stopped  ")
+
+	publisher.TrackPlaying(track)
+	waitForContent(t, text, "Playing Waiting in vain ")
+	publisher.PlaybackPosition(16*time.Second, 256*time.Second)
+	waitForContent(t, text, "Playing Waiting in vain 4m0s")
+
+	var status StatusTrack
+	b, _ := ioutil.ReadFile(jsonFile)
+	if err := json.Unmarshal(b, &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Artist != "Bob Marley" || status.Playlist != "Bob Marley" || status.Mode != "normal" || status.Volume != sconsify.MaxVolume {
+		t.Errorf("Wrong status %+v", status)
+	}
+
+	publisher.Control(func(playlists *sconsify.Playlists, queue sconsify.TrackQueue) (interface{}, error) {
+		playlists.SetMode(sconsify.ShuffleMode)
+		return nil, nil
+	})
+	publisher.TrackPlaying(other)
+	waitForContent(t, text, "Playing Natural mystic ")
+	b, _ = ioutil.ReadFile(jsonFile)
+	json.Unmarshal(b, &status)
+	if status.Playlist != "Bob Marley" || status.Mode != "shuffle" || status.Elapsed != "" {
+		t.Errorf("The playlist shuffled should be shown without the position of the previous track: %+v", status)
+	}
+
+	publisher.TrackNotAvailable(track)
+	waitForContent(t, text, "Not available Waiting in vain 0s")
+
+	publisher.ShutdownEngine()
+	<-stopped
+	waitForContent(t, text, "Stopped  ")
+}
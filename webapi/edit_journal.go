@@ -0,0 +1,129 @@
+package webapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/schaeferpp/sconsify/infrastructure"
+	"github.com/schaeferpp/sconsify/sconsify"
+)
+
+// EditJournal keeps the playlist edits made while Spotify cannot be reached, one
+// JSON object per line, so they are saved once the web api is back.
+type EditJournal struct {
+	fileLocation string
+	entries      []*editJournalEntry
+}
+
+type editJournalEntry struct {
+	Time     time.Time `json:"time"`
+	Kind     string    `json:"kind"`
+	Playlist string    `json:"playlist"`
+	Name     string    `json:"name,omitempty"`
+	Tracks   []string  `json:"tracks,omitempty"`
+	Position int       `json:"position,omitempty"`
+	To       int       `json:"to,omitempty"`
+}
+
+// OpenEditJournal reads the edits journaled by the previous runs, skipping the
+// lines it cannot read.
+func OpenEditJournal(fileLocation string) *EditJournal {
+	journal := &EditJournal{fileLocation: fileLocation}
+	if fileLocation == "" {
+		return journal
+	}
+	infrastructure.ReadJsonLines(fileLocation, "playlist edits journal", func(line []byte) error {
+		var entry editJournalEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return err
+		}
+		if _, err := sconsify.ParsePlaylistEditKind(entry.Kind); err != nil {
+			return err
+		}
+		journal.entries = append(journal.entries, &entry)
+		return nil
+	})
+	return journal
+}
+
+// Pending tells if edits are waiting to be saved, the next edits having to wait
+// for them to keep their order.
+func (journal *EditJournal) Pending() bool {
+	return len(journal.entries) > 0
+}
+
+// Creates tells if a playlist is created by an edit waiting to be saved, URI
+// being the one the user interface gave it.
+func (journal *EditJournal) Creates(URI string) bool {
+	for _, entry := range journal.entries {
+		if entry.Kind == sconsify.CreatePlaylist.String() && entry.Playlist == URI {
+			return true
+		}
+	}
+	return false
+}
+
+// Record journals the edit, setting it pending.
+func (journal *EditJournal) Record(edit *sconsify.PlaylistEdit) error {
+	entry := &editJournalEntry{
+		Time:     time.Now(),
+		Kind:     edit.Kind.String(),
+		Playlist: edit.Playlist,
+		Name:     edit.Name,
+		Tracks:   edit.Tracks,
+		Position: edit.Position,
+		To:       edit.To,
+	}
+	if journal.fileLocation != "" {
+		if err := infrastructure.AppendJsonLine(journal.fileLocation, entry); err != nil {
+			return err
+		}
+	}
+	journal.entries = append(journal.entries, entry)
+	edit.Pending = true
+	return nil
+}
+
+// next returns the oldest edit waiting, nil when none is.
+func (journal *EditJournal) next() *sconsify.PlaylistEdit {
+	if len(journal.entries) == 0 {
+		return nil
+	}
+	entry := journal.entries[0]
+	kind, _ := sconsify.ParsePlaylistEditKind(entry.Kind)
+	return &sconsify.PlaylistEdit{
+		Kind:     kind,
+		Playlist: entry.Playlist,
+		Name:     entry.Name,
+		Tracks:   entry.Tracks,
+		Position: entry.Position,
+		To:       entry.To,
+	}
+}
+
+// done removes the oldest edit, saved or skipped.
+func (journal *EditJournal) done() {
+	journal.entries = journal.entries[1:]
+}
+
+// save writes the edits still waiting, replacing the file by a rename so an
+// interrupted write never loses them. The file is removed when none is waiting.
+func (journal *EditJournal) save() error {
+	if journal.fileLocation == "" {
+		return nil
+	}
+	if len(journal.entries) == 0 {
+		if err := os.Remove(journal.fileLocation); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	for _, entry := range journal.entries {
+		encoder.Encode(entry)
+	}
+	return infrastructure.SaveFileAtomically(journal.fileLocation, b.Bytes())
+}
@@ -0,0 +1,180 @@
+package webapi
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/schaeferpp/sconsify/sconsify"
+)
+
+func createJournal(t *testing.T, edits ...*sconsify.PlaylistEdit) (*EditJournal, string) {
+	dir, err := ioutil.TempDir("", "sconsify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileLocation := filepath.Join(dir, "playlist-edits.json")
+	journal := OpenEditJournal(fileLocation)
+	for _, edit := range edits {
+		if err := journal.Record(edit); err != nil {
+			t.Fatal(err)
+		}
+		if !edit.Pending {
+			t.Errorf("Edit should be pending once recorded: %v", edit)
+		}
+	}
+	return journal, fileLocation
+}
+
+func TestEditJournalIsReadAgain(t *testing.T) {
+	journal, fileLocation := createJournal(t,
+		&sconsify.PlaylistEdit{Kind: sconsify.CreatePlaylist, Playlist: "unsaved:1", Name: "Reggae", Tracks: []string{"spotify:track:track0"}},
+		&sconsify.PlaylistEdit{Kind: sconsify.MoveTracks, Playlist: "unsaved:1", Tracks: []string{"spotify:track:track0"}, Position: 0, To: 1},
+	)
+	defer os.RemoveAll(filepath.Dir(fileLocation))
+
+	file, err := os.OpenFile(fileLocation, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("{\"kind\": \"unknown\"}\n")
+	file.Close()
+
+	journal = OpenEditJournal(fileLocation)
+	if len(journal.entries) != 2 {
+		t.Fatalf("Journal should have the 2 edits recorded, it has %v", len(journal.entries))
+	}
+	if !journal.Pending() || !journal.Creates("unsaved:1") || journal.Creates("unsaved:2") {
+		t.Error("Journal should be pending and create unsaved:1 only")
+	}
+	edit := journal.next()
+	if edit.Kind != sconsify.CreatePlaylist || edit.Name != "Reggae" || len(edit.Tracks) != 1 {
+		t.Errorf("First edit should create Reggae: %v", edit)
+	}
+	journal.done()
+	if edit := journal.next(); edit.Kind != sconsify.MoveTracks || edit.To != 1 {
+		t.Errorf("Second edit should move to 1: %v", edit)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	api, playlistSync := startWebApi(t)
+	defer api.server.Close()
+	api.tracks["playlist0"] = []string{"spotify:track:track0", "spotify:track:track1", "spotify:track:track2"}
+
+	journal, fileLocation := createJournal(t,
+		&sconsify.PlaylistEdit{Kind: sconsify.CreatePlaylist, Playlist: "unsaved:1", Name: "Reggae", Tracks: []string{"spotify:track:track0"}},
+		&sconsify.PlaylistEdit{Kind: sconsify.AddTracks, Playlist: "unsaved:1", Tracks: []string{"spotify:track:track1"}},
+		&sconsify.PlaylistEdit{Kind: sconsify.RemoveTracks, Playlist: "spotify:user:bob:playlist:playlist0", Tracks: []string{"spotify:track:track1"}, Position: 1},
+		// track2 moved up by the removal above
+		&sconsify.PlaylistEdit{Kind: sconsify.MoveTracks, Playlist: "spotify:user:bob:playlist:playlist0", Tracks: []string{"spotify:track:track2"}, Position: 2, To: 0},
+		&sconsify.PlaylistEdit{Kind: sconsify.MoveTracks, Playlist: "spotify:user:bob:playlist:playlist0", Tracks: []string{"spotify:track:track2"}, Position: 1, To: 0},
+		&sconsify.PlaylistEdit{Kind: sconsify.RenamePlaylist, Playlist: "unsaved:2", Name: "Ska"},
+	)
+	defer os.RemoveAll(filepath.Dir(fileLocation))
+
+	replay := playlistSync.Replay(journal)
+	if len(replay.Applied) != 4 || len(replay.Skipped) != 2 {
+		t.Fatalf("4 edits should be applied and 2 skipped: %v", replay.Summary())
+	}
+	if edit := replay.Applied[1]; edit.Playlist != "spotify:user:bob:playlist:playlist1" {
+		t.Errorf("Tracks should be added to the playlist created: %v", edit)
+	}
+	if edit := replay.Skipped[0]; edit.Kind != sconsify.MoveTracks || edit.Position != 2 || edit.Err == nil {
+		t.Errorf("The move from a position past the tracks should be skipped: %v", edit)
+	}
+	if edit := replay.Skipped[1]; edit.Kind != sconsify.RenamePlaylist || edit.Err == nil {
+		t.Errorf("The rename of a playlist never created should be skipped: %v", edit)
+	}
+	if journal.Pending() {
+		t.Error("Journal should be empty")
+	}
+	if _, err := os.Stat(fileLocation); !os.IsNotExist(err) {
+		t.Errorf("Journal file should be removed: %v", err)
+	}
+
+	if tracks := strings.Join(api.tracks["playlist0"], ","); tracks != "spotify:track:track2,spotify:track:track0" {
+		t.Errorf("track1 should be removed and track2 moved first: %v", tracks)
+	}
+	if tracks := strings.Join(api.tracks["playlist1"], ","); tracks != "spotify:track:track0,spotify:track:track1" {
+		t.Errorf("track0 and track1 should be in the playlist created: %v", tracks)
+	}
+}
+
+func TestReplaySkipsConflicts(t *testing.T) {
+	api, playlistSync := startWebApi(t)
+	defer api.server.Close()
+	api.tracks["playlist0"] = []string{"spotify:track:track0", "spotify:track:track2"}
+
+	journal, fileLocation := createJournal(t,
+		&sconsify.PlaylistEdit{Kind: sconsify.RemoveTracks, Playlist: "spotify:user:bob:playlist:playlist0", Tracks: []string{"spotify:track:track1"}, Position: 1},
+		&sconsify.PlaylistEdit{Kind: sconsify.RemoveTracks, Playlist: "spotify:user:bob:playlist:playlist0", Tracks: []string{"spotify:track:track2"}, Position: 1},
+	)
+	defer os.RemoveAll(filepath.Dir(fileLocation))
+
+	replay := playlistSync.Replay(journal)
+	if len(replay.Applied) != 1 || len(replay.Skipped) != 1 {
+		t.Fatalf("1 edit should be applied and 1 skipped: %v", replay.Summary())
+	}
+	if replay.Skipped[0].Tracks[0] != "spotify:track:track1" {
+		t.Errorf("Removing track1, removed on Spotify already, should be skipped: %v", replay.Skipped[0])
+	}
+	for _, request := range api.received() {
+		if request.method == "DELETE" && request.body["tracks"] != nil {
+			if tracks := request.body["tracks"].([]interface{}); len(tracks) != 1 || tracks[0].(map[string]interface{})["uri"] != "spotify:track:track2" {
+				t.Errorf("Only track2 should be removed: %v", request.body)
+			}
+		}
+	}
+}
+
+func TestReplayStopsWhenUnreachable(t *testing.T) {
+	api, playlistSync := startWebApi(t)
+	defer api.server.Close()
+	api.fail = "/playlist0"
+	api.failStatus = http.StatusServiceUnavailable
+
+	journal, fileLocation := createJournal(t,
+		&sconsify.PlaylistEdit{Kind: sconsify.CreatePlaylist, Playlist: "unsaved:1", Name: "Reggae"},
+		&sconsify.PlaylistEdit{Kind: sconsify.RenamePlaylist, Playlist: "spotify:user:bob:playlist:playlist0", Name: "Ska"},
+		&sconsify.PlaylistEdit{Kind: sconsify.DeletePlaylist, Playlist: "spotify:user:bob:playlist:playlist1"},
+	)
+	defer os.RemoveAll(filepath.Dir(fileLocation))
+
+	replay := playlistSync.Replay(journal)
+	if len(replay.Applied) != 1 || len(replay.Skipped) != 0 {
+		t.Fatalf("Only the create should be applied: %v", replay.Summary())
+	}
+	if journal = OpenEditJournal(fileLocation); len(journal.entries) != 2 {
+		t.Fatalf("Journal should keep the 2 edits not replayed, it has %v", len(journal.entries))
+	}
+	if edit := journal.next(); edit.Kind != sconsify.RenamePlaylist {
+		t.Errorf("Rename should be replayed next: %v", edit)
+	}
+}
+
+func TestIsUnreachable(t *testing.T) {
+	api, playlistSync := startWebApi(t)
+	api.fail = "/playlist0"
+	for status, unreachable := range map[int]bool{
+		http.StatusForbidden:          false,
+		http.StatusNotFound:           false,
+		http.StatusTooManyRequests:    true,
+		http.StatusServiceUnavailable: true,
+	} {
+		api.failStatus = status
+		err := playlistSync.Apply(&sconsify.PlaylistEdit{Kind: sconsify.RenamePlaylist, Playlist: "spotify:playlist:playlist0", Name: "Ska"})
+		if err == nil || IsUnreachable(err) != unreachable {
+			t.Errorf("Status %v should be unreachable: %v, %v", status, unreachable, err)
+		}
+	}
+
+	api.server.Close()
+	err := playlistSync.Apply(&sconsify.PlaylistEdit{Kind: sconsify.DeletePlaylist, Playlist: "spotify:playlist:playlist0"})
+	if !IsUnreachable(err) {
+		t.Errorf("Server closed should be unreachable: %v", err)
+	}
+}
@@ -0,0 +1,294 @@
+package webapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/schaeferpp/sconsify/infrastructure"
+	"github.com/schaeferpp/sconsify/sconsify"
+	"github.com/zmb3/spotify"
+)
+
+// maxTracksPerRequest is the most tracks the Web API adds in one request.
+const maxTracksPerRequest = 100
+
+// PlaylistSync saves the playlist edits of the user interfaces to Spotify.
+type PlaylistSync struct {
+	client *spotify.Client
+	userID string
+}
+
+func InitPlaylistSync(client *spotify.Client, userID string) *PlaylistSync {
+	return &PlaylistSync{client: client, userID: userID}
+}
+
+// IsPlaylistURI tells if the URI is a Spotify playlist, e.g.
+// spotify:user:username:playlist:id, the other playlists of sconsify, e.g. the
+// search results, not being saved.
+func IsPlaylistURI(URI string) bool {
+	_, _, err := parsePlaylistURI(URI)
+	return err == nil
+}
+
+// Apply saves an edit, setting the URI of the playlist created.
+func (sync *PlaylistSync) Apply(edit *sconsify.PlaylistEdit) error {
+	if edit.Kind == sconsify.CreatePlaylist {
+		URI, err := sync.Create(edit.Name, edit.Tracks)
+		if err == nil {
+			edit.Playlist = URI
+		}
+		return err
+	}
+
+	owner, id, err := parsePlaylistURI(edit.Playlist)
+	if err != nil {
+		return err
+	}
+	if owner == "" {
+		owner = sync.userID
+	}
+	switch edit.Kind {
+	case sconsify.AddTracks:
+		return sync.addTracks(owner, id, edit.Tracks)
+	case sconsify.RemoveTracks:
+		return sync.removeTracks(owner, id, edit.Tracks, edit.Position)
+	case sconsify.MoveTracks:
+		return sync.moveTracks(owner, id, edit.Tracks, edit.Position, edit.To)
+	case sconsify.RenamePlaylist:
+		return sync.client.ChangePlaylistName(owner, id, edit.Name)
+	case sconsify.DeletePlaylist:
+		return sync.client.UnfollowPlaylist(spotify.ID(owner), id)
+	}
+	return fmt.Errorf("Unknown playlist edit %v", edit.Kind)
+}
+
+// IsUnreachable tells if an error is Spotify not being reached, or not being
+// able to answer, rather than Spotify refusing the request.
+func IsUnreachable(err error) bool {
+	switch err := err.(type) {
+	case *url.Error:
+		return true
+	case spotify.Error:
+		return err.Status >= http.StatusInternalServerError || err.Status == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// Replay saves the edits of the journal in the order they were made. An edit is
+// skipped when it conflicts with the playlist on Spotify, e.g. the tracks to
+// remove were moved meanwhile, or when Spotify refuses it. The replay stops,
+// keeping the remaining edits, if Spotify cannot be reached.
+func (sync *PlaylistSync) Replay(journal *EditJournal) *sconsify.PlaylistEditsReplay {
+	replay := &sconsify.PlaylistEditsReplay{}
+	// the URIs of the playlists created by the URIs the user interface gave them
+	created := make(map[string]string)
+
+	for edit := journal.next(); edit != nil; edit = journal.next() {
+		err := sync.replayEdit(edit, created)
+		if IsUnreachable(err) {
+			infrastructure.Warn("Cannot replay the playlist edits", "pending", len(journal.entries), "error", err)
+			break
+		}
+		if err != nil {
+			infrastructure.Info("Skipping a playlist edit", "edit", edit.String(), "reason", err)
+			edit.Err = err
+			replay.Skipped = append(replay.Skipped, edit)
+		} else {
+			infrastructure.Debug("Replayed a playlist edit", "edit", edit.String())
+			replay.Applied = append(replay.Applied, edit)
+		}
+		journal.done()
+	}
+	if err := journal.save(); err != nil {
+		infrastructure.Warn("Cannot save the playlist edits journal", "error", err)
+	}
+	return replay
+}
+
+func (sync *PlaylistSync) replayEdit(edit *sconsify.PlaylistEdit, created map[string]string) error {
+	if edit.Kind == sconsify.CreatePlaylist {
+		unsaved := edit.Playlist
+		if err := sync.Apply(edit); err != nil {
+			return err
+		}
+		created[unsaved] = edit.Playlist
+		return nil
+	}
+
+	if URI, isCreated := created[edit.Playlist]; isCreated {
+		edit.Playlist = URI
+	} else if !IsPlaylistURI(edit.Playlist) {
+		return fmt.Errorf("The playlist %v was not created", edit.Playlist)
+	}
+	return sync.Apply(edit)
+}
+
+// spotifyPlaylist is a playlist as it is on Spotify. The positions sconsify
+// gives are those of the tracks it shows, the tracks without artist being left
+// out when the playlists are loaded, so they are translated to the positions on
+// Spotify before editing.
+type spotifyPlaylist struct {
+	snapshotID string
+	tracks     []string
+	// the positions on Spotify of the tracks shown by sconsify
+	shown []int
+}
+
+// read returns the playlist as it is on Spotify.
+func (sync *PlaylistSync) read(owner string, id spotify.ID) (*spotifyPlaylist, error) {
+	fullPlaylist, err := sync.client.GetPlaylistOpt(owner, id, "snapshot_id,tracks(items(track(uri,artists(uri))),total)")
+	if err != nil {
+		return nil, err
+	}
+	playlist := &spotifyPlaylist{snapshotID: fullPlaylist.SnapshotID}
+	page := &fullPlaylist.Tracks
+	limit := maxTracksPerRequest
+	offset := 0
+	for {
+		for _, track := range page.Tracks {
+			if len(track.Track.Artists) > 0 {
+				playlist.shown = append(playlist.shown, len(playlist.tracks))
+			}
+			playlist.tracks = append(playlist.tracks, string(track.Track.URI))
+		}
+		offset = offset + len(page.Tracks)
+		if len(page.Tracks) == 0 || offset >= page.Total {
+			break
+		}
+		if page, err = sync.client.GetPlaylistTracksOpt(owner, id, &spotify.Options{Limit: &limit, Offset: &offset}, "items(track(uri,artists(uri))),total"); err != nil {
+			return nil, err
+		}
+	}
+	return playlist, nil
+}
+
+// positions returns the positions on Spotify of the tracks shown from a
+// position, failing if they are no longer there.
+func (playlist *spotifyPlaylist) positions(tracks []string, position int) ([]int, error) {
+	positions := make([]int, len(tracks))
+	for i, URI := range tracks {
+		shown := position + i
+		if shown < 0 || shown >= len(playlist.shown) || playlist.tracks[playlist.shown[shown]] != URI {
+			return nil, fmt.Errorf("%v is no longer at position %v on Spotify", URI, shown+1)
+		}
+		positions[i] = playlist.shown[shown]
+	}
+	return positions, nil
+}
+
+// Create creates a private playlist with the tracks, returning its URI. The
+// playlist is deleted again if the tracks cannot be added.
+func (sync *PlaylistSync) Create(name string, tracks []string) (string, error) {
+	playlist, err := sync.client.CreatePlaylistForUser(sync.userID, name, false)
+	if err != nil {
+		return "", err
+	}
+	if err := sync.addTracks(sync.userID, playlist.ID, tracks); err != nil {
+		sync.client.UnfollowPlaylist(spotify.ID(sync.userID), playlist.ID)
+		return "", err
+	}
+	return string(playlist.URI), nil
+}
+
+func (sync *PlaylistSync) addTracks(owner string, id spotify.ID, tracks []string) error {
+	ids, err := toTrackIDs(tracks)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(ids); start += maxTracksPerRequest {
+		end := start + maxTracksPerRequest
+		if end > len(ids) {
+			end = len(ids)
+		}
+		if _, err := sync.client.AddTracksToPlaylist(owner, id, ids[start:end]...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeTracks removes the tracks found one after the other from a position, so
+// the other occurrences of the same tracks stay.
+func (sync *PlaylistSync) removeTracks(owner string, id spotify.ID, tracks []string, position int) error {
+	ids, err := toTrackIDs(tracks)
+	if err != nil {
+		return err
+	}
+	playlist, err := sync.read(owner, id)
+	if err != nil {
+		return err
+	}
+	positions, err := playlist.positions(tracks, position)
+	if err != nil {
+		return err
+	}
+	toRemove := make([]spotify.TrackToRemove, len(ids))
+	for i, trackID := range ids {
+		toRemove[i] = spotify.NewTrackToRemove(string(trackID), []int{positions[i]})
+	}
+	_, err = sync.client.RemoveTracksFromPlaylistOpt(owner, id, toRemove, playlist.snapshotID)
+	return err
+}
+
+// moveTracks moves the tracks found one after the other from a position so the
+// first of them ends up at the position to.
+func (sync *PlaylistSync) moveTracks(owner string, id spotify.ID, tracks []string, from int, to int) error {
+	playlist, err := sync.read(owner, id)
+	if err != nil {
+		return err
+	}
+	positions, err := playlist.positions(tracks, from)
+	if err != nil {
+		return err
+	}
+	count := len(positions)
+	if count == 0 || positions[count-1]-positions[0] != count-1 {
+		return errors.New("The tracks moved are not one after the other on Spotify")
+	}
+	if to < 0 || to+count > len(playlist.shown) {
+		return fmt.Errorf("The playlist has %v tracks on Spotify", len(playlist.shown))
+	}
+	// the tracks are taken out before being inserted, so they go before the
+	// track shown at to once they are out
+	insertBefore := len(playlist.tracks)
+	if to < from {
+		insertBefore = playlist.shown[to]
+	} else if to+count < len(playlist.shown) {
+		insertBefore = playlist.shown[to+count]
+	}
+	_, err = sync.client.ReorderPlaylistTracks(owner, id, spotify.PlaylistReorderOptions{
+		RangeStart:   positions[0],
+		RangeLength:  count,
+		InsertBefore: insertBefore,
+		SnapshotID:   playlist.snapshotID,
+	})
+	return err
+}
+
+// parsePlaylistURI returns the owner, empty for spotify:playlist:id, and the id
+// of a playlist.
+func parsePlaylistURI(URI string) (string, spotify.ID, error) {
+	parts := strings.Split(URI, ":")
+	if len(parts) == 5 && parts[0] == "spotify" && parts[1] == "user" && parts[3] == "playlist" && parts[4] != "" {
+		return parts[2], spotify.ID(parts[4]), nil
+	}
+	if len(parts) == 3 && parts[0] == "spotify" && parts[1] == "playlist" && parts[2] != "" {
+		return "", spotify.ID(parts[2]), nil
+	}
+	return "", "", fmt.Errorf("%v is not a Spotify playlist", URI)
+}
+
+func toTrackIDs(tracks []string) ([]spotify.ID, error) {
+	ids := make([]spotify.ID, len(tracks))
+	for i, URI := range tracks {
+		parts := strings.Split(URI, ":")
+		if len(parts) != 3 || parts[0] != "spotify" || parts[1] != "track" {
+			return nil, errors.New("Only Spotify tracks can be saved in a playlist, not " + URI)
+		}
+		ids[i] = spotify.ID(parts[2])
+	}
+	return ids, nil
+}
@@ -0,0 +1,400 @@
+package webapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/schaeferpp/sconsify/sconsify"
+	"github.com/zmb3/spotify"
+)
+
+// request is what the stand-in of the Web API received.
+type request struct {
+	method string
+	path   string
+	query  string
+	body   map[string]interface{}
+}
+
+// webApi stands in for the Web API, keeping the tracks of the playlists up to
+// date with the tracks added, removed and moved, and answering every other
+// request with a playlist, unless told to fail with failStatus, 403 by default.
+type webApi struct {
+	server     *httptest.Server
+	mutex      sync.Mutex
+	requests   []request
+	fail       string
+	failStatus int
+	tracks     map[string][]string
+	// the tracks without artist, which sconsify does not show
+	withoutArtist map[string]bool
+	// the number of times the playlists were edited, giving their snapshot ids
+	edits map[string]int
+}
+
+// redirect sends the requests of the client to the stand-in.
+type redirect struct {
+	target *url.URL
+}
+
+func (redirect *redirect) RoundTrip(r *http.Request) (*http.Response, error) {
+	r.URL.Scheme, r.URL.Host = redirect.target.Scheme, redirect.target.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func startWebApi(t *testing.T) (*webApi, *PlaylistSync) {
+	api := &webApi{failStatus: http.StatusForbidden, tracks: make(map[string][]string), withoutArtist: make(map[string]bool), edits: make(map[string]int)}
+	api.server = httptest.NewServer(http.HandlerFunc(api.serve))
+	target, err := url.Parse(api.server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := spotify.NewClient(&http.Client{Transport: &redirect{target: target}})
+	return api, InitPlaylistSync(&client, "bob")
+}
+
+func (api *webApi) serve(w http.ResponseWriter, r *http.Request) {
+	received := request{method: r.Method, path: r.URL.Path, query: r.URL.RawQuery}
+	if content, _ := ioutil.ReadAll(r.Body); len(content) > 0 {
+		json.Unmarshal(content, &received.body)
+	}
+	api.mutex.Lock()
+	api.requests = append(api.requests, received)
+	fail := api.fail != "" && strings.HasSuffix(r.URL.Path, api.fail)
+	api.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if fail {
+		w.WriteHeader(api.failStatus)
+		fmt.Fprintf(w, `{"error": {"status": %v, "message": "%v"}}`, api.failStatus, http.StatusText(api.failStatus))
+		return
+	}
+	parts := strings.Split(r.URL.Path, "/")
+	switch {
+	case r.Method == "GET" && len(parts) == 6:
+		api.writePlaylist(w, parts[5])
+	case r.Method == "GET" && len(parts) == 7 && parts[6] == "tracks":
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		json.NewEncoder(w).Encode(api.page(parts[5], offset, limit))
+	case len(parts) == 7 && parts[6] == "tracks":
+		api.edit(parts[5], r.Method, r.URL.Query(), received.body)
+		fmt.Fprintf(w, `{"snapshot_id": "%v"}`, api.snapshotID(parts[5]))
+	default:
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": "playlist1", "uri": "spotify:user:bob:playlist:playlist1", "snapshot_id": "snapshot"}`))
+	}
+}
+
+// trackPage is a page of the tracks of a playlist, as the Web API answers it.
+type trackPage struct {
+	Items []map[string]map[string]interface{} `json:"items"`
+	Total int                                 `json:"total"`
+}
+
+func (api *webApi) page(playlist string, offset int, limit int) trackPage {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	tracks := api.tracks[playlist]
+	page := trackPage{Items: []map[string]map[string]interface{}{}, Total: len(tracks)}
+	for i := offset; i < len(tracks) && i < offset+limit; i++ {
+		artists := []map[string]string{{"uri": "spotify:artist:artist"}}
+		if api.withoutArtist[tracks[i]] {
+			artists = []map[string]string{}
+		}
+		page.Items = append(page.Items, map[string]map[string]interface{}{"track": {"uri": tracks[i], "artists": artists}})
+	}
+	return page
+}
+
+func (api *webApi) snapshotID(playlist string) string {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	return "snapshot" + strconv.Itoa(api.edits[playlist])
+}
+
+// writePlaylist answers the snapshot id and the first page of the tracks of the
+// playlist.
+func (api *webApi) writePlaylist(w http.ResponseWriter, playlist string) {
+	json.NewEncoder(w).Encode(struct {
+		SnapshotID string    `json:"snapshot_id"`
+		Tracks     trackPage `json:"tracks"`
+	}{api.snapshotID(playlist), api.page(playlist, 0, maxTracksPerRequest)})
+}
+
+// edit adds, removes or moves the tracks of the playlist.
+func (api *webApi) edit(playlist string, method string, query url.Values, body map[string]interface{}) {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	tracks := api.tracks[playlist]
+	switch method {
+	case "POST":
+		tracks = append(tracks, strings.Split(query.Get("uris"), ",")...)
+	case "DELETE":
+		removed := make(map[int]bool)
+		for _, track := range body["tracks"].([]interface{}) {
+			for _, position := range track.(map[string]interface{})["positions"].([]interface{}) {
+				removed[int(position.(float64))] = true
+			}
+		}
+		var kept []string
+		for i, URI := range tracks {
+			if !removed[i] {
+				kept = append(kept, URI)
+			}
+		}
+		tracks = kept
+	case "PUT":
+		start, length, insertBefore := int(body["range_start"].(float64)), int(body["range_length"].(float64)), int(body["insert_before"].(float64))
+		moved := append([]string(nil), tracks[start:start+length]...)
+		var reordered []string
+		for i := 0; i <= len(tracks); i++ {
+			if i == insertBefore {
+				reordered = append(reordered, moved...)
+			}
+			if i < len(tracks) && (i < start || i >= start+length) {
+				reordered = append(reordered, tracks[i])
+			}
+		}
+		tracks = reordered
+	}
+	api.tracks[playlist] = tracks
+	api.edits[playlist]++
+}
+
+func (api *webApi) received() []request {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	return api.requests
+}
+
+func assertRequest(t *testing.T, received request, method string, path string) {
+	if received.method != method || received.path != path {
+		t.Errorf("Request should be %v %v, it is %v %v", method, path, received.method, received.path)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	api, playlistSync := startWebApi(t)
+	defer api.server.Close()
+
+	edit := &sconsify.PlaylistEdit{Kind: sconsify.CreatePlaylist, Name: "Reggae", Tracks: []string{"spotify:track:track0", "spotify:track:track1"}}
+	if err := playlistSync.Apply(edit); err != nil {
+		t.Fatal(err)
+	}
+	if edit.Playlist != "spotify:user:bob:playlist:playlist1" {
+		t.Errorf("Playlist created should be spotify:user:bob:playlist:playlist1, it is %v", edit.Playlist)
+	}
+
+	requests := api.received()
+	if len(requests) != 2 {
+		t.Fatalf("Should be 2 requests, there are %v", len(requests))
+	}
+	assertRequest(t, requests[0], "POST", "/v1/users/bob/playlists")
+	if requests[0].body["name"] != "Reggae" || requests[0].body["public"] != false {
+		t.Errorf("Playlist should be created private as Reggae: %v", requests[0].body)
+	}
+	assertRequest(t, requests[1], "POST", "/v1/users/bob/playlists/playlist1/tracks")
+	if uris, _ := url.ParseQuery(requests[1].query); uris.Get("uris") != "spotify:track:track0,spotify:track:track1" {
+		t.Errorf("Tracks added should be track0 and track1: %v", requests[1].query)
+	}
+}
+
+func TestCreateAddsTracksInChunks(t *testing.T) {
+	api, playlistSync := startWebApi(t)
+	defer api.server.Close()
+
+	tracks := make([]string, 250)
+	for i := range tracks {
+		tracks[i] = "spotify:track:track"
+	}
+	if _, err := playlistSync.Create("Reggae", tracks); err != nil {
+		t.Fatal(err)
+	}
+	if requests := api.received(); len(requests) != 4 {
+		t.Errorf("Should be 1 request to create and 3 to add the tracks, there are %v", len(requests))
+	}
+}
+
+func TestCreateUnfollowsWhenTracksFail(t *testing.T) {
+	api, playlistSync := startWebApi(t)
+	defer api.server.Close()
+	api.fail = "/tracks"
+
+	edit := &sconsify.PlaylistEdit{Kind: sconsify.CreatePlaylist, Name: "Reggae", Tracks: []string{"spotify:track:track0"}}
+	if err := playlistSync.Apply(edit); err == nil {
+		t.Fatal("Create should fail")
+	}
+	if edit.Playlist != "" {
+		t.Errorf("Playlist should not be set, it is %v", edit.Playlist)
+	}
+	requests := api.received()
+	if len(requests) != 3 {
+		t.Fatalf("Should be 3 requests, there are %v", len(requests))
+	}
+	assertRequest(t, requests[2], "DELETE", "/v1/users/bob/playlists/playlist1/followers")
+}
+
+func TestRemoveTracks(t *testing.T) {
+	api, playlistSync := startWebApi(t)
+	defer api.server.Close()
+	api.tracks["playlist0"] = []string{"spotify:track:track0", "spotify:track:track1", "spotify:track:track2", "spotify:track:track0", "spotify:track:track1"}
+
+	edit := &sconsify.PlaylistEdit{Kind: sconsify.RemoveTracks, Playlist: "spotify:user:alice:playlist:playlist0", Tracks: []string{"spotify:track:track0", "spotify:track:track1"}, Position: 3}
+	if err := playlistSync.Apply(edit); err != nil {
+		t.Fatal(err)
+	}
+	requests := api.received()
+	assertRequest(t, requests[1], "DELETE", "/v1/users/alice/playlists/playlist0/tracks")
+	removed, _ := json.Marshal(requests[1].body["tracks"])
+	if string(removed) != `[{"positions":[3],"uri":"spotify:track:track0"},{"positions":[4],"uri":"spotify:track:track1"}]` {
+		t.Errorf("Tracks removed should be track0 at 3 and track1 at 4: %s", removed)
+	}
+	if requests[1].body["snapshot_id"] != "snapshot0" {
+		t.Errorf("Tracks should be removed from the snapshot read: %v", requests[1].body)
+	}
+}
+
+func numberedTracks(count int) []string {
+	tracks := make([]string, count)
+	for i := range tracks {
+		tracks[i] = "spotify:track:track" + strconv.Itoa(i)
+	}
+	return tracks
+}
+
+func TestMoveTracks(t *testing.T) {
+	moves := []struct {
+		from         int
+		count        int
+		to           int
+		insertBefore float64
+	}{
+		{5, 1, 2, 2},
+		{2, 1, 5, 6},
+		{1, 2, 2, 4},
+		{1, 2, 6, 8},
+	}
+	for _, move := range moves {
+		api, playlistSync := startWebApi(t)
+		api.tracks["playlist0"] = numberedTracks(8)
+		tracks := api.tracks["playlist0"][move.from : move.from+move.count]
+		edit := &sconsify.PlaylistEdit{Kind: sconsify.MoveTracks, Playlist: "spotify:playlist:playlist0", Tracks: tracks, Position: move.from, To: move.to}
+		if err := playlistSync.Apply(edit); err != nil {
+			t.Fatal(err)
+		}
+		requests := api.received()
+		assertRequest(t, requests[1], "PUT", "/v1/users/bob/playlists/playlist0/tracks")
+		if body := requests[1].body; body["range_start"] != float64(move.from) || body["range_length"] != float64(move.count) || body["insert_before"] != move.insertBefore {
+			t.Errorf("Moving %v from %v to %v should insert before %v: %v", move.count, move.from, move.to, move.insertBefore, body)
+		}
+		if moved := api.tracks["playlist0"][move.to]; moved != tracks[0] {
+			t.Errorf("Moving %v from %v to %v should move %v, it moved %v", move.count, move.from, move.to, tracks[0], moved)
+		}
+		api.server.Close()
+	}
+}
+
+func TestEditsLeaveOutTracksWithoutArtist(t *testing.T) {
+	api, playlistSync := startWebApi(t)
+	defer api.server.Close()
+	// sconsify shows track0, track2 and track3
+	api.tracks["playlist0"] = numberedTracks(4)
+	api.withoutArtist["spotify:track:track1"] = true
+	playlist := "spotify:user:bob:playlist:playlist0"
+
+	if err := playlistSync.Apply(&sconsify.PlaylistEdit{Kind: sconsify.MoveTracks, Playlist: playlist, Tracks: []string{"spotify:track:track3"}, Position: 2, To: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if tracks := strings.Join(api.tracks["playlist0"], ","); tracks != "spotify:track:track0,spotify:track:track1,spotify:track:track3,spotify:track:track2" {
+		t.Errorf("track3 should be moved before track2: %v", tracks)
+	}
+	if err := playlistSync.Apply(&sconsify.PlaylistEdit{Kind: sconsify.RemoveTracks, Playlist: playlist, Tracks: []string{"spotify:track:track3"}, Position: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if tracks := strings.Join(api.tracks["playlist0"], ","); tracks != "spotify:track:track0,spotify:track:track1,spotify:track:track2" {
+		t.Errorf("track3 should be removed: %v", tracks)
+	}
+	if err := playlistSync.Apply(&sconsify.PlaylistEdit{Kind: sconsify.MoveTracks, Playlist: playlist, Tracks: []string{"spotify:track:track0", "spotify:track:track2"}, Position: 0, To: 0}); err == nil {
+		t.Error("Tracks apart on Spotify should not be moved")
+	}
+	if err := playlistSync.Apply(&sconsify.PlaylistEdit{Kind: sconsify.RemoveTracks, Playlist: playlist, Tracks: []string{"spotify:track:track1"}, Position: 1}); err == nil {
+		t.Error("A track not shown should not be removed")
+	}
+}
+
+func TestReadPagesOfTracks(t *testing.T) {
+	api, playlistSync := startWebApi(t)
+	defer api.server.Close()
+	api.tracks["playlist0"] = numberedTracks(250)
+
+	playlist, err := playlistSync.read("bob", "playlist0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(playlist.tracks) != 250 || len(playlist.shown) != 250 || playlist.tracks[249] != "spotify:track:track249" {
+		t.Errorf("All 250 tracks should be read, %v were", len(playlist.tracks))
+	}
+	if requests := api.received(); len(requests) != 3 {
+		t.Errorf("Should be 1 request for the playlist and 2 for the other tracks, there are %v", len(requests))
+	}
+}
+
+func TestRenameAndDelete(t *testing.T) {
+	api, playlistSync := startWebApi(t)
+	defer api.server.Close()
+
+	if err := playlistSync.Apply(&sconsify.PlaylistEdit{Kind: sconsify.RenamePlaylist, Playlist: "spotify:user:bob:playlist:playlist0", Name: "Ska"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := playlistSync.Apply(&sconsify.PlaylistEdit{Kind: sconsify.DeletePlaylist, Playlist: "spotify:user:bob:playlist:playlist0"}); err != nil {
+		t.Fatal(err)
+	}
+	requests := api.received()
+	assertRequest(t, requests[0], "PUT", "/v1/users/bob/playlists/playlist0")
+	if requests[0].body["name"] != "Ska" {
+		t.Errorf("Playlist should be renamed Ska: %v", requests[0].body)
+	}
+	assertRequest(t, requests[1], "DELETE", "/v1/users/bob/playlists/playlist0/followers")
+}
+
+func TestFailures(t *testing.T) {
+	api, playlistSync := startWebApi(t)
+	defer api.server.Close()
+	api.fail = "/playlist0"
+
+	if err := playlistSync.Apply(&sconsify.PlaylistEdit{Kind: sconsify.RenamePlaylist, Playlist: "spotify:user:bob:playlist:playlist0", Name: "Ska"}); err == nil {
+		t.Error("Rename should fail")
+	}
+	if err := playlistSync.Apply(&sconsify.PlaylistEdit{Kind: sconsify.AddTracks, Playlist: "spotify:user:bob:playlist:playlist1", Tracks: []string{"/home/bob/Music/track.mp3"}}); err == nil {
+		t.Error("A local track should not be added")
+	}
+	if err := playlistSync.Apply(&sconsify.PlaylistEdit{Kind: sconsify.RenamePlaylist, Playlist: "*Search", Name: "Ska"}); err == nil {
+		t.Error("A search should not be renamed")
+	}
+	if requests := api.received(); len(requests) != 1 {
+		t.Errorf("Only the rename should be requested, there are %v requests", len(requests))
+	}
+}
+
+func TestIsPlaylistURI(t *testing.T) {
+	for URI, isPlaylist := range map[string]bool{
+		"spotify:user:bob:playlist:playlist0": true,
+		"spotify:playlist:playlist0":          true,
+		"spotify:user:bob:playlist:":          false,
+		"spotify:album:album0":                false,
+		"Reggae":                              false,
+	} {
+		if IsPlaylistURI(URI) != isPlaylist {
+			t.Errorf("%v should be a playlist: %v", URI, isPlaylist)
+		}
+	}
+}
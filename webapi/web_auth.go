@@ -2,6 +2,7 @@ package webapi
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/schaeferpp/sconsify/infrastructure"
@@ -15,9 +16,13 @@ import (
 	"os/exec"
 )
 
+// requestTimeout is how long a request to the web api may take, the playlist
+// edits waiting behind a request that hangs.
+const requestTimeout = 30 * time.Second
+
 func Auth(spotifyClientId string, authRedirectUrl string, cacheWebApiToken bool, openBrowserCommand string) (*spotify.Client, error) {
 	if spotifyClientId == "" {
-		fmt.Print("Spotify Client ID not set")
+		infrastructure.Warn("Spotify Client ID not set")
 		return nil, nil
 	}
 
@@ -25,7 +30,9 @@ func Auth(spotifyClientId string, authRedirectUrl string, cacheWebApiToken bool,
 		spotify.ScopeUserLibraryRead,
 		spotify.ScopeUserFollowRead,
 		spotify.ScopePlaylistReadCollaborative,
-		spotify.ScopePlaylistReadPrivate)
+		spotify.ScopePlaylistReadPrivate,
+		spotify.ScopePlaylistModifyPublic,
+		spotify.ScopePlaylistModifyPrivate)
 
 	auth.SetAuthInfo(spotifyClientId, "")
 
@@ -53,7 +60,7 @@ func Auth(spotifyClientId string, authRedirectUrl string, cacheWebApiToken bool,
 
 		seconds, err := strconv.ParseInt(strings.Split(result[2], ":")[1], 10, 64)
 		if err != nil {
-			fmt.Printf("Error %v\n", err)
+			infrastructure.Error("Cannot read the access token", "error", err)
 			return nil, err
 		}
 		expiry := time.Now().Add(time.Duration(seconds) * time.Second)
@@ -67,7 +74,9 @@ func Auth(spotifyClientId string, authRedirectUrl string, cacheWebApiToken bool,
 		}
 	}
 
-	client := auth.NewClient(token)
+	httpClient := oauth2.NewClient(context.Background(), oauth2.StaticTokenSource(token))
+	httpClient.Timeout = requestTimeout
+	client := spotify.NewClient(httpClient)
 	return &client, nil
 }
 